@@ -0,0 +1,52 @@
+-- ============================================================================
+-- MIGRATION: Add the registered snapshot signing key to projects
+-- Purpose: Only accept snapshots signed by the owner device's registered key,
+--          and let members verify snapshots against it instead of trusting the
+--          key the first snapshot they saw was signed with
+-- ============================================================================
+
+ALTER TABLE public.projects
+ADD COLUMN IF NOT EXISTS signing_public_key TEXT;
+
+ALTER TABLE public.projects
+ADD COLUMN IF NOT EXISTS signing_device_id TEXT;
+
+ALTER TABLE public.projects
+ADD COLUMN IF NOT EXISTS signing_key_registered_at TIMESTAMPTZ;
+
+-- ============================================================================
+-- EXPLANATION
+-- ============================================================================
+
+/*
+
+NEW FIELDS:
+- signing_public_key: Base64 ed25519 public key of the owner device
+  Set: PUT /api/projects/:id/signing-key, by the Go agent when the project is
+       created or the owner device first uploads a snapshot
+  Used: POST /api/projects/:id/snapshot rejects snapshots signed by other keys
+
+- signing_device_id: Agent device ID the key belongs to, for display
+
+- signing_key_registered_at: When the key was registered or last replaced
+
+BACKWARD COMPATIBILITY:
+✓ Projects without a registered key accept snapshots as before
+✓ Schema is additive - no breaking changes
+
+*/
+
+-- ============================================================================
+-- ROLLBACK
+-- ============================================================================
+
+/*
+ALTER TABLE public.projects
+DROP COLUMN IF EXISTS signing_public_key;
+
+ALTER TABLE public.projects
+DROP COLUMN IF EXISTS signing_device_id;
+
+ALTER TABLE public.projects
+DROP COLUMN IF EXISTS signing_key_registered_at;
+*/
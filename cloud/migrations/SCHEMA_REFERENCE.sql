@@ -24,6 +24,9 @@ CREATE TABLE public.projects (
   snapshot_updated_at timestamp with time zone,
   snapshot_file_count integer,       -- Number of files in snapshot
   snapshot_total_size bigint,        -- Total size in bytes of all files in snapshot
+  signing_public_key text,           -- Base64 ed25519 key of the owner device; snapshots must be signed with it
+  signing_device_id text,            -- Agent device the signing key belongs to
+  signing_key_registered_at timestamp with time zone,
   created_at timestamp with time zone DEFAULT now(),
   updated_at timestamp with time zone DEFAULT now()
 );
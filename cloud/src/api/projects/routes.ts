@@ -1,13 +1,16 @@
-import { Router, Request, Response } from 'express';
+import express, { Router, Request, Response } from 'express';
 import multer from 'multer';
 import { authMiddleware } from '../../middleware/authMiddleware';
 import { supabase } from '../../lib/supabaseClient';
 import { getWebSocketService } from '../../services/webSocketService';
 import { SyncthingService } from '../../services/syncthingService';
-import { FileMetadataService } from '../../services/fileMetadataService';
+import { FileMetadataService, EncryptedSnapshotError, isEncryptedSnapshot } from '../../services/fileMetadataService';
 import { getSyncthingConfig } from '../../utils/syncthingConfig';
 import * as fs from 'fs';
+import * as os from 'os';
 import * as path from 'path';
+import * as crypto from 'crypto';
+import * as zlib from 'zlib';
 
 const router = Router();
 
@@ -19,6 +22,52 @@ const uploadSnapshot = multer({
   },
 });
 
+// ============================================================================
+// SNAPSHOT SIGNATURES: ed25519 over "vidsync-snapshot-v1:" + SHA-256 of the
+// uncompressed snapshot JSON, made with the uploading agent's device key
+// ============================================================================
+const SNAPSHOT_SIGNATURE_ALGORITHM = 'ed25519-sha256';
+const SNAPSHOT_SIGNATURE_PREFIX = Buffer.from('vidsync-snapshot-v1:');
+const ED25519_SPKI_PREFIX = Buffer.from('302a300506032b6570032100', 'hex');
+
+// Chunked AES-256-GCM applied by the agent with a per-project key the cloud never receives
+const SNAPSHOT_ENCRYPTION_ALGORITHM = 'aes-256-gcm-chunked';
+
+/**
+ * SHA-256 digest of a gzip snapshot's uncompressed content, without inflating it all in memory
+ */
+function snapshotDigest(gzipped: Buffer): Promise<Buffer> {
+  return new Promise((resolve, reject) => {
+    const hash = crypto.createHash('sha256');
+    const gunzip = zlib.createGunzip();
+    gunzip.on('data', (chunk: Buffer) => hash.update(chunk));
+    gunzip.on('end', () => resolve(hash.digest()));
+    gunzip.on('error', reject);
+    gunzip.end(gzipped);
+  });
+}
+
+/**
+ * Check a snapshot signature; publicKey and signature are base64
+ */
+function verifySnapshotSignature(digest: Buffer, publicKey: string, signature: string): boolean {
+  const rawKey = Buffer.from(publicKey, 'base64');
+  const rawSig = Buffer.from(signature, 'base64');
+  if (rawKey.length !== 32 || rawSig.length !== 64) {
+    return false;
+  }
+  try {
+    const key = crypto.createPublicKey({
+      key: Buffer.concat([ED25519_SPKI_PREFIX, rawKey]),
+      format: 'der',
+      type: 'spki',
+    });
+    return crypto.verify(null, Buffer.concat([SNAPSHOT_SIGNATURE_PREFIX, digest]), key, rawSig);
+  } catch {
+    return false;
+  }
+}
+
 // ============================================================================
 // CACHE: Sync status cache with TTL
 // ============================================================================
@@ -213,7 +262,11 @@ router.get('/list/invited', authMiddleware, async (req: Request, res: Response)
       let file_count = 0;
       let total_size = 0;
 
-      if (p.snapshot_url) {
+      if (p.snapshot_url && isEncryptedSnapshot(p.snapshot_url)) {
+        // The cloud can't read encrypted snapshots; the agent sends their totals in the clear
+        file_count = p.snapshot_file_count || 0;
+        total_size = p.snapshot_total_size || 0;
+      } else if (p.snapshot_url) {
         try {
           const snapshot = await FileMetadataService.loadSnapshot(p.snapshot_url);
           const files = snapshot.files || [];
@@ -996,6 +1049,9 @@ router.get('/:projectId/files-list', authMiddleware, async (req: Request, res: R
         const snapshot = await FileMetadataService.loadSnapshot(project.snapshot_url);
         allFiles = flattenFileTree(snapshot.files || []);
       } catch (err) {
+        if (err instanceof EncryptedSnapshotError) {
+          return res.status(409).json({ error: 'Snapshot is encrypted; read it through the Go agent', encrypted: true });
+        }
         console.warn('Failed to load snapshot:', err);
         // Continue - will generate new snapshot below
       }
@@ -1212,6 +1268,9 @@ router.get('/:projectId/file-tree', authMiddleware, async (req: Request, res: Re
         totalFiles = flatFiles.length;
         totalSize = flatFiles.reduce((sum, f) => sum + (f.size || 0), 0);
       } catch (err) {
+        if (err instanceof EncryptedSnapshotError) {
+          return res.status(409).json({ error: 'Snapshot is encrypted; read it through the Go agent', encrypted: true });
+        }
         console.warn('Failed to load snapshot:', err);
         return res.status(404).json({ error: 'Snapshot not available' });
       }
@@ -2275,15 +2334,342 @@ router.post('/:projectId/generate-snapshot', authMiddleware, async (req: Request
   }
 });
 
+/**
+ * Verify a snapshot file and its form fields, store it and point the project at it
+ * Shared by the single-request upload and the commit of a resumable upload
+ * Returns the success response it sent, or undefined after sending an error
+ */
+async function storeSnapshot(projectId: string, userId: string, fields: Record<string, any>, fileBuffer: Buffer | undefined, res: Response): Promise<Record<string, any> | undefined> {
+  // STEP 1: Validate authorization and project existence
+  const { data: project, error: projectErr } = await supabase
+    .from('projects')
+    .select('id, owner_id, name, snapshot_url, signing_public_key')
+    .eq('id', projectId)
+    .single();
+  
+  if (projectErr || !project) {
+    console.error(`[Snapshot:${projectId}] ✗ Project not found`);
+    res.status(404).json({ error: 'Project not found' });
+    return;
+  }
+  
+  if (project.owner_id !== userId) {
+    console.error(`[Snapshot:${projectId}] ✗ User ${userId} is not owner`);
+    res.status(403).json({ error: 'Not project owner' });
+    return;
+  }
+  
+  console.log(`[Snapshot:${projectId}] ✅ User authorized as owner`);
+  
+  // STEP 2: Validate the file and its metadata
+  console.log(`[Snapshot:${projectId}] Extracting gzip file and metadata from request...`);
+  
+  const fileCount = parseInt(fields.fileCount || '0', 10);
+  const totalSize = parseInt(fields.totalSize || '0', 10);
+  const kind = fields.kind === 'delta' ? 'delta' : 'full';
+  const baseUrl = fields.baseUrl || '';
+  const signature = fields.signature || '';
+  const publicKey = fields.publicKey || '';
+  const signatureAlgorithm = fields.signatureAlgorithm || '';
+  const signedBy = fields.signedBy || '';
+  const encryption = fields.encryption || '';
+  const keyId = fields.keyId || '';
+  
+  if (!fileBuffer) {
+    console.error(`[Snapshot:${projectId}] ✗ Missing file in request`);
+    res.status(400).json({ error: 'Missing gzip file in request' });
+    return;
+  }
+  
+  if (!fileCount || fileCount <= 0) {
+    console.error(`[Snapshot:${projectId}] ✗ Invalid fileCount: ${fileCount}`);
+    res.status(400).json({ error: 'fileCount must be positive number' });
+    return;
+  }
+  
+  // Deltas are only readable on top of the snapshot they were computed against
+  if (kind === 'delta' && (!baseUrl || baseUrl !== project.snapshot_url)) {
+    console.error(`[Snapshot:${projectId}] ✗ Delta base ${baseUrl} is not the current snapshot`);
+    res.status(409).json({ error: 'Delta base is not the current snapshot', code: 'DELTA_BASE_MISMATCH', currentSnapshotUrl: project.snapshot_url || null });
+    return;
+  }
+  
+  console.log(`[Snapshot:${projectId}] Received gzip ${kind} file: ${fileBuffer.length} bytes, Files: ${fileCount}, Original size: ${totalSize} bytes`);
+  
+  const encrypted = !!encryption;
+  if (encrypted && (encryption !== SNAPSHOT_ENCRYPTION_ALGORITHM || !keyId)) {
+    console.error(`[Snapshot:${projectId}] ✗ Unsupported encryption: ${encryption}`);
+    res.status(400).json({ error: 'Unsupported snapshot encryption' });
+    return;
+  }
+  
+  // Unsigned uploads from older agents are still accepted; signed ones must verify,
+  // unless encrypted, since the signature covers content the cloud can't decrypt
+  const signed = !!signature;
+  if (signed) {
+    if (signatureAlgorithm !== SNAPSHOT_SIGNATURE_ALGORITHM || !publicKey) {
+      console.error(`[Snapshot:${projectId}] ✗ Unsupported signature algorithm: ${signatureAlgorithm}`);
+      res.status(400).json({ error: 'Unsupported snapshot signature' });
+      return;
+    }
+    if (!encrypted) {
+      let digest: Buffer;
+      try {
+        digest = await snapshotDigest(fileBuffer);
+      } catch (err) {
+        console.error(`[Snapshot:${projectId}] ✗ Snapshot is not valid gzip:`, (err as Error).message);
+        res.status(400).json({ error: 'Snapshot file is not valid gzip' });
+        return;
+      }
+      if (!verifySnapshotSignature(digest, publicKey, signature)) {
+        console.error(`[Snapshot:${projectId}] ✗ Snapshot signature does not match`);
+        res.status(400).json({ error: 'Invalid snapshot signature' });
+        return;
+      }
+      console.log(`[Snapshot:${projectId}] ✅ Signature verified (device ${signedBy || 'unknown'})`);
+    }
+  }
+  
+  // Once the owner device registered its key, only snapshots signed with it are accepted;
+  // encrypted ones too, even though their signature can only be checked after decrypting
+  if (project.signing_public_key && (!signed || publicKey !== project.signing_public_key)) {
+    console.error(`[Snapshot:${projectId}] ✗ Snapshot is not signed by the registered owner key`);
+    res.status(403).json({ error: 'Snapshot is not signed by the registered key', code: 'SIGNING_KEY_MISMATCH' });
+    return;
+  }
+  
+  if (encrypted) {
+    console.log(`[Snapshot:${projectId}] Snapshot is encrypted (key ${keyId}), storing as-is`);
+  }
+  
+  // STEP 3: Upload gzip file to Supabase Storage (already compressed by Go agent)
+  console.log(`[Snapshot:${projectId}] Uploading gzip file to Supabase Storage...`);
+  
+  const timestamp = Date.now();
+  const filename = (kind === 'delta' ? `delta_${timestamp}.json.gz` : `snapshot_${timestamp}.json.gz`) + (encrypted ? '.enc' : '');
+  const bucket = 'project-snapshots';
+  const filePath = `${projectId}/${filename}`;
+  
+  const { data: uploadData, error: uploadErr } = await supabase.storage
+    .from(bucket)
+    .upload(filePath, fileBuffer, {
+      contentType: encrypted ? 'application/octet-stream' : 'application/gzip',
+      upsert: false,
+    });
+  
+  if (uploadErr) {
+    console.error(`[Snapshot:${projectId}] ✗ Storage upload failed:`, uploadErr.message);
+    res.status(500).json({ error: 'Failed to upload snapshot to storage' });
+    return;
+  }
+  
+  console.log(`[Snapshot:${projectId}] ✅ Uploaded to storage: ${filePath}`);
+  
+  // Store the signature next to the snapshot so receivers can check it against the file they download
+  if (signed) {
+    const sigPath = filePath.replace(/\.json\.gz(\.enc)?$/, '.sig.json');
+    const sigBody = JSON.stringify({
+      algorithm: signatureAlgorithm,
+      publicKey,
+      signature,
+      deviceId: signedBy,
+    });
+    const { error: sigErr } = await supabase.storage
+      .from(bucket)
+      .upload(sigPath, Buffer.from(sigBody), {
+        contentType: 'application/json',
+        upsert: false,
+      });
+    
+    if (sigErr) {
+      console.error(`[Snapshot:${projectId}] ✗ Signature upload failed:`, sigErr.message);
+      await supabase.storage.from(bucket).remove([filePath]);
+      res.status(500).json({ error: 'Failed to upload snapshot signature' });
+      return;
+    }
+    
+    console.log(`[Snapshot:${projectId}] ✅ Uploaded signature: ${sigPath}`);
+  }
+  
+  // STEP 4: Generate public URL
+  console.log(`[Snapshot:${projectId}] Generating public URL...`);
+  
+  const { data: publicUrlData } = supabase.storage
+    .from(bucket)
+    .getPublicUrl(filePath);
+  
+  const snapshotUrl = publicUrlData.publicUrl;
+  
+  console.log(`[Snapshot:${projectId}] Public URL: ${snapshotUrl}`);
+  
+  // STEP 5: Update project table with snapshot metadata
+  console.log(`[Snapshot:${projectId}] Updating project metadata in database...`);
+  
+  const updatePayload: any = {
+    snapshot_url: snapshotUrl,
+    snapshot_updated_at: new Date().toISOString(),
+    snapshot_file_count: fileCount,
+    snapshot_total_size: totalSize,
+  };
+  
+  const { error: updateErr } = await supabase
+    .from('projects')
+    .update(updatePayload)
+    .eq('id', projectId);
+  
+  if (updateErr) {
+    console.error(`[Snapshot:${projectId}] ⚠️  Failed to update project metadata:`, updateErr.message);
+    // Non-blocking error - storage succeeded, DB update is secondary
+  } else {
+    console.log(`[Snapshot:${projectId}] ✅ Project metadata updated in database`);
+    console.log(`[Snapshot:${projectId}]    Files: ${fileCount}, Size: ${totalSize} bytes`);
+  }
+  
+  // Success response
+  console.log(`[Snapshot:${projectId}] ✅ Snapshot upload complete`);
+  
+  const stored = {
+    ok: true,
+    snapshotUrl,
+    snapshotSize: fileBuffer.length,
+    uploadedAt: new Date().toISOString(),
+    kind,
+    fileCount,
+    totalSize,
+    signed,
+    encrypted,
+    message: 'Snapshot uploaded successfully',
+  };
+  res.status(200).json(stored);
+  return stored;
+}
+
+/**
+ * PUT /api/projects/:projectId/signing-key
+ * Register the public key of the owner device that signs the project's snapshots (owner only)
+ * Body: { algorithm, publicKey (base64), deviceId, replace? }
+ * A different key than the registered one is refused (409 SIGNING_KEY_MISMATCH) unless replace is set,
+ * e.g. when the owner moves the project to a new device
+ */
+router.put('/:projectId/signing-key', authMiddleware, async (req: Request, res: Response) => {
+  try {
+    const { projectId } = req.params;
+    const userId = (req as any).user.id;
+    const { algorithm, publicKey, deviceId, replace } = req.body || {};
+
+    if (algorithm !== SNAPSHOT_SIGNATURE_ALGORITHM) {
+      return res.status(400).json({ error: 'Unsupported signing algorithm' });
+    }
+    if (typeof publicKey !== 'string' || Buffer.from(publicKey, 'base64').length !== 32) {
+      return res.status(400).json({ error: 'publicKey must be a base64 ed25519 public key' });
+    }
+
+    const { data: project } = await supabase
+      .from('projects')
+      .select('owner_id, signing_public_key')
+      .eq('id', projectId)
+      .single();
+
+    if (!project) {
+      return res.status(404).json({ error: 'Project not found' });
+    }
+    if (project.owner_id !== userId) {
+      return res.status(403).json({ error: 'Only the owner can register a signing key' });
+    }
+
+    if (project.signing_public_key && project.signing_public_key !== publicKey && !replace) {
+      return res.status(409).json({ error: 'Another signing key is registered', code: 'SIGNING_KEY_MISMATCH' });
+    }
+
+    if (project.signing_public_key !== publicKey) {
+      const { error: updateErr } = await supabase
+        .from('projects')
+        .update({
+          signing_public_key: publicKey,
+          signing_device_id: deviceId || null,
+          signing_key_registered_at: new Date().toISOString(),
+        })
+        .eq('id', projectId);
+
+      if (updateErr) {
+        console.error('Failed to register signing key:', updateErr.message);
+        return res.status(500).json({ error: 'Failed to register signing key' });
+      }
+      console.log(`[Signing:${projectId}] Registered signing key of device ${deviceId || 'unknown'}`);
+    }
+
+    res.json({ algorithm, publicKey, deviceId: deviceId || null });
+  } catch (error) {
+    console.error('Register signing-key exception:', error);
+    res.status(500).json({ error: 'Failed to register signing key' });
+  }
+});
+
+/**
+ * GET /api/projects/:projectId/signing-key
+ * The public key the project's snapshots must be signed with, for members to verify them
+ * 404 SIGNING_KEY_NOT_REGISTERED when the owner hasn't registered one
+ */
+router.get('/:projectId/signing-key', authMiddleware, async (req: Request, res: Response) => {
+  try {
+    const { projectId } = req.params;
+    const userId = (req as any).user.id;
+
+    const { data: project } = await supabase
+      .from('projects')
+      .select('owner_id, signing_public_key, signing_device_id')
+      .eq('id', projectId)
+      .single();
+
+    if (!project) {
+      return res.status(404).json({ error: 'Project not found' });
+    }
+
+    if (project.owner_id !== userId) {
+      const { data: member } = await supabase
+        .from('project_members')
+        .select('status')
+        .eq('project_id', projectId)
+        .eq('user_id', userId)
+        .single();
+
+      if (!member) {
+        return res.status(403).json({ error: 'Access denied' });
+      }
+    }
+
+    if (!project.signing_public_key) {
+      return res.status(404).json({ error: 'No signing key registered', code: 'SIGNING_KEY_NOT_REGISTERED' });
+    }
+
+    res.json({
+      algorithm: SNAPSHOT_SIGNATURE_ALGORITHM,
+      publicKey: project.signing_public_key,
+      deviceId: project.signing_device_id || null,
+    });
+  } catch (error) {
+    console.error('Get signing-key exception:', error);
+    res.status(500).json({ error: 'Failed to fetch signing key' });
+  }
+});
+
 /**
  * POST /api/projects/:projectId/snapshot
  * Receive gzip-compressed snapshot file from Go agent and store in Supabase Storage
  * Go agent pre-compresses the file - Cloud API just uploads to storage and updates metadata
+ * Agents send large snapshots in parts through POST /snapshot/uploads instead (see below)
  * 
  * Request: multipart/form-data
  * - file: gzip binary data (already compressed by Go agent)
  * - fileCount: number of files in snapshot
  * - totalSize: total bytes in uncompressed snapshot
+ * - kind: optional, "delta" when the file holds changes against baseUrl (default "full")
+ * - baseUrl: snapshot the delta applies to; must be the project's current snapshot_url (409 otherwise)
+ * - signature, publicKey, signatureAlgorithm, signedBy: optional device signature of the uncompressed file;
+ *   checked here (400 if invalid) and stored next to the snapshot as <name>.sig.json for receivers to verify;
+ *   required, with the registered key, once the project has one (403 SIGNING_KEY_MISMATCH otherwise)
+ * - encryption, keyId: set when the agent encrypted the gzip file with a project key the cloud never sees;
+ *   stored as <name>.json.gz.enc, and its signature is stored unchecked for members to verify after decrypting
  * 
  * Response:
  * {
@@ -2292,7 +2678,9 @@ router.post('/:projectId/generate-snapshot', authMiddleware, async (req: Request
  *   snapshotSize: number,
  *   uploadedAt: ISO string,
  *   fileCount: number,
- *   totalSize: number
+ *   totalSize: number,
+ *   signed: boolean,
+ *   encrypted: boolean
  * }
  */
 router.post('/:projectId/snapshot', authMiddleware, uploadSnapshot.single('file'), async (req: Request, res: Response) => {
@@ -2302,116 +2690,318 @@ router.post('/:projectId/snapshot', authMiddleware, uploadSnapshot.single('file'
   try {
     console.log(`[Snapshot:${projectId}] POST /snapshot received from Go agent`);
     
-    // STEP 1: Validate authorization and project existence
+    await storeSnapshot(projectId, userId, (req as any).body || {}, (req as any).file?.buffer, res);
+    
+  } catch (error) {
+    console.error(`[Snapshot:${projectId}] ✗ POST /snapshot exception:`, error);
+    res.status(500).json({
+      error: 'Failed to upload snapshot',
+      message: (error as Error).message,
+    });
+  }
+});
+
+// ============================================================================
+// RESUMABLE SNAPSHOT UPLOADS: the agent sends the file in fixed-size parts,
+// each with its SHA-256, and resumes from the stored offset after a dropped
+// connection. Parts are kept on local disk until the upload is committed.
+// ============================================================================
+const SNAPSHOT_UPLOAD_DIR = path.join(os.tmpdir(), 'vidsync-snapshot-uploads');
+const SNAPSHOT_UPLOAD_MAX_SIZE = 500 * 1024 * 1024; // Same cap as the single-request upload
+const SNAPSHOT_UPLOAD_MIN_PART = 1024 * 1024;
+const SNAPSHOT_UPLOAD_MAX_PART = 64 * 1024 * 1024;
+const SNAPSHOT_UPLOAD_TTL_MS = 24 * 60 * 60 * 1000;
+
+interface SnapshotUploadSession {
+  uploadId: string;
+  projectId: string;
+  userId: string;
+  fileName: string;
+  size: number;
+  partSize: number;
+  checksum: string; // SHA-256 hex of the whole file
+  fields: Record<string, string>;
+  offset: number; // Bytes stored, always a whole number of parts
+  committed?: Record<string, any>; // Commit response, kept so a retried commit gets it again
+  createdAt: string;
+  expiresAt: string;
+}
+
+function snapshotUploadDir(uploadId: string): string {
+  return path.join(SNAPSHOT_UPLOAD_DIR, uploadId);
+}
+
+async function loadSnapshotUpload(projectId: string, uploadId: string, userId: string): Promise<SnapshotUploadSession | null> {
+  if (!/^[0-9a-f-]{36}$/.test(uploadId)) {
+    return null;
+  }
+  try {
+    const data = await fs.promises.readFile(path.join(snapshotUploadDir(uploadId), 'session.json'), 'utf8');
+    const session = JSON.parse(data) as SnapshotUploadSession;
+    if (session.projectId !== projectId || session.userId !== userId || Date.parse(session.expiresAt) < Date.now()) {
+      return null;
+    }
+    return session;
+  } catch {
+    return null;
+  }
+}
+
+async function saveSnapshotUpload(session: SnapshotUploadSession): Promise<void> {
+  const dir = snapshotUploadDir(session.uploadId);
+  const tmp = path.join(dir, 'session.json.tmp');
+  await fs.promises.writeFile(tmp, JSON.stringify(session));
+  await fs.promises.rename(tmp, path.join(dir, 'session.json'));
+}
+
+async function removeSnapshotUpload(uploadId: string): Promise<void> {
+  await fs.promises.rm(snapshotUploadDir(uploadId), { recursive: true, force: true });
+}
+
+/**
+ * Drop a committed upload's parts but keep its session with the commit response until it expires,
+ * so an agent that lost the response can commit again instead of restarting the upload
+ */
+async function markSnapshotUploadCommitted(session: SnapshotUploadSession, committed: Record<string, any>): Promise<void> {
+  const dir = snapshotUploadDir(session.uploadId);
+  for (const entry of await fs.promises.readdir(dir)) {
+    if (entry.startsWith('part-')) {
+      await fs.promises.rm(path.join(dir, entry), { force: true });
+    }
+  }
+  session.committed = committed;
+  await saveSnapshotUpload(session);
+}
+
+/**
+ * Remove sessions past their expiry, so abandoned uploads don't pile up
+ */
+async function pruneSnapshotUploads(): Promise<void> {
+  let entries: string[];
+  try {
+    entries = await fs.promises.readdir(SNAPSHOT_UPLOAD_DIR);
+  } catch {
+    return;
+  }
+  for (const uploadId of entries) {
+    try {
+      const data = await fs.promises.readFile(path.join(snapshotUploadDir(uploadId), 'session.json'), 'utf8');
+      if (Date.parse((JSON.parse(data) as SnapshotUploadSession).expiresAt) >= Date.now()) {
+        continue;
+      }
+    } catch {
+      // Unreadable sessions are removed too
+    }
+    await removeSnapshotUpload(uploadId);
+  }
+}
+
+function snapshotUploadStatus(session: SnapshotUploadSession) {
+  return {
+    uploadId: session.uploadId,
+    size: session.size,
+    partSize: session.partSize,
+    offset: session.offset,
+    expiresAt: session.expiresAt,
+  };
+}
+
+/**
+ * POST /api/projects/:projectId/snapshot/uploads
+ * Start a resumable snapshot upload
+ *
+ * Request: { fileName, size, partSize, checksum (SHA-256 hex of the file), fields }
+ * fields are the form fields of POST /snapshot; they are checked again on commit
+ * The part size is clamped to 1-64 MB and returned
+ *
+ * Response: { uploadId, size, partSize, offset, expiresAt }
+ */
+router.post('/:projectId/snapshot/uploads', authMiddleware, async (req: Request, res: Response) => {
+  const projectId = req.params.projectId;
+  const userId = (req as any).user.id;
+
+  try {
+    const { fileName, size, partSize, checksum } = req.body || {};
+    const fields: Record<string, string> = {};
+    for (const [key, value] of Object.entries(req.body?.fields || {})) {
+      fields[key] = String(value);
+    }
+
     const { data: project, error: projectErr } = await supabase
       .from('projects')
-      .select('id, owner_id, name')
+      .select('id, owner_id, snapshot_url')
       .eq('id', projectId)
       .single();
-    
+
     if (projectErr || !project) {
-      console.error(`[Snapshot:${projectId}] ✗ Project not found`);
       return res.status(404).json({ error: 'Project not found' });
     }
-    
     if (project.owner_id !== userId) {
-      console.error(`[Snapshot:${projectId}] ✗ User ${userId} is not owner`);
       return res.status(403).json({ error: 'Not project owner' });
     }
-    
-    console.log(`[Snapshot:${projectId}] ✅ User authorized as owner`);
-    
-    // STEP 2: Extract multipart form data
-    console.log(`[Snapshot:${projectId}] Extracting gzip file and metadata from request...`);
-    
-    // Get file from request (Multer stores file in req.file)
-    const fileBuffer = (req as any).file?.buffer;
-    const fileCount = parseInt((req as any).body?.fileCount || '0', 10);
-    const totalSize = parseInt((req as any).body?.totalSize || '0', 10);
-    
-    if (!fileBuffer) {
-      console.error(`[Snapshot:${projectId}] ✗ Missing file in request`);
-      return res.status(400).json({ error: 'Missing gzip file in request' });
+
+    if (!Number.isInteger(size) || size <= 0 || size > SNAPSHOT_UPLOAD_MAX_SIZE) {
+      return res.status(400).json({ error: 'size must be a positive number up to 500MB' });
     }
-    
-    if (!fileCount || fileCount <= 0) {
-      console.error(`[Snapshot:${projectId}] ✗ Invalid fileCount: ${fileCount}`);
+    if (typeof checksum !== 'string' || !/^[0-9a-f]{64}$/.test(checksum)) {
+      return res.status(400).json({ error: 'checksum must be a SHA-256 hex digest' });
+    }
+    if (!(parseInt(fields.fileCount || '0', 10) > 0)) {
       return res.status(400).json({ error: 'fileCount must be positive number' });
     }
-    
-    console.log(`[Snapshot:${projectId}] Received gzip file: ${fileBuffer.length} bytes, Files: ${fileCount}, Original size: ${totalSize} bytes`);
-    
-    // STEP 3: Upload gzip file to Supabase Storage (already compressed by Go agent)
-    console.log(`[Snapshot:${projectId}] Uploading gzip file to Supabase Storage...`);
-    
-    const timestamp = Date.now();
-    const filename = `snapshot_${timestamp}.json.gz`;
-    const bucket = 'project-snapshots';
-    const filePath = `${projectId}/${filename}`;
-    
-    const { data: uploadData, error: uploadErr } = await supabase.storage
-      .from(bucket)
-      .upload(filePath, fileBuffer, {
-        contentType: 'application/gzip',
-        upsert: false,
-      });
-    
-    if (uploadErr) {
-      console.error(`[Snapshot:${projectId}] ✗ Storage upload failed:`, uploadErr.message);
-      return res.status(500).json({ error: 'Failed to upload snapshot to storage' });
+
+    // Fail before any part is sent rather than on commit
+    if (fields.kind === 'delta' && (!fields.baseUrl || fields.baseUrl !== project.snapshot_url)) {
+      return res.status(409).json({ error: 'Delta base is not the current snapshot', code: 'DELTA_BASE_MISMATCH', currentSnapshotUrl: project.snapshot_url || null });
     }
-    
-    console.log(`[Snapshot:${projectId}] ✅ Uploaded to storage: ${filePath}`);
-    
-    // STEP 4: Generate public URL
-    console.log(`[Snapshot:${projectId}] Generating public URL...`);
-    
-    const { data: publicUrlData } = supabase.storage
-      .from(bucket)
-      .getPublicUrl(filePath);
-    
-    const snapshotUrl = publicUrlData.publicUrl;
-    
-    console.log(`[Snapshot:${projectId}] Public URL: ${snapshotUrl}`);
-    
-    // STEP 5: Update project table with snapshot metadata
-    console.log(`[Snapshot:${projectId}] Updating project metadata in database...`);
-    
-    const updatePayload: any = {
-      snapshot_url: snapshotUrl,
-      snapshot_updated_at: new Date().toISOString(),
-      snapshot_file_count: fileCount,
-      snapshot_total_size: totalSize,
+
+    await pruneSnapshotUploads();
+
+    const now = Date.now();
+    const requestedPart = Number.isInteger(partSize) ? partSize : 8 * 1024 * 1024;
+    const session: SnapshotUploadSession = {
+      uploadId: crypto.randomUUID(),
+      projectId,
+      userId,
+      fileName: typeof fileName === 'string' && fileName ? path.basename(fileName) : 'snapshot.json.gz',
+      size,
+      partSize: Math.min(Math.max(requestedPart, SNAPSHOT_UPLOAD_MIN_PART), SNAPSHOT_UPLOAD_MAX_PART),
+      checksum,
+      fields,
+      offset: 0,
+      createdAt: new Date(now).toISOString(),
+      expiresAt: new Date(now + SNAPSHOT_UPLOAD_TTL_MS).toISOString(),
     };
-    
-    const { error: updateErr } = await supabase
-      .from('projects')
-      .update(updatePayload)
-      .eq('id', projectId);
-    
-    if (updateErr) {
-      console.error(`[Snapshot:${projectId}] ⚠️  Failed to update project metadata:`, updateErr.message);
-      // Non-blocking error - storage succeeded, DB update is secondary
-    } else {
-      console.log(`[Snapshot:${projectId}] ✅ Project metadata updated in database`);
-      console.log(`[Snapshot:${projectId}]    Files: ${fileCount}, Size: ${totalSize} bytes`);
+
+    await fs.promises.mkdir(snapshotUploadDir(session.uploadId), { recursive: true });
+    await saveSnapshotUpload(session);
+
+    console.log(`[Snapshot:${projectId}] Started upload ${session.uploadId}: ${size} bytes in parts of ${session.partSize}`);
+    res.status(201).json(snapshotUploadStatus(session));
+  } catch (error) {
+    console.error(`[Snapshot:${projectId}] ✗ POST /snapshot/uploads exception:`, error);
+    res.status(500).json({ error: 'Failed to start snapshot upload' });
+  }
+});
+
+/**
+ * GET /api/projects/:projectId/snapshot/uploads/:uploadId
+ * Offset to resume an upload from
+ */
+router.get('/:projectId/snapshot/uploads/:uploadId', authMiddleware, async (req: Request, res: Response) => {
+  const { projectId, uploadId } = req.params;
+  const session = await loadSnapshotUpload(projectId, uploadId, (req as any).user.id);
+  if (!session) {
+    return res.status(404).json({ error: 'Upload not found' });
+  }
+  res.json(snapshotUploadStatus(session));
+});
+
+/**
+ * PUT /api/projects/:projectId/snapshot/uploads/:uploadId/parts/:partNumber
+ * Store one part; parts are numbered from 0 and must arrive in order
+ *
+ * Request: application/octet-stream body, X-Checksum-Sha256 header with the part's SHA-256 hex
+ * Every part is partSize bytes except the last
+ *
+ * Response: { uploadId, size, partSize, offset, expiresAt }
+ * 409 PART_OUT_OF_ORDER with the current offset when the part is not the next one expected
+ */
+router.put(
+  '/:projectId/snapshot/uploads/:uploadId/parts/:partNumber',
+  authMiddleware,
+  express.raw({ type: 'application/octet-stream', limit: SNAPSHOT_UPLOAD_MAX_PART }),
+  async (req: Request, res: Response) => {
+    const { projectId, uploadId } = req.params;
+
+    try {
+      const session = await loadSnapshotUpload(projectId, uploadId, (req as any).user.id);
+      if (!session) {
+        return res.status(404).json({ error: 'Upload not found' });
+      }
+
+      const partNumber = parseInt(req.params.partNumber, 10);
+      if (!Number.isInteger(partNumber) || partNumber < 0) {
+        return res.status(400).json({ error: 'Invalid part number' });
+      }
+      if (partNumber * session.partSize < session.offset) {
+        // Already stored; the response to an earlier attempt was lost
+        return res.json(snapshotUploadStatus(session));
+      }
+      if (partNumber * session.partSize !== session.offset) {
+        return res.status(409).json({ error: 'Part out of order', code: 'PART_OUT_OF_ORDER', ...snapshotUploadStatus(session) });
+      }
+
+      const data = req.body;
+      const length = Math.min(session.partSize, session.size - session.offset);
+      if (!Buffer.isBuffer(data) || data.length !== length) {
+        return res.status(400).json({ error: `Part must be ${length} bytes` });
+      }
+
+      const checksum = crypto.createHash('sha256').update(data).digest('hex');
+      if (checksum !== String(req.headers['x-checksum-sha256'] || '').toLowerCase()) {
+        console.warn(`[Snapshot:${projectId}] Part ${partNumber} of upload ${uploadId} failed its checksum`);
+        return res.status(422).json({ error: 'Part checksum mismatch' });
+      }
+
+      await fs.promises.writeFile(path.join(snapshotUploadDir(uploadId), `part-${partNumber}`), data);
+      session.offset += data.length;
+      await saveSnapshotUpload(session);
+
+      res.json(snapshotUploadStatus(session));
+    } catch (error) {
+      console.error(`[Snapshot:${projectId}] ✗ PUT part of upload ${uploadId} exception:`, error);
+      res.status(500).json({ error: 'Failed to store upload part' });
+    }
+  }
+);
+
+/**
+ * POST /api/projects/:projectId/snapshot/uploads/:uploadId/commit
+ * Assemble the parts, check the file checksum and store the snapshot as POST /snapshot does
+ * Response: same as POST /snapshot; committing an upload again returns the first commit's response
+ * 409 UPLOAD_INCOMPLETE with the current offset when parts are missing
+ */
+router.post('/:projectId/snapshot/uploads/:uploadId/commit', authMiddleware, async (req: Request, res: Response) => {
+  const { projectId, uploadId } = req.params;
+  const userId = (req as any).user.id;
+
+  try {
+    const session = await loadSnapshotUpload(projectId, uploadId, userId);
+    if (!session) {
+      return res.status(404).json({ error: 'Upload not found' });
+    }
+    if (session.committed) {
+      // Committed before; the response to that commit was lost
+      return res.json(session.committed);
+    }
+    if (session.offset !== session.size) {
+      return res.status(409).json({ error: 'Upload is incomplete', code: 'UPLOAD_INCOMPLETE', ...snapshotUploadStatus(session) });
+    }
+
+    const parts: Buffer[] = [];
+    for (let n = 0; n * session.partSize < session.size; n++) {
+      parts.push(await fs.promises.readFile(path.join(snapshotUploadDir(uploadId), `part-${n}`)));
+    }
+    const fileBuffer = Buffer.concat(parts);
+
+    if (crypto.createHash('sha256').update(fileBuffer).digest('hex') !== session.checksum) {
+      console.error(`[Snapshot:${projectId}] ✗ Upload ${uploadId} does not match its checksum`);
+      await removeSnapshotUpload(uploadId);
+      return res.status(422).json({ error: 'Upload checksum mismatch' });
+    }
+
+    console.log(`[Snapshot:${projectId}] Committing upload ${uploadId} (${fileBuffer.length} bytes)`);
+    const stored = await storeSnapshot(projectId, userId, session.fields, fileBuffer, res);
+
+    // Keep the parts if storage failed so the commit can be retried; a rejected file stays rejected
+    if (stored) {
+      await markSnapshotUploadCommitted(session, stored);
+    } else if (res.statusCode < 500) {
+      await removeSnapshotUpload(uploadId);
     }
-    
-    // Success response
-    console.log(`[Snapshot:${projectId}] ✅ Snapshot upload complete`);
-    
-    res.status(200).json({
-      ok: true,
-      snapshotUrl,
-      snapshotSize: fileBuffer.length,
-      uploadedAt: new Date().toISOString(),
-      fileCount,
-      totalSize,
-      message: 'Snapshot uploaded successfully',
-    });
-    
   } catch (error) {
-    console.error(`[Snapshot:${projectId}] ✗ POST /snapshot exception:`, error);
+    console.error(`[Snapshot:${projectId}] ✗ Commit of upload ${uploadId} exception:`, error);
     res.status(500).json({
       error: 'Failed to upload snapshot',
       message: (error as Error).message,
@@ -2419,6 +3009,20 @@ router.post('/:projectId/snapshot', authMiddleware, uploadSnapshot.single('file'
   }
 });
 
+/**
+ * DELETE /api/projects/:projectId/snapshot/uploads/:uploadId
+ * Abandon an upload and drop its parts
+ */
+router.delete('/:projectId/snapshot/uploads/:uploadId', authMiddleware, async (req: Request, res: Response) => {
+  const { projectId, uploadId } = req.params;
+  const session = await loadSnapshotUpload(projectId, uploadId, (req as any).user.id);
+  if (!session) {
+    return res.status(404).json({ error: 'Upload not found' });
+  }
+  await removeSnapshotUpload(uploadId);
+  res.json({ ok: true });
+});
+
 /**
  * GET /api/projects/:projectId/sync-status
  * Get current sync status (paused or syncing)
@@ -2538,6 +3142,78 @@ router.put('/:projectId/download-path', authMiddleware, async (req: Request, res
   }
 });
 
+/**
+ * GET /api/projects/:projectId/member-devices
+ * List Syncthing device IDs of the owner and accepted members of a project.
+ * Used by the Go agent to auto-accept pending Syncthing devices and folders.
+ */
+router.get('/:projectId/member-devices', authMiddleware, async (req: Request, res: Response) => {
+  try {
+    const { projectId } = req.params;
+    const userId = (req as any).user.id;
+
+    const { data: project } = await supabase
+      .from('projects')
+      .select('id, owner_id, name, local_sync_path')
+      .eq('id', projectId)
+      .single();
+
+    if (!project) {
+      return res.status(404).json({ error: 'Project not found' });
+    }
+
+    const { data: members, error: memErr } = await supabase
+      .from('project_members')
+      .select('user_id, role')
+      .eq('project_id', projectId)
+      .eq('status', 'accepted');
+
+    if (memErr) {
+      console.error('Failed to fetch members:', memErr.message);
+      return res.status(500).json({ error: 'Failed to fetch member devices' });
+    }
+
+    const isOwner = project.owner_id === userId;
+    const isMember = (members || []).some((m: any) => m.user_id === userId);
+    if (!isOwner && !isMember) {
+      return res.status(403).json({ error: 'Access denied' });
+    }
+
+    const roles: Record<string, string> = { [project.owner_id]: 'owner' };
+    for (const m of members || []) {
+      if (m.user_id && !roles[m.user_id]) roles[m.user_id] = m.role || 'member';
+    }
+
+    const { data: devices, error: devErr } = await supabase
+      .from('devices')
+      .select('user_id, device_name, syncthing_id')
+      .in('user_id', Object.keys(roles));
+
+    if (devErr) {
+      console.error('Failed to fetch member devices:', devErr.message);
+      return res.status(500).json({ error: 'Failed to fetch member devices' });
+    }
+
+    res.json({
+      projectId,
+      projectName: project.name,
+      role: isOwner ? 'owner' : roles[userId],
+      downloadPath: project.local_sync_path || `~/downloads/vidsync/${project.name}-${projectId}`,
+      devices: (devices || [])
+        .filter((d: any) => d.syncthing_id)
+        .map((d: any) => ({
+          syncthingId: d.syncthing_id,
+          userId: d.user_id,
+          deviceName: d.device_name,
+          role: roles[d.user_id],
+        })),
+    });
+  } catch (error) {
+    console.error('Get member-devices exception:', error);
+    res.status(500).json({ error: 'Failed to fetch member devices' });
+  }
+});
+
 /**
  * GET /api/projects/:projectId/download-path
  * Get current download path for a project
@@ -24,6 +24,43 @@ export interface SnapshotMetadata {
   files: FileMetadata[];
 }
 
+/**
+ * Changes uploaded by the Go agent against a previous snapshot (kind: "delta")
+ */
+export interface SnapshotDelta {
+  kind: 'delta';
+  projectId: string;
+  createdAt: string;
+  baseUrl: string;
+  chainLength: number;
+  added: FileMetadata[];
+  modified: FileMetadata[];
+  removed: string[];
+  fileCount: number;
+  totalSize: number;
+}
+
+// Agents start a new full snapshot after 20 deltas; anything deeper is corrupt
+const MAX_DELTA_CHAIN = 64;
+
+/**
+ * Thrown for snapshots the agent encrypted with a project key the cloud never sees;
+ * members read them through their own agent instead
+ */
+export class EncryptedSnapshotError extends Error {
+  constructor(snapshotUrl: string) {
+    super(`Snapshot is encrypted: ${snapshotUrl}`);
+    this.name = 'EncryptedSnapshotError';
+  }
+}
+
+/**
+ * Encrypted snapshots are stored with an .enc suffix
+ */
+export function isEncryptedSnapshot(snapshotUrl: string): boolean {
+  return snapshotUrl.endsWith('.enc');
+}
+
 export class FileMetadataService {
   /**
    * Save file metadata snapshot to Supabase Storage as compressed JSON
@@ -109,7 +146,11 @@ export class FileMetadataService {
   /**
    * Load file metadata snapshot from Supabase Storage
    */
-  static async loadSnapshot(snapshotUrl: string): Promise<SnapshotMetadata> {
+  static async loadSnapshot(snapshotUrl: string, depth: number = 0): Promise<SnapshotMetadata> {
+    if (isEncryptedSnapshot(snapshotUrl)) {
+      throw new EncryptedSnapshotError(snapshotUrl);
+    }
+
     try {
       // Extract project ID and filename from URL
       const urlParts = snapshotUrl.split('/');
@@ -130,9 +171,18 @@ export class FileMetadataService {
       const buffer = await (fileData as Blob).arrayBuffer();
       const decompressedBuffer = await gunzip(Buffer.from(buffer));
       const jsonString = decompressedBuffer.toString('utf-8');
-      const snapshot: SnapshotMetadata = JSON.parse(jsonString);
+      const snapshot = JSON.parse(jsonString);
 
-      return snapshot;
+      // Delta snapshots are rebuilt on top of the snapshot they were computed against
+      if (snapshot.kind === 'delta') {
+        if (depth >= MAX_DELTA_CHAIN) {
+          throw new Error(`Snapshot delta chain exceeds ${MAX_DELTA_CHAIN} entries`);
+        }
+        const base = await this.loadSnapshot(snapshot.baseUrl, depth + 1);
+        return this.applyDelta(base, snapshot as SnapshotDelta);
+      }
+
+      return snapshot as SnapshotMetadata;
     } catch (error) {
       console.error(`Error loading snapshot from ${snapshotUrl}:`, error);
       throw error;
@@ -196,6 +246,36 @@ export class FileMetadataService {
     }
   }
 
+  /**
+   * Apply a delta's added, modified and removed entries to a flat snapshot listing
+   */
+  static applyDelta(base: SnapshotMetadata, delta: SnapshotDelta): SnapshotMetadata {
+    const removed = new Set(delta.removed || []);
+    const changed = new Map<string, FileMetadata>();
+    for (const file of [...(delta.added || []), ...(delta.modified || [])]) {
+      changed.set(file.path, file);
+    }
+
+    const files: FileMetadata[] = [];
+    for (const file of base.files || []) {
+      if (removed.has(file.path)) {
+        continue;
+      }
+      const update = changed.get(file.path);
+      files.push(update || file);
+      changed.delete(file.path);
+    }
+    files.push(...changed.values());
+
+    return {
+      ...base,
+      totalFiles: delta.fileCount,
+      totalSize: delta.totalSize,
+      createdAt: delta.createdAt,
+      files,
+    };
+  }
+
   /**
    * Clean up old snapshots, keeping only the latest
    */
@@ -1,4 +1,5 @@
 import { spawn, ChildProcess } from 'child_process';
+import crypto from 'crypto';
 import { EventEmitter } from 'events';
 import path from 'path';
 import { platform } from 'os';
@@ -9,6 +10,8 @@ import SyncthingManager from './syncthingManager';
 
 export class AgentController {
   public events = new EventEmitter();
+  // Lets GoAgentClient change or export snapshot keys; the agent only accepts it from this launch
+  public readonly apiSecret = crypto.randomBytes(32).toString('hex');
   private process: ChildProcess | null = null;
   private isRunning = false;
   private resolvedPath: string | null = null;
@@ -95,8 +98,8 @@ export class AgentController {
         const syncthingConfig = syncthingManager['findSystemSyncthingConfig']?.() || {};
         const apiKey = syncthingConfig.apiKey || '';
 
-        // Prepare environment with Syncthing API key
-        const env = { ...process.env };
+        // Prepare environment with Syncthing API key and the local API secret
+        const env = { ...process.env, AGENT_API_SECRET: this.apiSecret };
         if (apiKey) {
           env.SYNCTHING_API_KEY = apiKey;
           if (isDevelopment()) {
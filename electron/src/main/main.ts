@@ -12,7 +12,7 @@ import { AgentController } from './agentController';
 import { SyncthingManager } from './syncthingManager';
 import { NebulaManager } from './nebulaManager';
 import { logger } from './logger';
-import { GoAgentClient } from './services/goAgentClient';
+import { GoAgentClient, SnapshotKeyMissingError } from './services/goAgentClient';
 import { initializeSyncWebSocket, getSyncWebSocketClient } from './syncWebSocketClient';
 import { listDirectory, scanDirectoryTree, scanDirectoryFlat, getDirectoryStats, FileItem, DirectoryEntry } from './fileScanner';
 import { FileWatcher } from './services/fileWatcher';
@@ -24,6 +24,7 @@ const agentController = new AgentController();
 const syncthingManager = new SyncthingManager();
 const nebulaManager = new NebulaManager();
 const goAgentClient = new GoAgentClient(logger);
+goAgentClient.setAgentSecret(agentController.apiSecret);
 
 // File watchers per project (projectId -> FileWatcher instance)
 const projectWatchers = new Map<string, FileWatcher>();
@@ -582,9 +583,9 @@ ipcMain.handle('project:stopSync', async (_ev, { projectId, deviceId, accessToke
   });
 
   // Snapshot Cache Handlers
-  ipcMain.handle('snapshot:getCached', async (_ev, projectId: string) => {
+  ipcMain.handle('snapshot:getCached', async (_ev, projectId: string, snapshotUrl?: string) => {
     try {
-      const cached = await snapshotCache.getCachedSnapshot(projectId);
+      const cached = await snapshotCache.getCachedSnapshot(projectId, snapshotUrl);
       return cached || null;
     } catch (error) {
       logger.error(`Failed to get cached snapshot for ${projectId}:`, error);
@@ -592,7 +593,7 @@ ipcMain.handle('project:stopSync', async (_ev, { projectId, deviceId, accessToke
     }
   });
 
-  ipcMain.handle('snapshot:downloadAndCache', async (_ev, projectId: string, downloadUrl: string) => {
+  ipcMain.handle('snapshot:downloadAndCache', async (_ev, projectId: string) => {
     try {
       // Setup progress callback
       const onProgress = (status: string, progress?: number) => {
@@ -601,14 +602,38 @@ ipcMain.handle('project:stopSync', async (_ev, { projectId, deviceId, accessToke
         }
       };
 
-      const result = await snapshotCache.downloadAndCacheSnapshot(projectId, downloadUrl, onProgress);
+      const result = await snapshotCache.downloadAndCacheSnapshot(
+        projectId,
+        () => goAgentClient.getRemoteSnapshot(projectId),
+        onProgress
+      );
       return result;
     } catch (error) {
+      // Not a failure: the renderer asks for the key shared by the owner
+      if (error instanceof SnapshotKeyMissingError) {
+        return { encrypted: true, keyMissing: true };
+      }
       logger.error(`Failed to download and cache snapshot for ${projectId}:`, error);
       throw error;
     }
   });
 
+  // Import the snapshot key the owner shared, so the agent can decrypt the project's snapshots
+  ipcMain.handle('snapshot:importKey', async (_ev, projectId: string, key: string) => {
+    if (!key || !key.trim()) {
+      // An empty key would make the agent generate a new one
+      return { ok: false, error: 'Paste the key shared by the project owner' };
+    }
+    try {
+      await goAgentClient.setSnapshotKey(projectId, key.trim());
+      snapshotCache.clearProjectCache(projectId);
+      return { ok: true };
+    } catch (error) {
+      logger.error(`Failed to import snapshot key for ${projectId}:`, error);
+      return { ok: false, error: error instanceof Error ? error.message : String(error) };
+    }
+  });
+
   ipcMain.handle('snapshot:clearProject', async (_ev, projectId: string) => {
     try {
       snapshotCache.clearProjectCache(projectId);
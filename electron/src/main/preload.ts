@@ -63,8 +63,9 @@ contextBridge.exposeInMainWorld('api', {
   elevateSetcap: (binaryPath: string) => ipcRenderer.invoke('privilege:elevateSetcap', binaryPath),
   // Snapshot cache
   snapshotCache: {
-    getCached: (projectId: string) => ipcRenderer.invoke('snapshot:getCached', projectId),
-    downloadAndCache: (projectId: string, downloadUrl: string) => ipcRenderer.invoke('snapshot:downloadAndCache', projectId, downloadUrl),
+    getCached: (projectId: string, snapshotUrl?: string) => ipcRenderer.invoke('snapshot:getCached', projectId, snapshotUrl),
+    downloadAndCache: (projectId: string) => ipcRenderer.invoke('snapshot:downloadAndCache', projectId),
+    importKey: (projectId: string, key: string) => ipcRenderer.invoke('snapshot:importKey', projectId, key),
     clearProject: (projectId: string) => ipcRenderer.invoke('snapshot:clearProject', projectId),
     clearAll: () => ipcRenderer.invoke('snapshot:clearAll'),
     onProgress: (cb: (status: string, progress?: number) => void) => ipcRenderer.on('snapshot:progress', (_ev, status, progress) => cb(status, progress)),
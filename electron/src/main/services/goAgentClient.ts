@@ -1,7 +1,33 @@
 import axios, { AxiosInstance, AxiosError } from 'axios';
 
 /**
- * GoAgentClient provides HTTP interface to the Go service running on localhost:5001
+ * Filters, order and page of a file list request
+ */
+export interface FileListOptions {
+  limit?: number; // Default 500, max 5000
+  cursor?: string; // nextCursor of the previous page
+  sort?: 'path' | 'name' | 'size' | 'mtime';
+  order?: 'asc' | 'desc';
+  prefix?: string;
+  extensions?: string[];
+  minSize?: number;
+  maxSize?: number;
+  modifiedSince?: string; // RFC 3339
+  expandSequences?: boolean;
+}
+
+/**
+ * Thrown when a project's snapshot is encrypted and no key has been imported for it
+ */
+export class SnapshotKeyMissingError extends Error {
+  constructor(message: string) {
+    super(message);
+    this.name = 'SnapshotKeyMissingError';
+  }
+}
+
+/**
+ * GoAgentClient provides HTTP interface to the Go service running on 127.0.0.1:5001
  * This is the primary bridge for:
  * - Syncthing folder operations (create, delete, pause, resume)
  * - Device management (add, remove, sync)
@@ -11,8 +37,9 @@ import axios, { AxiosInstance, AxiosError } from 'axios';
 export class GoAgentClient {
   private client: AxiosInstance;
   private logger: any;
-  private baseURL = 'http://localhost:5001/api/v1';
+  private baseURL = 'http://127.0.0.1:5001/api/v1';
   private cloudAuthToken: string = '';
+  private agentSecret: string = '';
 
   constructor(logger: any) {
     this.logger = logger;
@@ -61,6 +88,13 @@ export class GoAgentClient {
     this.logger.debug('[GoAgent] Cloud auth token set');
   }
 
+  /**
+   * Set the local secret the agent requires to change or export snapshot keys
+   */
+  setAgentSecret(secret: string): void {
+    this.agentSecret = secret;
+  }
+
   /**
    * Clear the cloud authorization token
    */
@@ -415,18 +449,26 @@ export class GoAgentClient {
   }
 
   /**
-   * Get file list for a project
+   * Get a page of a project's file list
+   * Pass the previous page's nextCursor as options.cursor, with the same sort and order, for the next page
    */
   async getFiles(
     projectId: string,
-    limit?: string,
-    offset?: string,
+    options: FileListOptions = {},
     accessToken?: string
   ): Promise<any> {
     try {
       const params = new URLSearchParams();
-      if (limit) params.append('limit', limit);
-      if (offset) params.append('offset', offset);
+      if (options.limit) params.append('limit', String(options.limit));
+      if (options.cursor) params.append('cursor', options.cursor);
+      if (options.sort) params.append('sort', options.sort);
+      if (options.order) params.append('order', options.order);
+      if (options.prefix) params.append('prefix', options.prefix);
+      if (options.extensions?.length) params.append('ext', options.extensions.join(','));
+      if (options.minSize !== undefined) params.append('minSize', String(options.minSize));
+      if (options.maxSize !== undefined) params.append('maxSize', String(options.maxSize));
+      if (options.modifiedSince) params.append('modifiedSince', options.modifiedSince);
+      if (options.expandSequences) params.append('expandSequences', 'true');
 
       const response = await this.client.get(
         `/projects/${projectId}/files`,
@@ -452,6 +494,43 @@ export class GoAgentClient {
     }
   }
 
+  /**
+   * Search a project's files and directories by name, case-insensitively
+   */
+  async searchFiles(
+    projectId: string,
+    query: string,
+    limit?: number,
+    accessToken?: string
+  ): Promise<any> {
+    try {
+      const params: Record<string, string> = { q: query };
+      if (limit) params.limit = String(limit);
+
+      const response = await this.client.get(
+        `/projects/${projectId}/files/search`,
+        {
+          params,
+          headers: accessToken
+            ? { Authorization: `Bearer ${accessToken}` }
+            : {},
+        }
+      );
+
+      if (response.status === 200) {
+        return response.data;
+      }
+
+      throw new Error(response.data?.error || 'Failed to search files');
+    } catch (error) {
+      const err = error as AxiosError;
+      this.logger.error(
+        `[GoAgent] Search files failed: ${err.message}`
+      );
+      throw error;
+    }
+  }
+
   /**
    * Get file tree structure for a project
    */
@@ -484,12 +563,14 @@ export class GoAgentClient {
   }
 
   /**
-   * Generate snapshot of project files
+   * Queue a snapshot of project files
+   * The agent runs it as a background job (one per project); follow it via
+   * GET /projects/:projectId/snapshot/jobs/:jobId or the snapshot progress stream
    */
   async generateSnapshot(
     projectId: string,
     accessToken: string
-  ): Promise<{ ok: boolean; snapshotId?: string; error?: string }> {
+  ): Promise<{ ok: boolean; jobId?: string; error?: string }> {
     try {
       const response = await this.client.post(
         `/projects/${projectId}/snapshot`,
@@ -497,10 +578,10 @@ export class GoAgentClient {
         { headers: { Authorization: `Bearer ${accessToken}` } }
       );
 
-      if (response.status === 200 || response.status === 201) {
+      if (response.status === 200 || response.status === 201 || response.status === 202) {
         return {
           ok: true,
-          snapshotId: response.data?.snapshotId,
+          jobId: response.data?.jobId,
         };
       }
 
@@ -612,6 +693,81 @@ export class GoAgentClient {
     }
   }
 
+  /**
+   * Get a project's cloud snapshot with its deltas applied, decrypted with the project key
+   * Returns: projectId, snapshotUrl, encrypted, createdAt, fileCount, totalSize, files
+   * Throws SnapshotKeyMissingError when the snapshot is encrypted and the project key isn't imported
+   */
+  async getRemoteSnapshot(projectId: string): Promise<any> {
+    const response = await this.client.get(`/projects/${projectId}/snapshot/remote`);
+    if (response.status === 200) {
+      return response.data;
+    }
+    if (response.status === 409) {
+      throw new SnapshotKeyMissingError(response.data?.error || 'Snapshot is encrypted and no key is set');
+    }
+    throw new Error(response.data?.error || 'Failed to get remote snapshot');
+  }
+
+  /**
+   * Get whether a project's snapshots are encrypted and the key ID
+   * Returns: projectId, enabled, algorithm, keyId
+   */
+  async getSnapshotKey(projectId: string): Promise<any> {
+    const response = await this.client.get(`/projects/${projectId}/snapshot/key`);
+    if (response.status === 200) {
+      return response.data;
+    }
+    throw new Error(response.data?.error || 'Failed to get snapshot key');
+  }
+
+  /**
+   * Enable snapshot encryption, importing a base64 key shared by the owner or generating a new one
+   */
+  async setSnapshotKey(projectId: string, key?: string): Promise<any> {
+    const response = await this.client.put(
+      `/projects/${projectId}/snapshot/key`,
+      key ? { key } : {},
+      { headers: { 'X-Agent-Secret': this.agentSecret } }
+    );
+    if (response.status === 200) {
+      return response.data;
+    }
+    throw new Error(response.data?.error || 'Failed to set snapshot key');
+  }
+
+  /**
+   * Export a project's snapshot key to share with project members
+   * Returns: projectId, enabled, algorithm, keyId, key (base64)
+   */
+  async exportSnapshotKey(projectId: string): Promise<any> {
+    const response = await this.client.post(
+      `/projects/${projectId}/snapshot/key/export`,
+      null,
+      { headers: { 'X-Agent-Secret': this.agentSecret } }
+    );
+    if (response.status === 200) {
+      return response.data;
+    }
+    throw new Error(response.data?.error || 'Failed to export snapshot key');
+  }
+
+  /**
+   * Register this device's snapshot signing key for a project the user owns
+   * replace swaps out another device's key, e.g. after moving the project to this device
+   */
+  async registerSigningKey(projectId: string, replace: boolean = false): Promise<any> {
+    const response = await this.client.put(
+      `/projects/${projectId}/signing-key`,
+      { replace },
+      { headers: { 'X-Agent-Secret': this.agentSecret } }
+    );
+    if (response.status === 200) {
+      return response.data;
+    }
+    throw new Error(response.data?.error || 'Failed to register signing key');
+  }
+
   /**
    * Subscribe to snapshot progress via Server-Sent Events
    * Returns an EventSource that emits progress updates
@@ -1,19 +1,11 @@
 import { app } from 'electron';
 import * as fs from 'fs';
 import * as path from 'path';
-import * as zlib from 'zlib';
-import { promisify } from 'util';
-
-const gunzip = promisify(zlib.gunzip);
-
-interface SnapshotCacheOptions {
-  projectId: string;
-  downloadUrl?: string;
-}
 
 interface SnapshotData {
   files: any[];
   timestamp: number;
+  snapshotUrl?: string; // Snapshot the listing was built from
 }
 
 export class SnapshotCacheService {
@@ -33,38 +25,26 @@ export class SnapshotCacheService {
   /**
    * Get the cache file path for a project
    */
-  private getCacheFilePath(projectId: string, compressed: boolean = false): string {
-    const filename = compressed ? `${projectId}.json.gz` : `${projectId}.json`;
-    return path.join(this.cacheDir, filename);
+  private getCacheFilePath(projectId: string): string {
+    return path.join(this.cacheDir, `${projectId}.json`);
   }
 
   /**
    * Get cached snapshot data if it exists
+   * With a snapshotUrl, a listing built from an older snapshot is ignored
    */
-  async getCachedSnapshot(projectId: string): Promise<SnapshotData | null> {
+  async getCachedSnapshot(projectId: string, snapshotUrl?: string): Promise<SnapshotData | null> {
     try {
-      const gzPath = this.getCacheFilePath(projectId, true);
-      const jsonPath = this.getCacheFilePath(projectId, false);
-
-      // Check if JSON cache exists (faster)
-      if (fs.existsSync(jsonPath)) {
-        const data = fs.readFileSync(jsonPath, 'utf-8');
-        return JSON.parse(data);
+      const jsonPath = this.getCacheFilePath(projectId);
+      if (!fs.existsSync(jsonPath)) {
+        return null;
       }
 
-      // Check if compressed cache exists
-      if (fs.existsSync(gzPath)) {
-        const compressed = fs.readFileSync(gzPath);
-        const decompressed = await gunzip(compressed);
-        const jsonData = decompressed.toString('utf-8');
-        const parsed = JSON.parse(jsonData);
-
-        // Cache the decompressed JSON for next time
-        fs.writeFileSync(jsonPath, JSON.stringify(parsed));
-        return parsed;
+      const parsed = JSON.parse(fs.readFileSync(jsonPath, 'utf-8')) as SnapshotData;
+      if (snapshotUrl && parsed.snapshotUrl !== snapshotUrl) {
+        return null;
       }
-
-      return null;
+      return parsed;
     } catch (error) {
       console.error(`Failed to get cached snapshot for project ${projectId}:`, error);
       return null;
@@ -72,69 +52,44 @@ export class SnapshotCacheService {
   }
 
   /**
-   * Download and cache a snapshot from URL
+   * Load a project's file listing and cache it
+   * snapshot_url may point at an encrypted snapshot or a delta on top of older snapshots,
+   * so the listing comes from the Go agent, which resolves both, instead of the URL itself
    */
   async downloadAndCacheSnapshot(
     projectId: string,
-    downloadUrl: string,
+    loadSnapshot: () => Promise<{ snapshotUrl: string; files: any[] }>,
     onProgress?: (status: string, progress?: number) => void
   ): Promise<SnapshotData | null> {
     try {
       onProgress?.('Downloading snapshot...');
 
-      // Use fetch to download
-      const response = await fetch(downloadUrl);
-      if (!response.ok) {
-        throw new Error(`Failed to download snapshot: ${response.status}`);
-      }
-
-      const buffer = await response.arrayBuffer();
-      onProgress?.('Processing snapshot...', 50);
-
-      // Determine if compressed
-      const isGzip = this.isGzipBuffer(Buffer.from(buffer));
-      
-      let decompressed: Buffer;
-      if (isGzip) {
-        decompressed = await gunzip(Buffer.from(buffer));
-      } else {
-        decompressed = Buffer.from(buffer);
-      }
-
-      onProgress?.('Parsing data...', 75);
-
-      const jsonData = decompressed.toString('utf-8');
-      const parsed = JSON.parse(jsonData) as SnapshotData;
-
-      // Cache both versions
-      const gzPath = this.getCacheFilePath(projectId, true);
-      const jsonPath = this.getCacheFilePath(projectId, false);
+      const snapshot = await loadSnapshot();
+      onProgress?.('Processing snapshot...', 75);
 
-      fs.writeFileSync(gzPath, Buffer.from(buffer));
-      fs.writeFileSync(jsonPath, JSON.stringify(parsed));
+      const data: SnapshotData = {
+        files: snapshot.files || [],
+        timestamp: Date.now(),
+        snapshotUrl: snapshot.snapshotUrl,
+      };
+      fs.writeFileSync(this.getCacheFilePath(projectId), JSON.stringify(data));
 
       onProgress?.('Snapshot ready', 100);
-      return parsed;
+      return data;
     } catch (error) {
       console.error(`Failed to download and cache snapshot for project ${projectId}:`, error);
       throw error;
     }
   }
 
-  /**
-   * Check if buffer is gzip compressed
-   */
-  private isGzipBuffer(buffer: Buffer): boolean {
-    return buffer.length >= 2 && buffer[0] === 0x1f && buffer[1] === 0x8b;
-  }
-
   /**
    * Clear cache for a specific project
    */
   clearProjectCache(projectId: string): void {
     try {
-      const gzPath = this.getCacheFilePath(projectId, true);
-      const jsonPath = this.getCacheFilePath(projectId, false);
+      const jsonPath = this.getCacheFilePath(projectId);
+      // Listings cached as gzip by older versions
+      const gzPath = `${jsonPath}.gz`;
 
       if (fs.existsSync(gzPath)) {
         fs.unlinkSync(gzPath);
@@ -15,6 +15,7 @@ import {
   Chip,
   TextField,
   InputAdornment,
+  Button,
 } from '@mui/material';
 import {
   ChevronDown,
@@ -25,6 +26,7 @@ import {
   AlertCircle,
   Search,
   Home,
+  Lock,
 } from 'lucide-react';
 import { cloudAPI } from '../hooks/useCloudApi';
 import {
@@ -133,6 +135,10 @@ export const FileTreeBrowser: React.FC<FileTreeBrowserProps> = ({
   const [searchTerm, setSearchTerm] = useState('');
   const [displayedTree, setDisplayedTree] = useState<FileNode | null>(null);
   const [loadingStatus, setLoadingStatus] = useState<string>('Loading...');
+  const [keyMissing, setKeyMissing] = useState(false);
+  const [keyInput, setKeyInput] = useState('');
+  const [importingKey, setImportingKey] = useState(false);
+  const [keyError, setKeyError] = useState<string | null>(null);
 
   useEffect(() => {
     fetchFileTree();
@@ -154,6 +160,7 @@ export const FileTreeBrowser: React.FC<FileTreeBrowserProps> = ({
   const fetchFileTree = async () => {
     setLoading(true);
     setError(null);
+    setKeyMissing(false);
     setLoadingStatus('Loading...');
 
     try {
@@ -162,25 +169,35 @@ export const FileTreeBrowser: React.FC<FileTreeBrowserProps> = ({
       if (snapshotUrl) {
         // Try to get from cache first
         setLoadingStatus('Checking cache...');
-        const cached = await (window as any).api?.snapshotCache?.getCached?.(projectId);
+        const cached = await (window as any).api?.snapshotCache?.getCached?.(projectId, snapshotUrl);
 
         if (cached && cached.files) {
           setLoadingStatus('Loading from cache...');
           fileData = cached.files;
         } else {
-          // Download and cache
+          // The agent resolves delta snapshots; snapshotUrl itself may only hold changes
           setLoadingStatus('Downloading snapshot...');
-          const downloaded = await (window as any).api?.snapshotCache?.downloadAndCache?.(projectId, snapshotUrl);
+          const downloaded = await (window as any).api?.snapshotCache
+            ?.downloadAndCache?.(projectId)
+            .catch((err: unknown) => {
+              console.warn('Agent could not load the snapshot, asking the server:', err);
+              return null;
+            });
 
+          if (downloaded?.keyMissing) {
+            setKeyMissing(true);
+            return;
+          }
           if (downloaded && downloaded.files) {
             fileData = downloaded.files;
+          } else if (snapshotUrl.endsWith('.enc')) {
+            // Encrypted snapshots are only readable through the agent, which holds the key
+            throw new Error('The agent could not read the encrypted snapshot');
           } else {
-            // Fallback to direct fetch
-            setLoadingStatus('Processing snapshot...');
-            const response = await fetch(snapshotUrl);
-            if (!response.ok) throw new Error('Failed to fetch snapshot');
-            const snapshotData = await response.json();
-            fileData = snapshotData.files || [];
+            // Fallback to the cloud, which resolves deltas too
+            setLoadingStatus('Fetching file list from server...');
+            const apiResponse = await cloudAPI.get(`/projects/${projectId}/file-tree`);
+            fileData = apiResponse.data.files || [];
           }
         }
       } else {
@@ -196,6 +213,10 @@ export const FileTreeBrowser: React.FC<FileTreeBrowserProps> = ({
       setDisplayedTree(builtTree);
       setLoadingStatus('Ready');
     } catch (err) {
+      if ((err as any)?.response?.data?.encrypted) {
+        setKeyMissing(true);
+        return;
+      }
       console.error('Failed to fetch file tree:', err);
       setError(
         err instanceof Error ? err.message : 'Failed to load file browser'
@@ -206,6 +227,22 @@ export const FileTreeBrowser: React.FC<FileTreeBrowserProps> = ({
     }
   };
 
+  const handleImportKey = async () => {
+    setImportingKey(true);
+    setKeyError(null);
+    try {
+      const result = await (window as any).api?.snapshotCache?.importKey?.(projectId, keyInput);
+      if (!result?.ok) {
+        setKeyError(result?.error || 'Failed to import the key');
+        return;
+      }
+      setKeyInput('');
+      await fetchFileTree();
+    } finally {
+      setImportingKey(false);
+    }
+  };
+
   const handleSearch = (term: string) => {
     setSearchTerm(term);
     if (tree) {
@@ -241,6 +278,50 @@ export const FileTreeBrowser: React.FC<FileTreeBrowserProps> = ({
     );
   }
 
+  if (keyMissing) {
+    return (
+      <Paper
+        sx={{
+          p: 3,
+          backgroundColor: '#fffbeb',
+          border: '1px solid #fde68a',
+          borderRadius: 1,
+        }}
+      >
+        <Stack direction="row" spacing={2} alignItems="flex-start">
+          <Lock size={20} style={{ color: '#d97706' }} />
+          <Box sx={{ flex: 1 }}>
+            <Typography variant="subtitle2" sx={{ fontWeight: 600, mb: 0.5 }}>
+              Snapshot is encrypted
+            </Typography>
+            <Typography variant="caption" color="textSecondary">
+              Import the project key shared by the owner to browse this project's files.
+            </Typography>
+            <Stack direction="row" spacing={1} sx={{ mt: 2 }}>
+              <TextField
+                fullWidth
+                size="small"
+                placeholder="Project key"
+                value={keyInput}
+                onChange={(e) => setKeyInput(e.target.value)}
+                error={!!keyError}
+                helperText={keyError || undefined}
+              />
+              <Button
+                variant="contained"
+                size="small"
+                onClick={handleImportKey}
+                disabled={importingKey || !keyInput.trim()}
+              >
+                Import key
+              </Button>
+            </Stack>
+          </Box>
+        </Stack>
+      </Paper>
+    );
+  }
+
   if (error) {
     return (
       <Paper
@@ -12,6 +12,7 @@ interface SnapshotProgressDisplayProps {
 const STEP_LABELS: Record<string, string> = {
   waiting: 'Waiting for Syncthing',
   browsing: 'Scanning Files',
+  hashing: 'Hashing Files',
   compressing: 'Processing Metadata',
   uploading: 'Uploading to Cloud',
   completed: 'Completed',
@@ -21,12 +22,32 @@ const STEP_LABELS: Record<string, string> = {
 const STEP_DESCRIPTIONS: Record<string, string> = {
   waiting: 'Waiting for Syncthing scan to complete...',
   browsing: 'Scanning files in the folder...',
+  hashing: 'Scanning and hashing files in the folder...',
   compressing: 'Processing file metadata...',
   uploading: 'Uploading snapshot to cloud storage...',
   completed: 'Snapshot generated successfully!',
   failed: 'Failed to generate snapshot.',
 };
 
+function formatBytes(bytes: number): string {
+  if (bytes < 1024) return `${bytes} B`;
+  const units = ['KB', 'MB', 'GB', 'TB'];
+  let value = bytes / 1024;
+  let unit = 0;
+  while (value >= 1024 && unit < units.length - 1) {
+    value /= 1024;
+    unit++;
+  }
+  return `${value.toFixed(1)} ${units[unit]}`;
+}
+
+function formatEta(seconds: number): string {
+  if (seconds < 60) return `${seconds}s`;
+  const minutes = Math.floor(seconds / 60);
+  if (minutes < 60) return `${minutes}m ${seconds % 60}s`;
+  return `${Math.floor(minutes / 60)}h ${minutes % 60}m`;
+}
+
 /**
  * Real-time snapshot progress display component
  * Shows progress bar, step indicator, and status messages
@@ -138,10 +159,23 @@ export function SnapshotProgressDisplay({
         {/* File count and size */}
         {progress && progress.fileCount > 0 && (
           <p className="text-xs text-gray-500">
-            {progress.fileCount} files • {progress.totalSize} total
+            {progress.fileCount} files • {formatBytes(progress.totalSize)} total
           </p>
         )}
 
+        {/* Throughput and time left */}
+        {progress && !isTerminal && (progress.bytesPerSecond || progress.etaSeconds) ? (
+          <p className="text-xs text-gray-500">
+            {progress.bytesPerSecond
+              ? `${formatBytes(progress.bytesPerSecond)}/s`
+              : ''}
+            {progress.bytesPerSecond && progress.etaSeconds ? ' • ' : ''}
+            {progress.etaSeconds
+              ? `about ${formatEta(progress.etaSeconds)} left`
+              : ''}
+          </p>
+        ) : null}
+
         {/* Error message */}
         {(isError || error) && (
           <div className="mt-3 p-3 bg-red-50 border border-red-200 rounded">
@@ -4,13 +4,22 @@
  */
 
 export interface SnapshotProgressEvent {
+  id?: number; // Event ID, sent back on reconnect to resume the stream
   projectId: string;
-  step: string; // 'waiting' | 'browsing' | 'compressing' | 'uploading' | 'completed' | 'failed'
+  step: string; // 'waiting' | 'browsing' | 'hashing' | 'compressing' | 'uploading' | 'completed' | 'failed'
   stepNumber: number; // 0-6
   totalSteps: number; // 6
   progress: number; // 0-100
-  fileCount: number;
-  totalSize: string; // 'KB', 'MB', 'GB' formatted
+  fileCount: number; // Entries walked so far
+  totalSize: number; // Bytes walked so far
+  bytesHashed?: number;
+  bytesCompressed?: number;
+  bytesUploaded?: number;
+  uploadSize?: number;
+  compressedSize?: number; // Size of the file being sent, once compressed
+  entriesPerSecond?: number;
+  bytesPerSecond?: number; // Hashing or upload rate
+  etaSeconds?: number; // Omitted when unknown
   message: string;
   snapshotUrl?: string;
   error?: string;
@@ -24,6 +33,7 @@ export type StatusCallback = (status: 'connected' | 'disconnected' | 'reconnecti
 export class ProgressClient {
   private eventSource: EventSource | null = null;
   private projectId: string | null = null;
+  private lastEventId: string | null = null;
   private progressCallback: ProgressCallback | null = null;
   private errorCallback: ErrorCallback | null = null;
   private statusCallback: StatusCallback | null = null;
@@ -33,7 +43,7 @@ export class ProgressClient {
   private reconnectDelay = 1000; // Start with 1s
   private maxReconnectDelay = 30000; // Cap at 30s
   private logger: any;
-  private baseURL = 'http://localhost:5001/api/v1';
+  private baseURL = 'http://127.0.0.1:5001/api/v1';
 
   constructor(logger: any) {
     this.logger = logger;
@@ -49,6 +59,7 @@ export class ProgressClient {
     onStatus?: StatusCallback
   ): void {
     this.projectId = projectId;
+    this.lastEventId = null;
     this.progressCallback = onProgress;
     this.errorCallback = onError || (() => {});
     this.statusCallback = onStatus || (() => {});
@@ -64,7 +75,11 @@ export class ProgressClient {
     if (!this.projectId) return;
 
     try {
-      const url = `${this.baseURL}/projects/${this.projectId}/progress/stream`;
+      // A new EventSource doesn't send Last-Event-ID itself, so resume through the query instead
+      const resume = this.lastEventId
+        ? `?lastEventId=${encodeURIComponent(this.lastEventId)}`
+        : '';
+      const url = `${this.baseURL}/projects/${this.projectId}/progress/stream${resume}`;
       this.logger.debug(`[ProgressClient] Connecting to SSE: ${url}`);
 
       this.eventSource = new EventSource(url);
@@ -73,6 +88,9 @@ export class ProgressClient {
       this.eventSource.addEventListener('message', (event: MessageEvent) => {
         try {
           const data = JSON.parse(event.data) as SnapshotProgressEvent;
+          if (event.lastEventId) {
+            this.lastEventId = event.lastEventId;
+          }
           this.logger.debug(
             `[ProgressClient] Received progress: ${data.step} (${data.progress}%)`
           );
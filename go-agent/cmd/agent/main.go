@@ -1,17 +1,28 @@
 package main
 
 import (
+	"context"
+	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
 	"github.com/vidsync/agent/internal/api"
 	"github.com/vidsync/agent/internal/config"
 	"github.com/vidsync/agent/internal/device"
+	"github.com/vidsync/agent/internal/encryption"
 	"github.com/vidsync/agent/internal/handlers"
+	"github.com/vidsync/agent/internal/hasher"
+	"github.com/vidsync/agent/internal/index"
+	"github.com/vidsync/agent/internal/jobs"
+	"github.com/vidsync/agent/internal/media"
 	"github.com/vidsync/agent/internal/nebula"
 	"github.com/vidsync/agent/internal/services"
+	"github.com/vidsync/agent/internal/signing"
 	"github.com/vidsync/agent/internal/sync"
+	"github.com/vidsync/agent/internal/syncthing"
 	"github.com/vidsync/agent/internal/util"
 	"github.com/vidsync/agent/internal/ws"
 )
@@ -55,8 +66,26 @@ func main() {
 	// Initialize Syncthing manager
 	syncMgr := sync.NewSyncManager(cfg.DataDir, logger)
 
+	// Launch Syncthing ourselves only when SYNCTHING_MANAGED opts in; Electron manages it otherwise
+	syncthingURL := fmt.Sprintf("http://localhost:%d", cfg.SyncthingPort)
+	syncthingAPIKey := cfg.SyncthingAPIKey
+	var syncthingSupervisor *syncthing.Supervisor
+	if cfg.SyncthingManaged {
+		syncthingSupervisor = syncthing.NewSupervisor(cfg.SyncthingBinary, cfg.DataDir, cfg.SyncthingPort, logger)
+		if err := syncthingSupervisor.Prepare(); err != nil {
+			logger.Fatal("Failed to prepare Syncthing: %v", err)
+		}
+		syncthingURL = syncthingSupervisor.BaseURL()
+		syncthingAPIKey = syncthingSupervisor.APIKey()
+		if err := syncthingSupervisor.Start(); err != nil {
+			logger.Fatal("Failed to start Syncthing: %v", err)
+		}
+	} else {
+		logger.Info("Using externally managed Syncthing at %s", syncthingURL)
+	}
+
 	// Initialize API clients
-	syncthingClient := api.NewSyncthingClient("http://localhost:8384", cfg.SyncthingAPIKey)
+	syncthingClient := api.NewSyncthingClient(syncthingURL, syncthingAPIKey)
 	cloudClient := api.NewCloudClient(cfg.CloudURL, cfg.CloudKey)
 
 	// Initialize services
@@ -64,18 +93,99 @@ func main() {
 	syncService := services.NewSyncService(syncthingClient, cloudClient, logger)
 	deviceService := services.NewDeviceService(syncthingClient, cloudClient, logger)
 	fileService := services.NewFileService(syncthingClient, cloudClient, logger)
+	fileService.SetSnapshotStore(services.NewSnapshotStore(filepath.Join(cfg.DataDir, "snapshots")))
+	if cfg.SnapshotHistory > 0 {
+		fileService.SetSnapshotHistory(services.NewSnapshotHistory(filepath.Join(cfg.DataDir, "snapshots", "history"), cfg.SnapshotHistory))
+	}
+	if cfg.SnapshotHashing {
+		hashCache, err := hasher.NewCache(filepath.Join(cfg.DataDir, "hashes.db"))
+		if err != nil {
+			logger.Warn("Failed to open hash cache, hashing without it: %v", err)
+			hashCache = nil
+		} else {
+			defer hashCache.Close()
+		}
+		fileService.SetHasher(hasher.New(hashCache, hasher.Options{
+			Workers:        cfg.HashWorkers,
+			BytesPerSecond: int64(cfg.HashMaxMBPerSec) << 20,
+		}))
+	}
+	conflictService := services.NewConflictService(syncthingClient, cloudClient, logger)
+	ignoreService := services.NewIgnoreService(syncthingClient, cloudClient, logger)
+	versioningService := services.NewVersioningService(syncthingClient, cloudClient, logger)
+	pendingService := services.NewPendingService(syncthingClient, cloudClient, logger)
+	pendingService.SetSyncRoot(cfg.SyncRoot)
+	peerService := services.NewPeerService(syncthingClient, cloudClient, logger)
+	peerService.SetOverlayNetworks(nebulaMgr.OverlayNetworks)
+	projectService.SetFileService(fileService)
+	projectService.SetPeerService(peerService)
+
+	if cfg.MediaMetadata {
+		prober, err := media.NewProber(filepath.Join(cfg.DataDir, "media.db"))
+		if err != nil {
+			logger.Warn("Failed to open media metadata cache, probing without it: %v", err)
+			prober, _ = media.NewProber("")
+		}
+		defer prober.Close()
+		fileService.SetMediaProber(prober)
+	}
+	var fileIndex *services.FileIndex
+	if cfg.FileIndex {
+		indexStore, err := index.NewStore(filepath.Join(cfg.DataDir, "index.db"))
+		if err != nil {
+			logger.Warn("Failed to open file index, walking folders instead: %v", err)
+		} else {
+			defer indexStore.Close()
+			fileIndex = services.NewFileIndex(indexStore, fileService, syncthingClient, logger)
+			fileService.SetFileIndex(fileIndex)
+			ignoreService.SetFileIndex(fileIndex)
+		}
+	}
+	fileService.SetExpandSequences(cfg.ExpandSequences)
+	fileService.SetUploadPartSize(int64(cfg.SnapshotUploadPartMB) << 20)
+	fileService.SetSnapshotSigner(deviceMgr.SignSnapshot, deviceMgr.SigningPublicKey(), deviceMgr.GetDeviceID())
+	fileService.SetSnapshotKeys(encryption.NewKeyStore(filepath.Join(cfg.DataDir, "snapshot-keys.json")))
+	fileService.SetSigningPins(signing.NewPinStore(filepath.Join(cfg.DataDir, "snapshots", "trusted-keys.json")))
+
+	snapshotJobs := services.NewSnapshotJobManager(fileService, cloudClient, logger, cfg.SnapshotConcurrency)
+	if jobStore, err := jobs.NewStore(filepath.Join(cfg.DataDir, "jobs.db")); err != nil {
+		logger.Warn("Failed to open job database, snapshot jobs won't survive restarts: %v", err)
+	} else {
+		defer jobStore.Close()
+		snapshotJobs.SetStore(jobStore)
+	}
+	projectService.SetSnapshotJobs(snapshotJobs)
+
+	snapshotScheduler := services.NewSnapshotScheduler(fileService, syncthingClient, cloudClient, logger)
+	if err := snapshotScheduler.SetDefaultPolicy(services.SnapshotPolicy{
+		Enabled:         &cfg.SnapshotAutoRefresh,
+		QuietSeconds:    cfg.SnapshotQuietPeriod,
+		MaxDelaySeconds: cfg.SnapshotMaxDelay,
+	}); err != nil {
+		logger.Warn("Invalid snapshot refresh settings, using defaults: %v", err)
+	}
+	if err := snapshotScheduler.SetPolicyFile(filepath.Join(cfg.DataDir, "snapshot-policies.json")); err != nil {
+		logger.Warn("Failed to load snapshot refresh policies: %v", err)
+	}
+	snapshotScheduler.SetJobManager(snapshotJobs)
+	projectService.SetSnapshotScheduler(snapshotScheduler)
 
 	// Note: FileService no longer needs Supabase credentials
 	// Snapshot uploads go through Cloud API which handles storage internally
 
 	// Initialize API router and start HTTP server
-	router := handlers.NewRouter(projectService, syncService, deviceService, fileService, logger)
+	router := handlers.NewRouter(projectService, syncService, deviceService, fileService, conflictService, ignoreService, versioningService, pendingService, peerService, snapshotScheduler, snapshotJobs, logger)
+	if syncthingSupervisor != nil {
+		router.SetSyncthingSupervisor(syncthingSupervisor)
+	}
+	router.SetLocalSecret(cfg.APISecret)
+	// The API has no user auth, so it only listens on loopback
 	go func() {
-		if err := router.Start(":5001"); err != nil {
+		if err := router.Start("127.0.0.1:5001"); err != nil {
 			logger.Error("HTTP API server error: %v", err)
 		}
 	}()
-	logger.Info("HTTP API server started on :5001")
+	logger.Info("HTTP API server started on 127.0.0.1:5001")
 
 	// Initialize WebSocket server
 	wsServer := ws.NewWebSocketServer(":29999", logger, deviceMgr)
@@ -85,6 +195,8 @@ func main() {
 		logger.Debug("Sync event: %s - %s", evt.Type, evt.ProjectID)
 		wsServer.Broadcast(evt)
 	})
+	syncMgr.OnEvent(conflictService.ReportConflict)
+	conflictService.SetEventEmitter(syncMgr.EmitEvent)
 
 	// Start services
 	go func() {
@@ -93,11 +205,31 @@ func main() {
 		}
 	}()
 
+	if err := syncMgr.Start(); err != nil {
+		logger.Error("Sync manager error: %v", err)
+	}
+
+	// Consume Syncthing's event stream and forward it to WebSocket clients
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	go func() {
-		if err := syncMgr.Start(); err != nil {
-			logger.Error("Sync manager error: %v", err)
+		if err := syncthingClient.Events().Run(ctx); err != nil && err != context.Canceled {
+			logger.Error("Syncthing event stream error: %v", err)
 		}
 	}()
+	go syncMgr.ConsumeSyncthingEvents(ctx, syncthingClient.Events())
+	go syncService.RunTransferMonitor(ctx, 2*time.Second, syncMgr.EmitEvent)
+	go peerService.RunPeerMonitor(ctx, syncMgr.EmitEvent)
+	go conflictService.RunConflictScanner(ctx, 5*time.Minute, syncMgr.EmitEvent)
+	snapshotJobs.Start(ctx, syncMgr.EmitEvent)
+	go snapshotScheduler.Run(ctx, syncMgr.EmitEvent)
+	if fileIndex != nil {
+		go fileIndex.Run(ctx)
+	}
+	if cfg.AutoAcceptPending {
+		go pendingService.RunAutoAccept(ctx, time.Minute, syncMgr.EmitEvent)
+	}
 
 	// Start Nebula if configured
 	if cfg.NebulaEnabled {
@@ -116,9 +248,13 @@ func main() {
 	logger.Info("Shutdown signal received")
 
 	// Cleanup
+	cancel()
 	syncMgr.Stop()
 	nebulaMgr.Stop()
 	wsServer.Stop()
+	if syncthingSupervisor != nil {
+		syncthingSupervisor.Stop()
+	}
 
 	logger.Info("Vidsync Agent stopped")
 }
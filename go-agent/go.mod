@@ -8,4 +8,4 @@ require (
 	github.com/mattn/go-sqlite3 v1.14.32
 )
 
-require github.com/gorilla/websocket v1.5.3 // indirect
+require github.com/gorilla/websocket v1.5.3
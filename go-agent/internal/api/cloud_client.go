@@ -2,20 +2,55 @@ package api
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
 	"net/http"
+	"strings"
+	"sync"
 	"time"
 )
 
+// ErrNotFound is returned by Download when the file doesn't exist in storage
+var ErrNotFound = errors.New("not found in cloud storage")
+
+// CodeDeltaBaseMismatch is the error code of a delta snapshot whose base is no longer the project's snapshot
+const CodeDeltaBaseMismatch = "DELTA_BASE_MISMATCH"
+
+// StatusError is a non-2xx response from the Cloud API
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("cloud API error: %d - %s", e.StatusCode, e.Body)
+}
+
+// Code returns the machine-readable "code" of a JSON error body, or "" without one
+func (e *StatusError) Code() string {
+	var body struct {
+		Code string `json:"code"`
+	}
+	if json.Unmarshal([]byte(e.Body), &body) != nil {
+		return ""
+	}
+	return body.Code
+}
+
 // CloudClient is an HTTP client for Cloud API
 type CloudClient struct {
 	baseURL string
 	apiKey  string
 	client  *http.Client
 	logger  interface{} // For compatibility, can be nil
+
+	tokenMu      sync.RWMutex
+	sessionToken string // Latest user access token, for background work without a request
 }
 
 // NewCloudClient creates a new Cloud API client
@@ -34,6 +69,41 @@ func (cc *CloudClient) GetBaseURL() string {
 	return cc.baseURL
 }
 
+// SetSessionToken remembers the signed-in user's access token
+// Background tasks use it to call user-scoped cloud endpoints
+func (cc *CloudClient) SetSessionToken(token string) {
+	cc.tokenMu.Lock()
+	defer cc.tokenMu.Unlock()
+	cc.sessionToken = token
+}
+
+// SessionToken returns the latest user access token, or "" if none has been seen
+func (cc *CloudClient) SessionToken() string {
+	cc.tokenMu.RLock()
+	defer cc.tokenMu.RUnlock()
+	return cc.sessionToken
+}
+
+// TokenUserID returns the user an access token was issued to, or "" if it can't be read
+// The token is not verified; the cloud still checks it on every call
+func TokenUserID(token string) string {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return ""
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return ""
+	}
+	var claims struct {
+		Sub string `json:"sub"`
+	}
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return ""
+	}
+	return claims.Sub
+}
+
 // RegisterDevice registers device with cloud
 func (cc *CloudClient) RegisterDevice(deviceID, deviceName, platform string) (map[string]interface{}, error) {
 	payload := map[string]interface{}{
@@ -81,6 +151,149 @@ func (cc *CloudClient) ListProjects() ([]map[string]interface{}, error) {
 	return projectList, nil
 }
 
+// ListProjectIDsWithAuth lists IDs of projects the user owns or is an accepted member of
+func (cc *CloudClient) ListProjectIDsWithAuth(bearerToken string) ([]string, error) {
+	result, err := cc.GetWithAuth("/projects", bearerToken)
+	if err != nil {
+		return nil, err
+	}
+
+	projects, ok := result["projects"].([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("invalid projects response")
+	}
+
+	var ids []string
+	for _, p := range projects {
+		if pm, ok := p.(map[string]interface{}); ok {
+			if id, ok := pm["id"].(string); ok && id != "" {
+				ids = append(ids, id)
+			}
+		}
+	}
+
+	return ids, nil
+}
+
+// MemberDevice is a Syncthing device belonging to a project owner or member
+type MemberDevice struct {
+	SyncthingID string `json:"syncthingId"`
+	UserID      string `json:"userId"`
+	DeviceName  string `json:"deviceName"`
+	Role        string `json:"role"` // owner or the member's role
+}
+
+// ProjectMemberDevices is the device membership of a project
+type ProjectMemberDevices struct {
+	ProjectID    string         `json:"projectId"`
+	ProjectName  string         `json:"projectName"`
+	Role         string         `json:"role"`         // Role of the signed-in user
+	DownloadPath string         `json:"downloadPath"` // May start with "~"
+	Devices      []MemberDevice `json:"devices"`
+}
+
+// GetProjectMemberDevices gets the Syncthing devices of a project's owner and accepted members
+func (cc *CloudClient) GetProjectMemberDevices(projectID, bearerToken string) (*ProjectMemberDevices, error) {
+	result, err := cc.GetWithAuth(fmt.Sprintf("/projects/%s/member-devices", projectID), bearerToken)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+
+	var members ProjectMemberDevices
+	if err := json.Unmarshal(data, &members); err != nil {
+		return nil, fmt.Errorf("invalid member devices response: %w", err)
+	}
+
+	return &members, nil
+}
+
+// GetProjectSnapshotURL gets the URL of a project's current snapshot, "" if it has none
+func (cc *CloudClient) GetProjectSnapshotURL(projectID, bearerToken string) (string, error) {
+	result, err := cc.GetWithAuth(fmt.Sprintf("/projects/%s", projectID), bearerToken)
+	if err != nil {
+		return "", err
+	}
+	project, _ := result["project"].(map[string]interface{})
+	snapshotURL, _ := project["snapshot_url"].(string)
+	return snapshotURL, nil
+}
+
+// Error codes of signing key responses
+const (
+	CodeSigningKeyMismatch      = "SIGNING_KEY_MISMATCH"
+	CodeSigningKeyNotRegistered = "SIGNING_KEY_NOT_REGISTERED"
+)
+
+// SigningKey is the owner device key a project's snapshots must be signed with
+type SigningKey struct {
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"publicKey"` // Base64
+	DeviceID  string `json:"deviceId,omitempty"`
+}
+
+// RegisterSigningKey registers the owner device's snapshot signing key for a project
+// A different registered key is only replaced with replace set; otherwise the cloud answers 409 SIGNING_KEY_MISMATCH
+func (cc *CloudClient) RegisterSigningKey(projectID string, key SigningKey, replace bool, bearerToken string) error {
+	return cc.PutWithAuth(fmt.Sprintf("/projects/%s/signing-key", projectID), map[string]interface{}{
+		"algorithm": key.Algorithm,
+		"publicKey": key.PublicKey,
+		"deviceId":  key.DeviceID,
+		"replace":   replace,
+	}, bearerToken)
+}
+
+// GetSigningKey gets the key a project's snapshots must be signed with, nil if the owner registered none
+func (cc *CloudClient) GetSigningKey(projectID, bearerToken string) (*SigningKey, error) {
+	result, err := cc.GetWithAuth(fmt.Sprintf("/projects/%s/signing-key", projectID), bearerToken)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.Code() == CodeSigningKeyNotRegistered {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		return nil, err
+	}
+	var key SigningKey
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, fmt.Errorf("invalid signing key response: %w", err)
+	}
+	return &key, nil
+}
+
+// Download opens a file in cloud storage by its public URL
+// The caller closes the returned body; there is no overall timeout, so large snapshots can stream
+func (cc *CloudClient) Download(ctx context.Context, fileURL string) (io.ReadCloser, error) {
+	fmt.Printf("[CloudClient] DOWNLOAD %s\n", fileURL)
+	req, err := http.NewRequestWithContext(ctx, "GET", fileURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	client := &http.Client{Transport: cc.client.Transport}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		resp.Body.Close()
+		// Storage answers 400 for missing objects under public URLs
+		if resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusBadRequest {
+			return nil, ErrNotFound
+		}
+		return nil, fmt.Errorf("cloud storage error: %d", resp.StatusCode)
+	}
+	return resp.Body, nil
+}
+
 // CreateProject creates a new project
 func (cc *CloudClient) CreateProject(name, description string) (map[string]interface{}, error) {
 	payload := map[string]interface{}{
@@ -144,60 +357,47 @@ func (cc *CloudClient) PostWithAuth(endpoint string, payload interface{}, bearer
 	return cc.doRequest(req)
 }
 
-// PostMultipartWithAuth sends a multipart form request with Bearer token auth
-// Used for file uploads like snapshots
-// fileFieldName is the form field name for the file (usually "file")
-// fileData is the binary file data
-// formFields are additional form fields (map of field name to value)
-func (cc *CloudClient) PostMultipartWithAuth(endpoint string, fileFieldName string, fileData []byte, formFields map[string]string, bearerToken string) (map[string]interface{}, error) {
-	// Create multipart form
-	body := &bytes.Buffer{}
-	writer := multipart.NewWriter(body)
-
-	// Add file field using CreateFormFile (not CreateFormField)
-	// This properly sets the Content-Disposition header for file uploads
-	part, err := writer.CreateFormFile(fileFieldName, "snapshot.json.gz")
-	if err != nil {
-		return nil, fmt.Errorf("failed to create file form field: %w", err)
-	}
-
-	if _, err := part.Write(fileData); err != nil {
-		return nil, fmt.Errorf("failed to write file data: %w", err)
-	}
-
-	// Add additional form fields
-	for fieldName, fieldValue := range formFields {
-		if err := writer.WriteField(fieldName, fieldValue); err != nil {
-			return nil, fmt.Errorf("failed to write form field %s: %w", fieldName, err)
+// PostMultipartStreamWithAuth sends a multipart form request whose file part is streamed
+// writeFile writes the file contents; the body is produced while it is sent, so it is never held in memory
+// Form fields are written before the file so the server sees them first
+// No overall timeout applies: large uploads run until ctx is cancelled
+func (cc *CloudClient) PostMultipartStreamWithAuth(ctx context.Context, endpoint, fileFieldName, fileName string, formFields map[string]string, writeFile func(io.Writer) error, bearerToken string) (map[string]interface{}, error) {
+	pr, pw := io.Pipe()
+	writer := multipart.NewWriter(pw)
+
+	go func() {
+		for fieldName, fieldValue := range formFields {
+			if err := writer.WriteField(fieldName, fieldValue); err != nil {
+				pw.CloseWithError(fmt.Errorf("failed to write form field %s: %w", fieldName, err))
+				return
+			}
 		}
-	}
 
-	// Close multipart writer to finalize the body
-	if err := writer.Close(); err != nil {
-		return nil, fmt.Errorf("failed to close multipart writer: %w", err)
-	}
+		part, err := writer.CreateFormFile(fileFieldName, fileName)
+		if err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to create file form field: %w", err))
+			return
+		}
+		if err := writeFile(part); err != nil {
+			pw.CloseWithError(fmt.Errorf("failed to write file data: %w", err))
+			return
+		}
+		pw.CloseWithError(writer.Close())
+	}()
 
-	fmt.Printf("[CloudClient] POST %s (multipart)\n", endpoint)
-	fmt.Printf("[CloudClient] File field: %s (%d bytes)\n", fileFieldName, len(fileData))
+	fmt.Printf("[CloudClient] POST %s (streamed multipart)\n", endpoint)
 	fmt.Printf("[CloudClient] Form fields: %v\n", formFields)
-	tokenPreview := bearerToken
-	if len(bearerToken) > 20 {
-		tokenPreview = bearerToken[:20] + "..."
-	}
-	fmt.Printf("[CloudClient] Authorization: Bearer %s\n", tokenPreview)
 
-	req, err := http.NewRequest("POST", cc.baseURL+endpoint, body)
+	req, err := http.NewRequestWithContext(ctx, "POST", cc.baseURL+endpoint, pr)
 	if err != nil {
+		pr.Close()
 		return nil, err
 	}
-
-	// Set Bearer token
 	req.Header.Set("Authorization", "Bearer "+bearerToken)
-
-	// Set Content-Type to multipart/form-data with boundary
 	req.Header.Set("Content-Type", writer.FormDataContentType())
 
-	return cc.doRequest(req)
+	// Same transport, but without the client's request timeout
+	return cc.doRequestWith(&http.Client{Transport: cc.client.Transport}, req)
 }
 
 // PutWithAuth updates a resource with Bearer token auth
@@ -227,6 +427,22 @@ func (cc *CloudClient) PutWithAuth(endpoint string, payload interface{}, bearerT
 	return err
 }
 
+// GetWithAuth gets a resource with Bearer token auth
+// Falls back to the API key when bearerToken is empty
+func (cc *CloudClient) GetWithAuth(endpoint, bearerToken string) (map[string]interface{}, error) {
+	fmt.Printf("[CloudClient] GET %s\n", endpoint)
+	req, err := http.NewRequest("GET", cc.baseURL+endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+bearerToken)
+	}
+
+	return cc.doRequest(req)
+}
+
 // min returns the minimum of two integers
 func min(a, b int) int {
 	if a < b {
@@ -246,6 +462,11 @@ func (cc *CloudClient) get(endpoint string) (map[string]interface{}, error) {
 }
 
 func (cc *CloudClient) doRequest(req *http.Request) (map[string]interface{}, error) {
+	return cc.doRequestWith(cc.client, req)
+}
+
+// doRequestWith executes a request with the given HTTP client
+func (cc *CloudClient) doRequestWith(client *http.Client, req *http.Request) (map[string]interface{}, error) {
 	// Only set API key if Authorization header is not already set
 	// (PostWithAuth/PutWithAuth set their own Bearer token)
 	if req.Header.Get("Authorization") == "" {
@@ -257,7 +478,7 @@ func (cc *CloudClient) doRequest(req *http.Request) (map[string]interface{}, err
 
 	fmt.Printf("[CloudClient] Request: %s %s\n", req.Method, req.URL.String())
 
-	resp, err := cc.client.Do(req)
+	resp, err := client.Do(req)
 	if err != nil {
 		fmt.Printf("[CloudClient] ✗ Request error: %v\n", err)
 		return nil, err
@@ -275,7 +496,7 @@ func (cc *CloudClient) doRequest(req *http.Request) (map[string]interface{}, err
 
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		fmt.Printf("[CloudClient] ✗ API error: %d - %s\n", resp.StatusCode, string(body))
-		return nil, fmt.Errorf("cloud API error: %d - %s", resp.StatusCode, string(body))
+		return nil, &StatusError{StatusCode: resp.StatusCode, Body: string(body)}
 	}
 
 	fmt.Printf("[CloudClient] ✓ API success: %d\n", resp.StatusCode)
@@ -0,0 +1,302 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// ErrResumableUnsupported is returned when the cloud has no resumable upload endpoints
+var ErrResumableUnsupported = errors.New("cloud does not support resumable uploads")
+
+// Error codes of upload conflicts that resuming resolves
+const (
+	CodePartOutOfOrder   = "PART_OUT_OF_ORDER" // A part that isn't the next one the cloud expects
+	CodeUploadIncomplete = "UPLOAD_INCOMPLETE" // A commit before every part is stored
+)
+
+// DefaultUploadPartSize is the part size asked for when none is set
+const DefaultUploadPartSize = 8 << 20
+
+const (
+	uploadPartTimeout = 5 * time.Minute // Per part, so a stalled connection is noticed without capping the whole upload
+	uploadPartRetries = 8               // Consecutive failed attempts before the upload gives up
+	uploadBackoff     = 2 * time.Second
+	uploadMaxBackoff  = 30 * time.Second
+)
+
+// UploadSession is a resumable upload open on the cloud
+type UploadSession struct {
+	ID       string `json:"uploadId"`
+	Size     int64  `json:"size"`
+	PartSize int64  `json:"partSize"`
+	Offset   int64  `json:"offset"` // Bytes the cloud has stored, a whole number of parts until complete
+}
+
+// ResumableUpload sends a file in fixed-size parts, each with its SHA-256, and resumes
+// from the offset the cloud reports after a dropped connection
+// Uploading the same ResumableUpload again continues its session instead of starting over
+type ResumableUpload struct {
+	Endpoint string            // Single-request upload endpoint; sessions live under Endpoint + "/uploads"
+	FileName string            // Name the file would have in a multipart upload
+	Fields   map[string]string // Form fields the single-request endpoint takes
+	PartSize int64             // Requested part size, 0 for DefaultUploadPartSize; the cloud may pick another
+	Progress func(n int64)     // Bytes sent, negative when sent bytes were lost and must be sent again
+
+	checksum string
+	session  *UploadSession
+	reported int64 // Bytes passed to Progress so far
+}
+
+// Upload sends size bytes of file and commits them, returning the commit response
+// Returns ErrResumableUnsupported if the cloud lacks the upload endpoints
+func (cc *CloudClient) Upload(ctx context.Context, up *ResumableUpload, file io.ReaderAt, size int64, bearerToken string) (map[string]interface{}, error) {
+	if up.checksum == "" {
+		hash := sha256.New()
+		if _, err := io.Copy(hash, io.NewSectionReader(file, 0, size)); err != nil {
+			return nil, fmt.Errorf("failed to checksum upload: %w", err)
+		}
+		up.checksum = hex.EncodeToString(hash.Sum(nil))
+	}
+
+	// Start by syncing with the cloud: a session left by an earlier call may have more stored than we know
+	resync := true
+	failures := 0
+	for {
+		var err error
+		switch {
+		case resync || up.session == nil:
+			err = cc.openUpload(ctx, up, size, bearerToken)
+		case up.session.Offset < size:
+			err = cc.sendPart(ctx, up, file, size, bearerToken)
+		}
+		if err == nil {
+			if !resync && up.session.Offset >= size {
+				break
+			}
+			resync = false
+			failures = 0
+			continue
+		}
+
+		if errors.Is(err, ErrResumableUnsupported) || ctx.Err() != nil || !isRetryableUploadError(err) {
+			return nil, err
+		}
+		failures++
+		if failures >= uploadPartRetries {
+			return nil, fmt.Errorf("upload failed %d times in a row: %w", failures, err)
+		}
+		backoff := uploadBackoff * time.Duration(1<<uint(failures-1))
+		if backoff > uploadMaxBackoff {
+			backoff = uploadMaxBackoff
+		}
+		fmt.Printf("[CloudClient] Upload to %s interrupted, resuming in %v: %v\n", up.Endpoint, backoff, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		// The last part may have been stored before the connection dropped: carry on from what the cloud has
+		resync = true
+	}
+
+	endpoint := fmt.Sprintf("%s/uploads/%s/commit", up.Endpoint, up.session.ID)
+	result, err := cc.uploadRequest(ctx, "POST", endpoint, nil, "", bearerToken)
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode < 500 {
+		up.session = nil // Rejected or expired: a retry needs a new session
+	}
+	return result, err
+}
+
+// AbortUpload drops an unfinished upload's session and the parts the cloud holds for it
+func (cc *CloudClient) AbortUpload(ctx context.Context, up *ResumableUpload, bearerToken string) error {
+	if up.session == nil {
+		return nil
+	}
+	endpoint := fmt.Sprintf("%s/uploads/%s", up.Endpoint, up.session.ID)
+	up.session = nil
+	_, err := cc.uploadRequest(ctx, "DELETE", endpoint, nil, "", bearerToken)
+	return err
+}
+
+// openUpload refreshes the offset of the upload's session, or creates a session if it has none or it expired
+func (cc *CloudClient) openUpload(ctx context.Context, up *ResumableUpload, size int64, bearerToken string) error {
+	if up.session != nil {
+		endpoint := fmt.Sprintf("%s/uploads/%s", up.Endpoint, up.session.ID)
+		result, err := cc.uploadRequest(ctx, "GET", endpoint, nil, "", bearerToken)
+		var statusErr *StatusError
+		switch {
+		case err == nil:
+			return up.update(result, size)
+		case errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound:
+			up.session = nil
+		default:
+			return err
+		}
+	}
+
+	partSize := up.PartSize
+	if partSize <= 0 {
+		partSize = DefaultUploadPartSize
+	}
+	payload, err := json.Marshal(map[string]interface{}{
+		"fileName": up.FileName,
+		"size":     size,
+		"partSize": partSize,
+		"checksum": up.checksum,
+		"fields":   up.Fields,
+	})
+	if err != nil {
+		return err
+	}
+
+	result, err := cc.uploadRequest(ctx, "POST", up.Endpoint+"/uploads", payload, "application/json", bearerToken)
+	// Cloud routes answer with a JSON error; an unknown route gets Express's HTML 404 page
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound && !strings.Contains(statusErr.Body, `"error"`) {
+		return ErrResumableUnsupported
+	}
+	if err != nil {
+		return err
+	}
+	return up.update(result, size)
+}
+
+// sendPart sends the part at the session's offset with its checksum, counting its bytes as they go out
+func (cc *CloudClient) sendPart(ctx context.Context, up *ResumableUpload, file io.ReaderAt, size int64, bearerToken string) error {
+	part := up.session.Offset / up.session.PartSize
+	data := make([]byte, min64(up.session.PartSize, size-up.session.Offset))
+	if _, err := file.ReadAt(data, up.session.Offset); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("failed to read part %d: %w", part, err)
+	}
+
+	sum := sha256.Sum256(data)
+	endpoint := fmt.Sprintf("%s/uploads/%s/parts/%d", up.Endpoint, up.session.ID, part)
+
+	ctx, cancel := context.WithTimeout(ctx, uploadPartTimeout)
+	defer cancel()
+
+	body := &progressReader{r: bytes.NewReader(data), add: up.add}
+	req, err := http.NewRequestWithContext(ctx, "PUT", cc.baseURL+endpoint, body)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = int64(len(data))
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("X-Checksum-Sha256", hex.EncodeToString(sum[:]))
+	req.Header.Set("Authorization", "Bearer "+bearerToken)
+
+	result, err := cc.doRequestWith(&http.Client{Transport: cc.client.Transport}, req)
+	if err != nil {
+		return err
+	}
+	return up.update(result, size)
+}
+
+// uploadRequest sends a session request without the client's overall timeout
+func (cc *CloudClient) uploadRequest(ctx context.Context, method, endpoint string, payload []byte, contentType, bearerToken string) (map[string]interface{}, error) {
+	var body io.Reader
+	if payload != nil {
+		body = bytes.NewReader(payload)
+	}
+	ctx, cancel := context.WithTimeout(ctx, uploadPartTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, method, cc.baseURL+endpoint, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	req.Header.Set("Authorization", "Bearer "+bearerToken)
+
+	return cc.doRequestWith(&http.Client{Transport: cc.client.Transport}, req)
+}
+
+// update takes the session state from a cloud response and reports progress against it
+func (up *ResumableUpload) update(result map[string]interface{}, size int64) error {
+	data, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	var session UploadSession
+	if err := json.Unmarshal(data, &session); err != nil {
+		return fmt.Errorf("invalid upload session response: %w", err)
+	}
+	if session.ID == "" || session.PartSize <= 0 || session.Size != size || session.Offset < 0 || session.Offset > size {
+		return fmt.Errorf("invalid upload session response")
+	}
+	up.session = &session
+	up.report(session.Offset)
+	return nil
+}
+
+// add counts bytes as they are sent
+func (up *ResumableUpload) add(n int64) {
+	atomic.AddInt64(&up.reported, n)
+	if up.Progress != nil {
+		up.Progress(n)
+	}
+}
+
+// report brings the bytes reported to Progress in line with what the cloud has stored
+func (up *ResumableUpload) report(stored int64) {
+	up.add(stored - atomic.LoadInt64(&up.reported))
+}
+
+// isRetryableUploadError reports whether a failed request may succeed when resumed:
+// network errors, timeouts, 5xx, 408/422/429 (a damaged part is re-sent), and 409 for a part out of order;
+// other conflicts, e.g. a delta whose base is no longer current, and local failures are final
+func isRetryableUploadError(err error) bool {
+	var statusErr *StatusError
+	if errors.As(err, &statusErr) {
+		switch statusErr.StatusCode {
+		case http.StatusRequestTimeout, http.StatusUnprocessableEntity, http.StatusTooManyRequests:
+			return true
+		case http.StatusConflict:
+			code := statusErr.Code()
+			return code == CodePartOutOfOrder || code == CodeUploadIncomplete
+		}
+		return statusErr.StatusCode >= 500
+	}
+
+	// A response cut off mid-body is a dropped connection too
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// progressReader calls add with the bytes read through it
+type progressReader struct {
+	r   io.Reader
+	add func(n int64)
+}
+
+func (pr *progressReader) Read(p []byte) (int, error) {
+	n, err := pr.r.Read(p)
+	if n > 0 {
+		pr.add(int64(n))
+	}
+	return n, err
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+func TestIsRetryableUploadError(t *testing.T) {
+	status := func(code int, body string) error {
+		return &StatusError{StatusCode: code, Body: body}
+	}
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"server error", status(http.StatusInternalServerError, `{"error":"boom"}`), true},
+		{"unavailable", status(http.StatusServiceUnavailable, ""), true},
+		{"request timeout", status(http.StatusRequestTimeout, ""), true},
+		{"damaged part", status(http.StatusUnprocessableEntity, `{"error":"Part checksum mismatch"}`), true},
+		{"rate limited", status(http.StatusTooManyRequests, ""), true},
+		{"part out of order", status(http.StatusConflict, `{"error":"Part out of order","code":"PART_OUT_OF_ORDER"}`), true},
+		{"commit too early", status(http.StatusConflict, `{"error":"Upload is incomplete","code":"UPLOAD_INCOMPLETE"}`), true},
+		{"delta base moved", status(http.StatusConflict, `{"error":"Delta base is not the current snapshot","code":"DELTA_BASE_MISMATCH"}`), false},
+		{"conflict without a code", status(http.StatusConflict, `{"error":"Part out of order"}`), false},
+		{"bad request", status(http.StatusBadRequest, ""), false},
+		{"forbidden", status(http.StatusForbidden, ""), false},
+		{"wrapped status", fmt.Errorf("commit: %w", status(http.StatusBadGateway, "")), true},
+		{"dropped connection", &url.Error{Op: "Put", URL: "http://cloud", Err: io.EOF}, true},
+		{"refused", &net.OpError{Op: "dial", Net: "tcp", Err: os.ErrDeadlineExceeded}, true},
+		{"part timeout", fmt.Errorf("send: %w", context.DeadlineExceeded), true},
+		{"truncated response", io.ErrUnexpectedEOF, true},
+		{"local read failure", fmt.Errorf("failed to read part 3: %w", os.ErrPermission), false},
+		{"malformed session", errors.New("invalid upload session response"), false},
+		{"cancelled", context.Canceled, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRetryableUploadError(tt.err); got != tt.want {
+				t.Errorf("isRetryableUploadError(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeUploads serves the cloud's resumable upload endpoints for one project
+type fakeUploads struct {
+	t *testing.T
+
+	mu        sync.Mutex
+	fail      map[string]int // Request ("part 1", "commit") -> status to answer with once, -1 to store and drop the connection
+	sessions  map[string]*fakeSession
+	partPuts  int
+	commits   int
+	committed []byte
+}
+
+type fakeSession struct {
+	id, checksum   string
+	size, partSize int64
+	data           []byte
+	result         map[string]interface{}
+}
+
+func (f *fakeUploads) status(s *fakeSession) map[string]interface{} {
+	return map[string]interface{}{"uploadId": s.id, "size": s.size, "partSize": s.partSize, "offset": len(s.data)}
+}
+
+func (f *fakeUploads) handler() http.Handler {
+	mux := http.NewServeMux()
+	reply := func(w http.ResponseWriter, code int, body map[string]interface{}) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		json.NewEncoder(w).Encode(body)
+	}
+	// failOnce answers with the injected status for a request; false lets the request through
+	failOnce := func(w http.ResponseWriter, request string, store func()) bool {
+		code, ok := f.fail[request]
+		if !ok {
+			return false
+		}
+		delete(f.fail, request)
+		if code >= 0 {
+			reply(w, code, map[string]interface{}{"error": "injected", "code": "INJECTED"})
+			return true
+		}
+		store()
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			f.t.Fatalf("hijack: %v", err)
+		}
+		conn.Close()
+		return true
+	}
+
+	mux.HandleFunc("POST /projects/p/snapshot/uploads", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		var req struct {
+			Size     int64  `json:"size"`
+			PartSize int64  `json:"partSize"`
+			Checksum string `json:"checksum"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		s := &fakeSession{id: fmt.Sprintf("upload-%d", len(f.sessions)), checksum: req.Checksum, size: req.Size, partSize: req.PartSize}
+		f.sessions[s.id] = s
+		reply(w, http.StatusCreated, f.status(s))
+	})
+	mux.HandleFunc("GET /projects/p/snapshot/uploads/{id}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		s, ok := f.sessions[r.PathValue("id")]
+		if !ok {
+			reply(w, http.StatusNotFound, map[string]interface{}{"error": "Upload not found"})
+			return
+		}
+		reply(w, http.StatusOK, f.status(s))
+	})
+	mux.HandleFunc("PUT /projects/p/snapshot/uploads/{id}/parts/{n}", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		s, ok := f.sessions[r.PathValue("id")]
+		if !ok {
+			reply(w, http.StatusNotFound, map[string]interface{}{"error": "Upload not found"})
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		f.partPuts++
+		n, _ := strconv.ParseInt(r.PathValue("n"), 10, 64)
+		if n*s.partSize < int64(len(s.data)) {
+			reply(w, http.StatusOK, f.status(s))
+			return
+		}
+		if n*s.partSize != int64(len(s.data)) {
+			reply(w, http.StatusConflict, map[string]interface{}{"error": "Part out of order", "code": CodePartOutOfOrder})
+			return
+		}
+		sum := sha256.Sum256(data)
+		if hex.EncodeToString(sum[:]) != r.Header.Get("X-Checksum-Sha256") {
+			reply(w, http.StatusUnprocessableEntity, map[string]interface{}{"error": "Part checksum mismatch"})
+			return
+		}
+		if failOnce(w, "part "+r.PathValue("n"), func() { s.data = append(s.data, data...) }) {
+			return
+		}
+		s.data = append(s.data, data...)
+		reply(w, http.StatusOK, f.status(s))
+	})
+	mux.HandleFunc("POST /projects/p/snapshot/uploads/{id}/commit", func(w http.ResponseWriter, r *http.Request) {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		s, ok := f.sessions[r.PathValue("id")]
+		if !ok {
+			reply(w, http.StatusNotFound, map[string]interface{}{"error": "Upload not found"})
+			return
+		}
+		f.commits++
+		if s.result != nil {
+			reply(w, http.StatusOK, s.result)
+			return
+		}
+		if int64(len(s.data)) != s.size {
+			reply(w, http.StatusConflict, map[string]interface{}{"error": "Upload is incomplete", "code": CodeUploadIncomplete})
+			return
+		}
+		commit := func() {
+			f.committed = s.data
+			s.result = map[string]interface{}{"ok": true, "snapshotUrl": "https://storage/" + s.id}
+		}
+		if failOnce(w, "commit", commit) {
+			return
+		}
+		commit()
+		reply(w, http.StatusOK, s.result)
+	})
+	return mux
+}
+
+func TestUploadResumes(t *testing.T) {
+	file := []byte("0123456789") // Parts of 4, 4 and 2 bytes
+
+	tests := []struct {
+		name     string
+		fail     map[string]int
+		calls    int // Upload calls until it succeeds
+		partPuts int
+		wantErr  bool
+	}{
+		{name: "in one go", calls: 1, partPuts: 3},
+		{name: "response to a stored part lost", fail: map[string]int{"part 1": -1}, calls: 1, partPuts: 3},
+		{name: "server error on a part", fail: map[string]int{"part 2": http.StatusServiceUnavailable}, calls: 1, partPuts: 4},
+		{name: "response to the commit lost", fail: map[string]int{"commit": -1}, calls: 2, partPuts: 3},
+		{name: "part refused", fail: map[string]int{"part 0": http.StatusBadRequest}, calls: 1, partPuts: 1, wantErr: true},
+		{name: "commit conflict", fail: map[string]int{"commit": http.StatusConflict}, calls: 1, partPuts: 3, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.fail == nil {
+				tt.fail = map[string]int{}
+			}
+			fake := &fakeUploads{t: t, fail: tt.fail, sessions: map[string]*fakeSession{}}
+			server := httptest.NewServer(fake.handler())
+			defer server.Close()
+
+			cc := NewCloudClient(server.URL, "key")
+			var progress int64
+			up := &ResumableUpload{
+				Endpoint: "/projects/p/snapshot",
+				FileName: "snapshot.json.gz",
+				PartSize: 4,
+				Progress: func(n int64) { progress += n },
+			}
+
+			var result map[string]interface{}
+			var err error
+			for call := 1; call <= tt.calls; call++ {
+				result, err = cc.Upload(context.Background(), up, bytes.NewReader(file), int64(len(file)), "token")
+				if err == nil && call < tt.calls {
+					t.Fatalf("Upload call %d succeeded, expected it to fail", call)
+				}
+			}
+
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Upload = %v, want an error", result)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("Upload: %v", err)
+				}
+				if result["snapshotUrl"] != "https://storage/upload-0" {
+					t.Errorf("snapshotUrl = %v, want the one of the only session", result["snapshotUrl"])
+				}
+				if !bytes.Equal(fake.committed, file) {
+					t.Errorf("committed %q, want %q", fake.committed, file)
+				}
+				if progress != int64(len(file)) {
+					t.Errorf("progress = %d, want %d", progress, len(file))
+				}
+			}
+			if len(fake.sessions) != 1 {
+				t.Errorf("%d sessions opened, want 1", len(fake.sessions))
+			}
+			if fake.partPuts != tt.partPuts {
+				t.Errorf("%d parts sent, want %d", fake.partPuts, tt.partPuts)
+			}
+		})
+	}
+}
+
+func TestUploadUnsupported(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	up := &ResumableUpload{Endpoint: "/projects/p/snapshot", FileName: "snapshot.json.gz"}
+	_, err := NewCloudClient(server.URL, "key").Upload(context.Background(), up, bytes.NewReader([]byte("x")), 1, "token")
+	if !errors.Is(err, ErrResumableUnsupported) {
+		t.Errorf("Upload to a cloud without upload endpoints = %v, want ErrResumableUnsupported", err)
+	}
+}
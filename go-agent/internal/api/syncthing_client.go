@@ -6,16 +6,26 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"sync"
 	"time"
+
+	"github.com/vidsync/agent/internal/ignore"
+	"github.com/vidsync/agent/internal/media"
+	"github.com/vidsync/agent/internal/sequence"
 )
 
 // SyncthingClient is an HTTP client for Syncthing API
 type SyncthingClient struct {
-	baseURL string
-	apiKey  string
-	client  *http.Client
+	baseURL      string
+	apiKey       string
+	client       *http.Client
+	streamClient *http.Client // No timeout, used for long-polling /rest/events
+	events       *EventStream
+	eventsOnce   sync.Once
 }
 
 // NewSyncthingClient creates a new Syncthing API client
@@ -27,52 +37,68 @@ func NewSyncthingClient(baseURL, apiKey string) *SyncthingClient {
 			Timeout: 10 * time.Second,
 			Jar:     nil, // Explicitly disable cookie jar to prevent automatic cookie sending
 		},
+		streamClient: &http.Client{},
 	}
 }
 
 // AddFolder adds a folder to Syncthing
-func (sc *SyncthingClient) AddFolder(folderID, folderLabel, folderPath string) error {
-	// Syncthing API only requires id and path for folder creation
-	// Other fields like label, type, etc. can be added/modified separately if needed
-	payload := map[string]interface{}{
-		"id":   folderID,
-		"path": folderPath,
+// Starts from Syncthing's folder defaults so new fields get their proper values
+// A nil versioning keeps Syncthing's folder defaults
+func (sc *SyncthingClient) AddFolder(folderID, folderLabel, folderPath string, versioning *VersioningConfig) error {
+	if _, err := sc.GetFolder(folderID); err == nil {
+		return fmt.Errorf("folder %s already exists", folderID)
+	}
+
+	folder, err := sc.GetDefaultFolder()
+	if err != nil {
+		return fmt.Errorf("failed to get folder defaults: %w", err)
+	}
+
+	folder.ID = folderID
+	folder.Label = folderLabel
+	folder.Path = folderPath
+	if versioning != nil {
+		folder.Versioning.Type = versioning.Type
+		folder.Versioning.Params = versioning.Params
+		folder.Versioning.CleanupIntervalS = versioning.CleanupIntervalS
 	}
 
-	fmt.Printf("[SyncthingClient] AddFolder payload: id=%s, path=%s\n", folderID, folderPath)
-	return sc.postConfig("folders", payload)
+	fmt.Printf("[SyncthingClient] AddFolder: id=%s, label=%s, path=%s\n", folderID, folderLabel, folderPath)
+	return sc.CreateFolder(folder)
 }
 
 // AddFolderReceiveOnly adds a folder to Syncthing with receiveonly type
 // This is used when an invitee device joins a shared folder
 // The invitee can only RECEIVE files, not send them back
 func (sc *SyncthingClient) AddFolderReceiveOnly(folderID, folderLabel, folderPath string, ownerDeviceID string) error {
-	payload := map[string]interface{}{
-		"id":    folderID,
-		"label": folderLabel,
-		"path":  folderPath,
-		"type":  "receiveonly", // ← KEY: Receive-only prevents uploads
-		"devices": []map[string]string{
-			{
-				"deviceID": ownerDeviceID,
-			},
-		},
-		"autoNormalize":   true,
-		"rescanIntervalS": 3600,
+	folder, err := sc.GetDefaultFolder()
+	if err != nil {
+		return fmt.Errorf("failed to get folder defaults: %w", err)
 	}
 
-	return sc.postConfig("folders", payload)
+	folder.ID = folderID
+	folder.Label = folderLabel
+	folder.Path = folderPath
+	folder.Type = "receiveonly" // ← KEY: Receive-only prevents uploads
+	folder.Devices = append(folder.Devices, FolderDeviceConfig{DeviceID: ownerDeviceID})
+	folder.AutoNormalize = true
+	folder.RescanIntervalS = 3600
+
+	return sc.CreateFolder(folder)
 }
 
 // AddDevice adds a device to Syncthing
 func (sc *SyncthingClient) AddDevice(deviceID, deviceName string) error {
-	payload := map[string]interface{}{
-		"deviceID":  deviceID,
-		"name":      deviceName,
-		"addresses": []string{"dynamic"},
+	device, err := sc.GetDefaultDevice()
+	if err != nil {
+		return fmt.Errorf("failed to get device defaults: %w", err)
 	}
 
-	return sc.postConfig("devices", payload)
+	device.DeviceID = deviceID
+	device.Name = deviceName
+	device.Addresses = []string{"dynamic"}
+
+	return sc.CreateDevice(device)
 }
 
 // PauseFolder pauses a folder
@@ -90,6 +116,31 @@ func (sc *SyncthingClient) Rescan(folderID string) error {
 	return sc.post(fmt.Sprintf("/rest/db/scan?folder=%s", folderID), nil)
 }
 
+// RescanPaths rescans only the given sub-paths of a folder
+func (sc *SyncthingClient) RescanPaths(folderID string, paths ...string) error {
+	params := url.Values{}
+	params.Set("folder", folderID)
+	for _, p := range paths {
+		params.Add("sub", p)
+	}
+	return sc.post("/rest/db/scan?"+params.Encode(), nil)
+}
+
+// SetFolderType changes a folder's type: sendreceive, sendonly or receiveonly
+func (sc *SyncthingClient) SetFolderType(folderID, folderType string) error {
+	return sc.PatchFolder(folderID, map[string]interface{}{"type": folderType})
+}
+
+// Override pushes the local state of a send-only folder over remote changes
+func (sc *SyncthingClient) Override(folderID string) error {
+	return sc.post("/rest/db/override?folder="+url.QueryEscape(folderID), nil)
+}
+
+// Revert discards local changes in a receive-only folder
+func (sc *SyncthingClient) Revert(folderID string) error {
+	return sc.post("/rest/db/revert?folder="+url.QueryEscape(folderID), nil)
+}
+
 // GetStatus gets Syncthing status
 func (sc *SyncthingClient) GetStatus() (map[string]interface{}, error) {
 	return sc.get("/rest/system/status")
@@ -100,26 +151,56 @@ func (sc *SyncthingClient) GetFolderStatus(folderID string) (map[string]interfac
 	return sc.get(fmt.Sprintf("/rest/db/status?folder=%s", folderID))
 }
 
-// GetFolderConfig gets folder configuration (includes path)
-func (sc *SyncthingClient) GetFolderConfig(folderID string) (map[string]interface{}, error) {
-	return sc.get(fmt.Sprintf("/rest/config/folders/%s", folderID))
-}
-
 // FileInfo represents file metadata for snapshot
 type FileInfo struct {
-	Name        string    `json:"name"`
-	Path        string    `json:"path"`
-	Size        int64     `json:"size"`
-	IsDirectory bool      `json:"isDirectory"`
-	ModTime     time.Time `json:"modTime"`
-	Hash        string    `json:"hash,omitempty"`
+	Name        string          `json:"name"`
+	Path        string          `json:"path"`
+	Size        int64           `json:"size"`
+	IsDirectory bool            `json:"isDirectory"`
+	ModTime     time.Time       `json:"modTime"`
+	Hash        string          `json:"hash,omitempty"`
+	Media       *media.Metadata `json:"media,omitempty"`    // Video container metadata, for supported clips
+	Sequence    *sequence.Info  `json:"sequence,omitempty"` // Set when the entry stands for a numbered frame sequence
 }
 
 // BrowseFiles returns a hierarchical file tree from a filesystem path
 // Used after Syncthing folder is scanned
-func (sc *SyncthingClient) BrowseFiles(folderPath string, maxDepth int) ([]FileInfo, error) {
+// Paths matched by ignores are skipped; a nil matcher only skips Syncthing's own files
+func (sc *SyncthingClient) BrowseFiles(folderPath string, maxDepth int, ignores *ignore.Matcher) ([]FileInfo, error) {
 	var files []FileInfo
-	err := filepath.Walk(folderPath, func(path string, info os.FileInfo, err error) error {
+	err := sc.WalkFiles(folderPath, maxDepth, ignores, func(f FileInfo) error {
+		files = append(files, f)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+// WalkFiles calls fn for every entry BrowseFiles would return, without collecting them
+// Entries arrive in walk order: the folder itself, then depth-first with names in lexical order
+// An error returned by fn stops the walk and is returned
+func (sc *SyncthingClient) WalkFiles(folderPath string, maxDepth int, ignores *ignore.Matcher, fn func(FileInfo) error) error {
+	return walkFiles(folderPath, folderPath, maxDepth, ignores, fn)
+}
+
+// WalkTree walks the entry at sub, a path relative to folderPath, and everything below it
+// Entries have paths relative to folderPath and arrive in walk order, as in WalkFiles
+// Nothing is visited when sub or a directory above it is ignored, or sub doesn't exist
+func (sc *SyncthingClient) WalkTree(folderPath, sub string, ignores *ignore.Matcher, fn func(FileInfo) error) error {
+	slashSub := filepath.ToSlash(filepath.Clean(sub))
+	for dir := path.Dir(slashSub); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if ignores.SkipDir(dir) {
+			return nil
+		}
+	}
+	return walkFiles(folderPath, filepath.Join(folderPath, sub), 0, ignores, fn)
+}
+
+// walkFiles walks start, which is folderPath or below it, reporting paths relative to folderPath
+func walkFiles(folderPath, start string, maxDepth int, ignores *ignore.Matcher, fn func(FileInfo) error) error {
+	err := filepath.Walk(start, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			return nil // Skip inaccessible files
 		}
@@ -134,22 +215,28 @@ func (sc *SyncthingClient) BrowseFiles(folderPath string, maxDepth int) ([]FileI
 			return nil
 		}
 
-		files = append(files, FileInfo{
+		// Skip ignored paths the same way Syncthing does
+		slashPath := filepath.ToSlash(relPath)
+		if info.IsDir() && ignores.SkipDir(slashPath) {
+			return filepath.SkipDir
+		}
+		if ignores.Match(slashPath) {
+			return nil
+		}
+
+		return fn(FileInfo{
 			Name:        info.Name(),
 			Path:        relPath,
 			Size:        info.Size(),
 			IsDirectory: info.IsDir(),
 			ModTime:     info.ModTime(),
 		})
-
-		return nil
 	})
 
 	if err != nil {
-		return nil, fmt.Errorf("failed to browse files: %w", err)
+		return fmt.Errorf("failed to browse files: %w", err)
 	}
-
-	return files, nil
+	return nil
 }
 
 // RemoveFolder removes a folder from Syncthing
@@ -165,109 +252,38 @@ func (sc *SyncthingClient) RemoveFolder(folderID string) error {
 
 // AddDeviceToFolder adds a device to a folder
 func (sc *SyncthingClient) AddDeviceToFolder(folderID, deviceID string) error {
-	// Get current folder config
-	folderConfig, err := sc.get("/rest/config/folders/" + folderID)
+	folder, err := sc.GetFolder(folderID)
 	if err != nil {
 		return err
 	}
 
-	// Add device to devices list
-	devices, ok := folderConfig["devices"].([]interface{})
-	if !ok {
-		devices = []interface{}{}
-	}
-
-	// Check if device already exists
-	for _, d := range devices {
-		if device, ok := d.(map[string]interface{}); ok {
-			if device["deviceID"] == deviceID {
-				return nil // Device already in folder
-			}
-		}
+	if folder.HasDevice(deviceID) {
+		return nil // Device already in folder
 	}
 
-	// Add new device
-	devices = append(devices, map[string]interface{}{
-		"deviceID": deviceID,
-	})
-	folderConfig["devices"] = devices
-
-	// Update folder config
-	data, err := json.Marshal(folderConfig)
-	if err != nil {
-		return err
-	}
-
-	endpoint := "/rest/config/folders/" + folderID
-	fmt.Printf("[SyncthingClient] PUT %s payload: %s\n", endpoint, string(data))
-	req, err := http.NewRequest("PUT", sc.baseURL+endpoint, bytes.NewBuffer(data))
-	if err != nil {
-		return err
-	}
-
-	return sc.doRequest(req)
+	devices := append(folder.Devices, FolderDeviceConfig{DeviceID: deviceID})
+	return sc.PatchFolder(folderID, map[string]interface{}{"devices": devices})
 }
 
 // RemoveDeviceFromFolder removes a device from a folder
 func (sc *SyncthingClient) RemoveDeviceFromFolder(folderID, deviceID string) error {
-	// Get current folder config
-	folderConfig, err := sc.get("/rest/config/folders/" + folderID)
+	folder, err := sc.GetFolder(folderID)
 	if err != nil {
 		return err
 	}
 
-	// Remove device from devices list
-	devices, ok := folderConfig["devices"].([]interface{})
-	if !ok {
+	if !folder.HasDevice(deviceID) {
 		return nil // No devices to remove
 	}
 
-	// Filter out the device
-	var filteredDevices []interface{}
-	for _, d := range devices {
-		if device, ok := d.(map[string]interface{}); ok {
-			if device["deviceID"] != deviceID {
-				filteredDevices = append(filteredDevices, d)
-			}
-		} else {
-			filteredDevices = append(filteredDevices, d)
+	devices := make([]FolderDeviceConfig, 0, len(folder.Devices))
+	for _, d := range folder.Devices {
+		if d.DeviceID != deviceID {
+			devices = append(devices, d)
 		}
 	}
 
-	folderConfig["devices"] = filteredDevices
-
-	// Update folder config
-	data, err := json.Marshal(folderConfig)
-	if err != nil {
-		return err
-	}
-
-	endpoint := "/rest/config/folders/" + folderID
-	fmt.Printf("[SyncthingClient] PUT %s payload: %s\n", endpoint, string(data))
-	req, err := http.NewRequest("PUT", sc.baseURL+endpoint, bytes.NewBuffer(data))
-	if err != nil {
-		return err
-	}
-
-	return sc.doRequest(req)
-}
-
-func (sc *SyncthingClient) postConfig(endpoint string, payload interface{}) error {
-	data, err := json.Marshal(payload)
-	if err != nil {
-		return err
-	}
-
-	url := sc.baseURL + "/rest/config/" + endpoint
-	fmt.Printf("[SyncthingClient] Calling: POST %s\n", url)
-	fmt.Printf("[SyncthingClient] Payload: %s\n", string(data))
-
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(data))
-	if err != nil {
-		return err
-	}
-
-	return sc.doRequest(req)
+	return sc.PatchFolder(folderID, map[string]interface{}{"devices": devices})
 }
 
 func (sc *SyncthingClient) post(endpoint string, payload interface{}) error {
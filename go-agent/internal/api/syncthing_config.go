@@ -0,0 +1,307 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// FolderConfig is a Syncthing folder configuration
+// Fields this struct doesn't know about are kept and written back unchanged
+type FolderConfig struct {
+	ID               string               `json:"id"`
+	Label            string               `json:"label"`
+	FilesystemType   string               `json:"filesystemType"`
+	Path             string               `json:"path"`
+	Type             string               `json:"type"` // sendreceive, sendonly, receiveonly, receiveencrypted
+	Devices          []FolderDeviceConfig `json:"devices"`
+	RescanIntervalS  int                  `json:"rescanIntervalS"`
+	FSWatcherEnabled bool                 `json:"fsWatcherEnabled"`
+	FSWatcherDelayS  float64              `json:"fsWatcherDelayS"`
+	IgnorePerms      bool                 `json:"ignorePerms"`
+	AutoNormalize    bool                 `json:"autoNormalize"`
+	Versioning       VersioningConfig     `json:"versioning"`
+	Paused           bool                 `json:"paused"`
+	MarkerName       string               `json:"markerName"`
+
+	raw map[string]json.RawMessage
+}
+
+// FolderDeviceConfig is a device entry in a folder's device list
+type FolderDeviceConfig struct {
+	DeviceID     string `json:"deviceID"`
+	IntroducedBy string `json:"introducedBy"`
+
+	raw map[string]json.RawMessage
+}
+
+// VersioningConfig is a folder's file versioning configuration
+type VersioningConfig struct {
+	Type             string            `json:"type"` // "", trashcan, simple, staggered, external
+	Params           map[string]string `json:"params"`
+	CleanupIntervalS int               `json:"cleanupIntervalS"`
+	FSPath           string            `json:"fsPath"`
+	FSType           string            `json:"fsType"`
+
+	raw map[string]json.RawMessage
+}
+
+// DeviceConfig is a Syncthing remote device configuration
+type DeviceConfig struct {
+	DeviceID          string   `json:"deviceID"`
+	Name              string   `json:"name"`
+	Addresses         []string `json:"addresses"`
+	Compression       string   `json:"compression"`
+	Introducer        bool     `json:"introducer"`
+	Paused            bool     `json:"paused"`
+	AutoAcceptFolders bool     `json:"autoAcceptFolders"`
+	MaxSendKbps       int      `json:"maxSendKbps"`
+	MaxRecvKbps       int      `json:"maxRecvKbps"`
+
+	raw map[string]json.RawMessage
+}
+
+// Options is Syncthing's global options section
+type Options struct {
+	ListenAddresses       []string `json:"listenAddresses"`
+	GlobalAnnounceEnabled bool     `json:"globalAnnounceEnabled"`
+	LocalAnnounceEnabled  bool     `json:"localAnnounceEnabled"`
+	RelaysEnabled         bool     `json:"relaysEnabled"`
+	NATEnabled            bool     `json:"natEnabled"`
+	MaxSendKbps           int      `json:"maxSendKbps"`
+	MaxRecvKbps           int      `json:"maxRecvKbps"`
+	StartBrowser          bool     `json:"startBrowser"`
+	URAccepted            int      `json:"urAccepted"`
+	AutoUpgradeIntervalH  int      `json:"autoUpgradeIntervalH"`
+	CrashReportingEnabled bool     `json:"crashReportingEnabled"`
+
+	raw map[string]json.RawMessage
+}
+
+type folderConfigFields FolderConfig
+type folderDeviceConfigFields FolderDeviceConfig
+type versioningConfigFields VersioningConfig
+type deviceConfigFields DeviceConfig
+type optionsFields Options
+
+// MarshalJSON writes known fields over the preserved original document
+func (c FolderConfig) MarshalJSON() ([]byte, error) {
+	return marshalPreserving(folderConfigFields(c), c.raw)
+}
+
+// UnmarshalJSON decodes known fields and keeps the full original document
+func (c *FolderConfig) UnmarshalJSON(data []byte) error {
+	return unmarshalPreserving(data, (*folderConfigFields)(c), &c.raw)
+}
+
+// MarshalJSON writes known fields over the preserved original document
+func (c FolderDeviceConfig) MarshalJSON() ([]byte, error) {
+	return marshalPreserving(folderDeviceConfigFields(c), c.raw)
+}
+
+// UnmarshalJSON decodes known fields and keeps the full original document
+func (c *FolderDeviceConfig) UnmarshalJSON(data []byte) error {
+	return unmarshalPreserving(data, (*folderDeviceConfigFields)(c), &c.raw)
+}
+
+// MarshalJSON writes known fields over the preserved original document
+func (c VersioningConfig) MarshalJSON() ([]byte, error) {
+	return marshalPreserving(versioningConfigFields(c), c.raw)
+}
+
+// UnmarshalJSON decodes known fields and keeps the full original document
+func (c *VersioningConfig) UnmarshalJSON(data []byte) error {
+	return unmarshalPreserving(data, (*versioningConfigFields)(c), &c.raw)
+}
+
+// MarshalJSON writes known fields over the preserved original document
+func (c DeviceConfig) MarshalJSON() ([]byte, error) {
+	return marshalPreserving(deviceConfigFields(c), c.raw)
+}
+
+// UnmarshalJSON decodes known fields and keeps the full original document
+func (c *DeviceConfig) UnmarshalJSON(data []byte) error {
+	return unmarshalPreserving(data, (*deviceConfigFields)(c), &c.raw)
+}
+
+// MarshalJSON writes known fields over the preserved original document
+func (o Options) MarshalJSON() ([]byte, error) {
+	return marshalPreserving(optionsFields(o), o.raw)
+}
+
+// UnmarshalJSON decodes known fields and keeps the full original document
+func (o *Options) UnmarshalJSON(data []byte) error {
+	return unmarshalPreserving(data, (*optionsFields)(o), &o.raw)
+}
+
+// HasDevice reports whether deviceID is in the folder's device list
+func (c *FolderConfig) HasDevice(deviceID string) bool {
+	for _, d := range c.Devices {
+		if d.DeviceID == deviceID {
+			return true
+		}
+	}
+	return false
+}
+
+// unmarshalPreserving decodes data into known and keeps every top-level field in raw
+func unmarshalPreserving(data []byte, known interface{}, raw *map[string]json.RawMessage) error {
+	if err := json.Unmarshal(data, known); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, raw)
+}
+
+// marshalPreserving encodes known and overlays it on the original fields in raw
+// known must be a type without a MarshalJSON method to avoid recursion
+func marshalPreserving(known interface{}, raw map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(known)
+	if err != nil || len(raw) == 0 {
+		return data, err
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+
+	merged := make(map[string]json.RawMessage, len(raw)+len(fields))
+	for k, v := range raw {
+		merged[k] = v
+	}
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	return json.Marshal(merged)
+}
+
+// GetFolders returns all configured folders
+func (sc *SyncthingClient) GetFolders() ([]FolderConfig, error) {
+	var folders []FolderConfig
+	if err := sc.getJSON("/rest/config/folders", &folders); err != nil {
+		return nil, err
+	}
+	return folders, nil
+}
+
+// GetFolder returns a single folder's configuration
+func (sc *SyncthingClient) GetFolder(folderID string) (*FolderConfig, error) {
+	var folder FolderConfig
+	if err := sc.getJSON("/rest/config/folders/"+url.PathEscape(folderID), &folder); err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// GetDefaultFolder returns the template Syncthing uses for new folders
+func (sc *SyncthingClient) GetDefaultFolder() (*FolderConfig, error) {
+	var folder FolderConfig
+	if err := sc.getJSON("/rest/config/defaults/folder", &folder); err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+// CreateFolder adds a new folder to Syncthing
+func (sc *SyncthingClient) CreateFolder(folder *FolderConfig) error {
+	return sc.sendJSON("POST", "/rest/config/folders", folder)
+}
+
+// PutFolder replaces a folder's configuration
+func (sc *SyncthingClient) PutFolder(folder *FolderConfig) error {
+	return sc.sendJSON("PUT", "/rest/config/folders/"+url.PathEscape(folder.ID), folder)
+}
+
+// PatchFolder updates only the given fields of a folder's configuration
+func (sc *SyncthingClient) PatchFolder(folderID string, patch map[string]interface{}) error {
+	return sc.sendJSON("PATCH", "/rest/config/folders/"+url.PathEscape(folderID), patch)
+}
+
+// GetDevices returns all configured devices
+func (sc *SyncthingClient) GetDevices() ([]DeviceConfig, error) {
+	var devices []DeviceConfig
+	if err := sc.getJSON("/rest/config/devices", &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// GetDevice returns a single device's configuration
+func (sc *SyncthingClient) GetDevice(deviceID string) (*DeviceConfig, error) {
+	var device DeviceConfig
+	if err := sc.getJSON("/rest/config/devices/"+url.PathEscape(deviceID), &device); err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// GetDefaultDevice returns the template Syncthing uses for new devices
+func (sc *SyncthingClient) GetDefaultDevice() (*DeviceConfig, error) {
+	var device DeviceConfig
+	if err := sc.getJSON("/rest/config/defaults/device", &device); err != nil {
+		return nil, err
+	}
+	return &device, nil
+}
+
+// CreateDevice adds a new device to Syncthing
+func (sc *SyncthingClient) CreateDevice(device *DeviceConfig) error {
+	return sc.sendJSON("POST", "/rest/config/devices", device)
+}
+
+// PutDevice replaces a device's configuration
+func (sc *SyncthingClient) PutDevice(device *DeviceConfig) error {
+	return sc.sendJSON("PUT", "/rest/config/devices/"+url.PathEscape(device.DeviceID), device)
+}
+
+// PatchDevice updates only the given fields of a device's configuration
+func (sc *SyncthingClient) PatchDevice(deviceID string, patch map[string]interface{}) error {
+	return sc.sendJSON("PATCH", "/rest/config/devices/"+url.PathEscape(deviceID), patch)
+}
+
+// GetOptions returns Syncthing's global options
+func (sc *SyncthingClient) GetOptions() (*Options, error) {
+	var options Options
+	if err := sc.getJSON("/rest/config/options", &options); err != nil {
+		return nil, err
+	}
+	return &options, nil
+}
+
+// PatchOptions updates only the given global options
+func (sc *SyncthingClient) PatchOptions(patch map[string]interface{}) error {
+	return sc.sendJSON("PATCH", "/rest/config/options", patch)
+}
+
+func (sc *SyncthingClient) getJSON(endpoint string, out interface{}) error {
+	fmt.Printf("[SyncthingClient] GET %s\n", endpoint)
+	req, err := http.NewRequest("GET", sc.baseURL+endpoint, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := sc.doReq(req, false)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(resp, out)
+}
+
+func (sc *SyncthingClient) sendJSON(method, endpoint string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("[SyncthingClient] %s %s payload: %s\n", method, endpoint, string(data))
+	req, err := http.NewRequest(method, sc.baseURL+endpoint, bytes.NewBuffer(data))
+	if err != nil {
+		return err
+	}
+
+	return sc.doRequest(req)
+}
@@ -0,0 +1,391 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultEventTypes are the Syncthing event types the agent listens for
+var DefaultEventTypes = []string{
+	"StateChanged",
+	"ItemStarted",
+	"ItemFinished",
+	"FolderSummary",
+	"FolderCompletion",
+	"DeviceConnected",
+	"DeviceDisconnected",
+	"LocalIndexUpdated",
+	"PendingDevicesChanged",
+	"PendingFoldersChanged",
+}
+
+// SyncthingEvent is a single entry from Syncthing's /rest/events stream
+type SyncthingEvent struct {
+	ID       int             `json:"id"`
+	GlobalID int             `json:"globalID"`
+	Type     string          `json:"type"`
+	Time     time.Time       `json:"time"`
+	Data     json.RawMessage `json:"data"`
+}
+
+// DecodeData unmarshals the event payload into v
+func (e SyncthingEvent) DecodeData(v interface{}) error {
+	return json.Unmarshal(e.Data, v)
+}
+
+// StateChangedData is the payload of a StateChanged event
+type StateChangedData struct {
+	Folder   string  `json:"folder"`
+	From     string  `json:"from"`
+	To       string  `json:"to"`
+	Duration float64 `json:"duration"`
+	Error    string  `json:"error,omitempty"`
+}
+
+// ItemEventData is the payload of ItemStarted and ItemFinished events
+type ItemEventData struct {
+	Folder string  `json:"folder"`
+	Item   string  `json:"item"`
+	Type   string  `json:"type"`   // file, dir, symlink
+	Action string  `json:"action"` // update, metadata, delete
+	Error  *string `json:"error,omitempty"`
+}
+
+// FolderSummaryData is the payload of a FolderSummary event
+type FolderSummaryData struct {
+	Folder  string                 `json:"folder"`
+	Summary map[string]interface{} `json:"summary"`
+}
+
+// FolderCompletionData is the payload of a FolderCompletion event
+type FolderCompletionData struct {
+	Folder      string  `json:"folder"`
+	Device      string  `json:"device"`
+	Completion  float64 `json:"completion"`
+	GlobalBytes int64   `json:"globalBytes"`
+	NeedBytes   int64   `json:"needBytes"`
+	GlobalItems int     `json:"globalItems"`
+	NeedItems   int     `json:"needItems"`
+	NeedDeletes int     `json:"needDeletes"`
+}
+
+// LocalIndexUpdatedData is the payload of a LocalIndexUpdated event
+type LocalIndexUpdatedData struct {
+	Folder    string   `json:"folder"`
+	Items     int      `json:"items"`
+	Filenames []string `json:"filenames"`
+	Sequence  int64    `json:"sequence"`
+}
+
+// DeviceConnectedData is the payload of a DeviceConnected event
+type DeviceConnectedData struct {
+	ID            string `json:"id"`
+	Addr          string `json:"addr"`
+	DeviceName    string `json:"deviceName"`
+	ClientName    string `json:"clientName"`
+	ClientVersion string `json:"clientVersion"`
+	Type          string `json:"type"`
+}
+
+// DeviceDisconnectedData is the payload of a DeviceDisconnected event
+type DeviceDisconnectedData struct {
+	ID    string `json:"id"`
+	Error string `json:"error"`
+}
+
+// GetEvents long-polls /rest/events for events newer than since
+// Blocks up to timeout waiting for new events; an empty slice means the poll timed out
+func (sc *SyncthingClient) GetEvents(ctx context.Context, since, limit int, timeout time.Duration, types []string) ([]SyncthingEvent, error) {
+	params := url.Values{}
+	params.Set("since", strconv.Itoa(since))
+	params.Set("timeout", strconv.Itoa(int(timeout/time.Second)))
+	if limit > 0 {
+		params.Set("limit", strconv.Itoa(limit))
+	}
+	if len(types) > 0 {
+		params.Set("events", strings.Join(types, ","))
+	}
+
+	// The shared client has a 10s timeout, so long polls get their own deadline
+	ctx, cancel := context.WithTimeout(ctx, timeout+15*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", sc.baseURL+"/rest/events?"+params.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-API-Key", sc.apiKey)
+
+	resp, err := sc.streamClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("syncthing API error: %d - %s", resp.StatusCode, resp.Status)
+	}
+
+	var events []SyncthingEvent
+	if err := json.NewDecoder(resp.Body).Decode(&events); err != nil {
+		return nil, fmt.Errorf("failed to decode events: %w", err)
+	}
+
+	return events, nil
+}
+
+// EventStream consumes Syncthing's event stream and fans it out to subscribers
+// Tracks the "since" cursor across polls and reconnects after errors
+type EventStream struct {
+	client       *SyncthingClient
+	types        []string
+	pollTimeout  time.Duration
+	maxBackoff   time.Duration
+	mu           sync.RWMutex
+	since        int
+	running      bool
+	connected    bool
+	subscribers  []chan SyncthingEvent
+	lastEventAt  time.Time
+	lastError    string
+	reconnectCnt int
+}
+
+// NewEventStream creates an event stream for the given client
+func NewEventStream(client *SyncthingClient, types []string) *EventStream {
+	return &EventStream{
+		client:      client,
+		types:       types,
+		pollTimeout: 60 * time.Second,
+		maxBackoff:  30 * time.Second,
+	}
+}
+
+// Events returns the client's shared event stream
+func (sc *SyncthingClient) Events() *EventStream {
+	sc.eventsOnce.Do(func() {
+		sc.events = NewEventStream(sc, DefaultEventTypes)
+	})
+	return sc.events
+}
+
+// Run polls Syncthing for events until ctx is cancelled
+// Connection errors are retried with exponential backoff
+func (es *EventStream) Run(ctx context.Context) error {
+	es.mu.Lock()
+	if es.running {
+		es.mu.Unlock()
+		return nil
+	}
+	es.running = true
+	es.mu.Unlock()
+
+	defer func() {
+		es.mu.Lock()
+		es.running = false
+		es.connected = false
+		es.mu.Unlock()
+	}()
+
+	fmt.Printf("[SyncthingEvents] Event stream started\n")
+
+	backoff := time.Second
+	needsResync := true
+
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Printf("[SyncthingEvents] Event stream stopped\n")
+			return ctx.Err()
+		default:
+		}
+
+		// After (re)connecting, make sure our cursor is still valid
+		// Syncthing restarts its event IDs from 1 when it restarts
+		if needsResync {
+			if err := es.resync(ctx); err != nil {
+				es.markDisconnected(err)
+				if !es.sleep(ctx, backoff) {
+					return ctx.Err()
+				}
+				backoff = nextBackoff(backoff, es.maxBackoff)
+				continue
+			}
+			needsResync = false
+		}
+
+		events, err := es.client.GetEvents(ctx, es.cursor(), 0, es.pollTimeout, es.types)
+		if err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			es.markDisconnected(err)
+			needsResync = true
+			if !es.sleep(ctx, backoff) {
+				return ctx.Err()
+			}
+			backoff = nextBackoff(backoff, es.maxBackoff)
+			continue
+		}
+
+		backoff = time.Second
+		es.markConnected()
+
+		for _, evt := range events {
+			es.dispatch(evt)
+		}
+	}
+}
+
+// resync fetches the most recent event ID and rewinds the cursor if Syncthing restarted
+// Syncthing numbers events separately for each event mask, so this asks with the mask the polls use
+func (es *EventStream) resync(ctx context.Context) error {
+	latest, err := es.client.GetEvents(ctx, 0, 1, 0, es.types)
+	if err != nil {
+		return err
+	}
+
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	latestID := 0
+	if len(latest) > 0 {
+		latestID = latest[len(latest)-1].ID
+	}
+
+	if es.since == 0 || latestID < es.since {
+		// First connect or Syncthing restarted: only deliver events from now on
+		if es.since != 0 {
+			fmt.Printf("[SyncthingEvents] Event IDs reset (cursor %d > latest %d), Syncthing restarted\n", es.since, latestID)
+		}
+		es.since = latestID
+	}
+
+	return nil
+}
+
+func (es *EventStream) dispatch(evt SyncthingEvent) {
+	es.mu.Lock()
+	if evt.ID > es.since {
+		es.since = evt.ID
+	}
+	es.lastEventAt = time.Now()
+	es.mu.Unlock()
+
+	// Hold the read lock while sending so Unsubscribe can't close a channel mid-send
+	es.mu.RLock()
+	defer es.mu.RUnlock()
+	for _, ch := range es.subscribers {
+		select {
+		case ch <- evt:
+		default:
+			fmt.Printf("[SyncthingEvents] Subscriber channel full, dropping %s event %d\n", evt.Type, evt.ID)
+		}
+	}
+}
+
+func (es *EventStream) cursor() int {
+	es.mu.RLock()
+	defer es.mu.RUnlock()
+	return es.since
+}
+
+func (es *EventStream) markConnected() {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if !es.connected {
+		fmt.Printf("[SyncthingEvents] Connected to Syncthing event stream (since=%d)\n", es.since)
+	}
+	es.connected = true
+	es.lastError = ""
+}
+
+func (es *EventStream) markDisconnected(err error) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+	if es.connected {
+		es.reconnectCnt++
+	}
+	es.connected = false
+	es.lastError = err.Error()
+	fmt.Printf("[SyncthingEvents] Event stream error: %v\n", err)
+}
+
+func (es *EventStream) sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func nextBackoff(current, max time.Duration) time.Duration {
+	next := current * 2
+	if next > max {
+		return max
+	}
+	return next
+}
+
+// IsConnected reports whether the last poll succeeded
+func (es *EventStream) IsConnected() bool {
+	es.mu.RLock()
+	defer es.mu.RUnlock()
+	return es.running && es.connected
+}
+
+// EventStreamStatus describes the state of the event stream
+type EventStreamStatus struct {
+	Running     bool      `json:"running"`
+	Connected   bool      `json:"connected"`
+	LastEventID int       `json:"lastEventId"`
+	LastEventAt time.Time `json:"lastEventAt,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+	Reconnects  int       `json:"reconnects"`
+}
+
+// Status returns a snapshot of the stream state
+func (es *EventStream) Status() EventStreamStatus {
+	es.mu.RLock()
+	defer es.mu.RUnlock()
+	return EventStreamStatus{
+		Running:     es.running,
+		Connected:   es.connected,
+		LastEventID: es.since,
+		LastEventAt: es.lastEventAt,
+		LastError:   es.lastError,
+		Reconnects:  es.reconnectCnt,
+	}
+}
+
+// Subscribe returns a channel receiving every event from the stream
+func (es *EventStream) Subscribe() chan SyncthingEvent {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	ch := make(chan SyncthingEvent, 100)
+	es.subscribers = append(es.subscribers, ch)
+	return ch
+}
+
+// Unsubscribe removes a subscriber and closes its channel
+func (es *EventStream) Unsubscribe(ch chan SyncthingEvent) {
+	es.mu.Lock()
+	defer es.mu.Unlock()
+
+	for i, subscriber := range es.subscribers {
+		if subscriber == ch {
+			es.subscribers = append(es.subscribers[:i], es.subscribers[i+1:]...)
+			close(ch)
+			return
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// Ignores is a folder's .stignore content as reported by Syncthing
+type Ignores struct {
+	Ignore   []string `json:"ignore"`             // Lines as written in .stignore
+	Expanded []string `json:"expanded,omitempty"` // Patterns after #include expansion
+	Error    string   `json:"error,omitempty"`    // Set when Syncthing failed to parse the file
+}
+
+// GetIgnores gets the ignore patterns of a folder
+func (sc *SyncthingClient) GetIgnores(folderID string) (*Ignores, error) {
+	var ignores Ignores
+	if err := sc.getJSON("/rest/db/ignores?folder="+url.QueryEscape(folderID), &ignores); err != nil {
+		return nil, fmt.Errorf("failed to get ignores for %s: %w", folderID, err)
+	}
+	if ignores.Ignore == nil {
+		ignores.Ignore = []string{}
+	}
+	return &ignores, nil
+}
+
+// SetIgnores replaces the ignore patterns of a folder
+// Syncthing writes .stignore but does not rescan; callers should trigger a rescan
+func (sc *SyncthingClient) SetIgnores(folderID string, lines []string) error {
+	if lines == nil {
+		lines = []string{}
+	}
+	return sc.sendJSON("POST", "/rest/db/ignores?folder="+url.QueryEscape(folderID), map[string]interface{}{
+		"ignore": lines,
+	})
+}
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// PendingDevice is an unknown device that tried to connect
+type PendingDevice struct {
+	Time    time.Time `json:"time"`
+	Name    string    `json:"name"`
+	Address string    `json:"address"`
+}
+
+// PendingFolderOffer is a folder offered by one remote device
+type PendingFolderOffer struct {
+	Time             time.Time `json:"time"`
+	Label            string    `json:"label"`
+	ReceiveEncrypted bool      `json:"receiveEncrypted"`
+	RemoteEncrypted  bool      `json:"remoteEncrypted"`
+}
+
+// PendingFolder is a folder shared with us that we haven't added yet
+type PendingFolder struct {
+	OfferedBy map[string]PendingFolderOffer `json:"offeredBy"` // Device ID -> offer
+}
+
+// GetPendingDevices lists unknown devices that tried to connect, keyed by device ID
+func (sc *SyncthingClient) GetPendingDevices() (map[string]PendingDevice, error) {
+	devices := map[string]PendingDevice{}
+	if err := sc.getJSON("/rest/cluster/pending/devices", &devices); err != nil {
+		return nil, fmt.Errorf("failed to get pending devices: %w", err)
+	}
+	return devices, nil
+}
+
+// GetPendingFolders lists folders offered by known devices, keyed by folder ID
+func (sc *SyncthingClient) GetPendingFolders() (map[string]PendingFolder, error) {
+	folders := map[string]PendingFolder{}
+	if err := sc.getJSON("/rest/cluster/pending/folders", &folders); err != nil {
+		return nil, fmt.Errorf("failed to get pending folders: %w", err)
+	}
+	return folders, nil
+}
+
+// DismissPendingDevice removes a device from the pending list
+// The device shows up again if it reconnects
+func (sc *SyncthingClient) DismissPendingDevice(deviceID string) error {
+	return sc.deletePending("/rest/cluster/pending/devices?device=" + url.QueryEscape(deviceID))
+}
+
+// DismissPendingFolder removes a folder offer from the pending list
+// An empty deviceID dismisses the offer from every device
+func (sc *SyncthingClient) DismissPendingFolder(folderID, deviceID string) error {
+	params := url.Values{}
+	params.Set("folder", folderID)
+	if deviceID != "" {
+		params.Set("device", deviceID)
+	}
+	return sc.deletePending("/rest/cluster/pending/folders?" + params.Encode())
+}
+
+func (sc *SyncthingClient) deletePending(endpoint string) error {
+	fmt.Printf("[SyncthingClient] DELETE %s\n", endpoint)
+	req, err := http.NewRequest("DELETE", sc.baseURL+endpoint, nil)
+	if err != nil {
+		return err
+	}
+	return sc.doRequest(req)
+}
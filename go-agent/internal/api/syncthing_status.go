@@ -0,0 +1,185 @@
+package api
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// SystemStatus is the subset of /rest/system/status the agent uses
+type SystemStatus struct {
+	MyID      string    `json:"myID"`
+	StartTime time.Time `json:"startTime"`
+	Uptime    int       `json:"uptime"`
+}
+
+// Completion is a device's sync completion for a folder from /rest/db/completion
+type Completion struct {
+	Completion  float64 `json:"completion"`
+	GlobalBytes int64   `json:"globalBytes"`
+	NeedBytes   int64   `json:"needBytes"`
+	GlobalItems int     `json:"globalItems"`
+	NeedItems   int     `json:"needItems"`
+	NeedDeletes int     `json:"needDeletes"`
+	RemoteState string  `json:"remoteState"` // valid, paused, notSharing, unknown
+}
+
+// ConnectionStats holds byte counters for a connection
+type ConnectionStats struct {
+	At            time.Time `json:"at"`
+	InBytesTotal  int64     `json:"inBytesTotal"`
+	OutBytesTotal int64     `json:"outBytesTotal"`
+}
+
+// Connection is a device entry from /rest/system/connections
+type Connection struct {
+	ConnectionStats
+	Connected     bool      `json:"connected"`
+	Paused        bool      `json:"paused"`
+	Address       string    `json:"address"`
+	ClientVersion string    `json:"clientVersion"`
+	Type          string    `json:"type"` // e.g. tcp-client, quic-server, relay-client
+	IsLocal       bool      `json:"isLocal"`
+	Crypto        string    `json:"crypto"`
+	StartedAt     time.Time `json:"startedAt"`
+}
+
+// Connections is the response of /rest/system/connections
+type Connections struct {
+	Total       ConnectionStats       `json:"total"`
+	Connections map[string]Connection `json:"connections"`
+}
+
+// DeviceStatistics is a device entry from /rest/stats/device
+type DeviceStatistics struct {
+	LastSeen                time.Time `json:"lastSeen"`
+	LastConnectionDurationS float64   `json:"lastConnectionDurationS"`
+}
+
+// NeedFile is a file entry from /rest/db/need
+type NeedFile struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+	Type     string    `json:"type"`
+}
+
+// NeedList is the response of /rest/db/need
+type NeedList struct {
+	Progress []NeedFile `json:"progress"` // Files currently downloading
+	Queued   []NeedFile `json:"queued"`
+	Rest     []NeedFile `json:"rest"`
+	Page     int        `json:"page"`
+	PerPage  int        `json:"perpage"`
+}
+
+// LocalChangedList is the response of /rest/db/localchanged
+// Lists files changed locally in a receive-only folder
+type LocalChangedList struct {
+	Files   []NeedFile `json:"files"`
+	Page    int        `json:"page"`
+	PerPage int        `json:"perpage"`
+}
+
+// RemoteNeedList is the response of /rest/db/remoteneed
+// Lists files a remote device still needs from the local device
+type RemoteNeedList struct {
+	Files   []NeedFile `json:"files"`
+	Page    int        `json:"page"`
+	PerPage int        `json:"perpage"`
+}
+
+// GetSystemStatus returns typed system status
+func (sc *SyncthingClient) GetSystemStatus() (*SystemStatus, error) {
+	var status SystemStatus
+	if err := sc.getJSON("/rest/system/status", &status); err != nil {
+		return nil, err
+	}
+	return &status, nil
+}
+
+// GetMyID returns the local Syncthing device ID
+func (sc *SyncthingClient) GetMyID() (string, error) {
+	status, err := sc.GetSystemStatus()
+	if err != nil {
+		return "", err
+	}
+	if status.MyID == "" {
+		return "", fmt.Errorf("syncthing did not report a device ID")
+	}
+	return status.MyID, nil
+}
+
+// GetCompletion returns how far deviceID is from having the folder in sync
+func (sc *SyncthingClient) GetCompletion(folderID, deviceID string) (*Completion, error) {
+	params := url.Values{}
+	params.Set("folder", folderID)
+	params.Set("device", deviceID)
+
+	var completion Completion
+	if err := sc.getJSON("/rest/db/completion?"+params.Encode(), &completion); err != nil {
+		return nil, err
+	}
+	return &completion, nil
+}
+
+// GetConnections returns connection state and byte counters for all devices
+func (sc *SyncthingClient) GetConnections() (*Connections, error) {
+	var connections Connections
+	if err := sc.getJSON("/rest/system/connections", &connections); err != nil {
+		return nil, err
+	}
+	return &connections, nil
+}
+
+// GetNeed returns the files the local device still needs for a folder
+func (sc *SyncthingClient) GetNeed(folderID string, page, perPage int) (*NeedList, error) {
+	params := url.Values{}
+	params.Set("folder", folderID)
+	params.Set("page", fmt.Sprintf("%d", page))
+	params.Set("perpage", fmt.Sprintf("%d", perPage))
+
+	var need NeedList
+	if err := sc.getJSON("/rest/db/need?"+params.Encode(), &need); err != nil {
+		return nil, err
+	}
+	return &need, nil
+}
+
+// GetDeviceStats returns last-seen statistics for all devices, keyed by device ID
+func (sc *SyncthingClient) GetDeviceStats() (map[string]DeviceStatistics, error) {
+	stats := map[string]DeviceStatistics{}
+	if err := sc.getJSON("/rest/stats/device", &stats); err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// GetLocalChanged returns files changed locally in a receive-only folder
+func (sc *SyncthingClient) GetLocalChanged(folderID string, page, perPage int) (*LocalChangedList, error) {
+	params := url.Values{}
+	params.Set("folder", folderID)
+	params.Set("page", fmt.Sprintf("%d", page))
+	params.Set("perpage", fmt.Sprintf("%d", perPage))
+
+	var changed LocalChangedList
+	if err := sc.getJSON("/rest/db/localchanged?"+params.Encode(), &changed); err != nil {
+		return nil, err
+	}
+	return &changed, nil
+}
+
+// GetRemoteNeed returns the files deviceID still needs for a folder
+func (sc *SyncthingClient) GetRemoteNeed(folderID, deviceID string, page, perPage int) (*RemoteNeedList, error) {
+	params := url.Values{}
+	params.Set("folder", folderID)
+	params.Set("device", deviceID)
+	params.Set("page", fmt.Sprintf("%d", page))
+	params.Set("perpage", fmt.Sprintf("%d", perPage))
+
+	var need RemoteNeedList
+	if err := sc.getJSON("/rest/db/remoteneed?"+params.Encode(), &need); err != nil {
+		return nil, err
+	}
+	return &need, nil
+}
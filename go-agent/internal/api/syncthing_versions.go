@@ -0,0 +1,55 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// FileVersion is an archived version of a file kept by folder versioning
+type FileVersion struct {
+	VersionTime time.Time `json:"versionTime"`
+	ModTime     time.Time `json:"modTime"`
+	Size        int64     `json:"size"`
+}
+
+// GetVersions lists archived versions of every file in a folder, keyed by path
+func (sc *SyncthingClient) GetVersions(folderID string) (map[string][]FileVersion, error) {
+	versions := map[string][]FileVersion{}
+	if err := sc.getJSON("/rest/folder/versions?folder="+url.QueryEscape(folderID), &versions); err != nil {
+		return nil, fmt.Errorf("failed to get versions for %s: %w", folderID, err)
+	}
+	return versions, nil
+}
+
+// RestoreVersions restores the given file versions, keyed by path
+// Returns per-file errors reported by Syncthing; an empty map means every file was restored
+func (sc *SyncthingClient) RestoreVersions(folderID string, files map[string]time.Time) (map[string]string, error) {
+	data, err := json.Marshal(files)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := "/rest/folder/versions?folder=" + url.QueryEscape(folderID)
+	fmt.Printf("[SyncthingClient] POST %s payload: %s\n", endpoint, string(data))
+	req, err := http.NewRequest("POST", sc.baseURL+endpoint, bytes.NewBuffer(data))
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := sc.doReq(req, false)
+	if err != nil {
+		return nil, err
+	}
+
+	failures := map[string]string{}
+	if len(bytes.TrimSpace(resp)) > 0 {
+		if err := json.Unmarshal(resp, &failures); err != nil {
+			return nil, fmt.Errorf("failed to decode restore response: %w", err)
+		}
+	}
+	return failures, nil
+}
@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"regexp"
+	"strconv"
 
 	"github.com/joho/godotenv"
 )
@@ -14,13 +15,47 @@ type Config struct {
 	DataDir string
 
 	// API configuration
-	APIPort int
-	APIHost string
+	APIPort   int
+	APIHost   string
+	APISecret string // Shared with Electron; required to change or export snapshot keys
 
 	// Syncthing configuration
-	SyncthingBinary string
-	SyncthingPort   int
-	SyncthingAPIKey string
+	SyncthingBinary  string
+	SyncthingPort    int
+	SyncthingAPIKey  string
+	SyncthingManaged bool // Agent launches and supervises Syncthing itself
+
+	// Accept pending devices/folders from known project members without the Syncthing GUI
+	AutoAcceptPending bool
+	SyncRoot          string // Auto-accepted folders must be created under this directory
+
+	// Content hashing for snapshots
+	SnapshotHashing bool
+	HashWorkers     int // 0 picks a default from the CPU count
+	HashMaxMBPerSec int // Disk read cap while hashing, 0 for unlimited
+
+	// Read duration, resolution, codec and timecode of video clips into snapshots and file lists
+	MediaMetadata bool
+
+	// Keep a SQLite index of each project's files so file APIs don't walk the disk
+	FileIndex bool
+
+	// Refresh project snapshots after local changes; per-project policies override these defaults
+	SnapshotAutoRefresh bool
+	SnapshotQuietPeriod int // Seconds without changes before refreshing
+	SnapshotMaxDelay    int // Seconds after the first change by which a refresh starts regardless
+
+	// Snapshots kept locally per project for diffs, 0 to keep none
+	SnapshotHistory int
+
+	// Snapshot jobs generating at once across all projects
+	SnapshotConcurrency int
+
+	// Part size of resumable snapshot uploads, in MB
+	SnapshotUploadPartMB int
+
+	// List every frame of an image sequence in snapshots instead of one entry per sequence
+	ExpandSequences bool
 
 	// Nebula configuration
 	NebulaEnabled bool
@@ -63,9 +98,25 @@ func Load() (*Config, error) {
 		DataDir:                dataDir,
 		APIHost:                "127.0.0.1",
 		APIPort:                29999,
-		SyncthingPort:          8384,
-		SyncthingBinary:        "syncthing",
+		SyncthingPort:          getEnvInt("SYNCTHING_PORT", 8384),
+		SyncthingBinary:        getEnv("SYNCTHING_BINARY", "syncthing"),
 		SyncthingAPIKey:        getSyncthingAPIKey(dataDir),
+		SyncthingManaged:       getEnvBool("SYNCTHING_MANAGED", false),
+		APISecret:              os.Getenv("AGENT_API_SECRET"),
+		AutoAcceptPending:      getEnvBool("AUTO_ACCEPT_PENDING", true),
+		SyncRoot:               getEnv("SYNC_ROOT", homeDir),
+		SnapshotHashing:        getEnvBool("SNAPSHOT_HASHING", false),
+		HashWorkers:            getEnvInt("HASH_WORKERS", 0),
+		HashMaxMBPerSec:        getEnvInt("HASH_MAX_MB_PER_SEC", 0),
+		MediaMetadata:          getEnvBool("MEDIA_METADATA", true),
+		FileIndex:              getEnvBool("FILE_INDEX", true),
+		ExpandSequences:        getEnvBool("SNAPSHOT_EXPAND_SEQUENCES", false),
+		SnapshotHistory:        getEnvInt("SNAPSHOT_HISTORY", 10),
+		SnapshotConcurrency:    getEnvInt("SNAPSHOT_JOB_CONCURRENCY", 2),
+		SnapshotUploadPartMB:   getEnvInt("SNAPSHOT_UPLOAD_PART_MB", 8),
+		SnapshotAutoRefresh:    getEnvBool("SNAPSHOT_AUTO_REFRESH", true),
+		SnapshotQuietPeriod:    getEnvInt("SNAPSHOT_QUIET_SECONDS", 120),
+		SnapshotMaxDelay:       getEnvInt("SNAPSHOT_MAX_DELAY_SECONDS", 1800),
 		NebulaEnabled:          true,
 		NebulaBinary:           "nebula",
 		CloudURL:               getEnv("CLOUD_URL", "http://localhost:5000/api"),
@@ -87,6 +138,24 @@ func getEnv(key, defaultVal string) string {
 	return defaultVal
 }
 
+func getEnvInt(key string, defaultVal int) int {
+	if val := os.Getenv(key); val != "" {
+		if n, err := strconv.Atoi(val); err == nil {
+			return n
+		}
+	}
+	return defaultVal
+}
+
+func getEnvBool(key string, defaultVal bool) bool {
+	if val := os.Getenv(key); val != "" {
+		if b, err := strconv.ParseBool(val); err == nil {
+			return b
+		}
+	}
+	return defaultVal
+}
+
 // getSyncthingAPIKey reads the API key from environment or Syncthing's config file
 func getSyncthingAPIKey(dataDir string) string {
 	// First, try to get from environment variable (passed by Electron)
@@ -1,12 +1,15 @@
 package device
 
 import (
+	"crypto/ed25519"
+	"crypto/rand"
 	"database/sql"
 	"os"
 	"path/filepath"
 
 	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/vidsync/agent/internal/signing"
 )
 
 // DeviceInfo represents device identity
@@ -23,6 +26,7 @@ type DeviceManager struct {
 	dbPath  string
 	db      *sql.DB
 	device  *DeviceInfo
+	key     ed25519.PrivateKey // Signs this device's snapshots
 }
 
 // NewDeviceManager creates a new device manager
@@ -63,6 +67,19 @@ func (dm *DeviceManager) Init() error {
 	}
 
 	dm.device = device
+
+	// Load or create the snapshot signing key
+	key, err := dm.loadSigningKey()
+	if err == ErrNoSigningKey {
+		_, key, err = ed25519.GenerateKey(rand.Reader)
+		if err == nil {
+			err = dm.saveSigningKey(key)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	dm.key = key
 	return nil
 }
 
@@ -79,6 +96,19 @@ func (dm *DeviceManager) GetDeviceInfo() *DeviceInfo {
 	return dm.device
 }
 
+// SigningPublicKey returns the public half of the device's snapshot signing key
+func (dm *DeviceManager) SigningPublicKey() ed25519.PublicKey {
+	if dm.key == nil {
+		return nil
+	}
+	return dm.key.Public().(ed25519.PublicKey)
+}
+
+// SignSnapshot signs a snapshot document digest with the device key
+func (dm *DeviceManager) SignSnapshot(digest []byte) signing.Signature {
+	return signing.Sign(dm.key, digest, dm.GetDeviceID())
+}
+
 func (dm *DeviceManager) createTables() error {
 	query := `
 	CREATE TABLE IF NOT EXISTS devices (
@@ -88,11 +118,36 @@ func (dm *DeviceManager) createTables() error {
 		token TEXT,
 		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 	);
+	CREATE TABLE IF NOT EXISTS signing_keys (
+		id INTEGER PRIMARY KEY CHECK (id = 1),
+		seed BLOB NOT NULL,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
 	`
 	_, err := dm.db.Exec(query)
 	return err
 }
 
+func (dm *DeviceManager) loadSigningKey() (ed25519.PrivateKey, error) {
+	var seed []byte
+	err := dm.db.QueryRow("SELECT seed FROM signing_keys WHERE id = 1").Scan(&seed)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, ErrNoSigningKey
+		}
+		return nil, err
+	}
+	if len(seed) != ed25519.SeedSize {
+		return nil, ErrInvalidDevice
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func (dm *DeviceManager) saveSigningKey(key ed25519.PrivateKey) error {
+	_, err := dm.db.Exec("INSERT OR REPLACE INTO signing_keys (id, seed) VALUES (1, ?)", key.Seed())
+	return err
+}
+
 func (dm *DeviceManager) loadDevice() (*DeviceInfo, error) {
 	query := "SELECT id, name, platform, token FROM devices LIMIT 1"
 	row := dm.db.QueryRow(query)
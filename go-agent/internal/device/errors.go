@@ -5,4 +5,5 @@ import "errors"
 var (
 	ErrNoDevice      = errors.New("no device found")
 	ErrInvalidDevice = errors.New("invalid device")
+	ErrNoSigningKey  = errors.New("no signing key found")
 )
@@ -0,0 +1,235 @@
+package encryption
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Algorithm identifies how snapshots are encrypted:
+// AES-256-GCM over 64 KiB chunks, each sealed with its index and a last-chunk flag in the nonce
+const Algorithm = "aes-256-gcm-chunked"
+
+// KeySize is the size of a project key in bytes
+const KeySize = 32
+
+// MagicSize is how many leading bytes IsEncrypted needs
+const MagicSize = len(magic)
+
+const (
+	magic       = "VSENC1"
+	keyIDSize   = 8
+	prefixSize  = 7 // Random nonce part; the remaining 5 bytes are the chunk index and last flag
+	headerSize  = len(magic) + keyIDSize + prefixSize
+	chunkSize   = 64 << 10
+	sealedChunk = chunkSize + 16 // Chunk plus GCM tag
+)
+
+var (
+	// ErrNotEncrypted is returned when a stream doesn't start with an encryption header
+	ErrNotEncrypted = errors.New("data is not encrypted")
+	// ErrWrongKey is returned when a stream was encrypted with another key
+	ErrWrongKey = errors.New("data was encrypted with a different key")
+	// ErrCorrupt is returned when a stream was modified, truncated or reordered
+	ErrCorrupt = errors.New("encrypted data is corrupt")
+)
+
+// NewKey generates a random project key
+func NewKey() ([]byte, error) {
+	key := make([]byte, KeySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// KeyID returns a short identifier of a key, stored with the data it encrypts
+// It is derived from the key but reveals nothing usable about it
+func KeyID(key []byte) string {
+	return hex.EncodeToString(keyID(key))
+}
+
+func keyID(key []byte) []byte {
+	sum := sha256.Sum256(append([]byte("vidsync-snapshot-key:"), key...))
+	return sum[:keyIDSize]
+}
+
+// IsEncrypted reports whether data starts with an encryption header
+func IsEncrypted(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(magic))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	if len(key) != KeySize {
+		return nil, fmt.Errorf("encryption key must be %d bytes", KeySize)
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// nonce builds the nonce of a chunk from the stream's prefix, the chunk index and whether it is the last one
+func nonce(prefix []byte, index uint32, last bool) []byte {
+	n := make([]byte, 0, prefixSize+5)
+	n = append(n, prefix...)
+	n = binary.BigEndian.AppendUint32(n, index)
+	if last {
+		return append(n, 1)
+	}
+	return append(n, 0)
+}
+
+// Writer encrypts everything written to it; Close must be called to write the last chunk
+type Writer struct {
+	w      io.Writer
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	index  uint32
+	buf    []byte
+	err    error
+}
+
+// NewWriter returns a writer that encrypts to w with key, writing the header immediately
+func NewWriter(w io.Writer, key []byte) (*Writer, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	prefix := make([]byte, prefixSize)
+	if _, err := rand.Read(prefix); err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, 0, headerSize)
+	header = append(header, magic...)
+	header = append(header, keyID(key)...)
+	header = append(header, prefix...)
+	if _, err := w.Write(header); err != nil {
+		return nil, err
+	}
+
+	return &Writer{w: w, aead: aead, header: header, prefix: prefix, buf: make([]byte, 0, chunkSize)}, nil
+}
+
+// Write encrypts p; full chunks are sealed only once more data follows, so the last one can be flagged
+func (ew *Writer) Write(p []byte) (int, error) {
+	if ew.err != nil {
+		return 0, ew.err
+	}
+	n := 0
+	for len(p) > 0 {
+		if len(ew.buf) == chunkSize {
+			if ew.err = ew.seal(false); ew.err != nil {
+				return n, ew.err
+			}
+		}
+		k := copy(ew.buf[len(ew.buf):chunkSize], p)
+		ew.buf = ew.buf[:len(ew.buf)+k]
+		p = p[k:]
+		n += k
+	}
+	return n, nil
+}
+
+// Close seals the last chunk; it doesn't close the underlying writer
+func (ew *Writer) Close() error {
+	if ew.err != nil {
+		return ew.err
+	}
+	ew.err = ew.seal(true)
+	if ew.err == nil {
+		ew.err = errors.New("encryption writer closed")
+		return nil
+	}
+	return ew.err
+}
+
+func (ew *Writer) seal(last bool) error {
+	sealed := ew.aead.Seal(nil, nonce(ew.prefix, ew.index, last), ew.buf, ew.header)
+	ew.index++
+	ew.buf = ew.buf[:0]
+	_, err := ew.w.Write(sealed)
+	return err
+}
+
+// Reader decrypts a stream written by Writer
+type Reader struct {
+	r      *bufio.Reader
+	aead   cipher.AEAD
+	header []byte
+	prefix []byte
+	index  uint32
+	plain  []byte
+	done   bool
+}
+
+// NewReader reads the header from r and returns a reader of the decrypted data
+func NewReader(r io.Reader, key []byte) (*Reader, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReaderSize(r, sealedChunk+1)
+	header := make([]byte, headerSize)
+	if _, err := io.ReadFull(br, header); err != nil || !IsEncrypted(header) {
+		return nil, ErrNotEncrypted
+	}
+	if !bytes.Equal(header[len(magic):len(magic)+keyIDSize], keyID(key)) {
+		return nil, ErrWrongKey
+	}
+
+	return &Reader{r: br, aead: aead, header: header, prefix: header[len(magic)+keyIDSize:]}, nil
+}
+
+// Read returns decrypted data; every chunk is authenticated before any of it is returned
+func (er *Reader) Read(p []byte) (int, error) {
+	for len(er.plain) == 0 {
+		if er.done {
+			return 0, io.EOF
+		}
+		if err := er.open(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, er.plain)
+	er.plain = er.plain[n:]
+	return n, nil
+}
+
+func (er *Reader) open() error {
+	sealed := make([]byte, sealedChunk)
+	n, err := io.ReadFull(er.r, sealed)
+	switch {
+	case err == io.ErrUnexpectedEOF || err == io.EOF:
+		er.done = true
+	case err != nil:
+		return err
+	default:
+		// A full chunk is the last one only if nothing follows it
+		if _, err := er.r.Peek(1); err == io.EOF {
+			er.done = true
+		} else if err != nil {
+			return err
+		}
+	}
+
+	plain, err := er.aead.Open(nil, nonce(er.prefix, er.index, er.done), sealed[:n], er.header)
+	if err != nil {
+		return ErrCorrupt
+	}
+	er.index++
+	er.plain = plain
+	return nil
+}
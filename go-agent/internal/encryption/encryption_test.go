@@ -0,0 +1,211 @@
+package encryption
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math/rand"
+	"testing"
+)
+
+func testKey(t *testing.T) []byte {
+	t.Helper()
+	key, err := NewKey()
+	if err != nil {
+		t.Fatalf("NewKey failed: %v", err)
+	}
+	return key
+}
+
+// plaintext returns n bytes of deterministic test data
+func plaintext(n int) []byte {
+	data := make([]byte, n)
+	rand.New(rand.NewSource(int64(n))).Read(data)
+	return data
+}
+
+// encrypt encrypts data with key, writing it in pieces of at most step bytes
+func encrypt(t *testing.T, key, data []byte, step int) []byte {
+	t.Helper()
+	var out bytes.Buffer
+	w, err := NewWriter(&out, key)
+	if err != nil {
+		t.Fatalf("NewWriter failed: %v", err)
+	}
+	for len(data) > 0 {
+		n := min(step, len(data))
+		if _, err := w.Write(data[:n]); err != nil {
+			t.Fatalf("Write failed: %v", err)
+		}
+		data = data[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	return out.Bytes()
+}
+
+func decrypt(data, key []byte) ([]byte, error) {
+	r, err := NewReader(bytes.NewReader(data), key)
+	if err != nil {
+		return nil, err
+	}
+	return io.ReadAll(r)
+}
+
+// chunks splits an encrypted stream into its header and sealed chunks
+func chunks(data []byte) ([]byte, [][]byte) {
+	header, rest := data[:headerSize], data[headerSize:]
+	var sealed [][]byte
+	for len(rest) > 0 {
+		n := min(sealedChunk, len(rest))
+		sealed = append(sealed, rest[:n])
+		rest = rest[n:]
+	}
+	return header, sealed
+}
+
+func join(header []byte, sealed ...[]byte) []byte {
+	return bytes.Join(append([][]byte{header}, sealed...), nil)
+}
+
+func TestRoundTrip(t *testing.T) {
+	key := testKey(t)
+	sizes := []int{0, 1, 100, chunkSize - 1, chunkSize, chunkSize + 1, 2 * chunkSize, 3*chunkSize + 7}
+	for _, size := range sizes {
+		for _, step := range []int{size + 1, 1000, chunkSize} {
+			data := plaintext(size)
+			encrypted := encrypt(t, key, data, step)
+			if !IsEncrypted(encrypted) {
+				t.Fatalf("size %d: output has no encryption header", size)
+			}
+			sealedChunks := max(1, (size+chunkSize-1)/chunkSize) // An empty stream still has its last chunk
+			if want := headerSize + sealedChunks*16 + size; len(encrypted) != want {
+				t.Errorf("size %d: encrypted length = %d, want %d", size, len(encrypted), want)
+			}
+
+			got, err := decrypt(encrypted, key)
+			if err != nil {
+				t.Fatalf("size %d, step %d: decrypt failed: %v", size, step, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Fatalf("size %d, step %d: round trip changed the data", size, step)
+			}
+		}
+	}
+}
+
+func TestEncryptionIsRandomized(t *testing.T) {
+	key := testKey(t)
+	data := plaintext(1000)
+	if bytes.Equal(encrypt(t, key, data, 1000), encrypt(t, key, data, 1000)) {
+		t.Fatal("encrypting the same data twice gave the same output")
+	}
+}
+
+func TestWrongKey(t *testing.T) {
+	encrypted := encrypt(t, testKey(t), plaintext(100), 100)
+	if _, err := decrypt(encrypted, testKey(t)); !errors.Is(err, ErrWrongKey) {
+		t.Fatalf("expected ErrWrongKey, got %v", err)
+	}
+}
+
+func TestNotEncrypted(t *testing.T) {
+	key := testKey(t)
+	for _, data := range [][]byte{nil, []byte("VSENC"), []byte(`{"files":[]}`), make([]byte, headerSize)} {
+		if _, err := decrypt(data, key); !errors.Is(err, ErrNotEncrypted) {
+			t.Errorf("decrypt(%q): expected ErrNotEncrypted, got %v", data, err)
+		}
+	}
+}
+
+func TestInvalidKeySize(t *testing.T) {
+	if _, err := NewWriter(io.Discard, make([]byte, 16)); err == nil {
+		t.Error("NewWriter accepted a 16-byte key")
+	}
+	if _, err := NewReader(bytes.NewReader(nil), make([]byte, 31)); err == nil {
+		t.Error("NewReader accepted a 31-byte key")
+	}
+}
+
+func TestTamperDetection(t *testing.T) {
+	key := testKey(t)
+	encrypted := encrypt(t, key, plaintext(3*chunkSize+100), chunkSize)
+	header, sealed := chunks(encrypted)
+	if len(sealed) != 4 {
+		t.Fatalf("expected 4 chunks, got %d", len(sealed))
+	}
+
+	flip := func(data []byte, at int) []byte {
+		out := bytes.Clone(data)
+		out[at] ^= 0x01
+		return out
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"header only", header},
+		{"truncated to first chunk", join(header, sealed[0])},
+		{"truncated at chunk boundary", join(header, sealed[:3]...)},
+		{"truncated mid chunk", encrypted[:headerSize+sealedChunk+1000]},
+		{"last byte missing", encrypted[:len(encrypted)-1]},
+		{"chunks swapped", join(header, sealed[1], sealed[0], sealed[2], sealed[3])},
+		{"middle chunk dropped", join(header, sealed[0], sealed[2], sealed[3])},
+		{"chunk repeated", join(header, sealed[0], sealed[0], sealed[1], sealed[2], sealed[3])},
+		{"last chunk moved earlier", join(header, sealed[0], sealed[3], sealed[1], sealed[2])},
+		{"trailing data", append(bytes.Clone(encrypted), 0)},
+		{"ciphertext bit flipped", flip(encrypted, headerSize+5000)},
+		{"tag bit flipped", flip(encrypted, len(encrypted)-1)},
+		{"nonce prefix bit flipped", flip(encrypted, headerSize-1)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := decrypt(tt.data, key); !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("expected ErrCorrupt, got %v", err)
+			}
+		})
+	}
+}
+
+func TestChunksFromAnotherStream(t *testing.T) {
+	key := testKey(t)
+	data := plaintext(2*chunkSize + 10)
+	headerA, sealedA := chunks(encrypt(t, key, data, chunkSize))
+	_, sealedB := chunks(encrypt(t, key, data, chunkSize))
+
+	spliced := join(headerA, sealedA[0], sealedB[1], sealedA[2])
+	if _, err := decrypt(spliced, key); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+}
+
+func TestNoPlaintextBeforeAuthentication(t *testing.T) {
+	key := testKey(t)
+	encrypted := encrypt(t, key, plaintext(100), 100)
+	encrypted[headerSize] ^= 0x01
+
+	r, err := NewReader(bytes.NewReader(encrypted), key)
+	if err != nil {
+		t.Fatalf("NewReader failed: %v", err)
+	}
+	buf := make([]byte, 10)
+	if n, err := r.Read(buf); n != 0 || !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("Read = %d, %v; want 0, ErrCorrupt", n, err)
+	}
+}
+
+func TestKeyID(t *testing.T) {
+	key := testKey(t)
+	id := KeyID(key)
+	if len(id) != 2*keyIDSize {
+		t.Fatalf("KeyID length = %d, want %d", len(id), 2*keyIDSize)
+	}
+	if KeyID(key) != id {
+		t.Error("KeyID is not stable")
+	}
+	if KeyID(testKey(t)) == id {
+		t.Error("different keys have the same KeyID")
+	}
+}
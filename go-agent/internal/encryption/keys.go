@@ -0,0 +1,95 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// KeyStore keeps the snapshot encryption key of each project on this device
+type KeyStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewKeyStore creates a key store saved at path
+func NewKeyStore(path string) *KeyStore {
+	return &KeyStore{path: path}
+}
+
+// Get returns a project's key, nil if the project's snapshots aren't encrypted
+func (ks *KeyStore) Get(projectID string) ([]byte, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	keys, err := ks.load()
+	if err != nil {
+		return nil, err
+	}
+	encoded, ok := keys[projectID]
+	if !ok {
+		return nil, nil
+	}
+	return base64.StdEncoding.DecodeString(encoded)
+}
+
+// Set stores a project's key, replacing any previous one
+func (ks *KeyStore) Set(projectID string, key []byte) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	keys, err := ks.load()
+	if err != nil {
+		return err
+	}
+	keys[projectID] = base64.StdEncoding.EncodeToString(key)
+	return ks.save(keys)
+}
+
+// Delete drops a project's key
+func (ks *KeyStore) Delete(projectID string) error {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	keys, err := ks.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := keys[projectID]; !ok {
+		return nil
+	}
+	delete(keys, projectID)
+	return ks.save(keys)
+}
+
+func (ks *KeyStore) load() (map[string]string, error) {
+	keys := make(map[string]string)
+	data, err := os.ReadFile(ks.path)
+	if os.IsNotExist(err) {
+		return keys, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	return keys, nil
+}
+
+func (ks *KeyStore) save(keys map[string]string) error {
+	data, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ks.path), 0700); err != nil {
+		return err
+	}
+	tmp := ks.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ks.path)
+}
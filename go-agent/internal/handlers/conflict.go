@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/vidsync/agent/internal/services"
+	"github.com/vidsync/agent/internal/util"
+)
+
+// ConflictHandler handles sync conflict HTTP requests
+type ConflictHandler struct {
+	service *services.ConflictService
+	logger  *util.Logger
+}
+
+// NewConflictHandler creates a new conflict handler
+func NewConflictHandler(service *services.ConflictService, logger *util.Logger) *ConflictHandler {
+	return &ConflictHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// ListConflicts lists conflict copies in a project grouped by original file
+func (h *ConflictHandler) ListConflicts(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	conflicts, err := h.service.ListConflicts(r.Context(), projectID)
+	if err != nil {
+		h.logger.Error("Failed to list conflicts: %v", err)
+		http.Error(w, `{"error":"failed to list conflicts"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"projectId": projectID,
+		"conflicts": conflicts,
+		"count":     len(conflicts),
+	})
+}
+
+// ResolveConflict resolves a conflict group with keep-local, keep-remote or keep-both
+func (h *ConflictHandler) ResolveConflict(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	var req services.ResolveConflictRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	switch req.Action {
+	case services.ConflictKeepLocal, services.ConflictKeepRemote, services.ConflictKeepBoth:
+	default:
+		http.Error(w, `{"error":"action must be keep-local, keep-remote or keep-both"}`, http.StatusBadRequest)
+		return
+	}
+	if req.OriginalPath == "" {
+		http.Error(w, `{"error":"originalPath is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.service.ResolveConflict(r.Context(), projectID, &req)
+	if errors.Is(err, services.ErrConflictSideMissing) {
+		http.Error(w, `{"error":"no conflict copy holds that version; keep both instead"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to resolve conflict: %v", err)
+		http.Error(w, `{"error":"failed to resolve conflict"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
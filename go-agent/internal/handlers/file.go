@@ -1,9 +1,18 @@
 package handlers
 
 import (
+	"encoding/base64"
 	"encoding/json"
+	"errors"
+	"io"
+	"mime"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/vidsync/agent/internal/encryption"
+	"github.com/vidsync/agent/internal/index"
 	"github.com/vidsync/agent/internal/services"
 	"github.com/vidsync/agent/internal/util"
 )
@@ -22,13 +31,59 @@ func NewFileHandler(service *services.FileService, logger *util.Logger) *FileHan
 	}
 }
 
-// GetFiles gets a list of files in a project folder
+// GetFiles gets a page of the files in a project folder
+// Query params: limit, cursor (nextCursor of the previous page), sort (path, name, size or mtime; default path),
+// order (asc or desc), prefix (path prefix), ext (comma-separated extensions), minSize and maxSize (bytes),
+// modifiedSince (RFC 3339 or Unix seconds) and expandSequences=true
 func (h *FileHandler) GetFiles(w http.ResponseWriter, r *http.Request) {
 	projectID := r.PathValue("projectId")
-	limit := r.URL.Query().Get("limit")
-	offset := r.URL.Query().Get("offset")
+	query := r.URL.Query()
 
-	result, err := h.service.GetFiles(r.Context(), projectID, limit, offset)
+	opts := services.FileListOptions{
+		Cursor:          query.Get("cursor"),
+		Sort:            query.Get("sort"),
+		Prefix:          query.Get("prefix"),
+		Extensions:      splitList(query.Get("ext")),
+		ExpandSequences: query.Get("expandSequences") == "true",
+	}
+	switch opts.Sort {
+	case "", services.SortByPath, services.SortByName, services.SortBySize, services.SortByMtime:
+	default:
+		http.Error(w, `{"error":"sort must be path, name, size or mtime"}`, http.StatusBadRequest)
+		return
+	}
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		opts.Desc = true
+	default:
+		http.Error(w, `{"error":"order must be asc or desc"}`, http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if opts.Limit, err = intParam(query.Get("limit")); err != nil || opts.Limit < 0 {
+		http.Error(w, `{"error":"limit must be a positive number"}`, http.StatusBadRequest)
+		return
+	}
+	if opts.MinSize, err = int64Param(query.Get("minSize")); err != nil || opts.MinSize < 0 {
+		http.Error(w, `{"error":"minSize must be a number of bytes"}`, http.StatusBadRequest)
+		return
+	}
+	if opts.MaxSize, err = int64Param(query.Get("maxSize")); err != nil || opts.MaxSize < 0 {
+		http.Error(w, `{"error":"maxSize must be a number of bytes"}`, http.StatusBadRequest)
+		return
+	}
+	if opts.ModifiedSince, err = timeParam(query.Get("modifiedSince")); err != nil {
+		http.Error(w, `{"error":"modifiedSince must be an RFC 3339 time or Unix seconds"}`, http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.service.GetFiles(r.Context(), projectID, opts)
+	if errors.Is(err, services.ErrInvalidCursor) {
+		http.Error(w, `{"error":"invalid cursor for this sort order"}`, http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		h.logger.Error("Failed to get files: %v", err)
 		http.Error(w, `{"error":"failed to get files"}`, http.StatusInternalServerError)
@@ -42,8 +97,9 @@ func (h *FileHandler) GetFiles(w http.ResponseWriter, r *http.Request) {
 // GetFileTree gets the file tree structure of a project
 func (h *FileHandler) GetFileTree(w http.ResponseWriter, r *http.Request) {
 	projectID := r.PathValue("projectId")
+	expandSequences := r.URL.Query().Get("expandSequences") == "true"
 
-	result, err := h.service.GetFileTree(r.Context(), projectID)
+	result, err := h.service.GetFileTree(r.Context(), projectID, expandSequences)
 	if err != nil {
 		h.logger.Error("Failed to get file tree: %v", err)
 		http.Error(w, `{"error":"failed to get file tree"}`, http.StatusInternalServerError)
@@ -54,26 +110,396 @@ func (h *FileHandler) GetFileTree(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(result)
 }
 
-// GenerateSnapshot generates a snapshot of current project files
-func (h *FileHandler) GenerateSnapshot(w http.ResponseWriter, r *http.Request) {
+// SearchFiles finds the files and directories of a project whose name contains a query, ignoring case
+// Query params: q (required) and limit
+func (h *FileHandler) SearchFiles(w http.ResponseWriter, r *http.Request) {
 	projectID := r.PathValue("projectId")
+	query := r.URL.Query()
 
-	var req struct {
-		AccessToken string `json:"accessToken"`
+	q := strings.TrimSpace(query.Get("q"))
+	if q == "" {
+		http.Error(w, `{"error":"q is required"}`, http.StatusBadRequest)
+		return
+	}
+	limit, err := intParam(query.Get("limit"))
+	if err != nil || limit < 0 {
+		http.Error(w, `{"error":"limit must be a positive number"}`, http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.service.SearchFiles(r.Context(), projectID, q, limit)
+	if err != nil {
+		h.logger.Error("Failed to search files: %v", err)
+		http.Error(w, `{"error":"failed to search files"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetFileIndex reports the state of a project's file index
+func (h *FileHandler) GetFileIndex(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	status, err := h.service.FileIndexStatus(projectID)
+	if errors.Is(err, services.ErrFileIndexDisabled) {
+		http.Error(w, `{"error":"file index is disabled"}`, http.StatusConflict)
+		return
+	}
+	if errors.Is(err, index.ErrNotBuilt) {
+		http.Error(w, `{"error":"file index not built yet"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get file index status: %v", err)
+		http.Error(w, `{"error":"failed to get file index status"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// RescanFileIndex updates a project's file index from disk
+// Query params: path (folder-relative, repeatable) to rescan just those paths; the whole folder otherwise
+func (h *FileHandler) RescanFileIndex(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	status, err := h.service.RescanFileIndex(r.Context(), projectID, r.URL.Query()["path"])
+	if errors.Is(err, services.ErrFileIndexDisabled) {
+		http.Error(w, `{"error":"file index is disabled"}`, http.StatusConflict)
+		return
+	}
+	if errors.Is(err, index.ErrNotBuilt) {
+		http.Error(w, `{"error":"file index not built yet, rescan without paths first"}`, http.StatusConflict)
+		return
 	}
+	if err != nil {
+		h.logger.Error("Failed to rescan file index: %v", err)
+		http.Error(w, `{"error":"failed to rescan file index"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
+
+// ExportManifest streams a project's file listing for spreadsheets and delivery checks
+// Query params: format (csv, ndjson or json; default csv), columns (comma-separated: hash, media, sync),
+// prefix (path prefix), ext (comma-separated extensions) and expandSequences=true
+func (h *FileHandler) ExportManifest(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+	query := r.URL.Query()
+
+	format := query.Get("format")
+	if format == "" {
+		format = services.ManifestCSV
+	}
+	switch format {
+	case services.ManifestCSV, services.ManifestNDJSON, services.ManifestJSON:
+	default:
+		http.Error(w, `{"error":"format must be csv, ndjson or json"}`, http.StatusBadRequest)
+		return
+	}
+
+	opts := services.ManifestOptions{
+		Prefix:          query.Get("prefix"),
+		Extensions:      splitList(query.Get("ext")),
+		ExpandSequences: query.Get("expandSequences") == "true",
+	}
+	for _, column := range splitList(query.Get("columns")) {
+		switch column {
+		case "hash":
+			opts.Hash = true
+		case "media":
+			opts.Media = true
+		case "sync":
+			opts.Sync = true
+		default:
+			http.Error(w, `{"error":"columns must be hash, media or sync"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	manifest, err := h.service.PrepareManifest(r.Context(), projectID, opts)
+	if errors.Is(err, services.ErrHashingDisabled) {
+		http.Error(w, `{"error":"hash column needs snapshot hashing enabled"}`, http.StatusConflict)
+		return
+	}
+	if errors.Is(err, services.ErrMediaDisabled) {
+		http.Error(w, `{"error":"media column needs media metadata enabled"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to prepare manifest: %v", err)
+		http.Error(w, `{"error":"failed to export manifest"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", services.ManifestContentType(format))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{
+		"filename": projectID + "-manifest." + format,
+	}))
+	if err := manifest.Write(r.Context(), w, format); err != nil {
+		// Headers are sent by now; the client sees a truncated file
+		h.logger.Error("Failed to write manifest: %v", err)
+	}
+}
+
+// splitList splits a comma-separated query value, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// intParam parses an optional integer query param, 0 when it is empty
+func intParam(value string) (int, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// int64Param parses an optional 64-bit integer query param, 0 when it is empty
+func int64Param(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.ParseInt(value, 10, 64)
+}
+
+// timeParam parses an optional time query param given as RFC 3339 or Unix seconds, zero when it is empty
+func timeParam(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if secs, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(secs, 0), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// ListSnapshots lists the snapshots of a project kept locally
+func (h *FileHandler) ListSnapshots(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	snapshots, err := h.service.ListSnapshots(r.Context(), projectID)
+	if err != nil {
+		h.logger.Error("Failed to list snapshots: %v", err)
+		http.Error(w, `{"error":"failed to list snapshots"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"projectId": projectID,
+		"snapshots": snapshots,
+	})
+}
 
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+// DiffSnapshots compares two snapshots of a project
+// Query params: from (required) and to (default latest), each a snapshot ID, "latest", an RFC 3339 time or a date
+func (h *FileHandler) DiffSnapshots(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+	from := r.URL.Query().Get("from")
+	to := r.URL.Query().Get("to")
+	if from == "" {
+		http.Error(w, `{"error":"from is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.service.DiffSnapshots(r.Context(), projectID, from, to)
+	if errors.Is(err, services.ErrSnapshotNotFound) {
+		http.Error(w, `{"error":"snapshot not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to diff snapshots: %v", err)
+		http.Error(w, `{"error":"failed to diff snapshots"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// VerifySnapshot checks that a project's cloud snapshot is signed by the owner's registered key
+// Query param: acceptKey=true trusts the registered key even if another key was pinned for the project
+func (h *FileHandler) VerifySnapshot(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+	acceptKey := r.URL.Query().Get("acceptKey") == "true"
+
+	// Optional "Bearer <token>"; the agent's session token is used without one
+	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	result, err := h.service.VerifySnapshot(r.Context(), projectID, accessToken, acceptKey)
+	if errors.Is(err, services.ErrSnapshotNotFound) {
+		http.Error(w, `{"error":"project has no snapshot"}`, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, services.ErrSnapshotKeyMissing) {
+		http.Error(w, `{"error":"snapshot is encrypted and no key is set for the project"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to verify snapshot: %v", err)
+		http.Error(w, `{"error":"failed to verify snapshot"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetRemoteSnapshot returns a project's cloud snapshot with its deltas applied, decrypting it with the project key
+func (h *FileHandler) GetRemoteSnapshot(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	// Optional "Bearer <token>"; the agent's session token is used without one
+	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	result, err := h.service.GetRemoteSnapshot(r.Context(), projectID, accessToken)
+	if errors.Is(err, services.ErrSnapshotNotFound) {
+		http.Error(w, `{"error":"project has no snapshot"}`, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, services.ErrSnapshotKeyMissing) {
+		http.Error(w, `{"error":"snapshot is encrypted and no key is set for the project"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get remote snapshot: %v", err)
+		http.Error(w, `{"error":"failed to get remote snapshot"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetSnapshotKey returns whether a project's snapshots are encrypted and the ID of the key
+func (h *FileHandler) GetSnapshotKey(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	result, err := h.service.GetSnapshotKey(projectID)
+	if err != nil {
+		h.logger.Error("Failed to get snapshot key: %v", err)
+		http.Error(w, `{"error":"failed to get snapshot key"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// SetSnapshotKey enables snapshot encryption for a project
+// Body: {"key": "<base64>"} imports a key shared by the owner; an empty body generates a new key
+func (h *FileHandler) SetSnapshotKey(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	var req struct {
+		Key string `json:"key"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
 		http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
 		return
 	}
 
-	result, err := h.service.GenerateSnapshot(r.Context(), projectID, req.AccessToken)
+	var key []byte
+	if req.Key != "" {
+		decoded, err := base64.StdEncoding.DecodeString(req.Key)
+		if err != nil || len(decoded) != encryption.KeySize {
+			http.Error(w, `{"error":"key must be 32 bytes, base64 encoded"}`, http.StatusBadRequest)
+			return
+		}
+		key = decoded
+	}
+
+	result, err := h.service.SetSnapshotKey(projectID, key)
+	if err != nil {
+		h.logger.Error("Failed to set snapshot key: %v", err)
+		http.Error(w, `{"error":"failed to set snapshot key"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// RegisterSigningKey registers this device's snapshot signing key for a project it owns
+// Body: {"replace": true} replaces another device's key, e.g. after moving the project to this device
+func (h *FileHandler) RegisterSigningKey(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	var req struct {
+		Replace bool `json:"replace"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Optional "Bearer <token>"; the agent's session token is used without one
+	accessToken := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	err := h.service.RegisterSigningKey(projectID, accessToken, req.Replace)
+	if errors.Is(err, services.ErrSigningKeyMismatch) {
+		http.Error(w, `{"error":"another device's signing key is registered; set replace to use this device"}`, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to register signing key: %v", err)
+		http.Error(w, `{"error":"failed to register signing key"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"projectId":  projectID,
+		"registered": true,
+	})
+}
+
+// ExportSnapshotKey returns a project's snapshot encryption key, to share with project members
+func (h *FileHandler) ExportSnapshotKey(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	result, err := h.service.ExportSnapshotKey(projectID)
 	if err != nil {
-		h.logger.Error("Failed to generate snapshot: %v", err)
-		http.Error(w, `{"error":"failed to generate snapshot"}`, http.StatusInternalServerError)
+		h.logger.Error("Failed to export snapshot key: %v", err)
+		http.Error(w, `{"error":"failed to export snapshot key"}`, http.StatusInternalServerError)
+		return
+	}
+	if !result.Enabled {
+		http.Error(w, `{"error":"no snapshot key set"}`, http.StatusNotFound)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
+
+// DeleteSnapshotKey disables snapshot encryption for a project
+func (h *FileHandler) DeleteSnapshotKey(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	if err := h.service.DeleteSnapshotKey(projectID); err != nil {
+		h.logger.Error("Failed to delete snapshot key: %v", err)
+		http.Error(w, `{"error":"failed to delete snapshot key"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"projectId": projectID,
+		"enabled":   false,
+	})
+}
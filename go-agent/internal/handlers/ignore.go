@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/vidsync/agent/internal/ignore"
+	"github.com/vidsync/agent/internal/services"
+	"github.com/vidsync/agent/internal/util"
+)
+
+// IgnoreHandler handles ignore pattern HTTP requests
+type IgnoreHandler struct {
+	service *services.IgnoreService
+	logger  *util.Logger
+}
+
+// NewIgnoreHandler creates a new ignore handler
+func NewIgnoreHandler(service *services.IgnoreService, logger *util.Logger) *IgnoreHandler {
+	return &IgnoreHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// GetIgnores gets the ignore patterns of a project
+func (h *IgnoreHandler) GetIgnores(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	result, err := h.service.GetIgnores(r.Context(), projectID)
+	if err != nil {
+		h.logger.Error("Failed to get ignores: %v", err)
+		http.Error(w, `{"error":"failed to get ignores"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// SetIgnores replaces the ignore patterns of a project
+func (h *IgnoreHandler) SetIgnores(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	var req services.SetIgnoresRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	for _, name := range req.Presets {
+		if _, ok := ignore.GetPreset(name); !ok {
+			http.Error(w, `{"error":"unknown preset"}`, http.StatusBadRequest)
+			return
+		}
+	}
+
+	result, err := h.service.SetIgnores(r.Context(), projectID, &req)
+	if err != nil {
+		var validationErrs ignore.ValidationErrors
+		if errors.As(err, &validationErrs) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"error":   "invalid ignore patterns",
+				"details": validationErrs,
+			})
+			return
+		}
+		h.logger.Error("Failed to set ignores: %v", err)
+		http.Error(w, `{"error":"failed to set ignores"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// ListPresets lists the built-in ignore presets
+func (h *IgnoreHandler) ListPresets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"presets": h.service.ListPresets(),
+	})
+}
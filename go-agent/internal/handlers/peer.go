@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/vidsync/agent/internal/services"
+	"github.com/vidsync/agent/internal/util"
+)
+
+// PeerHandler handles peer connection status HTTP requests
+type PeerHandler struct {
+	service *services.PeerService
+	logger  *util.Logger
+}
+
+// NewPeerHandler creates a new peer handler
+func NewPeerHandler(service *services.PeerService, logger *util.Logger) *PeerHandler {
+	return &PeerHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// GetProjectPeers lists the devices sharing a project with their connection status
+func (h *PeerHandler) GetProjectPeers(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	peers, err := h.service.GetProjectPeers(r.Context(), projectID)
+	if err != nil {
+		h.logger.Error("Failed to get project peers: %v", err)
+		http.Error(w, `{"error":"failed to get project devices"}`, http.StatusInternalServerError)
+		return
+	}
+
+	online := 0
+	for _, p := range peers {
+		if p.Connected && !p.IsSelf {
+			online++
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"projectId": projectID,
+		"devices":   peers,
+		"online":    online,
+	})
+}
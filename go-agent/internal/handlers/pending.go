@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/vidsync/agent/internal/services"
+	"github.com/vidsync/agent/internal/util"
+)
+
+// PendingHandler handles pending device and folder HTTP requests
+type PendingHandler struct {
+	service *services.PendingService
+	logger  *util.Logger
+}
+
+// NewPendingHandler creates a new pending request handler
+func NewPendingHandler(service *services.PendingService, logger *util.Logger) *PendingHandler {
+	return &PendingHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// ListPending lists pending devices and folders awaiting approval
+func (h *PendingHandler) ListPending(w http.ResponseWriter, r *http.Request) {
+	result, err := h.service.ListPending(r.Context())
+	if err != nil {
+		h.logger.Error("Failed to list pending requests: %v", err)
+		http.Error(w, `{"error":"failed to list pending requests"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// AcceptDevice accepts a pending device
+func (h *PendingHandler) AcceptDevice(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.PathValue("deviceId")
+
+	var req struct {
+		Name string `json:"name"`
+	}
+	// Body is optional
+	_ = json.NewDecoder(r.Body).Decode(&req)
+
+	if err := h.service.AcceptDevice(r.Context(), deviceID, req.Name); err != nil {
+		h.logger.Error("Failed to accept device: %v", err)
+		http.Error(w, `{"error":"failed to accept device"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true, "deviceId": deviceID})
+}
+
+// RejectDevice dismisses a pending device
+func (h *PendingHandler) RejectDevice(w http.ResponseWriter, r *http.Request) {
+	deviceID := r.PathValue("deviceId")
+
+	if err := h.service.RejectDevice(r.Context(), deviceID); err != nil {
+		h.logger.Error("Failed to dismiss device: %v", err)
+		http.Error(w, `{"error":"failed to dismiss device"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+}
+
+// AcceptFolder accepts a pending folder offered by a device
+func (h *PendingHandler) AcceptFolder(w http.ResponseWriter, r *http.Request) {
+	folderID := r.PathValue("folderId")
+
+	var req services.AcceptFolderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.DeviceID == "" {
+		http.Error(w, `{"error":"deviceId is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.service.AcceptFolder(r.Context(), folderID, &req)
+	if err != nil {
+		h.logger.Error("Failed to accept folder: %v", err)
+		http.Error(w, `{"error":"failed to accept folder"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// RejectFolder dismisses a pending folder offer
+// Optional query param: deviceId (dismiss only that device's offer)
+func (h *PendingHandler) RejectFolder(w http.ResponseWriter, r *http.Request) {
+	folderID := r.PathValue("folderId")
+
+	if err := h.service.RejectFolder(r.Context(), folderID, r.URL.Query().Get("deviceId")); err != nil {
+		h.logger.Error("Failed to dismiss folder: %v", err)
+		http.Error(w, `{"error":"failed to dismiss folder"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+}
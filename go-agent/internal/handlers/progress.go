@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/vidsync/agent/internal/services"
 	"github.com/vidsync/agent/internal/util"
@@ -45,12 +48,23 @@ func (h *ProgressHandler) GetSnapshotProgress(w http.ResponseWriter, r *http.Req
 	json.NewEncoder(w).Encode(progress)
 }
 
+// progressHeartbeat is how often an idle progress stream sends a comment, so proxies keep it open
+// and clients notice a dead connection
+const progressHeartbeat = 15 * time.Second
+
 // SubscribeSnapshotProgress subscribes to real-time snapshot progress updates
-// Returns Server-Sent Events stream
+// Returns Server-Sent Events stream; each event carries an ID, and a reconnecting client
+// sends the last one it saw in Last-Event-ID (or ?lastEventId=) to receive what it missed
 func (h *ProgressHandler) SubscribeSnapshotProgress(w http.ResponseWriter, r *http.Request) {
 	projectID := r.PathValue("projectId")
 
-	h.logger.Info("[ProgressHandler] WebSocket subscription for project: %s", projectID)
+	lastEventID := r.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = r.URL.Query().Get("lastEventId")
+	}
+	lastID, _ := strconv.ParseUint(lastEventID, 10, 64)
+
+	h.logger.Info("[ProgressHandler] Progress stream opened for project: %s (last event %d)", projectID, lastID)
 
 	// Set up SSE headers
 	w.Header().Set("Content-Type", "text/event-stream")
@@ -67,29 +81,45 @@ func (h *ProgressHandler) SubscribeSnapshotProgress(w http.ResponseWriter, r *ht
 
 	progressTracker := h.fileService.GetProgressTracker()
 
-	// Subscribe to progress updates
-	progressCh := progressTracker.Subscribe(projectID)
-	defer progressTracker.Unsubscribe(projectID, progressCh)
+	// Subscribe before reading events so none are missed in between
+	updates := progressTracker.Subscribe(projectID)
+	defer progressTracker.Unsubscribe(projectID, updates)
 
-	// Send initial progress
-	currentProgress := progressTracker.GetProgress(projectID)
-	if currentProgress != nil {
-		data, _ := json.Marshal(currentProgress)
-		w.Write([]byte("data: " + string(data) + "\n\n"))
-		flusher.Flush()
+	// A new stream waits for the next run instead of replaying one that already ended
+	if lastID == 0 {
+		if latest := progressTracker.GetProgress(projectID); latest != nil && latest.Finished() {
+			lastID = latest.ID
+		}
 	}
 
-	// Stream progress updates
-	for progress := range progressCh {
-		data, _ := json.Marshal(progress)
-		w.Write([]byte("data: " + string(data) + "\n\n"))
+	fmt.Fprintf(w, "retry: %d\n\n", 3000)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(progressHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		for _, progress := range progressTracker.EventsSince(projectID, lastID) {
+			data, _ := json.Marshal(progress)
+			fmt.Fprintf(w, "id: %d\ndata: %s\n\n", progress.ID, data)
+			lastID = progress.ID
+
+			// Close stream on completion or error
+			if progress.Finished() {
+				flusher.Flush()
+				h.logger.Info("[ProgressHandler] Progress stream ended for project: %s (%s)", projectID, progress.Step)
+				return
+			}
+		}
 		flusher.Flush()
 
-		// Close stream on completion or error
-		if progress.Step == "completed" || progress.Step == "failed" {
-			break
+		select {
+		case <-updates:
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": heartbeat\n\n")
+		case <-r.Context().Done():
+			h.logger.Info("[ProgressHandler] Progress stream closed by client for project: %s", projectID)
+			return
 		}
 	}
-
-	h.logger.Info("[ProgressHandler] WebSocket subscription ended for project: %s", projectID)
 }
@@ -33,11 +33,12 @@ func min(a, b int) int {
 // CreateProject creates a new project with Syncthing folder
 func (h *ProjectHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		ProjectID string `json:"projectId"`
-		Name      string `json:"name"`
-		LocalPath string `json:"localPath"`
-		DeviceID  string `json:"deviceId"`
-		OwnerID   string `json:"ownerId"`
+		ProjectID  string                       `json:"projectId"`
+		Name       string                       `json:"name"`
+		LocalPath  string                       `json:"localPath"`
+		DeviceID   string                       `json:"deviceId"`
+		OwnerID    string                       `json:"ownerId"`
+		Versioning *services.VersioningSettings `json:"versioning,omitempty"`
 	}
 
 	h.logger.Info("[CreateProject] Handler received request")
@@ -78,6 +79,7 @@ func (h *ProjectHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
 		DeviceID:    req.DeviceID,
 		OwnerID:     req.OwnerID,
 		AccessToken: accessToken,
+		Versioning:  req.Versioning,
 	})
 
 	if err != nil {
@@ -99,11 +101,12 @@ func (h *ProjectHandler) CreateProject(w http.ResponseWriter, r *http.Request) {
 // 3. Generate snapshot (background process)
 func (h *ProjectHandler) CreateProjectWithSnapshot(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		ProjectID string `json:"projectId"`
-		Name      string `json:"name"`
-		LocalPath string `json:"localPath"`
-		DeviceID  string `json:"deviceId"`
-		OwnerID   string `json:"ownerId"`
+		ProjectID  string                       `json:"projectId"`
+		Name       string                       `json:"name"`
+		LocalPath  string                       `json:"localPath"`
+		DeviceID   string                       `json:"deviceId"`
+		OwnerID    string                       `json:"ownerId"`
+		Versioning *services.VersioningSettings `json:"versioning,omitempty"`
 	}
 
 	h.logger.Info("[CreateProjectWithSnapshot] Handler received request")
@@ -144,6 +147,7 @@ func (h *ProjectHandler) CreateProjectWithSnapshot(w http.ResponseWriter, r *htt
 		DeviceID:    req.DeviceID,
 		OwnerID:     req.OwnerID,
 		AccessToken: accessToken,
+		Versioning:  req.Versioning,
 	})
 
 	if err != nil {
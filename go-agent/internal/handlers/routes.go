@@ -1,20 +1,31 @@
 package handlers
 
 import (
+	"crypto/subtle"
+	"encoding/json"
 	"net/http"
 
 	"github.com/vidsync/agent/internal/services"
+	"github.com/vidsync/agent/internal/syncthing"
 	"github.com/vidsync/agent/internal/util"
 )
 
 // Router sets up HTTP routes for the API
 type Router struct {
-	projectHandler  *ProjectHandler
-	syncHandler     *SyncHandler
-	deviceHandler   *DeviceHandler
-	fileHandler     *FileHandler
-	progressHandler *ProgressHandler
-	logger          *util.Logger
+	projectHandler    *ProjectHandler
+	syncHandler       *SyncHandler
+	deviceHandler     *DeviceHandler
+	fileHandler       *FileHandler
+	progressHandler   *ProgressHandler
+	conflictHandler   *ConflictHandler
+	ignoreHandler     *IgnoreHandler
+	versioningHandler *VersioningHandler
+	pendingHandler    *PendingHandler
+	peerHandler       *PeerHandler
+	snapshotHandler   *SnapshotHandler
+	supervisor        *syncthing.Supervisor
+	localSecret       string
+	logger            *util.Logger
 }
 
 // NewRouter creates a new HTTP router
@@ -23,18 +34,42 @@ func NewRouter(
 	syncService *services.SyncService,
 	deviceService *services.DeviceService,
 	fileService *services.FileService,
+	conflictService *services.ConflictService,
+	ignoreService *services.IgnoreService,
+	versioningService *services.VersioningService,
+	pendingService *services.PendingService,
+	peerService *services.PeerService,
+	snapshotScheduler *services.SnapshotScheduler,
+	snapshotJobs *services.SnapshotJobManager,
 	logger *util.Logger,
 ) *Router {
 	return &Router{
-		projectHandler:  NewProjectHandler(projectService, logger),
-		syncHandler:     NewSyncHandler(syncService, logger),
-		deviceHandler:   NewDeviceHandler(deviceService, logger),
-		fileHandler:     NewFileHandler(fileService, logger),
-		progressHandler: NewProgressHandler(fileService, logger),
-		logger:          logger,
+		projectHandler:    NewProjectHandler(projectService, logger),
+		syncHandler:       NewSyncHandler(syncService, logger),
+		deviceHandler:     NewDeviceHandler(deviceService, logger),
+		fileHandler:       NewFileHandler(fileService, logger),
+		progressHandler:   NewProgressHandler(fileService, logger),
+		conflictHandler:   NewConflictHandler(conflictService, logger),
+		ignoreHandler:     NewIgnoreHandler(ignoreService, logger),
+		versioningHandler: NewVersioningHandler(versioningService, logger),
+		pendingHandler:    NewPendingHandler(pendingService, logger),
+		peerHandler:       NewPeerHandler(peerService, logger),
+		snapshotHandler:   NewSnapshotHandler(snapshotScheduler, snapshotJobs, logger),
+		logger:            logger,
 	}
 }
 
+// SetSyncthingSupervisor reports the supervised Syncthing process in health checks
+func (r *Router) SetSyncthingSupervisor(supervisor *syncthing.Supervisor) {
+	r.supervisor = supervisor
+}
+
+// SetLocalSecret sets the secret Electron passes to manage snapshot and signing keys
+// Without one, those keys can't be changed or exported through the API
+func (r *Router) SetLocalSecret(secret string) {
+	r.localSecret = secret
+}
+
 // RegisterRoutes registers all API routes
 func (r *Router) RegisterRoutes(mux *http.ServeMux) {
 	// Project endpoints
@@ -43,6 +78,7 @@ func (r *Router) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("GET /api/v1/projects/{projectId}", r.projectHandler.GetProject)
 	mux.HandleFunc("GET /api/v1/projects/{projectId}/status", r.projectHandler.GetProjectStatus)
 	mux.HandleFunc("DELETE /api/v1/projects/{projectId}", r.projectHandler.DeleteProject)
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/devices", r.peerHandler.GetProjectPeers)
 	mux.HandleFunc("POST /api/v1/projects/{projectId}/devices", r.projectHandler.AddDevice)
 	mux.HandleFunc("DELETE /api/v1/projects/{projectId}/devices/{deviceId}", r.projectHandler.RemoveDevice)
 
@@ -52,11 +88,57 @@ func (r *Router) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /api/v1/projects/{projectId}/sync/resume", r.syncHandler.ResumeSync)
 	mux.HandleFunc("POST /api/v1/projects/{projectId}/sync/stop", r.syncHandler.StopSync)
 	mux.HandleFunc("GET /api/v1/projects/{projectId}/sync/status", r.syncHandler.GetSyncStatus)
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/transfers", r.syncHandler.GetTransfers)
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/sync/role", r.syncHandler.GetFolderRole)
+	mux.HandleFunc("PUT /api/v1/projects/{projectId}/sync/role", r.syncHandler.SetFolderRole)
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/sync/local-changes", r.syncHandler.GetLocalChanges)
+	mux.HandleFunc("POST /api/v1/projects/{projectId}/sync/revert", r.syncHandler.RevertLocalChanges)
+	mux.HandleFunc("POST /api/v1/projects/{projectId}/sync/override", r.syncHandler.OverrideRemoteChanges)
 
 	// File endpoints
 	mux.HandleFunc("GET /api/v1/projects/{projectId}/files", r.fileHandler.GetFiles)
 	mux.HandleFunc("GET /api/v1/projects/{projectId}/files-tree", r.fileHandler.GetFileTree)
-	mux.HandleFunc("POST /api/v1/projects/{projectId}/snapshot", r.fileHandler.GenerateSnapshot)
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/files/search", r.fileHandler.SearchFiles)
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/files/index", r.fileHandler.GetFileIndex)
+	mux.HandleFunc("POST /api/v1/projects/{projectId}/files/index/rescan", r.fileHandler.RescanFileIndex)
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/manifest", r.fileHandler.ExportManifest)
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/snapshots", r.fileHandler.ListSnapshots)
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/snapshots/diff", r.fileHandler.DiffSnapshots)
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/snapshot/verify", r.fileHandler.VerifySnapshot)
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/snapshot/remote", r.fileHandler.GetRemoteSnapshot)
+
+	// Snapshot encryption key endpoints
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/snapshot/key", r.fileHandler.GetSnapshotKey)
+	mux.HandleFunc("PUT /api/v1/projects/{projectId}/snapshot/key", r.requireSecret(r.fileHandler.SetSnapshotKey))
+	mux.HandleFunc("DELETE /api/v1/projects/{projectId}/snapshot/key", r.requireSecret(r.fileHandler.DeleteSnapshotKey))
+	mux.HandleFunc("POST /api/v1/projects/{projectId}/snapshot/key/export", r.requireSecret(r.fileHandler.ExportSnapshotKey))
+	mux.HandleFunc("PUT /api/v1/projects/{projectId}/signing-key", r.requireSecret(r.fileHandler.RegisterSigningKey))
+
+	// Snapshot job endpoints
+	mux.HandleFunc("POST /api/v1/projects/{projectId}/snapshot", r.snapshotHandler.GenerateSnapshot)
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/snapshot/jobs", r.snapshotHandler.ListJobs)
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/snapshot/jobs/{id}", r.snapshotHandler.GetJob)
+	mux.HandleFunc("DELETE /api/v1/projects/{projectId}/snapshot/jobs/{id}", r.snapshotHandler.CancelJob)
+
+	// Snapshot refresh policy endpoints
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/snapshot/policy", r.snapshotHandler.GetPolicy)
+	mux.HandleFunc("PUT /api/v1/projects/{projectId}/snapshot/policy", r.snapshotHandler.UpdatePolicy)
+	mux.HandleFunc("DELETE /api/v1/projects/{projectId}/snapshot/policy", r.snapshotHandler.ResetPolicy)
+
+	// Conflict endpoints
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/conflicts", r.conflictHandler.ListConflicts)
+	mux.HandleFunc("POST /api/v1/projects/{projectId}/conflicts/resolve", r.conflictHandler.ResolveConflict)
+
+	// Ignore pattern endpoints
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/ignores", r.ignoreHandler.GetIgnores)
+	mux.HandleFunc("PUT /api/v1/projects/{projectId}/ignores", r.ignoreHandler.SetIgnores)
+	mux.HandleFunc("GET /api/v1/ignores/presets", r.ignoreHandler.ListPresets)
+
+	// Versioning endpoints
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/versioning", r.versioningHandler.GetSettings)
+	mux.HandleFunc("PUT /api/v1/projects/{projectId}/versioning", r.versioningHandler.UpdateSettings)
+	mux.HandleFunc("GET /api/v1/projects/{projectId}/versions", r.versioningHandler.ListVersions)
+	mux.HandleFunc("POST /api/v1/projects/{projectId}/versions/restore", r.versioningHandler.RestoreVersion)
 
 	// Progress endpoints (real-time snapshot generation progress)
 	mux.HandleFunc("GET /api/v1/projects/{projectId}/progress", r.progressHandler.GetSnapshotProgress)
@@ -66,6 +148,13 @@ func (r *Router) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("POST /api/v1/devices/sync", r.deviceHandler.SyncDevice)
 	mux.HandleFunc("GET /api/v1/devices/{deviceId}/status", r.deviceHandler.GetDeviceStatus)
 
+	// Pending device/folder endpoints (requests not auto-accepted)
+	mux.HandleFunc("GET /api/v1/pending", r.pendingHandler.ListPending)
+	mux.HandleFunc("POST /api/v1/pending/devices/{deviceId}/accept", r.pendingHandler.AcceptDevice)
+	mux.HandleFunc("DELETE /api/v1/pending/devices/{deviceId}", r.pendingHandler.RejectDevice)
+	mux.HandleFunc("POST /api/v1/pending/folders/{folderId}/accept", r.pendingHandler.AcceptFolder)
+	mux.HandleFunc("DELETE /api/v1/pending/folders/{folderId}", r.pendingHandler.RejectFolder)
+
 	// Health check endpoint
 	mux.HandleFunc("GET /api/v1/health", r.HealthCheck)
 	mux.HandleFunc("GET /health", r.HealthCheck)
@@ -73,18 +162,49 @@ func (r *Router) RegisterRoutes(mux *http.ServeMux) {
 	r.logger.Info("API routes registered")
 }
 
-// Start starts the HTTP server
-func (r *Router) Start(port string) error {
+// Start starts the HTTP server on addr, e.g. 127.0.0.1:5001
+func (r *Router) Start(addr string) error {
 	mux := http.NewServeMux()
 	r.RegisterRoutes(mux)
 
-	r.logger.Info("Starting HTTP server on %s", port)
-	return http.ListenAndServe(port, mux)
+	r.logger.Info("Starting HTTP server on %s", addr)
+	return http.ListenAndServe(addr, mux)
+}
+
+// requireSecret only lets requests carrying the local secret in X-Agent-Secret through
+func (r *Router) requireSecret(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		if r.localSecret == "" {
+			http.Error(w, `{"error":"AGENT_API_SECRET is not set"}`, http.StatusForbidden)
+			return
+		}
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get("X-Agent-Secret")), []byte(r.localSecret)) != 1 {
+			http.Error(w, `{"error":"invalid agent secret"}`, http.StatusUnauthorized)
+			return
+		}
+		next(w, req)
+	}
 }
 
 // HealthCheck is a simple health check endpoint
+// Includes the supervised Syncthing process state when the agent runs Syncthing itself
 func (r *Router) HealthCheck(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(`{"status":"ok"}`))
+
+	if r.supervisor == nil {
+		w.Write([]byte(`{"status":"ok"}`))
+		return
+	}
+
+	syncthingStatus := r.supervisor.Status()
+	status := "ok"
+	if syncthingStatus.State != syncthing.StateRunning {
+		status = "degraded"
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":    status,
+		"syncthing": syncthingStatus,
+	})
 }
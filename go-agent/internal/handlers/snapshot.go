@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/vidsync/agent/internal/services"
+	"github.com/vidsync/agent/internal/util"
+)
+
+// SnapshotHandler handles snapshot job and refresh policy HTTP requests
+type SnapshotHandler struct {
+	scheduler *services.SnapshotScheduler
+	jobs      *services.SnapshotJobManager
+	logger    *util.Logger
+}
+
+// NewSnapshotHandler creates a new snapshot handler
+func NewSnapshotHandler(scheduler *services.SnapshotScheduler, jobs *services.SnapshotJobManager, logger *util.Logger) *SnapshotHandler {
+	return &SnapshotHandler{
+		scheduler: scheduler,
+		jobs:      jobs,
+		logger:    logger,
+	}
+}
+
+// GenerateSnapshot queues a snapshot of current project files, or returns the project's pending job
+// The access token comes from the body's accessToken or a "Bearer <token>" header; without one the signed-in user's is used
+func (h *SnapshotHandler) GenerateSnapshot(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	var req struct {
+		AccessToken string `json:"accessToken"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
+		return
+	}
+	if req.AccessToken == "" {
+		req.AccessToken = strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	}
+
+	job, created := h.jobs.Submit(projectID, req.AccessToken, services.TriggerAPI)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"ok":           true,
+		"projectId":    projectID,
+		"jobId":        job.ID,
+		"job":          job,
+		"deduplicated": !created,
+	})
+}
+
+// ListJobs lists a project's recent snapshot jobs, newest first
+func (h *SnapshotHandler) ListJobs(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	list, err := h.jobs.List(projectID)
+	if err != nil {
+		h.logger.Error("Failed to list snapshot jobs: %v", err)
+		http.Error(w, `{"error":"failed to list snapshot jobs"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"projectId": projectID,
+		"jobs":      list,
+	})
+}
+
+// GetJob gets one of a project's snapshot jobs
+func (h *SnapshotHandler) GetJob(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+	jobID := r.PathValue("id")
+
+	job, err := h.jobs.Get(projectID, jobID)
+	if errors.Is(err, services.ErrJobNotFound) {
+		http.Error(w, `{"error":"job not found"}`, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to get snapshot job: %v", err)
+		http.Error(w, `{"error":"failed to get snapshot job"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// CancelJob cancels a queued or running snapshot job
+func (h *SnapshotHandler) CancelJob(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+	jobID := r.PathValue("id")
+
+	job, err := h.jobs.Cancel(projectID, jobID)
+	if errors.Is(err, services.ErrJobNotFound) {
+		http.Error(w, `{"error":"job not found"}`, http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, services.ErrJobFinished) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusConflict)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error": "job already finished",
+			"job":   job,
+		})
+		return
+	}
+	if err != nil {
+		h.logger.Error("Failed to cancel snapshot job: %v", err)
+		http.Error(w, `{"error":"failed to cancel snapshot job"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// GetPolicy gets a project's snapshot refresh policy and schedule
+func (h *SnapshotHandler) GetPolicy(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.scheduler.GetSchedule(projectID))
+}
+
+// UpdatePolicy sets a project's own snapshot refresh policy
+// Unset fields take the agent defaults
+func (h *SnapshotHandler) UpdatePolicy(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	var req services.SnapshotPolicy
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(h.scheduler.DefaultPolicy()); err != nil {
+		http.Error(w, `{"error":"invalid snapshot policy"}`, http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.scheduler.SetPolicy(projectID, req)
+	if err != nil {
+		h.logger.Error("Failed to update snapshot policy: %v", err)
+		http.Error(w, `{"error":"failed to update snapshot policy"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// ResetPolicy returns a project to the default snapshot refresh policy
+func (h *SnapshotHandler) ResetPolicy(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	result, err := h.scheduler.ResetPolicy(projectID)
+	if err != nil {
+		h.logger.Error("Failed to reset snapshot policy: %v", err)
+		http.Error(w, `{"error":"failed to reset snapshot policy"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 
 	"github.com/vidsync/agent/internal/services"
@@ -121,3 +122,114 @@ func (h *SyncHandler) GetSyncStatus(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
+
+// GetTransfers gets per-device transfer progress of a project
+func (h *SyncHandler) GetTransfers(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	result, err := h.service.GetTransfers(r.Context(), projectID)
+	if err != nil {
+		h.logger.Error("Failed to get transfers: %v", err)
+		http.Error(w, `{"error":"failed to get transfers"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetFolderRole gets the folder type of a project on this device
+func (h *SyncHandler) GetFolderRole(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	result, err := h.service.GetFolderRole(r.Context(), projectID)
+	if err != nil {
+		h.logger.Error("Failed to get folder role: %v", err)
+		http.Error(w, `{"error":"failed to get folder role"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// SetFolderRole switches a project between sendreceive, sendonly and receiveonly
+func (h *SyncHandler) SetFolderRole(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	var req struct {
+		FolderType string `json:"folderType"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
+		return
+	}
+
+	switch req.FolderType {
+	case services.FolderTypeSendReceive, services.FolderTypeSendOnly, services.FolderTypeReceiveOnly:
+	default:
+		http.Error(w, `{"error":"folderType must be sendreceive, sendonly or receiveonly"}`, http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.service.SetFolderRole(r.Context(), projectID, req.FolderType)
+	if err != nil {
+		h.logger.Error("Failed to set folder role: %v", err)
+		http.Error(w, `{"error":"failed to set folder role"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// GetLocalChanges lists local additions in a receive-only project
+func (h *SyncHandler) GetLocalChanges(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	result, err := h.service.GetLocalChanges(r.Context(), projectID)
+	if err != nil {
+		h.writeFolderTypeError(w, err, "failed to get local changes")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// RevertLocalChanges discards local changes in a receive-only project
+func (h *SyncHandler) RevertLocalChanges(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	if err := h.service.RevertLocalChanges(r.Context(), projectID); err != nil {
+		h.writeFolderTypeError(w, err, "failed to revert local changes")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+}
+
+// OverrideRemoteChanges pushes the local state of a send-only project to all devices
+func (h *SyncHandler) OverrideRemoteChanges(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	if err := h.service.OverrideRemoteChanges(r.Context(), projectID); err != nil {
+		h.writeFolderTypeError(w, err, "failed to override remote changes")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"ok": true})
+}
+
+// writeFolderTypeError responds 409 when the folder has the wrong type, 500 otherwise
+func (h *SyncHandler) writeFolderTypeError(w http.ResponseWriter, err error, message string) {
+	if errors.Is(err, services.ErrFolderTypeMismatch) {
+		http.Error(w, `{"error":"operation not supported for this folder type"}`, http.StatusConflict)
+		return
+	}
+	h.logger.Error("%s: %v", message, err)
+	http.Error(w, `{"error":"`+message+`"}`, http.StatusInternalServerError)
+}
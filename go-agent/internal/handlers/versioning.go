@@ -0,0 +1,111 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/vidsync/agent/internal/services"
+	"github.com/vidsync/agent/internal/util"
+)
+
+// VersioningHandler handles file versioning HTTP requests
+type VersioningHandler struct {
+	service *services.VersioningService
+	logger  *util.Logger
+}
+
+// NewVersioningHandler creates a new versioning handler
+func NewVersioningHandler(service *services.VersioningService, logger *util.Logger) *VersioningHandler {
+	return &VersioningHandler{
+		service: service,
+		logger:  logger,
+	}
+}
+
+// GetSettings gets the versioning settings of a project
+func (h *VersioningHandler) GetSettings(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	result, err := h.service.GetSettings(r.Context(), projectID)
+	if err != nil {
+		h.logger.Error("Failed to get versioning settings: %v", err)
+		http.Error(w, `{"error":"failed to get versioning settings"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// UpdateSettings changes the versioning settings of a project
+func (h *VersioningHandler) UpdateSettings(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	var req services.VersioningSettings
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
+		return
+	}
+	if err := req.Validate(); err != nil {
+		http.Error(w, `{"error":"invalid versioning settings"}`, http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.service.UpdateSettings(r.Context(), projectID, &req)
+	if err != nil {
+		h.logger.Error("Failed to update versioning settings: %v", err)
+		http.Error(w, `{"error":"failed to update versioning settings"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// ListVersions lists archived file versions of a project
+// Optional query param: path (file or directory to filter by)
+func (h *VersioningHandler) ListVersions(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	files, err := h.service.ListVersions(r.Context(), projectID, r.URL.Query().Get("path"))
+	if err != nil {
+		h.logger.Error("Failed to list versions: %v", err)
+		http.Error(w, `{"error":"failed to list versions"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"projectId": projectID,
+		"files":     files,
+	})
+}
+
+// RestoreVersion restores files to archived versions
+func (h *VersioningHandler) RestoreVersion(w http.ResponseWriter, r *http.Request) {
+	projectID := r.PathValue("projectId")
+
+	var req services.RestoreVersionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, `{"error":"invalid request"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Path == "" && len(req.Files) == 0 {
+		http.Error(w, `{"error":"path and versionTime or files are required"}`, http.StatusBadRequest)
+		return
+	}
+	if req.Path != "" && req.VersionTime.IsZero() {
+		http.Error(w, `{"error":"versionTime is required"}`, http.StatusBadRequest)
+		return
+	}
+
+	result, err := h.service.RestoreVersion(r.Context(), projectID, &req)
+	if err != nil {
+		h.logger.Error("Failed to restore version: %v", err)
+		http.Error(w, `{"error":"failed to restore version"}`, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
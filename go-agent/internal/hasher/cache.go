@@ -0,0 +1,127 @@
+package hasher
+
+import (
+	"database/sql"
+	"fmt"
+	stdsync "sync"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Entries neither stored nor reused for cacheMaxAge, e.g. of deleted or moved files, are pruned
+const (
+	cacheMaxAge     = 30 * 24 * time.Hour
+	cachePruneEvery = 24 * time.Hour
+)
+
+// Cache remembers content hashes of files that haven't changed since they were hashed
+// An entry is only reused while the file's size, modification time and inode all still match
+// hashed_at is refreshed whenever an entry is reused, so it tells when the file was last seen
+type Cache struct {
+	db *sql.DB
+
+	pruneMu   stdsync.Mutex
+	lastPrune time.Time
+}
+
+// NewCache opens or creates the hash cache database at dbPath
+func NewCache(dbPath string) (*Cache, error) {
+	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	CREATE TABLE IF NOT EXISTS file_hashes (
+		path TEXT PRIMARY KEY,
+		size INTEGER NOT NULL,
+		mod_time INTEGER NOT NULL,
+		inode INTEGER NOT NULL,
+		hash TEXT NOT NULL,
+		hashed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	if _, err := db.Exec(query); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Cache{db: db}, nil
+}
+
+// Lookup returns the cached hash of a file, or false if it is missing or stale
+func (c *Cache) Lookup(path string, size int64, modTime time.Time, inode uint64) (string, bool) {
+	var hash string
+	err := c.db.QueryRow(
+		`SELECT hash FROM file_hashes WHERE path = ? AND size = ? AND mod_time = ? AND inode = ?`,
+		path, size, modTime.UnixNano(), int64(inode),
+	).Scan(&hash)
+	if err != nil {
+		return "", false
+	}
+	return hash, true
+}
+
+// Store records the hash of a file in its current state
+func (c *Cache) Store(path string, size int64, modTime time.Time, inode uint64, hash string) error {
+	_, err := c.db.Exec(
+		`INSERT INTO file_hashes (path, size, mod_time, inode, hash, hashed_at) VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		ON CONFLICT(path) DO UPDATE SET size = excluded.size, mod_time = excluded.mod_time, inode = excluded.inode, hash = excluded.hash, hashed_at = excluded.hashed_at`,
+		path, size, modTime.UnixNano(), int64(inode), hash,
+	)
+	return err
+}
+
+// Touch marks entries as seen now, so they aren't pruned
+func (c *Cache) Touch(paths []string) error {
+	if len(paths) == 0 {
+		return nil
+	}
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`UPDATE file_hashes SET hashed_at = CURRENT_TIMESTAMP WHERE path = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, p := range paths {
+		if _, err := stmt.Exec(p); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Prune drops entries not seen within maxAge and returns how many were dropped
+func (c *Cache) Prune(maxAge time.Duration) (int64, error) {
+	res, err := c.db.Exec(
+		`DELETE FROM file_hashes WHERE hashed_at < datetime('now', ?)`,
+		fmt.Sprintf("-%d seconds", int64(maxAge/time.Second)),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// pruneIfDue prunes entries older than cacheMaxAge at most once per cachePruneEvery
+func (c *Cache) pruneIfDue() {
+	c.pruneMu.Lock()
+	defer c.pruneMu.Unlock()
+	if time.Since(c.lastPrune) < cachePruneEvery {
+		return
+	}
+	if _, err := c.Prune(cacheMaxAge); err == nil {
+		c.lastPrune = time.Now()
+	}
+}
+
+// Close closes the cache database
+func (c *Cache) Close() error {
+	return c.db.Close()
+}
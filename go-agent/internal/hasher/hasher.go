@@ -0,0 +1,210 @@
+package hasher
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	stdsync "sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vidsync/agent/internal/api"
+)
+
+const (
+	readBufferSize   = 1 << 20 // 1 MiB per read, which is also the rate limiter's granularity
+	progressInterval = 250 * time.Millisecond
+)
+
+// Options configures a Hasher
+type Options struct {
+	Workers        int   // Files hashed in parallel, defaults to the CPU count capped at 8
+	BytesPerSecond int64 // Read rate cap shared by all workers, 0 for unlimited
+}
+
+// Progress is a point-in-time report of a HashFiles call
+type Progress struct {
+	Files       int   `json:"files"`       // Regular files to hash
+	Done        int   `json:"done"`        // Files hashed, served from cache, or failed
+	Cached      int   `json:"cached"`      // Files served from the cache
+	Failed      int   `json:"failed"`      // Files that couldn't be read
+	BytesHashed int64 `json:"bytesHashed"` // Bytes read from disk
+	BytesDone   int64 `json:"bytesDone"`   // Size of the files done, including those served from cache
+}
+
+// ProgressFunc receives throttled progress reports, and always the final one
+type ProgressFunc func(Progress)
+
+// Hasher computes SHA-256 content hashes with a bounded worker pool
+type Hasher struct {
+	cache   *Cache
+	workers int
+	limiter *rateLimiter
+}
+
+// New creates a hasher; cache may be nil to always read files
+func New(cache *Cache, opts Options) *Hasher {
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+		if workers > 8 {
+			workers = 8 // Beyond this, hashing is disk bound
+		}
+	}
+	return &Hasher{
+		cache:   cache,
+		workers: workers,
+		limiter: newRateLimiter(opts.BytesPerSecond),
+	}
+}
+
+// HashFiles fills in the Hash of every regular file in files, whose paths are relative to root
+// Files that can't be read are left without a hash; only ctx cancellation aborts the run
+func (h *Hasher) HashFiles(ctx context.Context, root string, files []api.FileInfo, progress ProgressFunc) (Progress, error) {
+	jobs := make(chan int)
+	var (
+		done, cached, failed   int64
+		bytesHashed, bytesDone int64
+	)
+
+	total := 0
+	for _, f := range files {
+		if hashable(f) {
+			total++
+		}
+	}
+
+	snapshot := func() Progress {
+		return Progress{
+			Files:       total,
+			Done:        int(atomic.LoadInt64(&done)),
+			Cached:      int(atomic.LoadInt64(&cached)),
+			Failed:      int(atomic.LoadInt64(&failed)),
+			BytesHashed: atomic.LoadInt64(&bytesHashed),
+			BytesDone:   atomic.LoadInt64(&bytesDone),
+		}
+	}
+
+	// Paths served from the cache, so their entries are kept
+	var (
+		hitsMu stdsync.Mutex
+		hits   []string
+	)
+
+	var wg stdsync.WaitGroup
+	for i := 0; i < h.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			buf := make([]byte, readBufferSize)
+			for idx := range jobs {
+				path := filepath.Join(root, files[idx].Path)
+				hash, fromCache, n, err := h.hashFile(ctx, path, buf)
+				switch {
+				case err != nil:
+					atomic.AddInt64(&failed, 1)
+				case fromCache:
+					atomic.AddInt64(&cached, 1)
+					hitsMu.Lock()
+					hits = append(hits, path)
+					hitsMu.Unlock()
+				}
+				files[idx].Hash = hash
+				atomic.AddInt64(&bytesHashed, n)
+				atomic.AddInt64(&bytesDone, files[idx].Size)
+				atomic.AddInt64(&done, 1)
+			}
+		}()
+	}
+
+	// Report progress while the workers run
+	reporterDone := make(chan struct{})
+	if progress != nil {
+		go func() {
+			ticker := time.NewTicker(progressInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-reporterDone:
+					return
+				case <-ticker.C:
+					progress(snapshot())
+				}
+			}
+		}()
+	}
+
+	var err error
+feed:
+	for i := range files {
+		if !hashable(files[i]) {
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+			break feed
+		case jobs <- i:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	close(reporterDone)
+
+	if h.cache != nil {
+		h.cache.Touch(hits)
+		h.cache.pruneIfDue()
+	}
+
+	final := snapshot()
+	if progress != nil {
+		progress(final)
+	}
+	return final, err
+}
+
+// hashable reports whether an entry is a single file whose content has to be hashed
+// Collapsed image sequences stand for many files and carry no hash of their own. A hash the
+// entry already has, e.g. from the file index, is replaced too: the index doesn't know inodes,
+// so only the cache can tell the file wasn't replaced in place since
+func hashable(f api.FileInfo) bool {
+	return !f.IsDirectory && f.Sequence == nil
+}
+
+// hashFile returns a file's hash, whether it came from the cache, and how many bytes were read
+func (h *Hasher) hashFile(ctx context.Context, path string, buf []byte) (string, bool, int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", false, 0, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", false, 0, err
+	}
+	ino := inode(info)
+
+	if h.cache != nil {
+		if hash, ok := h.cache.Lookup(path, info.Size(), info.ModTime(), ino); ok {
+			return hash, true, 0, nil
+		}
+	}
+
+	sum := sha256.New()
+	n, err := io.CopyBuffer(sum, &limitedReader{ctx: ctx, r: f, limiter: h.limiter}, buf)
+	if err != nil {
+		return "", false, n, err
+	}
+	hash := hex.EncodeToString(sum.Sum(nil))
+
+	// Don't cache a file that changed while it was being read
+	if after, err := os.Stat(path); err == nil && after.Size() == info.Size() && after.ModTime().Equal(info.ModTime()) && h.cache != nil {
+		h.cache.Store(path, info.Size(), info.ModTime(), ino, hash)
+	}
+	return hash, false, n, nil
+}
@@ -0,0 +1,16 @@
+//go:build !windows
+
+package hasher
+
+import (
+	"os"
+	"syscall"
+)
+
+// inode returns the file's inode number, so a file replaced in place is never mistaken for the cached one
+func inode(info os.FileInfo) uint64 {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return uint64(st.Ino)
+	}
+	return 0
+}
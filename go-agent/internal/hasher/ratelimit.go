@@ -0,0 +1,72 @@
+package hasher
+
+import (
+	"context"
+	"io"
+	stdsync "sync"
+	"time"
+)
+
+// rateLimiter spreads reads across all workers so they share one bytes-per-second budget
+type rateLimiter struct {
+	mu             stdsync.Mutex
+	bytesPerSecond int64
+	next           time.Time // When the budget allows the next read to start
+}
+
+// newRateLimiter returns a limiter for bytesPerSecond, or nil for no limit
+func newRateLimiter(bytesPerSecond int64) *rateLimiter {
+	if bytesPerSecond <= 0 {
+		return nil
+	}
+	return &rateLimiter{bytesPerSecond: bytesPerSecond}
+}
+
+// wait blocks until n more bytes may be read
+func (rl *rateLimiter) wait(ctx context.Context, n int) error {
+	if rl == nil {
+		return nil
+	}
+
+	rl.mu.Lock()
+	now := time.Now()
+	if rl.next.Before(now) {
+		rl.next = now
+	}
+	start := rl.next
+	rl.next = rl.next.Add(time.Duration(int64(n) * int64(time.Second) / rl.bytesPerSecond))
+	rl.mu.Unlock()
+
+	delay := time.Until(start)
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// limitedReader reads through a rate limiter, honouring ctx cancellation between reads
+type limitedReader struct {
+	ctx     context.Context
+	r       io.Reader
+	limiter *rateLimiter
+}
+
+func (lr *limitedReader) Read(p []byte) (int, error) {
+	if err := lr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := lr.r.Read(p)
+	if n > 0 {
+		if werr := lr.limiter.wait(lr.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
@@ -0,0 +1,230 @@
+package ignore
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// internalNames are Syncthing's own files, which it never syncs
+var internalNames = map[string]bool{
+	".stfolder":   true,
+	".stignore":   true,
+	".stversions": true,
+}
+
+// rule is a single compiled .stignore pattern
+type rule struct {
+	negate bool
+	re     *regexp.Regexp
+}
+
+// Matcher matches project-relative paths against .stignore patterns
+// It follows Syncthing's semantics: the first matching pattern wins, patterns without
+// a leading "/" match at any depth, and a matched directory excludes everything below it
+type Matcher struct {
+	rules        []rule
+	hasNegations bool
+	includes     []string
+}
+
+// ValidationError describes an invalid line in an ignore file
+type ValidationError struct {
+	Line    int    `json:"line"`
+	Pattern string `json:"pattern"`
+	Message string `json:"message"`
+}
+
+// ValidationErrors is returned when one or more ignore patterns are invalid
+type ValidationErrors []ValidationError
+
+func (e ValidationErrors) Error() string {
+	if len(e) == 0 {
+		return "invalid ignore patterns"
+	}
+	return fmt.Sprintf("invalid ignore pattern on line %d (%q): %s", e[0].Line, e[0].Pattern, e[0].Message)
+}
+
+// Validate checks ignore lines and returns every invalid one
+func Validate(lines []string) ValidationErrors {
+	var errs ValidationErrors
+	for i, line := range lines {
+		if strings.ContainsAny(line, "\r\n") {
+			errs = append(errs, ValidationError{Line: i + 1, Pattern: line, Message: "pattern must be a single line"})
+			continue
+		}
+		if _, _, err := compileLine(line); err != nil {
+			errs = append(errs, ValidationError{Line: i + 1, Pattern: line, Message: err.Error()})
+		}
+	}
+	return errs
+}
+
+// Parse compiles ignore lines into a Matcher
+func Parse(lines []string) (*Matcher, error) {
+	if errs := Validate(lines); len(errs) > 0 {
+		return nil, errs
+	}
+
+	m := &Matcher{}
+	for _, line := range lines {
+		r, include, _ := compileLine(line)
+		if include != "" {
+			m.includes = append(m.includes, include)
+			continue
+		}
+		if r == nil {
+			continue
+		}
+		m.rules = append(m.rules, *r)
+		if r.negate {
+			m.hasNegations = true
+		}
+	}
+	return m, nil
+}
+
+// Includes returns the files referenced by #include lines
+// Their patterns are not read here; parse Syncthing's expanded patterns to apply them
+func (m *Matcher) Includes() []string {
+	return m.includes
+}
+
+// Match reports whether a slash-separated project-relative path is ignored
+func (m *Matcher) Match(rel string) bool {
+	rel = strings.TrimPrefix(path.Clean("/"+rel), "/")
+	if rel == "" {
+		return false
+	}
+	if internalNames[strings.SplitN(rel, "/", 2)[0]] {
+		return true
+	}
+	if m == nil {
+		return false
+	}
+
+	for _, r := range m.rules {
+		if r.re.MatchString(rel) {
+			return !r.negate
+		}
+	}
+	return false
+}
+
+// SkipDir reports whether a directory and everything below it can be skipped
+// Directories can't be skipped while negated patterns might re-include a child
+func (m *Matcher) SkipDir(rel string) bool {
+	if m != nil && m.hasNegations {
+		rel = strings.TrimPrefix(path.Clean("/"+rel), "/")
+		return internalNames[strings.SplitN(rel, "/", 2)[0]]
+	}
+	return m.Match(rel)
+}
+
+// compileLine compiles one ignore line
+// Returns a nil rule for blank lines and comments, and the file name for #include lines
+func compileLine(line string) (*rule, string, error) {
+	// Only surrounding whitespace of blank lines and directives is trimmed; file names may contain spaces
+	if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "//") {
+		return nil, "", nil
+	}
+	if strings.HasPrefix(line, "#include") {
+		include := strings.TrimSpace(strings.TrimPrefix(line, "#include"))
+		if include == "" {
+			return nil, "", fmt.Errorf("#include requires a file name")
+		}
+		return nil, include, nil
+	}
+
+	r := &rule{}
+	fold := runtime.GOOS == "darwin" || runtime.GOOS == "windows"
+	pattern := line
+prefixes:
+	for {
+		switch {
+		case strings.HasPrefix(pattern, "!"):
+			r.negate = true
+			pattern = pattern[1:]
+		case strings.HasPrefix(pattern, "(?i)"):
+			fold = true
+			pattern = pattern[4:]
+		case strings.HasPrefix(pattern, "(?d)"):
+			pattern = pattern[4:] // Deletable: only affects Syncthing's directory removal
+		default:
+			break prefixes
+		}
+	}
+
+	rooted := strings.HasPrefix(pattern, "/")
+	pattern = strings.Trim(pattern, "/")
+	if pattern == "" {
+		return nil, "", fmt.Errorf("pattern is empty")
+	}
+
+	expr, err := globToRegexp(pattern)
+	if err != nil {
+		return nil, "", err
+	}
+
+	// Matching a directory matches everything inside it
+	expr += "(?:/.*)?$"
+	if rooted {
+		expr = "^" + expr
+	} else {
+		expr = "^(?:.*/)?" + expr
+	}
+	if fold {
+		expr = "(?i)" + expr
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, "", fmt.Errorf("invalid pattern: %v", err)
+	}
+	r.re = re
+	return r, "", nil
+}
+
+// globToRegexp converts a Syncthing glob to a regular expression body
+func globToRegexp(glob string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(glob); i++ {
+		c := glob[i]
+		switch c {
+		case '*':
+			if i+1 < len(glob) && glob[i+1] == '*' {
+				b.WriteString(".*")
+				i++
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated character class")
+			}
+			class := glob[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			if class == "" || class == "^" {
+				return "", fmt.Errorf("empty character class")
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 >= len(glob) {
+				return "", fmt.Errorf("trailing escape character")
+			}
+			i++
+			b.WriteString(regexp.QuoteMeta(string(glob[i])))
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,160 @@
+package ignore
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestGlobToRegexp(t *testing.T) {
+	tests := []struct {
+		glob    string
+		match   []string
+		noMatch []string
+	}{
+		{"*.mov", []string{"a.mov", ".mov"}, []string{"a/b.mov", "a.mov2", "amov"}},
+		{"**.mov", []string{"a.mov", "a/b/c.mov"}, []string{"a.mp4"}},
+		{"a/**/b", []string{"a/x/b", "a/x/y/b"}, []string{"a/b", "ab/x/b"}},
+		{"shot_????.exr", []string{"shot_0001.exr"}, []string{"shot_001.exr", "shot_0/01.exr"}},
+		{"[abc].txt", []string{"a.txt", "c.txt"}, []string{"d.txt", "ab.txt"}},
+		{"[!abc].txt", []string{"d.txt"}, []string{"a.txt"}},
+		{"[a-c]1", []string{"b1"}, []string{"d1"}},
+		{`\*.txt`, []string{"*.txt"}, []string{"a.txt"}},
+		{"a+b (1).txt", []string{"a+b (1).txt"}, []string{"aab (1).txt", "a+b 1.txt"}},
+		{"[\\].txt", []string{`\.txt`}, []string{"a.txt"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.glob, func(t *testing.T) {
+			expr, err := globToRegexp(tt.glob)
+			if err != nil {
+				t.Fatalf("globToRegexp(%q): %v", tt.glob, err)
+			}
+			re := regexp.MustCompile("^" + expr + "$")
+			for _, s := range tt.match {
+				if !re.MatchString(s) {
+					t.Errorf("%q (%s) doesn't match %q", tt.glob, expr, s)
+				}
+			}
+			for _, s := range tt.noMatch {
+				if re.MatchString(s) {
+					t.Errorf("%q (%s) matches %q", tt.glob, expr, s)
+				}
+			}
+		})
+	}
+}
+
+func TestGlobToRegexpErrors(t *testing.T) {
+	for _, glob := range []string{"[abc", "a[]", "[!]", `a\`} {
+		if expr, err := globToRegexp(glob); err == nil {
+			t.Errorf("globToRegexp(%q) = %q, want an error", glob, expr)
+		}
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		ignored  []string
+		kept     []string
+	}{
+		{
+			name:     "unrooted patterns match at any depth",
+			patterns: []string{"*.tmp", "cache"},
+			ignored:  []string{"a.tmp", "x/y/a.tmp", "cache", "x/cache", "x/cache/file.mov"},
+			kept:     []string{"a.tmp.mov", "caches", "x/cache.mov"},
+		},
+		{
+			name:     "rooted patterns match at the top only",
+			patterns: []string{"/render"},
+			ignored:  []string{"render", "render/out.exr"},
+			kept:     []string{"shots/render", "renders"},
+		},
+		{
+			name:     "first matching pattern wins",
+			patterns: []string{"!keep.tmp", "*.tmp"},
+			ignored:  []string{"drop.tmp"},
+			kept:     []string{"keep.tmp", "x/keep.tmp"},
+		},
+		{
+			name:     "later negations don't re-include",
+			patterns: []string{"*.tmp", "!keep.tmp"},
+			ignored:  []string{"drop.tmp", "keep.tmp"},
+		},
+		{
+			name:     "case folding",
+			patterns: []string{"(?i)*.MOV", "(?d)(?i)/Thumbs.db"},
+			ignored:  []string{"a.mov", "a.MoV", "thumbs.DB"},
+			kept:     []string{"x/thumbs.db2"},
+		},
+		{
+			name:     "comments, blank lines and includes are not patterns",
+			patterns: []string{"// *.mov", "", "   ", "#include more.stignore"},
+			kept:     []string{"a.mov", "more.stignore"},
+		},
+		{
+			name:    "Syncthing's own files are always ignored",
+			ignored: []string{".stfolder", ".stversions/a.mov", "/.stignore"},
+			kept:    []string{"x/.stfolder", ".", ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(tt.patterns)
+			if err != nil {
+				t.Fatalf("Parse(%q): %v", tt.patterns, err)
+			}
+			for _, p := range tt.ignored {
+				if !m.Match(p) {
+					t.Errorf("%q is not ignored", p)
+				}
+			}
+			for _, p := range tt.kept {
+				if m.Match(p) {
+					t.Errorf("%q is ignored", p)
+				}
+			}
+		})
+	}
+}
+
+func TestSkipDir(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		dir      string
+		want     bool
+	}{
+		{"ignored directory", []string{"cache"}, "x/cache", true},
+		{"kept directory", []string{"cache"}, "x/media", false},
+		{"negations may re-include a child", []string{"!cache/keep.mov", "cache"}, "cache", false},
+		{"Syncthing's own directory despite negations", []string{"!a"}, ".stversions", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := Parse(tt.patterns)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got := m.SkipDir(tt.dir); got != tt.want {
+				t.Errorf("SkipDir(%q) = %v, want %v", tt.dir, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	errs := Validate([]string{"*.mov", "[abc", "#include", "/", "ok\nsplit", "!"})
+	want := []int{2, 3, 4, 5, 6}
+	if len(errs) != len(want) {
+		t.Fatalf("Validate = %v, want errors on lines %v", errs, want)
+	}
+	for i, e := range errs {
+		if e.Line != want[i] || e.Message == "" {
+			t.Errorf("error %d = %+v, want line %d with a message", i, e, want[i])
+		}
+	}
+	if _, err := Parse([]string{"[abc"}); err == nil {
+		t.Error("Parse accepted an invalid pattern")
+	}
+}
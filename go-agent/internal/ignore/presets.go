@@ -0,0 +1,104 @@
+package ignore
+
+import "sort"
+
+// Preset is a named set of ignore patterns for common video workflow clutter
+type Preset struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Patterns    []string `json:"patterns"`
+}
+
+// presets is the built-in preset library, keyed by name
+var presets = map[string]Preset{
+	"os-junk": {
+		Name:        "os-junk",
+		Description: "Operating system metadata files",
+		Patterns: []string{
+			"(?d).DS_Store",
+			"(?d)._*",
+			"(?d).Spotlight-V100",
+			"(?d).Trashes",
+			"(?d).fseventsd",
+			"(?d)Thumbs.db",
+			"(?d)desktop.ini",
+			"(?d)$RECYCLE.BIN",
+		},
+	},
+	"render-cache": {
+		Name:        "render-cache",
+		Description: "NLE render, media and peak caches (Premiere, After Effects, Resolve, Final Cut)",
+		Patterns: []string{
+			"Media Cache",
+			"Media Cache Files",
+			"Peak Files",
+			"*.pek",
+			"*.cfa",
+			"*.ims",
+			"Adobe Premiere Pro Video Previews",
+			"Adobe Premiere Pro Audio Previews",
+			"Adobe After Effects Disk Cache",
+			"CacheClip",
+			".gallery",
+			"Render Files",
+			"Analysis Files",
+			"Transcoded Media",
+		},
+	},
+	"autosaves": {
+		Name:        "autosaves",
+		Description: "Editor autosave folders and lock files",
+		Patterns: []string{
+			"Adobe Premiere Pro Auto-Save",
+			"Auto-Save",
+			"*.prproj.lck",
+			"*.aep.lck",
+			"*.autosave",
+			"*.tmp",
+			"~$*",
+		},
+	},
+	"proxies": {
+		Name:        "proxies",
+		Description: "Proxy and optimized media that each editor can regenerate locally",
+		Patterns: []string{
+			"Proxies",
+			"Proxy Media",
+			"Optimized Media",
+			"*_Proxy.*",
+		},
+	},
+}
+
+// Presets returns all built-in presets sorted by name
+func Presets() []Preset {
+	result := make([]Preset, 0, len(presets))
+	for _, p := range presets {
+		result = append(result, p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+// GetPreset returns a built-in preset by name
+func GetPreset(name string) (Preset, bool) {
+	p, ok := presets[name]
+	return p, ok
+}
+
+// Merge appends patterns that are not already present, keeping the original order
+func Merge(lines []string, patterns ...string) []string {
+	seen := make(map[string]bool, len(lines))
+	for _, l := range lines {
+		seen[l] = true
+	}
+	for _, p := range patterns {
+		if !seen[p] {
+			lines = append(lines, p)
+			seen[p] = true
+		}
+	}
+	return lines
+}
@@ -0,0 +1,450 @@
+package index
+
+import (
+	"database/sql"
+	"errors"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/vidsync/agent/internal/api"
+)
+
+// ErrNotBuilt is returned when a project has no index yet
+var ErrNotBuilt = errors.New("file index not built")
+
+// Entry is an indexed file or directory and its sync state
+type Entry struct {
+	api.FileInfo
+	SyncState string `json:"syncState,omitempty"` // Empty until sync states were read
+}
+
+// Status describes a project's index
+type Status struct {
+	ProjectID  string    `json:"projectId"`
+	FolderPath string    `json:"folderPath"`
+	Entries    int       `json:"entries"`
+	TotalSize  int64     `json:"totalSize"`
+	Hashed     int       `json:"hashed"` // Files with a content hash
+	BuiltAt    time.Time `json:"builtAt"`
+	UpdatedAt  time.Time `json:"updatedAt"`
+}
+
+// Store keeps an index of every project's files, so listings don't have to walk the disk
+// Entries are kept in walk order (see api.SyncthingClient.WalkFiles) by their walk key
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore opens or creates the index database at dbPath
+func NewStore(dbPath string) (*Store, error) {
+	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	CREATE TABLE IF NOT EXISTS files (
+		project_id TEXT NOT NULL,
+		path TEXT NOT NULL,
+		walk_key TEXT NOT NULL,
+		parent TEXT NOT NULL,
+		name TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		mod_time INTEGER NOT NULL,
+		is_dir INTEGER NOT NULL,
+		hash TEXT NOT NULL DEFAULT '',
+		sync_state TEXT NOT NULL DEFAULT '',
+		generation INTEGER NOT NULL,
+		PRIMARY KEY (project_id, path)
+	);
+	CREATE INDEX IF NOT EXISTS files_walk ON files (project_id, walk_key);
+	CREATE INDEX IF NOT EXISTS files_parent ON files (project_id, parent);
+	CREATE TABLE IF NOT EXISTS projects (
+		project_id TEXT PRIMARY KEY,
+		folder_path TEXT NOT NULL,
+		generation INTEGER NOT NULL,
+		built_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);
+	`
+	if _, err := db.Exec(query); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Status returns the state of a project's index, or ErrNotBuilt
+func (s *Store) Status(projectID string) (*Status, error) {
+	st := &Status{ProjectID: projectID}
+	var builtAt, updatedAt int64
+	err := s.db.QueryRow(`SELECT folder_path, built_at, updated_at FROM projects WHERE project_id = ?`, projectID).
+		Scan(&st.FolderPath, &builtAt, &updatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotBuilt
+	}
+	if err != nil {
+		return nil, err
+	}
+	st.BuiltAt = time.Unix(0, builtAt)
+	st.UpdatedAt = time.Unix(0, updatedAt)
+
+	err = s.db.QueryRow(
+		`SELECT COUNT(*), COALESCE(SUM(size), 0), COALESCE(SUM(hash != ''), 0) FROM files WHERE project_id = ? AND path != '.'`,
+		projectID,
+	).Scan(&st.Entries, &st.TotalSize, &st.Hashed)
+	if err != nil {
+		return nil, err
+	}
+	return st, nil
+}
+
+// FolderPath returns the folder a project's index was built from, or ErrNotBuilt
+func (s *Store) FolderPath(projectID string) (string, error) {
+	var folderPath string
+	err := s.db.QueryRow(`SELECT folder_path FROM projects WHERE project_id = ?`, projectID).Scan(&folderPath)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrNotBuilt
+	}
+	return folderPath, err
+}
+
+// Projects returns the IDs of the projects with an index
+func (s *Store) Projects() ([]string, error) {
+	rows, err := s.db.Query(`SELECT project_id FROM projects`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []string{}
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// Replace rebuilds a project's index from a full walk of its folder
+// walk must call add for every entry, the folder itself included; hashes and sync states
+// of entries that haven't changed are kept
+func (s *Store) Replace(projectID, folderPath string, walk func(add func(api.FileInfo) error) error) error {
+	return s.replace(projectID, folderPath, "", walk)
+}
+
+// ReplaceTree rebuilds the part of a project's index at and below sub, a path relative to the folder
+// walk must call add for every entry at or below sub; sub is removed if walk adds nothing
+func (s *Store) ReplaceTree(projectID, sub string, walk func(add func(api.FileInfo) error) error) error {
+	return s.replace(projectID, "", slashPath(sub), walk)
+}
+
+// replace upserts every entry walk adds under a new generation, then drops the entries of the
+// replaced part that weren't added; sub is "" to replace the whole index
+func (s *Store) replace(projectID, folderPath, sub string, walk func(add func(api.FileInfo) error) error) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UnixNano()
+	var generation int64
+	err = tx.QueryRow(`SELECT generation FROM projects WHERE project_id = ?`, projectID).Scan(&generation)
+	switch {
+	case errors.Is(err, sql.ErrNoRows):
+		if sub != "" {
+			return ErrNotBuilt
+		}
+	case err != nil:
+		return err
+	}
+	generation++
+
+	if sub == "" {
+		_, err = tx.Exec(
+			`INSERT INTO projects (project_id, folder_path, generation, built_at, updated_at) VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT(project_id) DO UPDATE SET folder_path = excluded.folder_path, generation = excluded.generation,
+				built_at = excluded.built_at, updated_at = excluded.updated_at`,
+			projectID, folderPath, generation, now, now,
+		)
+	} else {
+		_, err = tx.Exec(`UPDATE projects SET generation = ?, updated_at = ? WHERE project_id = ?`, generation, now, projectID)
+	}
+	if err != nil {
+		return err
+	}
+
+	stmt, err := tx.Prepare(upsertFile)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	if err := walk(func(f api.FileInfo) error {
+		return putFile(stmt, projectID, f, generation)
+	}); err != nil {
+		return err
+	}
+
+	if sub == "" {
+		_, err = tx.Exec(`DELETE FROM files WHERE project_id = ? AND generation != ?`, projectID, generation)
+	} else {
+		key := walkKey(sub)
+		_, err = tx.Exec(
+			`DELETE FROM files WHERE project_id = ? AND generation != ? AND (walk_key = ? OR (walk_key > ? AND walk_key < ?))`,
+			projectID, generation, key, key+"\x01", key+"\x02",
+		)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// upsertFile adds or updates an entry, clearing its hash when its content may have changed
+const upsertFile = `INSERT INTO files (project_id, path, walk_key, parent, name, size, mod_time, is_dir, hash, generation)
+	VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+	ON CONFLICT(project_id, path) DO UPDATE SET
+		hash = CASE WHEN excluded.hash != '' THEN excluded.hash
+			WHEN files.size = excluded.size AND files.mod_time = excluded.mod_time AND files.is_dir = excluded.is_dir THEN files.hash
+			ELSE '' END,
+		name = excluded.name, size = excluded.size, mod_time = excluded.mod_time, is_dir = excluded.is_dir,
+		generation = excluded.generation`
+
+func putFile(stmt *sql.Stmt, projectID string, f api.FileInfo, generation int64) error {
+	p := slashPath(f.Path)
+	_, err := stmt.Exec(projectID, p, walkKey(p), parentPath(p), f.Name, f.Size, f.ModTime.UnixNano(), f.IsDirectory, f.Hash, generation)
+	return err
+}
+
+// Put adds or updates single entries, without touching what is below them
+func (s *Store) Put(projectID string, files []api.FileInfo) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var generation int64
+	if err := tx.QueryRow(`SELECT generation FROM projects WHERE project_id = ?`, projectID).Scan(&generation); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNotBuilt
+		}
+		return err
+	}
+	stmt, err := tx.Prepare(upsertFile)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, f := range files {
+		if err := putFile(stmt, projectID, f, generation); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Has reports whether a path is in a project's index
+func (s *Store) Has(projectID, p string) (bool, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT COUNT(*) FROM files WHERE project_id = ? AND path = ?`, projectID, slashPath(p)).Scan(&n)
+	return n > 0, err
+}
+
+// Walk calls fn for every entry of a project's index in walk order, the folder itself first
+// An error returned by fn stops the walk and is returned
+func (s *Store) Walk(projectID string, fn func(Entry) error) error {
+	rows, err := s.db.Query(selectFiles+` WHERE project_id = ? ORDER BY walk_key`, projectID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(e); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Files returns the files directly inside dir, a path relative to the folder ("." for the folder itself)
+func (s *Store) Files(projectID, dir string) ([]api.FileInfo, error) {
+	rows, err := s.db.Query(selectFiles+` WHERE project_id = ? AND parent = ? AND is_dir = 0 ORDER BY walk_key`, projectID, slashPath(dir))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var files []api.FileInfo
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, e.FileInfo)
+	}
+	return files, rows.Err()
+}
+
+// Search returns the entries whose name contains query, case-insensitively for ASCII, in walk order
+// Returns at most limit entries and the number of matches
+func (s *Store) Search(projectID, query string, limit int) ([]Entry, int, error) {
+	pattern := "%" + escapeLike(query) + "%"
+
+	var total int
+	if err := s.db.QueryRow(
+		`SELECT COUNT(*) FROM files WHERE project_id = ? AND path != '.' AND name LIKE ? ESCAPE '\'`,
+		projectID, pattern,
+	).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.Query(
+		selectFiles+` WHERE project_id = ? AND path != '.' AND name LIKE ? ESCAPE '\' ORDER BY walk_key LIMIT ?`,
+		projectID, pattern, limit,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []Entry{}
+	for rows.Next() {
+		e, err := scanEntry(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+// SetHashes records the hashes of files, unless they changed since they were indexed
+func (s *Store) SetHashes(projectID string, files []api.FileInfo) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(`UPDATE files SET hash = ? WHERE project_id = ? AND path = ? AND size = ? AND mod_time = ? AND is_dir = 0`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for _, f := range files {
+		if f.Hash == "" || f.IsDirectory || f.Sequence != nil {
+			continue
+		}
+		if _, err := stmt.Exec(f.Hash, projectID, slashPath(f.Path), f.Size, f.ModTime.UnixNano()); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SetSyncStates sets the sync state of every entry of a project to all, except those in
+// files, a map of slash-separated paths to states
+func (s *Store) SetSyncStates(projectID, all string, files map[string]string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE files SET sync_state = ? WHERE project_id = ?`, all, projectID); err != nil {
+		return err
+	}
+	stmt, err := tx.Prepare(`UPDATE files SET sync_state = ? WHERE project_id = ? AND path = ?`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+	for p, state := range files {
+		if _, err := stmt.Exec(state, projectID, slashPath(p)); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// SetSyncState sets the sync state of one entry
+func (s *Store) SetSyncState(projectID, p, state string) error {
+	_, err := s.db.Exec(`UPDATE files SET sync_state = ? WHERE project_id = ? AND path = ?`, state, projectID, slashPath(p))
+	return err
+}
+
+// Delete removes a project's index
+func (s *Store) Delete(projectID string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM files WHERE project_id = ?`, projectID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM projects WHERE project_id = ?`, projectID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// Close closes the index database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+const selectFiles = `SELECT path, name, size, mod_time, is_dir, hash, sync_state FROM files`
+
+func scanEntry(rows *sql.Rows) (Entry, error) {
+	var e Entry
+	var p string
+	var modTime int64
+	if err := rows.Scan(&p, &e.Name, &e.Size, &modTime, &e.IsDirectory, &e.Hash, &e.SyncState); err != nil {
+		return e, err
+	}
+	e.Path = filepath.FromSlash(p)
+	e.ModTime = time.Unix(0, modTime)
+	return e, nil
+}
+
+// slashPath returns the stored form of a folder-relative path
+func slashPath(p string) string {
+	return path.Clean(filepath.ToSlash(p))
+}
+
+// walkKey makes byte order of stored paths match walk order: a directory's entries come
+// right after it and before its siblings, as "/" sorts below every other character in a name
+func walkKey(p string) string {
+	if p == "." {
+		return "" // The folder itself comes first
+	}
+	return strings.ReplaceAll(p, "/", "\x01")
+}
+
+// parentPath returns the directory holding an entry, "." for top-level entries and "" for the folder itself
+func parentPath(p string) string {
+	if p == "." {
+		return ""
+	}
+	return path.Dir(p)
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
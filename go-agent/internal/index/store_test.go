@@ -0,0 +1,210 @@
+package index
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vidsync/agent/internal/api"
+)
+
+var modTime = time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+	s, err := NewStore(filepath.Join(t.TempDir(), "index.db"))
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// entry describes an indexed path; paths ending in "/" are directories
+type entry struct {
+	path string
+	size int64
+	hash string
+}
+
+func (e entry) info() api.FileInfo {
+	p, dir := e.path, false
+	if p != "." && p[len(p)-1] == '/' {
+		p, dir = p[:len(p)-1], true
+	}
+	return api.FileInfo{
+		Name:        path.Base(p),
+		Path:        filepath.FromSlash(p),
+		Size:        e.size,
+		IsDirectory: dir || p == ".",
+		ModTime:     modTime,
+		Hash:        e.hash,
+	}
+}
+
+func walkOf(entries []entry) func(add func(api.FileInfo) error) error {
+	return func(add func(api.FileInfo) error) error {
+		for _, e := range entries {
+			if err := add(e.info()); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// contents lists a project's index in walk order as path:hash
+func contents(t *testing.T, s *Store, projectID string) []string {
+	t.Helper()
+	var got []string
+	err := s.Walk(projectID, func(e Entry) error {
+		got = append(got, filepath.ToSlash(e.Path)+":"+e.Hash)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk: %v", err)
+	}
+	return got
+}
+
+func TestWalkKey(t *testing.T) {
+	tests := []struct {
+		first, second string
+	}{
+		{".", "a"},         // The folder comes first
+		{"a", "a/b"},       // A directory comes before its entries
+		{"a/b", "a b"},     // and its entries before its siblings, though "/" sorts after " "
+		{"a/z/z", "a.txt"}, // however deep they are
+		{"a.txt", "b"},
+		{"A", "a"}, // Byte order, like the walk
+	}
+	for _, tt := range tests {
+		t.Run(tt.first+" < "+tt.second, func(t *testing.T) {
+			if a, b := walkKey(tt.first), walkKey(tt.second); a >= b {
+				t.Errorf("walkKey(%q) = %q, not before walkKey(%q) = %q", tt.first, a, tt.second, b)
+			}
+		})
+	}
+}
+
+func TestWalkOrder(t *testing.T) {
+	s := newTestStore(t)
+	// Added out of order; Walk returns them the way a folder walk visits them
+	err := s.Replace("p", "/data/p", walkOf([]entry{
+		{path: "b.txt"}, {path: "a.txt"}, {path: "a b/"}, {path: "a/c.txt"}, {path: "a/"}, {path: "."},
+	}))
+	if err != nil {
+		t.Fatalf("Replace: %v", err)
+	}
+	want := []string{".:", "a:", "a/c.txt:", "a b:", "a.txt:", "b.txt:"}
+	if got := contents(t, s, "p"); !reflect.DeepEqual(got, want) {
+		t.Errorf("Walk = %v, want %v", got, want)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	initial := []entry{
+		{path: "."}, {path: "a/"}, {path: "a/one.mov", size: 10, hash: "h1"}, {path: "two.mov", size: 20, hash: "h2"},
+	}
+	tests := []struct {
+		name string
+		walk []entry
+		want []string
+	}{
+		{
+			name: "unchanged entries keep their hashes",
+			walk: []entry{{path: "."}, {path: "a/"}, {path: "a/one.mov", size: 10}, {path: "two.mov", size: 20}},
+			want: []string{".:", "a:", "a/one.mov:h1", "two.mov:h2"},
+		},
+		{
+			name: "changed entries lose their hashes",
+			walk: []entry{{path: "."}, {path: "a/"}, {path: "a/one.mov", size: 11}, {path: "two.mov", size: 20}},
+			want: []string{".:", "a:", "a/one.mov:", "two.mov:h2"},
+		},
+		{
+			name: "new hashes replace old ones",
+			walk: []entry{{path: "."}, {path: "two.mov", size: 20, hash: "h3"}},
+			want: []string{".:", "two.mov:h3"},
+		},
+		{
+			name: "entries not walked are removed",
+			walk: []entry{{path: "."}, {path: "three.mov"}},
+			want: []string{".:", "three.mov:"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			if err := s.Replace("p", "/data/p", walkOf(initial)); err != nil {
+				t.Fatalf("Replace: %v", err)
+			}
+			if err := s.Replace("p", "/data/p", walkOf(tt.walk)); err != nil {
+				t.Fatalf("Replace: %v", err)
+			}
+			if got := contents(t, s, "p"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("index = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceTree(t *testing.T) {
+	initial := []entry{
+		{path: "."}, {path: "a/"}, {path: "a/one.mov", hash: "h1"}, {path: "a/b/"}, {path: "a/b/two.mov"},
+		{path: "a b/"}, {path: "a b/three.mov"}, {path: "ab.mov"},
+	}
+	tests := []struct {
+		name string
+		sub  string
+		walk []entry
+		want []string
+	}{
+		{
+			name: "entries below sub are replaced",
+			sub:  "a",
+			walk: []entry{{path: "a/"}, {path: "a/one.mov"}, {path: "a/new.mov"}},
+			want: []string{".:", "a:", "a/new.mov:", "a/one.mov:h1", "a b:", "a b/three.mov:", "ab.mov:"},
+		},
+		{
+			name: "sub is removed when the walk adds nothing",
+			sub:  "a",
+			want: []string{".:", "a b:", "a b/three.mov:", "ab.mov:"},
+		},
+		{
+			name: "a nested sub leaves its parent alone",
+			sub:  "a/b",
+			want: []string{".:", "a:", "a/one.mov:h1", "a b:", "a b/three.mov:", "ab.mov:"},
+		},
+		{
+			name: "a file sub",
+			sub:  "ab.mov",
+			walk: []entry{{path: "ab.mov", hash: "h4"}},
+			want: []string{".:", "a:", "a/b:", "a/b/two.mov:", "a/one.mov:h1", "a b:", "a b/three.mov:", "ab.mov:h4"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestStore(t)
+			if err := s.Replace("p", "/data/p", walkOf(initial)); err != nil {
+				t.Fatalf("Replace: %v", err)
+			}
+			if err := s.ReplaceTree("p", filepath.FromSlash(tt.sub), walkOf(tt.walk)); err != nil {
+				t.Fatalf("ReplaceTree: %v", err)
+			}
+			if got := contents(t, s, "p"); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("index = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceTreeNotBuilt(t *testing.T) {
+	s := newTestStore(t)
+	err := s.ReplaceTree("p", "a", walkOf([]entry{{path: "a/"}}))
+	if !errors.Is(err, ErrNotBuilt) {
+		t.Errorf("ReplaceTree on an unbuilt project = %v, want ErrNotBuilt", err)
+	}
+}
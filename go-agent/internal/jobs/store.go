@@ -0,0 +1,219 @@
+package jobs
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Job statuses
+const (
+	StatusQueued    = "queued"
+	StatusRunning   = "running"
+	StatusCompleted = "completed"
+	StatusFailed    = "failed"
+	StatusCancelled = "cancelled"
+)
+
+// ErrNotFound is returned when no job has the requested ID
+var ErrNotFound = errors.New("job not found")
+
+// Job is a unit of background work on a project and where it stands
+type Job struct {
+	ID          string     `json:"id"`
+	ProjectID   string     `json:"projectId"`
+	Kind        string     `json:"kind"`             // What the job does, e.g. "snapshot"
+	Trigger     string     `json:"trigger"`          // What started it: api, project-create, scheduler
+	UserID      string     `json:"userId,omitempty"` // Cloud user the snapshot is uploaded as, "" until known
+	Status      string     `json:"status"`
+	Attempts    int        `json:"attempts"` // Times it was started, more than one after being resumed
+	Error       string     `json:"error,omitempty"`
+	SnapshotURL string     `json:"snapshotUrl,omitempty"`
+	FileCount   int        `json:"fileCount,omitempty"`
+	TotalSize   int64      `json:"totalSize,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	FinishedAt  *time.Time `json:"finishedAt,omitempty"`
+}
+
+// Finished reports whether the job reached a final status
+func (j *Job) Finished() bool {
+	return j.Status == StatusCompleted || j.Status == StatusFailed || j.Status == StatusCancelled
+}
+
+// Store persists jobs so unfinished ones survive a restart
+type Store struct {
+	db *sql.DB
+}
+
+// NewStore opens or creates the job database at dbPath
+func NewStore(dbPath string) (*Store, error) {
+	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	CREATE TABLE IF NOT EXISTS jobs (
+		id TEXT PRIMARY KEY,
+		project_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		trigger TEXT NOT NULL,
+		user_id TEXT NOT NULL DEFAULT '',
+		status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		snapshot_url TEXT NOT NULL DEFAULT '',
+		file_count INTEGER NOT NULL DEFAULT 0,
+		total_size INTEGER NOT NULL DEFAULT 0,
+		created_at INTEGER NOT NULL,
+		started_at INTEGER NOT NULL DEFAULT 0,
+		finished_at INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX IF NOT EXISTS jobs_project ON jobs (project_id, created_at);
+	CREATE INDEX IF NOT EXISTS jobs_status ON jobs (status);
+	`
+	if _, err := db.Exec(query); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := addColumn(db, "jobs", "user_id", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Save inserts or updates a job
+func (s *Store) Save(j *Job) error {
+	_, err := s.db.Exec(
+		`INSERT INTO jobs (id, project_id, kind, trigger, user_id, status, attempts, error, snapshot_url, file_count, total_size, created_at, started_at, finished_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET user_id = excluded.user_id, status = excluded.status, attempts = excluded.attempts, error = excluded.error,
+			snapshot_url = excluded.snapshot_url, file_count = excluded.file_count, total_size = excluded.total_size,
+			started_at = excluded.started_at, finished_at = excluded.finished_at`,
+		j.ID, j.ProjectID, j.Kind, j.Trigger, j.UserID, j.Status, j.Attempts, j.Error, j.SnapshotURL, j.FileCount, j.TotalSize,
+		j.CreatedAt.UnixNano(), unixNano(j.StartedAt), unixNano(j.FinishedAt),
+	)
+	return err
+}
+
+// Get returns the job with the given ID
+func (s *Store) Get(id string) (*Job, error) {
+	rows, err := s.db.Query(selectJobs+` WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	list, err := scanJobs(rows)
+	if err != nil {
+		return nil, err
+	}
+	if len(list) == 0 {
+		return nil, ErrNotFound
+	}
+	return &list[0], nil
+}
+
+// List returns a project's jobs, newest first, at most limit of them
+func (s *Store) List(projectID string, limit int) ([]Job, error) {
+	rows, err := s.db.Query(selectJobs+` WHERE project_id = ? ORDER BY created_at DESC LIMIT ?`, projectID, limit)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+// Unfinished returns the queued and running jobs, oldest first
+func (s *Store) Unfinished() ([]Job, error) {
+	rows, err := s.db.Query(selectJobs+` WHERE status IN (?, ?) ORDER BY created_at`, StatusQueued, StatusRunning)
+	if err != nil {
+		return nil, err
+	}
+	return scanJobs(rows)
+}
+
+// Prune deletes a project's finished jobs beyond the newest keep
+func (s *Store) Prune(projectID string, keep int) error {
+	_, err := s.db.Exec(
+		`DELETE FROM jobs WHERE project_id = ? AND status NOT IN (?, ?) AND id NOT IN (
+			SELECT id FROM jobs WHERE project_id = ? AND status NOT IN (?, ?) ORDER BY created_at DESC LIMIT ?
+		)`,
+		projectID, StatusQueued, StatusRunning, projectID, StatusQueued, StatusRunning, keep,
+	)
+	return err
+}
+
+// Delete removes all jobs of a project
+func (s *Store) Delete(projectID string) error {
+	_, err := s.db.Exec(`DELETE FROM jobs WHERE project_id = ?`, projectID)
+	return err
+}
+
+// Close closes the job database
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+const selectJobs = `SELECT id, project_id, kind, trigger, user_id, status, attempts, error, snapshot_url, file_count, total_size, created_at, started_at, finished_at FROM jobs`
+
+func scanJobs(rows *sql.Rows) ([]Job, error) {
+	defer rows.Close()
+
+	list := []Job{}
+	for rows.Next() {
+		var j Job
+		var createdAt, startedAt, finishedAt int64
+		if err := rows.Scan(&j.ID, &j.ProjectID, &j.Kind, &j.Trigger, &j.UserID, &j.Status, &j.Attempts, &j.Error,
+			&j.SnapshotURL, &j.FileCount, &j.TotalSize, &createdAt, &startedAt, &finishedAt); err != nil {
+			return nil, err
+		}
+		j.CreatedAt = time.Unix(0, createdAt)
+		j.StartedAt = fromUnixNano(startedAt)
+		j.FinishedAt = fromUnixNano(finishedAt)
+		list = append(list, j)
+	}
+	return list, rows.Err()
+}
+
+// addColumn adds a column to a table created before the column existed
+func addColumn(db *sql.DB, table, column, definition string) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info(?)`, table)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return err
+		}
+		if name == column {
+			return nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	_, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	return err
+}
+
+func unixNano(t *time.Time) int64 {
+	if t == nil {
+		return 0
+	}
+	return t.UnixNano()
+}
+
+func fromUnixNano(n int64) *time.Time {
+	if n == 0 {
+		return nil
+	}
+	t := time.Unix(0, n)
+	return &t
+}
@@ -0,0 +1,231 @@
+package jobs
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+var created = time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+func openStore(t *testing.T, path string) *Store {
+	t.Helper()
+	s, err := NewStore(path)
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// job makes the nth job of a project, created n minutes after the first
+func job(projectID string, n int, status string) *Job {
+	return &Job{
+		ID:        fmt.Sprintf("%s-%d", projectID, n),
+		ProjectID: projectID,
+		Kind:      "snapshot",
+		Trigger:   "api",
+		Status:    status,
+		CreatedAt: created.Add(time.Duration(n) * time.Minute),
+	}
+}
+
+func ids(list []Job) []string {
+	out := []string{}
+	for _, j := range list {
+		out = append(out, j.ID)
+	}
+	return out
+}
+
+func TestStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	started := created.Add(time.Second)
+	finished := created.Add(time.Minute)
+	want := &Job{
+		ID:          "p-1",
+		ProjectID:   "p",
+		Kind:        "snapshot",
+		Trigger:     "scheduler",
+		UserID:      "user-1",
+		Status:      StatusCompleted,
+		Attempts:    2,
+		Error:       "",
+		SnapshotURL: "https://storage/p.json.gz",
+		FileCount:   12,
+		TotalSize:   1 << 40,
+		CreatedAt:   created,
+		StartedAt:   &started,
+		FinishedAt:  &finished,
+	}
+
+	s := openStore(t, path)
+	if err := s.Save(want); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	s.Close()
+
+	// Reopened as after a restart
+	got, err := openStore(t, path).Get("p-1")
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if !got.CreatedAt.Equal(want.CreatedAt) || !got.StartedAt.Equal(*want.StartedAt) || !got.FinishedAt.Equal(*want.FinishedAt) {
+		t.Errorf("times = %v, %v, %v; want %v, %v, %v", got.CreatedAt, got.StartedAt, got.FinishedAt, want.CreatedAt, want.StartedAt, want.FinishedAt)
+	}
+	got.CreatedAt, got.StartedAt, got.FinishedAt = want.CreatedAt, want.StartedAt, want.FinishedAt
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Get = %+v, want %+v", got, want)
+	}
+
+	if _, err := openStore(t, path).Get("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get of a missing job = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStoreSaveUpdates(t *testing.T) {
+	s := openStore(t, filepath.Join(t.TempDir(), "jobs.db"))
+
+	j := job("p", 1, StatusQueued)
+	if err := s.Save(j); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+	// Saving the same job again updates it instead of adding another
+	j.Status = StatusFailed
+	j.UserID = "user-1"
+	j.Attempts = 1
+	j.Error = "upload failed"
+	if err := s.Save(j); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	list, err := s.List("p", 10)
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(list) != 1 {
+		t.Fatalf("List = %v, want the one job", ids(list))
+	}
+	got := list[0]
+	if got.Status != StatusFailed || got.UserID != "user-1" || got.Attempts != 1 || got.Error != "upload failed" || got.StartedAt != nil {
+		t.Errorf("saved job = %+v, want the update", got)
+	}
+}
+
+func TestStoreQueries(t *testing.T) {
+	jobs := []*Job{
+		job("p", 1, StatusCompleted),
+		job("p", 2, StatusFailed),
+		job("p", 3, StatusCancelled),
+		job("p", 4, StatusRunning),
+		job("p", 5, StatusCompleted),
+		job("q", 1, StatusQueued),
+		job("q", 2, StatusCompleted),
+	}
+
+	tests := []struct {
+		name  string
+		query func(s *Store) ([]Job, error)
+		want  []string
+	}{
+		{
+			name:  "list newest first",
+			query: func(s *Store) ([]Job, error) { return s.List("p", 10) },
+			want:  []string{"p-5", "p-4", "p-3", "p-2", "p-1"},
+		},
+		{
+			name:  "list limit",
+			query: func(s *Store) ([]Job, error) { return s.List("p", 2) },
+			want:  []string{"p-5", "p-4"},
+		},
+		{
+			name:  "unfinished oldest first",
+			query: func(s *Store) ([]Job, error) { return s.Unfinished() },
+			want:  []string{"q-1", "p-4"},
+		},
+		{
+			name: "prune keeps unfinished and the newest finished",
+			query: func(s *Store) ([]Job, error) {
+				if err := s.Prune("p", 2); err != nil {
+					return nil, err
+				}
+				return s.List("p", 10)
+			},
+			want: []string{"p-5", "p-4", "p-3"},
+		},
+		{
+			name: "prune leaves other projects alone",
+			query: func(s *Store) ([]Job, error) {
+				if err := s.Prune("p", 0); err != nil {
+					return nil, err
+				}
+				return s.List("q", 10)
+			},
+			want: []string{"q-2", "q-1"},
+		},
+		{
+			name: "delete",
+			query: func(s *Store) ([]Job, error) {
+				if err := s.Delete("p"); err != nil {
+					return nil, err
+				}
+				return s.Unfinished()
+			},
+			want: []string{"q-1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := openStore(t, filepath.Join(t.TempDir(), "jobs.db"))
+			for _, j := range jobs {
+				if err := s.Save(j); err != nil {
+					t.Fatalf("Save: %v", err)
+				}
+			}
+			list, err := tt.query(s)
+			if err != nil {
+				t.Fatalf("query: %v", err)
+			}
+			if got := ids(list); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("jobs = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStoreAddsUserColumn(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "jobs.db")
+
+	// A database from before jobs recorded their user
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	_, err = db.Exec(`CREATE TABLE jobs (
+		id TEXT PRIMARY KEY, project_id TEXT NOT NULL, kind TEXT NOT NULL, trigger TEXT NOT NULL, status TEXT NOT NULL,
+		attempts INTEGER NOT NULL DEFAULT 0, error TEXT NOT NULL DEFAULT '', snapshot_url TEXT NOT NULL DEFAULT '',
+		file_count INTEGER NOT NULL DEFAULT 0, total_size INTEGER NOT NULL DEFAULT 0, created_at INTEGER NOT NULL,
+		started_at INTEGER NOT NULL DEFAULT 0, finished_at INTEGER NOT NULL DEFAULT 0
+	);
+	INSERT INTO jobs (id, project_id, kind, trigger, status, created_at) VALUES ('p-1', 'p', 'snapshot', 'api', 'queued', 1);`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("create old table: %v", err)
+	}
+
+	for i := 0; i < 2; i++ { // Opening again finds the column in place
+		s, err := NewStore(path)
+		if err != nil {
+			t.Fatalf("NewStore on an old database: %v", err)
+		}
+		list, err := s.Unfinished()
+		s.Close()
+		if err != nil || len(list) != 1 || list[0].UserID != "" {
+			t.Fatalf("Unfinished = %+v, %v; want the old job without a user", list, err)
+		}
+	}
+}
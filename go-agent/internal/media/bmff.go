@@ -0,0 +1,284 @@
+package media
+
+import (
+	"encoding/binary"
+	"io"
+	"time"
+)
+
+// ISO BMFF (MP4) and QuickTime share the same atom layout:
+// a 32-bit size (1 = 64-bit size follows, 0 = to end of file), a fourcc type, then the payload
+
+// qtEpoch is the origin of MP4/QuickTime timestamps
+var qtEpoch = time.Date(1904, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// atom is one box of an ISO BMFF file
+type atom struct {
+	typ    string
+	offset int64 // Start of the payload
+	size   int64 // Payload size
+}
+
+// bmffTrack is what a trak atom tells about its track
+type bmffTrack struct {
+	handler     string // vide, soun, tmcd, ...
+	width       int
+	height      int
+	timescale   uint32
+	duration    uint64
+	sampleEntry []byte // First stsd entry, including its size and type
+	samples     uint64 // From stts
+	sampleDelta uint32 // Delta of the only stts entry, 0 if there are several
+	firstChunk  int64  // File offset of the first chunk, -1 if unknown
+}
+
+// probeBMFF reads an MP4 or QuickTime file's moov atom
+func probeBMFF(r io.ReaderAt, size int64) (*Metadata, error) {
+	meta := &Metadata{Container: ContainerMOV}
+	var moov *atom
+
+	err := eachAtom(r, 0, size, func(a atom) error {
+		switch a.typ {
+		case "ftyp":
+			brand, err := readAt(r, a.offset, 4)
+			if err == nil && string(brand) != "qt  " {
+				meta.Container = ContainerMP4
+			}
+		case "moov":
+			moov = &a
+		}
+		return nil
+	})
+	if err != nil && moov == nil {
+		return nil, err
+	}
+	if moov == nil {
+		return nil, errMalformed // No movie header yet, e.g. a recording that hasn't been finalized
+	}
+
+	var tracks []*bmffTrack
+	err = eachAtom(r, moov.offset, moov.offset+moov.size, func(a atom) error {
+		switch a.typ {
+		case "mvhd":
+			return parseMvhd(r, a, meta)
+		case "trak":
+			track := &bmffTrack{firstChunk: -1}
+			if err := parseTrak(r, a, track); err != nil {
+				return err
+			}
+			tracks = append(tracks, track)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, t := range tracks {
+		if t.handler == "vide" && meta.Codec == "" {
+			applyVideoTrack(t, meta)
+		}
+		if t.handler == "tmcd" && meta.Timecode == "" {
+			meta.Timecode = readTmcdStart(r, t)
+		}
+	}
+	return meta, nil
+}
+
+// applyVideoTrack copies a video track's codec, resolution and frame rate
+func applyVideoTrack(t *bmffTrack, meta *Metadata) {
+	if len(t.sampleEntry) >= 8 {
+		meta.Codec = string(t.sampleEntry[4:8])
+	}
+
+	meta.Width, meta.Height = t.width, t.height
+	if (meta.Width == 0 || meta.Height == 0) && len(t.sampleEntry) >= 36 {
+		// Coded size from the visual sample entry
+		meta.Width = int(binary.BigEndian.Uint16(t.sampleEntry[32:34]))
+		meta.Height = int(binary.BigEndian.Uint16(t.sampleEntry[34:36]))
+	}
+
+	switch {
+	case t.sampleDelta > 0 && t.timescale > 0:
+		meta.FrameRate = roundRate(float64(t.timescale) / float64(t.sampleDelta))
+	case t.duration > 0 && t.samples > 0:
+		meta.FrameRate = roundRate(float64(t.samples) * float64(t.timescale) / float64(t.duration))
+	}
+}
+
+// readTmcdStart reads the start frame of a QuickTime timecode track and formats it
+func readTmcdStart(r io.ReaderAt, t *bmffTrack) string {
+	// tmcd sample entry: header(8) reserved(6) dataRefIndex(2) reserved(4) flags(4) timescale(4) frameDuration(4) numberOfFrames(1)
+	if len(t.sampleEntry) < 33 || t.firstChunk < 0 {
+		return ""
+	}
+	flags := binary.BigEndian.Uint32(t.sampleEntry[20:24])
+	fps := int(t.sampleEntry[32])
+
+	sample, err := readAt(r, t.firstChunk, 4)
+	if err != nil {
+		return ""
+	}
+	return formatTimecode(int64(binary.BigEndian.Uint32(sample)), fps, flags&0x1 != 0)
+}
+
+// parseMvhd reads the movie duration and creation time
+func parseMvhd(r io.ReaderAt, a atom, meta *Metadata) error {
+	data, err := readAtom(r, a)
+	if err != nil {
+		return err
+	}
+
+	var created, duration uint64
+	var timescale uint32
+	switch {
+	case len(data) >= 32 && data[0] == 1:
+		created = binary.BigEndian.Uint64(data[4:12])
+		timescale = binary.BigEndian.Uint32(data[20:24])
+		duration = binary.BigEndian.Uint64(data[24:32])
+	case len(data) >= 20:
+		created = uint64(binary.BigEndian.Uint32(data[4:8]))
+		timescale = binary.BigEndian.Uint32(data[12:16])
+		duration = uint64(binary.BigEndian.Uint32(data[16:20]))
+	default:
+		return errMalformed
+	}
+
+	if timescale > 0 {
+		meta.Duration = float64(duration) / float64(timescale)
+	}
+	if created > 0 {
+		t := qtEpoch.Add(time.Duration(created) * time.Second)
+		meta.CreationTime = &t
+	}
+	return nil
+}
+
+// parseTrak walks a track's atoms down to its sample table
+func parseTrak(r io.ReaderAt, a atom, t *bmffTrack) error {
+	return eachAtom(r, a.offset, a.offset+a.size, func(child atom) error {
+		switch child.typ {
+		case "tkhd":
+			data, err := readAtom(r, child)
+			if err != nil {
+				return err
+			}
+			// Width and height are 16.16 fixed point after the matrix
+			at := 76
+			if len(data) > 0 && data[0] == 1 {
+				at = 88
+			}
+			if len(data) >= at+8 {
+				t.width = int(binary.BigEndian.Uint32(data[at:at+4]) >> 16)
+				t.height = int(binary.BigEndian.Uint32(data[at+4:at+8]) >> 16)
+			}
+		case "mdia", "minf", "stbl":
+			return parseTrak(r, child, t)
+		case "mdhd":
+			data, err := readAtom(r, child)
+			if err != nil {
+				return err
+			}
+			switch {
+			case len(data) >= 32 && data[0] == 1:
+				t.timescale = binary.BigEndian.Uint32(data[20:24])
+				t.duration = binary.BigEndian.Uint64(data[24:32])
+			case len(data) >= 20:
+				t.timescale = binary.BigEndian.Uint32(data[12:16])
+				t.duration = uint64(binary.BigEndian.Uint32(data[16:20]))
+			}
+		case "hdlr":
+			data, err := readAtom(r, child)
+			if err == nil && len(data) >= 12 {
+				t.handler = string(data[8:12])
+			}
+		case "stsd":
+			data, err := readAtom(r, child)
+			if err != nil {
+				return err
+			}
+			if len(data) >= 16 {
+				entrySize := int(binary.BigEndian.Uint32(data[8:12]))
+				if entrySize >= 8 && 8+entrySize <= len(data) {
+					t.sampleEntry = data[8 : 8+entrySize]
+				}
+			}
+		case "stts":
+			data, err := readAtom(r, child)
+			if err != nil {
+				return err
+			}
+			if len(data) < 8 {
+				return nil
+			}
+			entries := int(binary.BigEndian.Uint32(data[4:8]))
+			for i := 0; i < entries && 8+i*8+8 <= len(data); i++ {
+				count := binary.BigEndian.Uint32(data[8+i*8:])
+				t.samples += uint64(count)
+				if entries == 1 {
+					t.sampleDelta = binary.BigEndian.Uint32(data[12:16])
+				}
+			}
+		case "stco", "co64":
+			data, err := readAt(r, child.offset, min(child.size, 16))
+			if err != nil || len(data) < 12 || binary.BigEndian.Uint32(data[4:8]) == 0 {
+				return nil
+			}
+			if child.typ == "co64" && len(data) >= 16 {
+				t.firstChunk = int64(binary.BigEndian.Uint64(data[8:16]))
+			} else {
+				t.firstChunk = int64(binary.BigEndian.Uint32(data[8:12]))
+			}
+		}
+		return nil
+	})
+}
+
+// eachAtom calls fn for every atom between start and end
+func eachAtom(r io.ReaderAt, start, end int64, fn func(atom) error) error {
+	for off := start; off+8 <= end; {
+		hdr, err := readAt(r, off, 8)
+		if err != nil {
+			return err
+		}
+		size := int64(binary.BigEndian.Uint32(hdr[0:4]))
+		header := int64(8)
+		switch size {
+		case 0:
+			size = end - off
+		case 1:
+			ext, err := readAt(r, off+8, 8)
+			if err != nil {
+				return err
+			}
+			size = int64(binary.BigEndian.Uint64(ext))
+			header = 16
+		}
+		if size < header || size > end-off {
+			return errMalformed // Truncated, e.g. still being written or synced
+		}
+
+		if err := fn(atom{typ: string(hdr[4:8]), offset: off + header, size: size - header}); err != nil {
+			return err
+		}
+		off += size
+	}
+	return nil
+}
+
+// readAtom reads an atom's whole payload
+func readAtom(r io.ReaderAt, a atom) ([]byte, error) {
+	if a.size > maxReadSize {
+		return nil, errMalformed
+	}
+	return readAt(r, a.offset, a.size)
+}
+
+// readAt reads exactly n bytes at off
+func readAt(r io.ReaderAt, off, n int64) ([]byte, error) {
+	buf := make([]byte, n)
+	if _, err := r.ReadAt(buf, off); err != nil {
+		return nil, err
+	}
+	return buf, nil
+}
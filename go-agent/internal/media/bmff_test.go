@@ -0,0 +1,241 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// box builds an atom from its type and payload parts
+func box(typ string, parts ...[]byte) []byte {
+	payload := bytes.Join(parts, nil)
+	out := binary.BigEndian.AppendUint32(nil, uint32(8+len(payload)))
+	return append(append(out, typ...), payload...)
+}
+
+// u16 and u32 encode big-endian integers for fixtures
+func u16(v uint16) []byte { return binary.BigEndian.AppendUint16(nil, v) }
+func u32(v uint32) []byte { return binary.BigEndian.AppendUint32(nil, v) }
+
+func zeros(n int) []byte { return make([]byte, n) }
+
+// bmffTrackSpec describes one track of a fixture movie
+type bmffTrackSpec struct {
+	handler       string
+	width, height int    // tkhd size, 0 to leave it to the sample entry
+	entry         []byte // stsd sample entry
+	timescale     uint32
+	duration      uint32
+	samples       uint32
+	delta         uint32
+	chunk         uint32 // stco first chunk offset, 0 for no stco
+}
+
+func mvhd(created, timescale, duration uint32) []byte {
+	return box("mvhd", zeros(4), u32(created), zeros(4), u32(timescale), u32(duration), zeros(80))
+}
+
+func trak(t bmffTrackSpec) []byte {
+	tkhd := box("tkhd", zeros(76), u32(uint32(t.width)<<16), u32(uint32(t.height)<<16))
+	mdhd := box("mdhd", zeros(12), u32(t.timescale), u32(t.duration), zeros(4))
+	hdlr := box("hdlr", zeros(8), []byte(t.handler), zeros(13))
+	stbl := [][]byte{
+		box("stsd", zeros(4), u32(1), t.entry),
+		box("stts", zeros(4), u32(1), u32(t.samples), u32(t.delta)),
+	}
+	if t.chunk > 0 {
+		stbl = append(stbl, box("stco", zeros(4), u32(1), u32(t.chunk)))
+	}
+	return box("trak", tkhd, box("mdia", mdhd, hdlr, box("minf", box("stbl", stbl...))))
+}
+
+// visualEntry builds a visual sample entry with its coded size
+func visualEntry(fourcc string, width, height uint16) []byte {
+	return box(fourcc, zeros(24), u16(width), u16(height), zeros(50))
+}
+
+// tmcdEntry builds a QuickTime timecode sample entry
+func tmcdEntry(flags uint32, fps uint8) []byte {
+	return box("tmcd", zeros(12), u32(flags), u32(uint32(fps)*1000), u32(1000), []byte{fps}, zeros(1))
+}
+
+// mp4Fixture is a 10 second 1920x1080 23.976 fps H.264 movie
+func mp4Fixture() []byte {
+	created := uint32(time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC).Sub(qtEpoch) / time.Second)
+	return append(box("ftyp", []byte("isom"), zeros(4), []byte("isomavc1")),
+		box("moov",
+			mvhd(created, 1000, 10000),
+			trak(bmffTrackSpec{
+				handler: "vide", width: 1920, height: 1080,
+				entry:     visualEntry("avc1", 1920, 1080),
+				timescale: 24000, duration: 240240, samples: 240, delta: 1001,
+			}),
+		)...)
+}
+
+// movFixture is a 29.97 fps ProRes QuickTime movie with a drop-frame timecode track
+// The first timecode sample is in an mdat right after ftyp
+func movFixture(startFrame uint32) []byte {
+	ftyp := box("ftyp", []byte("qt  "), zeros(4), []byte("qt  "))
+	mdat := box("mdat", u32(startFrame))
+	sample := uint32(len(ftyp) + 8)
+
+	out := append(ftyp, mdat...)
+	return append(out, box("moov",
+		mvhd(0, 600, 6000),
+		trak(bmffTrackSpec{
+			handler:   "vide",
+			entry:     visualEntry("apcn", 3840, 2160),
+			timescale: 30000, duration: 300300, samples: 300, delta: 1001,
+		}),
+		trak(bmffTrackSpec{
+			handler:   "tmcd",
+			entry:     tmcdEntry(0x1, 30),
+			timescale: 30000, duration: 300300, samples: 1, delta: 300300,
+			chunk: sample,
+		}),
+	)...)
+}
+
+func probeBytes(data []byte) (*Metadata, error) {
+	return probeBMFF(bytes.NewReader(data), int64(len(data)))
+}
+
+func TestProbeBMFF(t *testing.T) {
+	created := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name string
+		data []byte
+		want Metadata
+	}{
+		{
+			name: "mp4",
+			data: mp4Fixture(),
+			want: Metadata{Container: ContainerMP4, Duration: 10, Width: 1920, Height: 1080, FrameRate: 23.976, Codec: "avc1", CreationTime: &created},
+		},
+		{
+			name: "mov with drop-frame timecode",
+			data: movFixture(107892),
+			want: Metadata{Container: ContainerMOV, Duration: 10, Width: 3840, Height: 2160, FrameRate: 29.97, Codec: "apcn", Timecode: "01:00:00;00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := probeBytes(tt.data)
+			if err != nil {
+				t.Fatalf("probe failed: %v", err)
+			}
+			assertMetadata(t, got, &tt.want)
+		})
+	}
+}
+
+func TestProbeBMFFWithoutMoov(t *testing.T) {
+	data := append(box("ftyp", []byte("isom")), box("mdat", zeros(64))...)
+	if _, err := probeBytes(data); err != errMalformed {
+		t.Fatalf("expected errMalformed, got %v", err)
+	}
+}
+
+func TestProbeBMFFTruncated(t *testing.T) {
+	for _, fixture := range [][]byte{mp4Fixture(), movFixture(107892)} {
+		for n := 0; n < len(fixture); n++ {
+			probeBytes(fixture[:n]) // Must not panic
+		}
+	}
+}
+
+func TestProbeBMFFGarbage(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"short header", []byte{0, 0, 0}},
+		{"size smaller than header", append(u32(4), "moov"...)},
+		{"size past end", append(u32(1<<30), "moov"...)},
+		{"64-bit size missing", append(u32(1), "moov"...)},
+		{"64-bit size overflow", append(append(u32(1), "moov"...), 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)},
+		{"size zero to end", append(u32(0), "moov"...)},
+		{"empty stsd", box("moov", box("trak", box("mdia", box("minf", box("stbl", box("stsd", u32(0), u32(1), u32(1<<31)))))))},
+		{"tmcd chunk past end", box("moov", trak(bmffTrackSpec{handler: "tmcd", entry: tmcdEntry(0, 25), chunk: 1 << 31}))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probeBytes(tt.data) // Must not panic
+		})
+	}
+
+	// Corrupt every byte of the fixtures in turn, then feed random noise
+	for _, fixture := range [][]byte{mp4Fixture(), movFixture(107892)} {
+		for i := range fixture {
+			data := bytes.Clone(fixture)
+			data[i] ^= 0xff
+			probeBytes(data)
+		}
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		data := make([]byte, rng.Intn(256))
+		rng.Read(data)
+		probeBytes(data)
+	}
+}
+
+func TestFormatTimecode(t *testing.T) {
+	tests := []struct {
+		frame int64
+		fps   int
+		drop  bool
+		want  string
+	}{
+		{0, 25, false, "00:00:00:00"},
+		{86400, 24, false, "01:00:00:00"},
+		{1799, 30, true, "00:00:59;29"},
+		{1800, 30, true, "00:01:00;02"},
+		{17982, 30, true, "00:10:00;00"},
+		{107892, 30, true, "01:00:00;00"},
+		{215784, 60, true, "01:00:00;00"},
+		{10, 0, false, ""},
+		{-1, 25, false, ""},
+	}
+	for _, tt := range tests {
+		if got := formatTimecode(tt.frame, tt.fps, tt.drop); got != tt.want {
+			t.Errorf("formatTimecode(%d, %d, %v) = %q, want %q", tt.frame, tt.fps, tt.drop, got, tt.want)
+		}
+	}
+}
+
+// assertMetadata compares probe results, allowing for float rounding
+func assertMetadata(t *testing.T, got, want *Metadata) {
+	t.Helper()
+	if got.Container != want.Container {
+		t.Errorf("container = %q, want %q", got.Container, want.Container)
+	}
+	if math.Abs(got.Duration-want.Duration) > 1e-6 {
+		t.Errorf("duration = %v, want %v", got.Duration, want.Duration)
+	}
+	if got.Width != want.Width || got.Height != want.Height {
+		t.Errorf("size = %dx%d, want %dx%d", got.Width, got.Height, want.Width, want.Height)
+	}
+	if got.FrameRate != want.FrameRate {
+		t.Errorf("frame rate = %v, want %v", got.FrameRate, want.FrameRate)
+	}
+	if got.Codec != want.Codec {
+		t.Errorf("codec = %q, want %q", got.Codec, want.Codec)
+	}
+	if got.Timecode != want.Timecode {
+		t.Errorf("timecode = %q, want %q", got.Timecode, want.Timecode)
+	}
+	switch {
+	case want.CreationTime == nil && got.CreationTime != nil:
+		t.Errorf("creation time = %v, want none", got.CreationTime)
+	case want.CreationTime != nil && (got.CreationTime == nil || !got.CreationTime.Equal(*want.CreationTime)):
+		t.Errorf("creation time = %v, want %v", got.CreationTime, want.CreationTime)
+	}
+}
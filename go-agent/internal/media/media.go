@@ -0,0 +1,109 @@
+package media
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Container formats
+const (
+	ContainerMP4 = "mp4"
+	ContainerMOV = "mov"
+	ContainerMXF = "mxf"
+)
+
+// ErrUnsupported is returned for files that aren't a supported video container
+var ErrUnsupported = errors.New("unsupported media format")
+
+// errMalformed is returned when a container's structure can't be parsed
+var errMalformed = errors.New("malformed media file")
+
+// maxReadSize caps how much of a single header structure is read into memory
+const maxReadSize = 16 << 20
+
+// Metadata describes a video clip as recorded in its container headers
+type Metadata struct {
+	Container    string     `json:"container"`              // mp4, mov, mxf
+	Duration     float64    `json:"duration,omitempty"`     // Seconds
+	Width        int        `json:"width,omitempty"`        // Pixels
+	Height       int        `json:"height,omitempty"`       // Pixels
+	FrameRate    float64    `json:"frameRate,omitempty"`    // Frames per second
+	Codec        string     `json:"codec,omitempty"`        // Sample entry fourcc for MP4/MOV, essence coding for MXF
+	Timecode     string     `json:"timecode,omitempty"`     // Start timecode HH:MM:SS:FF, ";" before the frames when drop-frame
+	CreationTime *time.Time `json:"creationTime,omitempty"` // When the clip was recorded or created
+}
+
+// containers maps file extensions to container formats
+var containers = map[string]string{
+	".mp4": ContainerMP4,
+	".m4v": ContainerMP4,
+	".3gp": ContainerMP4,
+	".3g2": ContainerMP4,
+	".mov": ContainerMOV,
+	".qt":  ContainerMOV,
+	".mxf": ContainerMXF,
+}
+
+// Supported reports whether a file name has a supported video container extension
+func Supported(name string) bool {
+	_, ok := containers[strings.ToLower(filepath.Ext(name))]
+	return ok
+}
+
+// Probe reads the container headers of a video file
+func Probe(path string) (*Metadata, error) {
+	container, ok := containers[strings.ToLower(filepath.Ext(path))]
+	if !ok {
+		return nil, ErrUnsupported
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if container == ContainerMXF {
+		return probeMXF(f)
+	}
+	return probeBMFF(f, info.Size())
+}
+
+// formatTimecode formats a frame count as SMPTE timecode
+// Drop-frame timecode skips frame numbers at the start of each minute except every tenth
+func formatTimecode(frame int64, fps int, drop bool) string {
+	if fps <= 0 || frame < 0 {
+		return ""
+	}
+
+	separator := ":"
+	if drop && fps%30 == 0 {
+		separator = ";"
+		dropped := int64(fps / 15) // 2 at 29.97, 4 at 59.94
+		perMinute := int64(fps)*60 - dropped
+		perTenMinutes := perMinute*10 + dropped
+		tens, rem := frame/perTenMinutes, frame%perTenMinutes
+		frame += 9 * dropped * tens
+		if rem > dropped {
+			frame += dropped * ((rem - dropped) / perMinute)
+		}
+	}
+
+	f := int64(fps)
+	return fmt.Sprintf("%02d:%02d:%02d%s%02d",
+		frame/(f*3600)%24, frame/(f*60)%60, frame/f%60, separator, frame%f)
+}
+
+// roundRate rounds a frame rate to three decimals, e.g. 29.97
+func roundRate(rate float64) float64 {
+	return float64(int64(rate*1000+0.5)) / 1000
+}
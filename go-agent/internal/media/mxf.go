@@ -0,0 +1,278 @@
+package media
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+)
+
+// MXF (SMPTE 377) files start with a header partition pack followed by header metadata:
+// KLV triplets of a 16-byte universal label key, a BER-encoded length and a value
+// Metadata sets are local sets of 2-byte tags with 2-byte lengths
+
+// maxHeaderScan caps how far into a file header metadata is looked for
+const maxHeaderScan = 32 << 20
+
+var (
+	mxfPrefix          = []byte{0x06, 0x0e, 0x2b, 0x34}
+	mxfHeaderPartition = []byte{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x05, 0x01, 0x01, 0x0d, 0x01, 0x02, 0x01, 0x01, 0x02}
+	mxfPartitionPack   = []byte{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x05, 0x01, 0x01, 0x0d, 0x01, 0x02, 0x01, 0x01}
+	mxfEssence         = []byte{0x06, 0x0e, 0x2b, 0x34, 0x01, 0x02, 0x01, 0x01, 0x0d, 0x01, 0x03, 0x01}
+	mxfMetadataSet     = []byte{0x0d, 0x01, 0x01, 0x01, 0x01, 0x01} // Bytes 8-13 of SMPTE 377 metadata set keys
+)
+
+// Metadata set types (byte 14 of the set key)
+const (
+	mxfSetTimecodeComponent = 0x14
+	mxfSetGenericPicture    = 0x27
+	mxfSetCDCIPicture       = 0x28
+	mxfSetRGBAPicture       = 0x29
+	mxfSetIdentification    = 0x30
+	mxfSetMPEGVideoPicture  = 0x51
+)
+
+// Local tags of the metadata sets read here
+const (
+	mxfTagStartTimecode     = 0x1501
+	mxfTagRoundedTimecode   = 0x1502
+	mxfTagDropFrame         = 0x1503
+	mxfTagSampleRate        = 0x3001
+	mxfTagContainerDuration = 0x3002
+	mxfTagPictureCoding     = 0x3201
+	mxfTagStoredHeight      = 0x3202
+	mxfTagStoredWidth       = 0x3203
+	mxfTagFrameLayout       = 0x320c
+	mxfTagModificationDate  = 0x3c06
+)
+
+// mxfFrameLayoutSeparate is the frame layout whose stored height is per field
+const mxfFrameLayoutSeparate = 1
+
+// mxfCodecs names picture essence codings by their label from byte 8 on; more specific prefixes come first
+// A mask, when set, selects the prefix bits that must match
+var mxfCodecs = []struct {
+	prefix []byte
+	mask   []byte
+	name   string
+}{
+	{[]byte{0x04, 0x01, 0x02, 0x02, 0x03, 0x01}, nil, "jpeg2000"},
+	{[]byte{0x04, 0x01, 0x02, 0x02, 0x03, 0x06}, nil, "prores"},
+	{[]byte{0x04, 0x01, 0x02, 0x02, 0x01, 0x30}, []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xf0}, "avc1"}, // 01.3x, H.264 profiles
+	{[]byte{0x04, 0x01, 0x02, 0x02, 0x01}, nil, "mpeg2"},
+	{[]byte{0x04, 0x01, 0x02, 0x02, 0x02}, nil, "dv"},
+	{[]byte{0x04, 0x01, 0x02, 0x02, 0x71}, nil, "dnxhd"}, // SMPTE VC-3
+	{[]byte{0x04, 0x01, 0x02, 0x01}, nil, "uncompressed"},
+}
+
+// probeMXF reads an MXF file's header metadata
+func probeMXF(r io.Reader) (*Metadata, error) {
+	br := bufio.NewReader(io.LimitReader(r, maxHeaderScan))
+
+	key, _, err := readKLV(br, maxReadSize)
+	if err != nil || !bytes.HasPrefix(key, mxfHeaderPartition) {
+		return nil, errMalformed
+	}
+
+	meta := &Metadata{Container: ContainerMXF}
+	var (
+		picture, timecode bool
+		rate              [2]uint32
+		duration          int64
+	)
+	for {
+		key, value, err := readKLV(br, maxReadSize)
+		if err != nil {
+			break // End of the scanned range; keep what was found
+		}
+		if bytes.HasPrefix(key, mxfEssence) || isPartitionPack(key) {
+			break // Header metadata ends where essence or the next partition starts
+		}
+		if len(key) != 16 || !bytes.Equal(key[8:14], mxfMetadataSet) || key[5] != 0x53 {
+			continue
+		}
+
+		tags := localSet(value)
+		switch key[14] {
+		case mxfSetGenericPicture, mxfSetCDCIPicture, mxfSetRGBAPicture, mxfSetMPEGVideoPicture:
+			if picture {
+				continue
+			}
+			picture = true
+			meta.Width = int(tagUint(tags[mxfTagStoredWidth]))
+			meta.Height = int(tagUint(tags[mxfTagStoredHeight]))
+			if v := tags[mxfTagFrameLayout]; len(v) == 1 && v[0] == mxfFrameLayoutSeparate {
+				meta.Height *= 2
+			}
+			if v := tags[mxfTagSampleRate]; len(v) == 8 {
+				rate = [2]uint32{binary.BigEndian.Uint32(v[0:4]), binary.BigEndian.Uint32(v[4:8])}
+			}
+			if v := tags[mxfTagContainerDuration]; len(v) == 8 {
+				duration = int64(binary.BigEndian.Uint64(v))
+			}
+			meta.Codec = mxfCodecName(tags[mxfTagPictureCoding])
+
+		case mxfSetTimecodeComponent:
+			if timecode {
+				continue
+			}
+			timecode = true
+			start := int64(tagUint(tags[mxfTagStartTimecode]))
+			fps := int(tagUint(tags[mxfTagRoundedTimecode]))
+			drop := len(tags[mxfTagDropFrame]) == 1 && tags[mxfTagDropFrame][0] != 0
+			meta.Timecode = formatTimecode(start, fps, drop)
+
+		case mxfSetIdentification:
+			if meta.CreationTime == nil {
+				meta.CreationTime = mxfTimestamp(tags[mxfTagModificationDate])
+			}
+		}
+	}
+
+	if !picture && !timecode {
+		return nil, errMalformed
+	}
+	if rate[0] > 0 && rate[1] > 0 {
+		meta.FrameRate = roundRate(float64(rate[0]) / float64(rate[1]))
+		if duration > 0 {
+			meta.Duration = float64(duration) * float64(rate[1]) / float64(rate[0])
+		}
+	}
+	return meta, nil
+}
+
+// isPartitionPack reports whether a key is a header, body or footer partition pack
+// The primer pack and random index pack share the prefix but not byte 13
+func isPartitionPack(key []byte) bool {
+	return bytes.HasPrefix(key, mxfPartitionPack) && key[13] >= 0x02 && key[13] <= 0x04
+}
+
+// readKLV reads one KLV triplet, skipping values larger than maxValue
+func readKLV(br *bufio.Reader, maxValue int64) ([]byte, []byte, error) {
+	key := make([]byte, 16)
+	if _, err := io.ReadFull(br, key); err != nil {
+		return nil, nil, err
+	}
+	if !bytes.HasPrefix(key, mxfPrefix) {
+		return nil, nil, errMalformed
+	}
+
+	length, err := readBERLength(br)
+	if err != nil {
+		return nil, nil, err
+	}
+	if length > maxValue {
+		if _, err := br.Discard(int(length)); err != nil {
+			return nil, nil, err
+		}
+		return key, nil, nil
+	}
+
+	value := make([]byte, length)
+	if _, err := io.ReadFull(br, value); err != nil {
+		return nil, nil, err
+	}
+	return key, value, nil
+}
+
+// readBERLength reads a BER-encoded KLV length
+func readBERLength(br *bufio.Reader) (int64, error) {
+	b, err := br.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	if b < 0x80 {
+		return int64(b), nil
+	}
+
+	n := int(b & 0x7f)
+	if n == 0 || n > 8 {
+		return 0, errMalformed
+	}
+	var length uint64
+	for i := 0; i < n; i++ {
+		b, err := br.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		length = length<<8 | uint64(b)
+	}
+	if length > 1<<40 {
+		return 0, errMalformed
+	}
+	return int64(length), nil
+}
+
+// localSet splits a local set value into its tags
+func localSet(value []byte) map[uint16][]byte {
+	tags := make(map[uint16][]byte)
+	for len(value) >= 4 {
+		tag := binary.BigEndian.Uint16(value[0:2])
+		length := int(binary.BigEndian.Uint16(value[2:4]))
+		if 4+length > len(value) {
+			break
+		}
+		tags[tag] = value[4 : 4+length]
+		value = value[4+length:]
+	}
+	return tags
+}
+
+// tagUint decodes a big-endian unsigned tag value of 1, 2, 4 or 8 bytes
+func tagUint(v []byte) uint64 {
+	switch len(v) {
+	case 1:
+		return uint64(v[0])
+	case 2:
+		return uint64(binary.BigEndian.Uint16(v))
+	case 4:
+		return uint64(binary.BigEndian.Uint32(v))
+	case 8:
+		return binary.BigEndian.Uint64(v)
+	}
+	return 0
+}
+
+// mxfTimestamp decodes an MXF timestamp: year(2) month day hour minute second quarter-millisecond
+func mxfTimestamp(v []byte) *time.Time {
+	if len(v) != 8 {
+		return nil
+	}
+	year := int(binary.BigEndian.Uint16(v[0:2]))
+	if year == 0 || v[2] == 0 || v[3] == 0 {
+		return nil
+	}
+	t := time.Date(year, time.Month(v[2]), int(v[3]), int(v[4]), int(v[5]), int(v[6]), int(v[7])*4*int(time.Millisecond), time.UTC)
+	return &t
+}
+
+// mxfCodecName names a picture essence coding label, falling back to its hex form
+func mxfCodecName(label []byte) string {
+	if len(label) != 16 {
+		return ""
+	}
+	for _, c := range mxfCodecs {
+		if labelHasPrefix(label[8:], c.prefix, c.mask) {
+			return c.name
+		}
+	}
+	return fmt.Sprintf("%x", label)
+}
+
+// labelHasPrefix reports whether a label starts with prefix in the bits selected by mask
+func labelHasPrefix(label, prefix, mask []byte) bool {
+	if mask == nil {
+		return bytes.HasPrefix(label, prefix)
+	}
+	if len(label) < len(prefix) {
+		return false
+	}
+	for i := range prefix {
+		if label[i]&mask[i] != prefix[i]&mask[i] {
+			return false
+		}
+	}
+	return true
+}
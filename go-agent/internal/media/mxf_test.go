@@ -0,0 +1,178 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math/rand"
+	"testing"
+	"time"
+)
+
+// klv builds a KLV triplet with a BER length
+func klv(key []byte, value []byte) []byte {
+	out := append([]byte{}, key...)
+	if len(value) < 0x80 {
+		out = append(out, byte(len(value)))
+	} else {
+		out = append(out, 0x83, byte(len(value)>>16), byte(len(value)>>8), byte(len(value)))
+	}
+	return append(out, value...)
+}
+
+// mxfKey completes a 16-byte key from a prefix
+func mxfKey(prefix []byte, rest ...byte) []byte {
+	key := append(append([]byte{}, prefix...), rest...)
+	return append(key, zeros(16-len(key))...)
+}
+
+// metadataSet builds a header metadata set of the given type from local tags
+func metadataSet(setType byte, tags ...[]byte) []byte {
+	key := []byte{0x06, 0x0e, 0x2b, 0x34, 0x02, 0x53, 0x01, 0x01, 0x0d, 0x01, 0x01, 0x01, 0x01, 0x01, setType, 0x00}
+	return klv(key, bytes.Join(tags, nil))
+}
+
+// tag builds a local set tag
+func tag(id uint16, value []byte) []byte {
+	return append(append(u16(id), u16(uint16(len(value)))...), value...)
+}
+
+func u64(v uint64) []byte { return binary.BigEndian.AppendUint64(nil, v) }
+
+// codingLabel builds a picture essence coding label from its bytes 8 on
+func codingLabel(rest ...byte) []byte {
+	return mxfKey([]byte{0x06, 0x0e, 0x2b, 0x34, 0x04, 0x01, 0x01, 0x0a}, rest...)
+}
+
+// mxfFixture is a 10.01 second 1920x1080i 29.97 fps DNxHD clip starting at 01:00:00;00
+func mxfFixture() []byte {
+	var out []byte
+	out = append(out, klv(mxfKey(mxfHeaderPartition, 0x04, 0x00), zeros(88))...)
+	out = append(out, klv(mxfKey(mxfPartitionPack, 0x05, 0x01), zeros(8))...) // Primer pack
+	out = append(out, metadataSet(mxfSetIdentification,
+		tag(mxfTagModificationDate, []byte{0x07, 0xe8, 3, 15, 10, 30, 0, 0}),
+	)...)
+	out = append(out, metadataSet(mxfSetTimecodeComponent,
+		tag(mxfTagStartTimecode, u64(107892)),
+		tag(mxfTagRoundedTimecode, u16(30)),
+		tag(mxfTagDropFrame, []byte{1}),
+	)...)
+	out = append(out, metadataSet(mxfSetCDCIPicture,
+		tag(mxfTagSampleRate, append(u32(30000), u32(1001)...)),
+		tag(mxfTagContainerDuration, u64(300)),
+		tag(mxfTagPictureCoding, codingLabel(0x04, 0x01, 0x02, 0x02, 0x71, 0x08)),
+		tag(mxfTagStoredWidth, u32(1920)),
+		tag(mxfTagStoredHeight, u32(540)),
+		tag(mxfTagFrameLayout, []byte{mxfFrameLayoutSeparate}),
+	)...)
+	out = append(out, klv(mxfKey(mxfEssence, 0x15, 0x01, 0x05, 0x01), zeros(256))...)
+	// Past the essence, so never read
+	out = append(out, metadataSet(mxfSetRGBAPicture, tag(mxfTagStoredWidth, u32(640)))...)
+	return out
+}
+
+func TestProbeMXF(t *testing.T) {
+	got, err := probeMXF(bytes.NewReader(mxfFixture()))
+	if err != nil {
+		t.Fatalf("probe failed: %v", err)
+	}
+
+	created := time.Date(2024, 3, 15, 10, 30, 0, 0, time.UTC)
+	assertMetadata(t, got, &Metadata{
+		Container:    ContainerMXF,
+		Duration:     10.01,
+		Width:        1920,
+		Height:       1080,
+		FrameRate:    29.97,
+		Codec:        "dnxhd",
+		Timecode:     "01:00:00;00",
+		CreationTime: &created,
+	})
+}
+
+func TestProbeMXFNotMXF(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"mp4", mp4Fixture()},
+		{"body partition first", klv(mxfKey(mxfPartitionPack, 0x03, 0x04), zeros(88))},
+		{"header partition only", klv(mxfKey(mxfHeaderPartition, 0x04, 0x00), zeros(88))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := probeMXF(bytes.NewReader(tt.data)); err != errMalformed {
+				t.Fatalf("expected errMalformed, got %v", err)
+			}
+		})
+	}
+}
+
+func TestProbeMXFTruncated(t *testing.T) {
+	fixture := mxfFixture()
+	for n := 0; n < len(fixture); n++ {
+		probeMXF(bytes.NewReader(fixture[:n])) // Must not panic
+	}
+}
+
+func TestProbeMXFGarbage(t *testing.T) {
+	header := mxfKey(mxfHeaderPartition, 0x04, 0x00)
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"indefinite length", append(bytes.Clone(header), 0x80)},
+		{"length too long", append(bytes.Clone(header), 0x89, 1, 2, 3, 4, 5, 6, 7, 8, 9)},
+		{"length past limit", append(bytes.Clone(header), 0x88, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff)},
+		{"length past end", append(bytes.Clone(header), 0x84, 0x7f, 0xff, 0xff, 0xff)},
+		{"short local set", append(klv(header, nil), metadataSet(mxfSetCDCIPicture, []byte{0x32, 0x03, 0xff})...)},
+		{"tag past set end", append(klv(header, nil), metadataSet(mxfSetCDCIPicture, []byte{0x32, 0x03, 0xff, 0xff, 0x00})...)},
+		{"bad timestamp", append(klv(header, nil), metadataSet(mxfSetIdentification, tag(mxfTagModificationDate, []byte{0xff, 0xff, 99, 99, 99, 99, 99, 255}))...)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			probeMXF(bytes.NewReader(tt.data)) // Must not panic
+		})
+	}
+
+	// Corrupt every byte of the fixture in turn, then feed random noise after a valid header key
+	fixture := mxfFixture()
+	for i := range fixture {
+		data := bytes.Clone(fixture)
+		data[i] ^= 0xff
+		probeMXF(bytes.NewReader(data))
+	}
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		data := make([]byte, rng.Intn(256))
+		rng.Read(data)
+		probeMXF(bytes.NewReader(append(bytes.Clone(header), data...)))
+	}
+}
+
+func TestMXFCodecName(t *testing.T) {
+	tests := []struct {
+		name  string
+		label []byte
+		want  string
+	}{
+		{"jpeg2000", codingLabel(0x04, 0x01, 0x02, 0x02, 0x03, 0x01, 0x01), "jpeg2000"},
+		{"prores", codingLabel(0x04, 0x01, 0x02, 0x02, 0x03, 0x06, 0x03), "prores"},
+		{"avc high intra", codingLabel(0x04, 0x01, 0x02, 0x02, 0x01, 0x32, 0x21), "avc1"},
+		{"avc baseline", codingLabel(0x04, 0x01, 0x02, 0x02, 0x01, 0x31, 0x10), "avc1"},
+		{"mpeg2 422p", codingLabel(0x04, 0x01, 0x02, 0x02, 0x01, 0x02, 0x01), "mpeg2"},
+		{"mpeg2 long gop", codingLabel(0x04, 0x01, 0x02, 0x02, 0x01, 0x04, 0x03), "mpeg2"},
+		{"dv", codingLabel(0x04, 0x01, 0x02, 0x02, 0x02, 0x02, 0x02), "dv"},
+		{"dnxhd", codingLabel(0x04, 0x01, 0x02, 0x02, 0x71, 0x01), "dnxhd"},
+		{"uncompressed", codingLabel(0x04, 0x01, 0x02, 0x01, 0x7f), "uncompressed"},
+		{"unknown", codingLabel(0x04, 0x01, 0x02, 0x02, 0x7f), "060e2b340401010a040102027f000000"},
+		{"short", []byte{0x04, 0x01}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mxfCodecName(tt.label); got != tt.want {
+				t.Errorf("mxfCodecName = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,101 @@
+package media
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Prober reads clip metadata, remembering results for files that haven't changed
+type Prober struct {
+	db *sql.DB // nil to probe every time
+}
+
+// NewProber creates a prober that caches results in the SQLite database at dbPath
+// An empty dbPath disables the cache
+func NewProber(dbPath string) (*Prober, error) {
+	if dbPath == "" {
+		return &Prober{}, nil
+	}
+
+	db, err := sql.Open("sqlite3", dbPath+"?_journal_mode=WAL&_busy_timeout=5000")
+	if err != nil {
+		return nil, err
+	}
+
+	query := `
+	CREATE TABLE IF NOT EXISTS media_metadata (
+		path TEXT PRIMARY KEY,
+		size INTEGER NOT NULL,
+		mod_time INTEGER NOT NULL,
+		metadata TEXT NOT NULL,
+		probed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+	`
+	if _, err := db.Exec(query); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &Prober{db: db}, nil
+}
+
+// Probe returns the metadata of the video file at path, or nil if it isn't a readable clip
+// size and modTime identify the file version; unreadable files are cached too, so they aren't re-read
+func (p *Prober) Probe(path string, size int64, modTime time.Time) *Metadata {
+	if !Supported(path) {
+		return nil
+	}
+
+	if p.db != nil {
+		var cached string
+		err := p.db.QueryRow(
+			`SELECT metadata FROM media_metadata WHERE path = ? AND size = ? AND mod_time = ?`,
+			path, size, modTime.UnixNano(),
+		).Scan(&cached)
+		if err == nil {
+			return decodeMetadata(cached)
+		}
+	}
+
+	meta, err := Probe(path)
+	if err != nil {
+		meta = nil
+	}
+
+	if p.db != nil {
+		encoded := ""
+		if meta != nil {
+			data, _ := json.Marshal(meta)
+			encoded = string(data)
+		}
+		p.db.Exec(
+			`INSERT INTO media_metadata (path, size, mod_time, metadata, probed_at) VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+			ON CONFLICT(path) DO UPDATE SET size = excluded.size, mod_time = excluded.mod_time, metadata = excluded.metadata, probed_at = excluded.probed_at`,
+			path, size, modTime.UnixNano(), encoded,
+		)
+	}
+	return meta
+}
+
+// Close closes the cache database
+func (p *Prober) Close() error {
+	if p.db == nil {
+		return nil
+	}
+	return p.db.Close()
+}
+
+// decodeMetadata decodes a cached result; "" records a file that couldn't be read
+func decodeMetadata(cached string) *Metadata {
+	if cached == "" {
+		return nil
+	}
+	var meta Metadata
+	if err := json.Unmarshal([]byte(cached), &meta); err != nil {
+		return nil
+	}
+	return &meta
+}
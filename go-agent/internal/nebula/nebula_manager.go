@@ -1,10 +1,13 @@
 package nebula
 
 import (
+	"bufio"
+	"net"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strings"
 
 	"github.com/vidsync/agent/internal/util"
 )
@@ -105,3 +108,61 @@ func (nm *NebulaManager) Stop() error {
 func (nm *NebulaManager) IsRunning() bool {
 	return nm.running
 }
+
+// OverlayNetworks returns the subnets assigned to the Nebula TUN interface
+// Returns nil when Nebula isn't configured or its interface is down
+func (nm *NebulaManager) OverlayNetworks() []*net.IPNet {
+	iface, err := net.InterfaceByName(nm.tunDevice())
+	if err != nil {
+		return nil
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return nil
+	}
+
+	var networks []*net.IPNet
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok {
+			networks = append(networks, ipNet)
+		}
+	}
+	return networks
+}
+
+// tunDevice reads the TUN device name from nebula.yml (tun.dev)
+// Falls back to Nebula's default device name
+func (nm *NebulaManager) tunDevice() string {
+	const defaultDevice = "nebula1"
+
+	f, err := os.Open(filepath.Join(nm.dataDir, "nebula.yml"))
+	if err != nil {
+		return defaultDevice
+	}
+	defer f.Close()
+
+	inTun := false
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// Top-level keys aren't indented
+		if line[0] != ' ' && line[0] != '\t' {
+			inTun = trimmed == "tun:"
+			continue
+		}
+
+		if inTun && strings.HasPrefix(trimmed, "dev:") {
+			dev := strings.Trim(strings.TrimSpace(strings.TrimPrefix(trimmed, "dev:")), `"'`)
+			if dev != "" {
+				return dev
+			}
+		}
+	}
+	return defaultDevice
+}
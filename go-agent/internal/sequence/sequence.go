@@ -0,0 +1,233 @@
+package sequence
+
+import (
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// MinFrames is the fewest numbered files collapsed into a sequence
+const MinFrames = 3
+
+// maxDigits caps frame numbers; longer digit runs are dates or IDs rather than frames
+const maxDigits = 9
+
+// imageExtensions are the still formats frame sequences are delivered in
+var imageExtensions = map[string]bool{
+	".exr":  true,
+	".dpx":  true,
+	".cin":  true,
+	".ari":  true,
+	".dng":  true,
+	".tif":  true,
+	".tiff": true,
+	".png":  true,
+	".jpg":  true,
+	".jpeg": true,
+	".jp2":  true,
+	".j2c":  true,
+	".tga":  true,
+	".hdr":  true,
+	".sgi":  true,
+	".rgb":  true,
+	".bmp":  true,
+}
+
+// Info describes a numbered frame sequence listed as one entry
+type Info struct {
+	Pattern string  `json:"pattern"` // printf-style file name, e.g. shot_%04d.exr
+	First   int     `json:"first"`
+	Last    int     `json:"last"`
+	Frames  int     `json:"frames"`  // Frames present, First to Last minus Missing
+	Padding int     `json:"padding"` // Minimum digits of a frame number, 0 when unpadded
+	Missing []Range `json:"missing,omitempty"`
+}
+
+// Range is an inclusive range of frame numbers
+type Range struct {
+	First int `json:"first"`
+	Last  int `json:"last"`
+}
+
+// Frame is a file name split around its frame number
+type Frame struct {
+	Prefix string // Everything before the frame number, e.g. "shot_"
+	Suffix string // Everything after it, e.g. ".exr"
+	Number int
+	Digits string // The frame number as written, e.g. "0001"
+}
+
+// padded reports whether the frame number is written with leading zeros
+func (f Frame) padded() bool {
+	return len(f.Digits) > 1 && f.Digits[0] == '0'
+}
+
+// ParseFrame splits an image file name whose stem ends in a frame number
+func ParseFrame(name string) (Frame, bool) {
+	ext := filepath.Ext(name)
+	if !imageExtensions[strings.ToLower(ext)] {
+		return Frame{}, false
+	}
+	stem := strings.TrimSuffix(name, ext)
+
+	start := len(stem)
+	for start > 0 && stem[start-1] >= '0' && stem[start-1] <= '9' {
+		start--
+	}
+	digits := stem[start:]
+	if digits == "" || len(digits) > maxDigits {
+		return Frame{}, false
+	}
+
+	n, err := strconv.Atoi(digits)
+	if err != nil {
+		return Frame{}, false
+	}
+	return Frame{Prefix: stem[:start], Suffix: ext, Number: n, Digits: digits}, true
+}
+
+// File is a file of one directory considered for a sequence
+type File struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Sequence is a detected frame sequence and the files it stands for
+type Sequence struct {
+	Info    Info
+	Size    int64     // Total size of the frames
+	ModTime time.Time // Latest frame modification
+	Names   []string  // Frame file names
+}
+
+// member is a parsed frame of a candidate sequence
+type member struct {
+	frame Frame
+	file  File
+}
+
+// Detect groups the numbered image files of one directory into sequences of at least MinFrames frames
+// Files that aren't part of a sequence are left out; results are ordered by pattern
+func Detect(files []File) []Sequence {
+	type key struct{ prefix, suffix string }
+	groups := make(map[key][]member)
+	for _, f := range files {
+		frame, ok := ParseFrame(f.Name)
+		if !ok {
+			continue
+		}
+		k := key{frame.Prefix, frame.Suffix}
+		groups[k] = append(groups[k], member{frame, f})
+	}
+
+	var sequences []Sequence
+	for _, members := range groups {
+		if len(members) < MinFrames {
+			continue
+		}
+		for padding, class := range splitByPadding(members) {
+			if len(class) >= MinFrames {
+				sequences = append(sequences, build(class, padding))
+			}
+		}
+	}
+
+	sort.Slice(sequences, func(i, j int) bool {
+		return sequences[i].Info.Pattern < sequences[j].Info.Pattern
+	})
+	return sequences
+}
+
+// splitByPadding separates frames written with different zero padding, e.g. shot_01.exr and shot_0001.exr
+// Unpadded numbers join the widest padding they fit, e.g. 10000 in a %04d sequence
+func splitByPadding(members []member) map[int][]member {
+	var widths []int
+	seen := make(map[int]bool)
+	for _, m := range members {
+		if w := len(m.frame.Digits); m.frame.padded() && !seen[w] {
+			seen[w] = true
+			widths = append(widths, w)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.IntSlice(widths)))
+
+	classes := make(map[int][]member)
+	for _, m := range members {
+		width := 0
+		if m.frame.padded() {
+			width = len(m.frame.Digits)
+		} else {
+			for _, w := range widths {
+				if len(m.frame.Digits) >= w {
+					width = w
+					break
+				}
+			}
+		}
+		classes[width] = append(classes[width], m)
+	}
+
+	// Unpadded numbers that all have the same length read as padded to it, e.g. 1001-1240
+	// Single digits stay unpadded since %01d and %d name the same files
+	if unpadded := classes[0]; len(unpadded) > 0 && len(unpadded[0].frame.Digits) > 1 && !seen[len(unpadded[0].frame.Digits)] {
+		width := len(unpadded[0].frame.Digits)
+		same := true
+		for _, m := range unpadded {
+			if len(m.frame.Digits) != width {
+				same = false
+				break
+			}
+		}
+		if same {
+			delete(classes, 0)
+			classes[width] = unpadded
+		}
+	}
+	return classes
+}
+
+// build describes the frames of one sequence
+func build(members []member, padding int) Sequence {
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].frame.Number < members[j].frame.Number
+	})
+
+	first := members[0].frame
+	seq := Sequence{
+		Info: Info{
+			Pattern: pattern(first.Prefix, first.Suffix, padding),
+			First:   first.Number,
+			Last:    members[len(members)-1].frame.Number,
+			Frames:  len(members),
+			Padding: padding,
+		},
+		Names: make([]string, 0, len(members)),
+	}
+
+	for i, m := range members {
+		if i > 0 {
+			if prev := members[i-1].frame.Number; m.frame.Number > prev+1 {
+				seq.Info.Missing = append(seq.Info.Missing, Range{First: prev + 1, Last: m.frame.Number - 1})
+			}
+		}
+		seq.Size += m.file.Size
+		if m.file.ModTime.After(seq.ModTime) {
+			seq.ModTime = m.file.ModTime
+		}
+		seq.Names = append(seq.Names, m.file.Name)
+	}
+	return seq
+}
+
+// pattern builds the printf-style name of a sequence
+func pattern(prefix, suffix string, padding int) string {
+	escape := func(s string) string { return strings.ReplaceAll(s, "%", "%%") }
+	if padding == 0 {
+		return escape(prefix) + "%d" + escape(suffix)
+	}
+	return fmt.Sprintf("%s%%0%dd%s", escape(prefix), padding, escape(suffix))
+}
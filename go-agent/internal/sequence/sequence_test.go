@@ -0,0 +1,210 @@
+package sequence
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// files builds directory entries of 100 bytes each, the last one modified latest
+func files(names ...string) []File {
+	base := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	out := make([]File, len(names))
+	for i, name := range names {
+		out[i] = File{Name: name, Size: 100, ModTime: base.Add(time.Duration(i) * time.Minute)}
+	}
+	return out
+}
+
+func TestParseFrame(t *testing.T) {
+	tests := []struct {
+		name string
+		want Frame
+		ok   bool
+	}{
+		{"shot_0001.exr", Frame{Prefix: "shot_", Suffix: ".exr", Number: 1, Digits: "0001"}, true},
+		{"plate.1001.DPX", Frame{Prefix: "plate.", Suffix: ".DPX", Number: 1001, Digits: "1001"}, true},
+		{"42.png", Frame{Prefix: "", Suffix: ".png", Number: 42, Digits: "42"}, true},
+		{"v2_shot10.tif", Frame{Prefix: "v2_shot", Suffix: ".tif", Number: 10, Digits: "10"}, true},
+		{"shot_0001.mov", Frame{}, false},       // Not an image format
+		{"shot.exr", Frame{}, false},            // No frame number
+		{"shot_0001_v2a.exr", Frame{}, false},   // Number not at the end of the stem
+		{"scan_2024031512.dpx", Frame{}, false}, // Too many digits for a frame number
+		{"shot_0001", Frame{}, false},           // No extension
+		{"shot_0001.exr.tmp", Frame{}, false},   // Partial download
+		{"README", Frame{}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ParseFrame(tt.name)
+			if ok != tt.ok || got != tt.want {
+				t.Errorf("ParseFrame(%q) = %+v, %v; want %+v, %v", tt.name, got, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestDetect(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  []Info
+	}{
+		{
+			name:  "padded",
+			files: []string{"shot_0003.exr", "shot_0001.exr", "shot_0002.exr"},
+			want:  []Info{{Pattern: "shot_%04d.exr", First: 1, Last: 3, Frames: 3, Padding: 4}},
+		},
+		{
+			name:  "gaps",
+			files: []string{"f_001.dpx", "f_002.dpx", "f_003.dpx", "f_007.dpx", "f_008.dpx", "f_010.dpx"},
+			want: []Info{{Pattern: "f_%03d.dpx", First: 1, Last: 10, Frames: 6, Padding: 3,
+				Missing: []Range{{First: 4, Last: 6}, {First: 9, Last: 9}}}},
+		},
+		{
+			name:  "too few frames",
+			files: []string{"shot_0001.exr", "shot_0002.exr"},
+		},
+		{
+			name:  "other files left out",
+			files: []string{"a_01.png", "a_02.png", "a_03.png", "notes.txt", "a_01.mov", "b_01.png"},
+			want:  []Info{{Pattern: "a_%02d.png", First: 1, Last: 3, Frames: 3, Padding: 2}},
+		},
+		{
+			name:  "separate sequences by prefix and extension, ordered by pattern",
+			files: []string{"b.1.jpg", "b.2.jpg", "b.3.jpg", "a.01.tif", "a.02.tif", "a.03.tif", "a.01.tiff", "a.02.tiff", "a.03.tiff"},
+			want: []Info{
+				{Pattern: "a.%02d.tif", First: 1, Last: 3, Frames: 3, Padding: 2},
+				{Pattern: "a.%02d.tiff", First: 1, Last: 3, Frames: 3, Padding: 2},
+				{Pattern: "b.%d.jpg", First: 1, Last: 3, Frames: 3, Padding: 0},
+			},
+		},
+		{
+			name:  "mixed padding splits",
+			files: []string{"s_01.exr", "s_02.exr", "s_03.exr", "s_0001.exr", "s_0002.exr", "s_0003.exr"},
+			want: []Info{
+				{Pattern: "s_%02d.exr", First: 1, Last: 3, Frames: 3, Padding: 2},
+				{Pattern: "s_%04d.exr", First: 1, Last: 3, Frames: 3, Padding: 4},
+			},
+		},
+		{
+			name:  "unpadded numbers join the padding they fill",
+			files: []string{"s_0998.exr", "s_0999.exr", "s_1000.exr", "s_10000.exr"},
+			want: []Info{{Pattern: "s_%04d.exr", First: 998, Last: 10000, Frames: 4, Padding: 4,
+				Missing: []Range{{First: 1001, Last: 9999}}}},
+		},
+		{
+			name:  "same-length unpadded numbers read as padded",
+			files: []string{"plate.1001.dpx", "plate.1002.dpx", "plate.1003.dpx"},
+			want:  []Info{{Pattern: "plate.%04d.dpx", First: 1001, Last: 1003, Frames: 3, Padding: 4}},
+		},
+		{
+			name:  "varying unpadded lengths stay unpadded",
+			files: []string{"x8.png", "x9.png", "x10.png", "x11.png"},
+			want:  []Info{{Pattern: "x%d.png", First: 8, Last: 11, Frames: 4, Padding: 0}},
+		},
+		{
+			name:  "percent signs escaped",
+			files: []string{"50%_001.png", "50%_002.png", "50%_003.png"},
+			want:  []Info{{Pattern: "50%%_%03d.png", First: 1, Last: 3, Frames: 3, Padding: 3}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []Info
+			for _, seq := range Detect(files(tt.files...)) {
+				got = append(got, seq.Info)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Detect() = %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDetectTotals(t *testing.T) {
+	input := files("shot_0002.exr", "shot_0001.exr", "shot_0003.exr", "notes.txt")
+	seqs := Detect(input)
+	if len(seqs) != 1 {
+		t.Fatalf("expected 1 sequence, got %d", len(seqs))
+	}
+
+	seq := seqs[0]
+	if seq.Size != 300 {
+		t.Errorf("size = %d, want 300", seq.Size)
+	}
+	if !seq.ModTime.Equal(input[2].ModTime) {
+		t.Errorf("mod time = %v, want %v", seq.ModTime, input[2].ModTime)
+	}
+	if want := []string{"shot_0001.exr", "shot_0002.exr", "shot_0003.exr"}; !reflect.DeepEqual(seq.Names, want) {
+		t.Errorf("names = %v, want %v", seq.Names, want)
+	}
+}
+
+func TestSplitByPadding(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  map[int][]string
+	}{
+		{
+			name:  "single padding",
+			files: []string{"s_001.exr", "s_002.exr"},
+			want:  map[int][]string{3: {"s_001.exr", "s_002.exr"}},
+		},
+		{
+			name:  "two paddings",
+			files: []string{"s_01.exr", "s_0001.exr", "s_02.exr"},
+			want:  map[int][]string{2: {"s_01.exr", "s_02.exr"}, 4: {"s_0001.exr"}},
+		},
+		{
+			name:  "unpadded numbers join the widest padding they fit",
+			files: []string{"s_001.exr", "s_00001.exr", "s_100.exr", "s_1000.exr", "s_12345.exr", "s_7.exr", "s_12.exr"},
+			want:  map[int][]string{3: {"s_001.exr", "s_100.exr", "s_1000.exr"}, 5: {"s_00001.exr", "s_12345.exr"}, 0: {"s_7.exr", "s_12.exr"}},
+		},
+		{
+			name:  "same-length unpadded numbers",
+			files: []string{"s_1001.exr", "s_1002.exr"},
+			want:  map[int][]string{4: {"s_1001.exr", "s_1002.exr"}},
+		},
+		{
+			name:  "single digits stay unpadded",
+			files: []string{"s_1.exr", "s_2.exr"},
+			want:  map[int][]string{0: {"s_1.exr", "s_2.exr"}},
+		},
+		{
+			name:  "varying unpadded lengths",
+			files: []string{"s_9.exr", "s_10.exr"},
+			want:  map[int][]string{0: {"s_9.exr", "s_10.exr"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var members []member
+			for _, f := range files(tt.files...) {
+				frame, ok := ParseFrame(f.Name)
+				if !ok {
+					t.Fatalf("ParseFrame(%q) failed", f.Name)
+				}
+				members = append(members, member{frame, f})
+			}
+
+			got := make(map[int][]string)
+			for width, class := range splitByPadding(members) {
+				for _, m := range class {
+					got[width] = append(got[width], m.file.Name)
+				}
+				sort.Strings(got[width])
+			}
+			for _, names := range tt.want {
+				sort.Strings(names)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("splitByPadding() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,421 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	stdsync "sync"
+	"time"
+
+	"github.com/vidsync/agent/internal/api"
+	"github.com/vidsync/agent/internal/sync"
+	"github.com/vidsync/agent/internal/util"
+)
+
+// Conflict resolution actions
+const (
+	ConflictKeepLocal  = "keep-local"  // Keep this device's version, discard the other device's edits
+	ConflictKeepRemote = "keep-remote" // Keep the other device's version, discard this device's edits
+	ConflictKeepBoth   = "keep-both"   // Rename conflict copies to regular files so both versions sync
+)
+
+// ErrConflictSideMissing is returned when no conflict copy holds the version to keep
+// With more than two devices the original can't be assumed to be the other side's
+var ErrConflictSideMissing = errors.New("no conflict copy holds the requested version")
+
+// ConflictService detects and resolves Syncthing sync conflicts
+type ConflictService struct {
+	syncClient  *api.SyncthingClient
+	cloudClient *api.CloudClient
+	logger      *util.Logger
+	emitter     EventEmitter
+	mu          stdsync.Mutex
+	seen        map[string]bool // projectID + "/" + conflict path -> already reported
+}
+
+// NewConflictService creates a new conflict service
+func NewConflictService(syncClient *api.SyncthingClient, cloudClient *api.CloudClient, logger *util.Logger) *ConflictService {
+	return &ConflictService{
+		syncClient:  syncClient,
+		cloudClient: cloudClient,
+		logger:      logger,
+		seen:        make(map[string]bool),
+	}
+}
+
+// ConflictFile describes one side of a conflict
+type ConflictFile struct {
+	Path          string    `json:"path"`
+	Size          int64     `json:"size"`
+	ModTime       time.Time `json:"modTime"`
+	Exists        bool      `json:"exists"`
+	ShortDeviceID string    `json:"shortDeviceId,omitempty"`
+	DeviceID      string    `json:"deviceId,omitempty"`
+	DeviceName    string    `json:"deviceName,omitempty"`
+	Local         bool      `json:"local"` // Copy holds this device's losing edit
+	CreatedAt     time.Time `json:"createdAt,omitempty"`
+}
+
+// ConflictGroup is an original file with all of its conflict copies
+type ConflictGroup struct {
+	Original  ConflictFile   `json:"original"`
+	Conflicts []ConflictFile `json:"conflicts"`
+}
+
+// ResolveConflictRequest is the request to resolve a conflict group
+type ResolveConflictRequest struct {
+	OriginalPath string `json:"originalPath"`
+	ConflictPath string `json:"conflictPath,omitempty"` // Optional: act on a single copy
+	Action       string `json:"action"`
+}
+
+// SetEventEmitter sets where conflict resolution events are published
+func (cs *ConflictService) SetEventEmitter(emitter EventEmitter) {
+	cs.emitter = emitter
+}
+
+// ListConflicts scans a project folder for conflict copies grouped by original file
+func (cs *ConflictService) ListConflicts(ctx context.Context, projectID string) ([]ConflictGroup, error) {
+	cs.logger.Debug("[ConflictService] Listing conflicts for project: %s", projectID)
+
+	folder, err := cs.syncClient.GetFolder(projectID)
+	if err != nil {
+		cs.logger.Error("[ConflictService] Failed to get folder config: %v", err)
+		return nil, err
+	}
+
+	conflicts, err := findConflicts(ctx, folder.Path)
+	if err != nil {
+		cs.logger.Error("[ConflictService] Failed to scan for conflicts: %v", err)
+		return nil, err
+	}
+
+	devices := cs.deviceIndex()
+	localID := cs.localShortID()
+	groups := map[string]*ConflictGroup{}
+	var order []string
+
+	for _, c := range conflicts {
+		group, ok := groups[c.OriginalPath]
+		if !ok {
+			group = &ConflictGroup{Original: statConflictFile(folder.Path, c.OriginalPath)}
+			groups[c.OriginalPath] = group
+			order = append(order, c.OriginalPath)
+		}
+
+		file := statConflictFile(folder.Path, c.Path)
+		file.ShortDeviceID = c.ShortDeviceID
+		file.CreatedAt = c.CreatedAt
+		file.Local = localID != "" && c.ShortDeviceID == localID
+		if device, ok := devices[c.ShortDeviceID]; ok {
+			file.DeviceID = device.DeviceID
+			file.DeviceName = device.Name
+		}
+		group.Conflicts = append(group.Conflicts, file)
+	}
+
+	sort.Strings(order)
+	result := make([]ConflictGroup, 0, len(order))
+	for _, p := range order {
+		group := groups[p]
+		sort.Slice(group.Conflicts, func(i, j int) bool {
+			return group.Conflicts[i].CreatedAt.After(group.Conflicts[j].CreatedAt)
+		})
+		result = append(result, *group)
+	}
+
+	return result, nil
+}
+
+// ResolveConflict applies a resolution action to a conflict group and rescans the folder
+func (cs *ConflictService) ResolveConflict(ctx context.Context, projectID string, req *ResolveConflictRequest) (map[string]interface{}, error) {
+	cs.logger.Info("[ConflictService] Resolving conflict in %s: %s (%s)", projectID, req.OriginalPath, req.Action)
+
+	groups, err := cs.ListConflicts(ctx, projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	var group *ConflictGroup
+	for i := range groups {
+		if groups[i].Original.Path == req.OriginalPath {
+			group = &groups[i]
+			break
+		}
+	}
+	if group == nil {
+		return nil, fmt.Errorf("no conflicts found for %s", req.OriginalPath)
+	}
+
+	copies := group.Conflicts
+	if req.ConflictPath != "" {
+		copies = nil
+		for _, c := range group.Conflicts {
+			if c.Path == req.ConflictPath {
+				copies = append(copies, c)
+			}
+		}
+		if len(copies) == 0 {
+			return nil, fmt.Errorf("conflict copy %s not found", req.ConflictPath)
+		}
+	}
+
+	folder, err := cs.syncClient.GetFolder(projectID)
+	if err != nil {
+		return nil, err
+	}
+	root := folder.Path
+
+	var changed []string
+	switch req.Action {
+	case ConflictKeepLocal, ConflictKeepRemote:
+		// A conflict copy is named after the device whose edit lost, so the wanted
+		// version is the newest copy made on that side
+		if cs.localShortID() == "" {
+			return nil, fmt.Errorf("cannot tell local and remote versions apart without the local device ID")
+		}
+		changed, err = keepSide(root, group.Original.Path, copies, req.Action == ConflictKeepLocal)
+		if err != nil {
+			return nil, err
+		}
+
+	case ConflictKeepBoth:
+		for _, c := range copies {
+			target := keepBothName(root, group.Original.Path, c)
+			if err := os.Rename(projectFilePath(root, c.Path), projectFilePath(root, target)); err != nil {
+				return nil, fmt.Errorf("failed to rename %s: %w", c.Path, err)
+			}
+			changed = append(changed, c.Path, target)
+		}
+
+	default:
+		return nil, fmt.Errorf("unknown conflict action: %s", req.Action)
+	}
+
+	if err := cs.syncClient.RescanPaths(projectID, changed...); err != nil {
+		cs.logger.Warn("[ConflictService] Rescan after resolution failed: %v", err)
+	}
+
+	cs.mu.Lock()
+	for _, c := range copies {
+		delete(cs.seen, projectID+"/"+c.Path)
+	}
+	cs.mu.Unlock()
+
+	emit(cs.emitter, projectID, "conflictResolved", req.OriginalPath, req.Action, map[string]interface{}{
+		"action":  req.Action,
+		"changed": changed,
+	})
+	if err := cs.cloudClient.ReportSyncEvent(projectID, "conflict_resolved", req.OriginalPath, req.Action); err != nil {
+		cs.logger.Warn("[ConflictService] Failed to report resolution to cloud: %v", err)
+	}
+
+	cs.logger.Info("[ConflictService] Conflict resolved: %s", req.OriginalPath)
+	return map[string]interface{}{
+		"ok":      true,
+		"action":  req.Action,
+		"changed": changed,
+	}, nil
+}
+
+// ReportConflict forwards a newly detected conflict to the cloud once
+// Registered as a SyncManager event handler for "conflict" events
+func (cs *ConflictService) ReportConflict(evt sync.Event) {
+	if evt.Type != "conflict" || !cs.markSeen(evt.ProjectID, evt.Path) {
+		return
+	}
+
+	cs.logger.Warn("[ConflictService] Sync conflict detected in %s: %s", evt.ProjectID, evt.Path)
+	if err := cs.cloudClient.ReportSyncEvent(evt.ProjectID, "conflict", evt.Path, evt.Message); err != nil {
+		cs.logger.Warn("[ConflictService] Failed to report conflict to cloud: %v", err)
+	}
+}
+
+// RunConflictScanner periodically scans all folders for conflicts the event stream missed
+// e.g. conflicts created while the agent was not running
+func (cs *ConflictService) RunConflictScanner(ctx context.Context, interval time.Duration, emitter EventEmitter) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		cs.scanAll(ctx, emitter)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cs *ConflictService) scanAll(ctx context.Context, emitter EventEmitter) {
+	folders, err := cs.syncClient.GetFolders()
+	if err != nil {
+		cs.logger.Debug("[ConflictService] Conflict scan skipped: %v", err)
+		return
+	}
+
+	for _, folder := range folders {
+		conflicts, err := findConflicts(ctx, folder.Path)
+		if err != nil {
+			cs.logger.Warn("[ConflictService] Conflict scan of %s failed: %v", folder.ID, err)
+			continue
+		}
+		for _, c := range conflicts {
+			if cs.isSeen(folder.ID, c.Path) {
+				continue
+			}
+			// ReportConflict marks it seen when the event comes back through the sync manager
+			emit(emitter, folder.ID, "conflict", c.Path, "Sync conflict on "+c.OriginalPath, map[string]interface{}{
+				"originalPath":  c.OriginalPath,
+				"shortDeviceId": c.ShortDeviceID,
+				"createdAt":     c.CreatedAt,
+			})
+		}
+	}
+}
+
+// markSeen records a conflict and reports whether it was new
+func (cs *ConflictService) markSeen(projectID, conflictPath string) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	key := projectID + "/" + conflictPath
+	if cs.seen[key] {
+		return false
+	}
+	cs.seen[key] = true
+	return true
+}
+
+func (cs *ConflictService) isSeen(projectID, conflictPath string) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.seen[projectID+"/"+conflictPath]
+}
+
+// localShortID returns the short ID this device stamps on its conflict copies
+func (cs *ConflictService) localShortID() string {
+	myID, err := cs.syncClient.GetMyID()
+	if err != nil || len(myID) < 7 {
+		cs.logger.Warn("[ConflictService] Failed to get local device ID: %v", err)
+		return ""
+	}
+	return myID[:7]
+}
+
+// deviceIndex maps short device IDs (first 7 characters) to device configs
+func (cs *ConflictService) deviceIndex() map[string]api.DeviceConfig {
+	index := map[string]api.DeviceConfig{}
+	devices, err := cs.syncClient.GetDevices()
+	if err != nil {
+		return index
+	}
+	for _, d := range devices {
+		if len(d.DeviceID) >= 7 {
+			index[d.DeviceID[:7]] = d
+		}
+	}
+	return index
+}
+
+// findConflicts walks a folder and returns every conflict copy in it
+func findConflicts(ctx context.Context, root string) ([]sync.ConflictName, error) {
+	var conflicts []sync.ConflictName
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // Skip inaccessible files
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if d.IsDir() {
+			if d.Name() == ".stfolder" || d.Name() == ".stversions" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return nil
+		}
+		if c, ok := sync.ParseConflictName(filepath.ToSlash(rel)); ok {
+			conflicts = append(conflicts, c)
+		}
+		return nil
+	})
+	return conflicts, err
+}
+
+// keepSide resolves a conflict in favour of the local or remote version
+// The newest copy from the wanted side replaces the original and all other copies are removed
+func keepSide(root, originalPath string, copies []ConflictFile, local bool) ([]string, error) {
+	var changed []string
+	winner := -1
+	for i, c := range copies {
+		if c.Local == local {
+			winner = i
+			break // Copies are sorted newest first
+		}
+	}
+
+	if winner < 0 {
+		return nil, ErrConflictSideMissing
+	}
+
+	c := copies[winner]
+	if err := os.Rename(projectFilePath(root, c.Path), projectFilePath(root, originalPath)); err != nil {
+		return nil, fmt.Errorf("failed to replace %s: %w", originalPath, err)
+	}
+	changed = append(changed, c.Path, originalPath)
+	for i, c := range copies {
+		if i == winner {
+			continue
+		}
+		if err := os.Remove(projectFilePath(root, c.Path)); err != nil {
+			return nil, fmt.Errorf("failed to remove %s: %w", c.Path, err)
+		}
+		changed = append(changed, c.Path)
+	}
+	return changed, nil
+}
+
+// statConflictFile returns size and mtime for a project-relative path
+func statConflictFile(root, rel string) ConflictFile {
+	file := ConflictFile{Path: rel}
+	if info, err := os.Stat(projectFilePath(root, rel)); err == nil {
+		file.Exists = true
+		file.Size = info.Size()
+		file.ModTime = info.ModTime()
+	}
+	return file
+}
+
+// keepBothName returns a free, non-conflict name for a conflict copy
+// e.g. "edit.prproj" -> "edit (conflict ABCDEFG 2024-01-02 150405).prproj"
+func keepBothName(root, originalPath string, c ConflictFile) string {
+	ext := path.Ext(originalPath)
+	base := strings.TrimSuffix(originalPath, ext)
+	label := fmt.Sprintf("%s (conflict %s %s)", base, c.ShortDeviceID, c.CreatedAt.Format("2006-01-02 150405"))
+
+	candidate := label + ext
+	for i := 2; ; i++ {
+		if _, err := os.Stat(projectFilePath(root, candidate)); os.IsNotExist(err) {
+			return candidate
+		}
+		candidate = fmt.Sprintf("%s %d%s", label, i, ext)
+	}
+}
+
+// projectFilePath joins a slash-separated project-relative path onto the folder root
+// The path is cleaned first so it can't escape the folder
+func projectFilePath(root, rel string) string {
+	clean := path.Clean("/" + rel)
+	return filepath.Join(root, filepath.FromSlash(clean))
+}
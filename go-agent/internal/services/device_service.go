@@ -28,6 +28,11 @@ func NewDeviceService(syncClient *api.SyncthingClient, cloudClient *api.CloudCli
 func (ds *DeviceService) SyncDevice(ctx context.Context, userID, accessToken string) (map[string]interface{}, error) {
 	ds.logger.Info("[DeviceService] Syncing device for user: %s", userID)
 
+	// Electron syncs the device on sign-in; keep the token for background membership checks
+	if accessToken != "" {
+		ds.cloudClient.SetSessionToken(accessToken)
+	}
+
 	// Get device ID from Syncthing
 	status, err := ds.syncClient.GetStatus()
 	if err != nil {
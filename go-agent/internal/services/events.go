@@ -0,0 +1,26 @@
+package services
+
+import (
+	"time"
+
+	"github.com/vidsync/agent/internal/sync"
+)
+
+// EventEmitter publishes an event to local WebSocket clients
+// Wired to SyncManager.EmitEvent in main
+type EventEmitter func(evt sync.Event)
+
+// emit sends an event through emitter if one is configured
+func emit(emitter EventEmitter, projectID, eventType, path, message string, data map[string]interface{}) {
+	if emitter == nil {
+		return
+	}
+	emitter(sync.Event{
+		ProjectID: projectID,
+		Type:      eventType,
+		Path:      path,
+		Message:   message,
+		Data:      data,
+		Timestamp: time.Now().Format(time.RFC3339),
+	})
+}
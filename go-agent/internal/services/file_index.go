@@ -0,0 +1,482 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	stdsync "sync"
+	"time"
+
+	"github.com/vidsync/agent/internal/api"
+	"github.com/vidsync/agent/internal/index"
+	"github.com/vidsync/agent/internal/sequence"
+	"github.com/vidsync/agent/internal/util"
+)
+
+const (
+	// fileIndexDelay is how long changes reported by events are gathered before the index is updated
+	fileIndexDelay = time.Second
+	// fileIndexRetry is how long changes that failed to apply wait before they are tried again
+	fileIndexRetry = 30 * time.Second
+)
+
+// FileIndex keeps a persistent index of each project's files, so file APIs don't walk the disk
+// A project is indexed by a full walk the first time its files are read; after that, Syncthing's
+// events rescan just the paths that changed and keep each entry's sync state
+type FileIndex struct {
+	store       *index.Store
+	fileService *FileService
+	syncClient  *api.SyncthingClient
+	logger      *util.Logger
+
+	mu       stdsync.Mutex
+	locks    map[string]*stdsync.Mutex // Serializes builds and updates per project
+	built    map[string]bool           // Projects with an index, so events are checked without a query
+	pending  map[string]*indexUpdate   // Changes not applied yet
+	updating map[string]bool           // Projects with pending changes being applied
+}
+
+// indexUpdate is what changed in a project since its index was last updated
+type indexUpdate struct {
+	since      time.Time
+	retryAt    time.Time         // Not applied before then, after applying failed
+	full       bool              // Walk the whole folder again
+	paths      map[string]bool   // Slash-separated paths to rescan
+	states     map[string]string // Sync states to set once the paths are rescanned
+	syncStates bool              // Read every sync state from Syncthing again
+}
+
+// NewFileIndex creates an index kept in store for the projects of fileService
+func NewFileIndex(store *index.Store, fileService *FileService, syncClient *api.SyncthingClient, logger *util.Logger) *FileIndex {
+	return &FileIndex{
+		store:       store,
+		fileService: fileService,
+		syncClient:  syncClient,
+		logger:      logger,
+		locks:       make(map[string]*stdsync.Mutex),
+		built:       make(map[string]bool),
+		pending:     make(map[string]*indexUpdate),
+		updating:    make(map[string]bool),
+	}
+}
+
+// Ensure makes a project's index current for folderPath: built if it is missing or was built for
+// another path, and with the changes reported so far applied
+func (fi *FileIndex) Ensure(ctx context.Context, projectID, folderPath string) error {
+	lock := fi.lock(projectID)
+	lock.Lock()
+	defer lock.Unlock()
+
+	indexedPath, err := fi.store.FolderPath(projectID)
+	if err != nil && !errors.Is(err, index.ErrNotBuilt) {
+		return err
+	}
+	if indexedPath != folderPath {
+		return fi.buildLocked(ctx, projectID, folderPath)
+	}
+	fi.mu.Lock()
+	fi.built[projectID] = true
+	fi.mu.Unlock()
+	return fi.applyLocked(ctx, projectID, folderPath)
+}
+
+// Status returns the state of a project's index, or index.ErrNotBuilt
+func (fi *FileIndex) Status(projectID string) (*index.Status, error) {
+	return fi.store.Status(projectID)
+}
+
+// Rebuild walks a project's folder into a new index
+func (fi *FileIndex) Rebuild(ctx context.Context, projectID string) error {
+	folderPath, err := fi.fileService.folderPath(projectID)
+	if err != nil {
+		return err
+	}
+	lock := fi.lock(projectID)
+	lock.Lock()
+	defer lock.Unlock()
+	return fi.buildLocked(ctx, projectID, folderPath)
+}
+
+// Rescan updates the entries of a project at and below the given folder-relative paths
+func (fi *FileIndex) Rescan(ctx context.Context, projectID string, paths []string) error {
+	folderPath, err := fi.store.FolderPath(projectID)
+	if err != nil {
+		return err
+	}
+	lock := fi.lock(projectID)
+	lock.Lock()
+	defer lock.Unlock()
+	return fi.rescanLocked(ctx, projectID, folderPath, paths)
+}
+
+// Invalidate has a project's index rebuilt, e.g. after its ignore patterns changed
+func (fi *FileIndex) Invalidate(projectID string) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	fi.updateLocked(projectID).full = true
+}
+
+// Forget drops the index of a removed project
+func (fi *FileIndex) Forget(projectID string) {
+	fi.mu.Lock()
+	delete(fi.built, projectID)
+	delete(fi.pending, projectID)
+	fi.mu.Unlock()
+
+	if err := fi.store.Delete(projectID); err != nil {
+		fi.logger.Warn("[FileIndex] Failed to remove file index of %s: %v", projectID, err)
+	}
+}
+
+// Run keeps indexed projects current from Syncthing's events until ctx is cancelled
+// Indexes are rebuilt on start, as files may have changed while the agent wasn't running
+func (fi *FileIndex) Run(ctx context.Context) {
+	events := fi.syncClient.Events()
+	ch := events.Subscribe()
+	defer events.Unsubscribe(ch)
+
+	if projects, err := fi.store.Projects(); err != nil {
+		fi.logger.Warn("[FileIndex] Failed to list indexed projects: %v", err)
+	} else {
+		fi.mu.Lock()
+		for _, projectID := range projects {
+			fi.built[projectID] = true
+			fi.updateLocked(projectID).full = true
+		}
+		fi.mu.Unlock()
+	}
+
+	ticker := time.NewTicker(fileIndexDelay)
+	defer ticker.Stop()
+
+	fi.logger.Info("[FileIndex] File index updater started")
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-ch:
+			if !ok {
+				return
+			}
+			fi.handleEvent(evt)
+		case <-ticker.C:
+			for _, projectID := range fi.due() {
+				go fi.update(ctx, projectID)
+			}
+		}
+	}
+}
+
+// handleEvent records the changes an event reports for an indexed project
+func (fi *FileIndex) handleEvent(evt api.SyncthingEvent) {
+	switch evt.Type {
+	case "LocalIndexUpdated":
+		var data api.LocalIndexUpdatedData
+		if err := evt.DecodeData(&data); err != nil || !fi.indexed(data.Folder) {
+			return
+		}
+		fi.mu.Lock()
+		u := fi.updateLocked(data.Folder)
+		if len(data.Filenames) < data.Items {
+			u.full = true // Not every change was named
+		}
+		for _, name := range data.Filenames {
+			u.paths[name] = true
+		}
+		fi.mu.Unlock()
+	case "ItemStarted", "ItemFinished":
+		var data api.ItemEventData
+		if err := evt.DecodeData(&data); err != nil || data.Item == "" || !fi.indexed(data.Folder) {
+			return
+		}
+		state := SyncStateSyncing
+		if evt.Type == "ItemFinished" {
+			state = SyncStateSynced
+			if data.Error != nil {
+				state = SyncStateNeeded
+			}
+		}
+		fi.mu.Lock()
+		u := fi.updateLocked(data.Folder)
+		u.paths[data.Item] = true
+		u.states[data.Item] = state
+		fi.mu.Unlock()
+	case "StateChanged":
+		var data api.StateChangedData
+		if err := evt.DecodeData(&data); err != nil || data.To != "idle" || !fi.indexed(data.Folder) {
+			return
+		}
+		fi.mu.Lock()
+		fi.updateLocked(data.Folder).syncStates = true
+		fi.mu.Unlock()
+	}
+}
+
+// due returns the projects whose changes have been gathered long enough and marks them updating
+func (fi *FileIndex) due() []string {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	var projects []string
+	for projectID, u := range fi.pending {
+		if !fi.updating[projectID] && time.Since(u.since) >= fileIndexDelay && !time.Now().Before(u.retryAt) {
+			fi.updating[projectID] = true
+			projects = append(projects, projectID)
+		}
+	}
+	return projects
+}
+
+// update applies a project's pending changes
+func (fi *FileIndex) update(ctx context.Context, projectID string) {
+	defer func() {
+		fi.mu.Lock()
+		delete(fi.updating, projectID)
+		fi.mu.Unlock()
+	}()
+
+	folderPath, err := fi.store.FolderPath(projectID)
+	if errors.Is(err, index.ErrNotBuilt) {
+		fi.mu.Lock()
+		delete(fi.pending, projectID) // Forgotten meanwhile
+		fi.mu.Unlock()
+		return
+	}
+	if err != nil {
+		fi.logger.Warn("[FileIndex] Failed to read file index of %s: %v", projectID, err)
+		return
+	}
+
+	lock := fi.lock(projectID)
+	lock.Lock()
+	defer lock.Unlock()
+	if err := fi.applyLocked(ctx, projectID, folderPath); err != nil && ctx.Err() == nil {
+		fi.logger.Warn("[FileIndex] Failed to update file index of %s: %v", projectID, err)
+	}
+}
+
+// applyLocked applies a project's pending changes; the caller holds the project's lock
+// Changes that fail to apply are queued again, so they aren't lost until the next restart
+func (fi *FileIndex) applyLocked(ctx context.Context, projectID, folderPath string) error {
+	fi.mu.Lock()
+	u := fi.pending[projectID]
+	delete(fi.pending, projectID)
+	fi.mu.Unlock()
+	if u == nil {
+		return nil
+	}
+
+	if err := fi.applyUpdate(ctx, projectID, folderPath, u); err != nil {
+		fi.requeue(projectID, u)
+		return err
+	}
+	return nil
+}
+
+// applyUpdate applies one set of changes; the caller holds the project's lock
+func (fi *FileIndex) applyUpdate(ctx context.Context, projectID, folderPath string, u *indexUpdate) error {
+	if u.full {
+		return fi.buildLocked(ctx, projectID, folderPath)
+	}
+	if len(u.paths) > 0 {
+		paths := make([]string, 0, len(u.paths))
+		for p := range u.paths {
+			paths = append(paths, p)
+		}
+		if err := fi.rescanLocked(ctx, projectID, folderPath, paths); err != nil {
+			return err
+		}
+	}
+	if u.syncStates {
+		return fi.refreshSyncStates(projectID)
+	}
+	for p, state := range u.states {
+		if err := fi.store.SetSyncState(projectID, p, state); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requeue merges changes that failed to apply back into the project's pending ones, delayed by fileIndexRetry
+func (fi *FileIndex) requeue(projectID string, u *indexUpdate) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	if !fi.built[projectID] {
+		return // Forgotten meanwhile
+	}
+
+	pending := fi.updateLocked(projectID)
+	pending.retryAt = time.Now().Add(fileIndexRetry)
+	pending.full = pending.full || u.full
+	pending.syncStates = pending.syncStates || u.syncStates
+	for p := range u.paths {
+		pending.paths[p] = true
+	}
+	for p, state := range u.states {
+		if _, newer := pending.states[p]; !newer {
+			pending.states[p] = state
+		}
+	}
+}
+
+// buildLocked walks a project's folder into a new index; the caller holds the project's lock
+func (fi *FileIndex) buildLocked(ctx context.Context, projectID, folderPath string) error {
+	// Changes reported until now are covered by the walk
+	fi.mu.Lock()
+	delete(fi.pending, projectID)
+	fi.mu.Unlock()
+
+	start := time.Now()
+	ignores := fi.fileService.ignoreMatcher(projectID)
+	err := fi.store.Replace(projectID, folderPath, func(add func(api.FileInfo) error) error {
+		return fi.syncClient.WalkFiles(folderPath, 0, ignores, func(f api.FileInfo) error {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return add(f)
+		})
+	})
+	if err != nil {
+		return err
+	}
+	fi.mu.Lock()
+	fi.built[projectID] = true
+	fi.mu.Unlock()
+	fi.logger.Info("[FileIndex] Indexed %s in %v", projectID, time.Since(start).Round(time.Millisecond))
+
+	if err := fi.refreshSyncStates(projectID); err != nil {
+		fi.logger.Warn("[FileIndex] Failed to read sync states of %s: %v", projectID, err)
+	}
+	return nil
+}
+
+// rescanLocked walks the given paths again; the caller holds the project's lock
+// A path whose parent is new or gone is rescanned from the topmost such ancestor
+func (fi *FileIndex) rescanLocked(ctx context.Context, projectID, folderPath string, paths []string) error {
+	roots := make([]string, 0, len(paths))
+	for _, p := range paths {
+		p = path.Clean(filepath.ToSlash(p))
+		if p == "." || p == ".." || strings.HasPrefix(p, "../") || strings.HasPrefix(p, "/") {
+			continue
+		}
+		for parent := path.Dir(p); parent != "."; parent = path.Dir(parent) {
+			known, err := fi.store.Has(projectID, parent)
+			if err != nil {
+				return err
+			}
+			if known {
+				if _, err := os.Lstat(filepath.Join(folderPath, filepath.FromSlash(parent))); err == nil {
+					break
+				}
+			}
+			p = parent
+		}
+		roots = append(roots, p)
+	}
+
+	// Rescanning a directory covers everything below it
+	sort.Strings(roots)
+	ignores := fi.fileService.ignoreMatcher(projectID)
+	parents := make(map[string]bool)
+	last := ""
+	for _, p := range roots {
+		if last != "" && (p == last || strings.HasPrefix(p, last+"/")) {
+			continue
+		}
+		last = p
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		err := fi.store.ReplaceTree(projectID, p, func(add func(api.FileInfo) error) error {
+			return fi.syncClient.WalkTree(folderPath, filepath.FromSlash(p), ignores, add)
+		})
+		if err != nil {
+			return err
+		}
+		parents[path.Dir(p)] = true
+	}
+
+	// Adding or removing entries changes their directory's modification time
+	dirs := make([]api.FileInfo, 0, len(parents))
+	for dir := range parents {
+		info, err := os.Lstat(filepath.Join(folderPath, filepath.FromSlash(dir)))
+		if err != nil || !info.IsDir() {
+			continue
+		}
+		dirs = append(dirs, api.FileInfo{
+			Name:        info.Name(),
+			Path:        filepath.FromSlash(dir),
+			Size:        info.Size(),
+			IsDirectory: true,
+			ModTime:     info.ModTime(),
+		})
+	}
+	return fi.store.Put(projectID, dirs)
+}
+
+// refreshSyncStates reads the sync state of every file of a project from Syncthing
+func (fi *FileIndex) refreshSyncStates(projectID string) error {
+	folder, err := fi.syncClient.GetFolder(projectID)
+	if err != nil {
+		return err
+	}
+	states, err := fi.fileService.localSyncStates(projectID, folder.Type == FolderTypeReceiveOnly)
+	if err != nil {
+		return err
+	}
+	all := states.all
+	if all == "" {
+		all = SyncStateSynced
+	}
+	return fi.store.SetSyncStates(projectID, all, states.files)
+}
+
+// frames lists the frame files of a directory from a project's index, for sequence detection
+func (fi *FileIndex) frames(projectID string) frameLister {
+	return func(dir string) []sequence.File {
+		files, err := fi.store.Files(projectID, dir)
+		if err != nil {
+			fi.logger.Warn("[FileIndex] Failed to list %s of %s: %v", dir, projectID, err)
+			return nil
+		}
+		var frames []sequence.File
+		for _, f := range files {
+			if _, ok := sequence.ParseFrame(f.Name); ok {
+				frames = append(frames, sequence.File{Name: f.Name, Size: f.Size, ModTime: f.ModTime})
+			}
+		}
+		return frames
+	}
+}
+
+// indexed reports whether a project has an index to keep current
+func (fi *FileIndex) indexed(projectID string) bool {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	return fi.built[projectID]
+}
+
+func (fi *FileIndex) lock(projectID string) *stdsync.Mutex {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+	lock, ok := fi.locks[projectID]
+	if !ok {
+		lock = &stdsync.Mutex{}
+		fi.locks[projectID] = lock
+	}
+	return lock
+}
+
+func (fi *FileIndex) updateLocked(projectID string) *indexUpdate {
+	u, ok := fi.pending[projectID]
+	if !ok {
+		u = &indexUpdate{since: time.Now(), paths: make(map[string]bool), states: make(map[string]string)}
+		fi.pending[projectID] = u
+	}
+	return u
+}
@@ -0,0 +1,360 @@
+package services
+
+import (
+	"container/heap"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vidsync/agent/internal/api"
+	"github.com/vidsync/agent/internal/index"
+)
+
+// Orders of file listings; every order falls back to the path so pages stay stable
+const (
+	SortByPath  = "path"
+	SortByName  = "name" // File name, case-insensitive
+	SortBySize  = "size"
+	SortByMtime = "mtime"
+)
+
+// Page sizes of file listings
+const (
+	DefaultFileListLimit = 500
+	MaxFileListLimit     = 5000
+)
+
+// ErrInvalidCursor is returned for a cursor that is malformed or was made for another order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// FileListOptions selects, orders and pages a project's file listing
+type FileListOptions struct {
+	Limit           int       // Entries per page, DefaultFileListLimit when 0, at most MaxFileListLimit
+	Cursor          string    // NextCursor of the previous page, "" for the first page
+	Sort            string    // SortByPath when empty
+	Desc            bool      // Largest, newest or last first
+	Prefix          string    // Only paths starting with it, slash-separated
+	Extensions      []string  // Only files with one of these extensions, all when empty
+	MinSize         int64     // Only files of at least this size
+	MaxSize         int64     // Only files of at most this size, 0 for no limit
+	ModifiedSince   time.Time // Only files modified at or after it, all when zero
+	ExpandSequences bool      // List each frame of an image sequence instead of one entry per sequence
+}
+
+// FileListPage is one page of a project's file listing
+type FileListPage struct {
+	ProjectID  string                 `json:"projectId"`
+	Files      []api.FileInfo         `json:"files"`
+	Total      int                    `json:"total"`                // Entries matching the filters across all pages
+	NextCursor string                 `json:"nextCursor,omitempty"` // Empty on the last page
+	Sort       string                 `json:"sort"`
+	Desc       bool                   `json:"desc"`
+	Status     map[string]interface{} `json:"status,omitempty"` // Folder status, on the first page only
+}
+
+// fileListCursor is the position of the last entry of a page
+type fileListCursor struct {
+	Sort string `json:"s"`
+	Desc bool   `json:"d,omitempty"`
+	Key  string `json:"k,omitempty"` // Lowercase name for name order
+	Num  int64  `json:"n,omitempty"` // Size, or mtime in nanoseconds
+	Path string `json:"p"`
+}
+
+// GetFiles lists a project's files a page at a time
+// Directories are listed unless a filter only files can pass is set (extensions, size or modified-since)
+func (fs *FileService) GetFiles(ctx context.Context, projectID string, opts FileListOptions) (*FileListPage, error) {
+	fs.logger.Debug("[FileService] Getting files for project: %s", projectID)
+
+	normalizeFileListOptions(&opts)
+	var after *fileListCursor
+	if opts.Cursor != "" {
+		cursor, err := decodeFileListCursor(opts.Cursor, opts)
+		if err != nil {
+			return nil, err
+		}
+		after = cursor
+	}
+
+	// Get folder path from config
+	folderPath, err := fs.folderPath(projectID)
+	if err != nil {
+		fs.logger.Error("[FileService] Could not determine folder path: %v", err)
+		return nil, err
+	}
+
+	result, err := pageFileList(&opts, after, func(add func(api.FileInfo) error) error {
+		return fs.walkFiles(ctx, projectID, folderPath, opts.ExpandSequences, add)
+	})
+	if err != nil {
+		fs.logger.Error("[FileService] Failed to browse files: %v", err)
+		return nil, err
+	}
+	result.ProjectID = projectID
+	fs.attachMedia(folderPath, result.Files)
+
+	if opts.Cursor == "" {
+		status, err := fs.syncClient.GetFolderStatus(projectID)
+		if err != nil {
+			fs.logger.Error("[FileService] Failed to get folder status: %v", err)
+			return nil, err
+		}
+		result.Status = status
+	}
+	return result, nil
+}
+
+// pageFileList collects the page after cursor from the entries walk adds; after is nil for the first page
+func pageFileList(opts *FileListOptions, after *fileListCursor, walk func(add func(api.FileInfo) error) error) (*FileListPage, error) {
+	// Keep the first limit+1 entries past the cursor; the extra one tells whether another page follows
+	page := &fileListHeap{opts: opts}
+	total := 0
+	add := func(f api.FileInfo) error {
+		if !opts.includes(f) {
+			return nil
+		}
+		total++
+		if after != nil && !opts.before(*after, opts.cursorFor(f)) {
+			return nil
+		}
+		if page.Len() <= opts.Limit {
+			heap.Push(page, f)
+		} else if opts.less(f, page.files[0]) {
+			page.files[0] = f
+			heap.Fix(page, 0)
+		}
+		return nil
+	}
+	if err := walk(add); err != nil {
+		return nil, err
+	}
+
+	// The heap pops the last entry first
+	files := make([]api.FileInfo, page.Len())
+	for i := len(files) - 1; i >= 0; i-- {
+		files[i] = heap.Pop(page).(api.FileInfo)
+	}
+
+	result := &FileListPage{
+		Files: files,
+		Total: total,
+		Sort:  opts.Sort,
+		Desc:  opts.Desc,
+	}
+	if len(files) > opts.Limit {
+		result.Files = files[:opts.Limit]
+		result.NextCursor = encodeFileListCursor(opts.cursorFor(result.Files[opts.Limit-1]))
+	}
+	return result, nil
+}
+
+// normalizeFileListOptions fills in defaults and puts filters in the form entries are compared with
+func normalizeFileListOptions(opts *FileListOptions) {
+	if opts.Limit <= 0 {
+		opts.Limit = DefaultFileListLimit
+	}
+	if opts.Limit > MaxFileListLimit {
+		opts.Limit = MaxFileListLimit
+	}
+	if opts.Sort == "" {
+		opts.Sort = SortByPath
+	}
+	opts.Prefix = strings.TrimPrefix(filepath.ToSlash(opts.Prefix), "/")
+	extensions := make([]string, 0, len(opts.Extensions))
+	for _, ext := range opts.Extensions {
+		extensions = append(extensions, "."+strings.TrimPrefix(strings.ToLower(ext), "."))
+	}
+	opts.Extensions = extensions
+}
+
+// includes reports whether an entry passes the listing's filters
+func (o *FileListOptions) includes(f api.FileInfo) bool {
+	if f.Path == "." {
+		return false // The folder itself
+	}
+	if o.Prefix != "" && !strings.HasPrefix(filepath.ToSlash(f.Path), o.Prefix) {
+		return false
+	}
+	if f.IsDirectory {
+		return len(o.Extensions) == 0 && o.MinSize <= 0 && o.MaxSize <= 0 && o.ModifiedSince.IsZero()
+	}
+	if f.Size < o.MinSize || (o.MaxSize > 0 && f.Size > o.MaxSize) {
+		return false
+	}
+	if !o.ModifiedSince.IsZero() && f.ModTime.Before(o.ModifiedSince) {
+		return false
+	}
+	if len(o.Extensions) == 0 {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(f.Name))
+	for _, want := range o.Extensions {
+		if ext == want {
+			return true
+		}
+	}
+	return false
+}
+
+// cursorFor returns the position of an entry in the listing's order
+func (o *FileListOptions) cursorFor(f api.FileInfo) fileListCursor {
+	c := fileListCursor{Sort: o.Sort, Desc: o.Desc, Path: filepath.ToSlash(f.Path)}
+	switch o.Sort {
+	case SortByName:
+		c.Key = strings.ToLower(f.Name)
+	case SortBySize:
+		c.Num = f.Size
+	case SortByMtime:
+		c.Num = f.ModTime.UnixNano()
+	}
+	return c
+}
+
+// before reports whether position a comes before position b in the listing's order
+func (o *FileListOptions) before(a, b fileListCursor) bool {
+	switch {
+	case a.Key != b.Key:
+		return (a.Key < b.Key) != o.Desc
+	case a.Num != b.Num:
+		return (a.Num < b.Num) != o.Desc
+	case a.Path != b.Path:
+		return (a.Path < b.Path) != o.Desc
+	}
+	return false
+}
+
+// less reports whether entry a comes before entry b in the listing's order
+func (o *FileListOptions) less(a, b api.FileInfo) bool {
+	return o.before(o.cursorFor(a), o.cursorFor(b))
+}
+
+func encodeFileListCursor(c fileListCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeFileListCursor reads a cursor, which must have been made for the same order
+func decodeFileListCursor(s string, opts FileListOptions) (*fileListCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c fileListCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.Sort != opts.Sort || c.Desc != opts.Desc {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// fileListHeap holds the first entries of a page, the last of them on top
+type fileListHeap struct {
+	opts  *FileListOptions
+	files []api.FileInfo
+}
+
+func (h *fileListHeap) Len() int           { return len(h.files) }
+func (h *fileListHeap) Less(i, j int) bool { return h.opts.less(h.files[j], h.files[i]) }
+func (h *fileListHeap) Swap(i, j int)      { h.files[i], h.files[j] = h.files[j], h.files[i] }
+func (h *fileListHeap) Push(x interface{}) { h.files = append(h.files, x.(api.FileInfo)) }
+
+func (h *fileListHeap) Pop() interface{} {
+	last := h.files[len(h.files)-1]
+	h.files = h.files[:len(h.files)-1]
+	return last
+}
+
+// Result sizes of file searches
+const (
+	DefaultFileSearchLimit = 100
+	MaxFileSearchLimit     = 1000
+)
+
+// ErrFileIndexDisabled is returned for index requests when the file index is turned off
+var ErrFileIndexDisabled = errors.New("file index is disabled")
+
+// FileSearchResult is the entries of a project whose name matched a search
+type FileSearchResult struct {
+	ProjectID string        `json:"projectId"`
+	Query     string        `json:"query"`
+	Files     []index.Entry `json:"files"`
+	Total     int           `json:"total"` // Matches, of which at most the limit are listed
+}
+
+// SearchFiles finds a project's files and directories whose name contains query, ignoring case
+// Frames of image sequences are matched one by one
+func (fs *FileService) SearchFiles(ctx context.Context, projectID, query string, limit int) (*FileSearchResult, error) {
+	if limit <= 0 {
+		limit = DefaultFileSearchLimit
+	}
+	if limit > MaxFileSearchLimit {
+		limit = MaxFileSearchLimit
+	}
+
+	folderPath, err := fs.folderPath(projectID)
+	if err != nil {
+		fs.logger.Error("[FileService] Could not determine folder path: %v", err)
+		return nil, err
+	}
+
+	result := &FileSearchResult{ProjectID: projectID, Query: query, Files: []index.Entry{}}
+	if fs.index != nil {
+		if err := fs.index.Ensure(ctx, projectID, folderPath); err != nil {
+			fs.logger.Error("[FileService] Failed to update file index: %v", err)
+			return nil, err
+		}
+		result.Files, result.Total, err = fs.index.store.Search(projectID, query, limit)
+		if err != nil {
+			fs.logger.Error("[FileService] Failed to search file index: %v", err)
+			return nil, err
+		}
+		return result, nil
+	}
+
+	query = strings.ToLower(query)
+	err = fs.walkFiles(ctx, projectID, folderPath, true, func(f api.FileInfo) error {
+		if f.Path == "." || !strings.Contains(strings.ToLower(f.Name), query) {
+			return nil
+		}
+		result.Total++
+		if len(result.Files) < limit {
+			result.Files = append(result.Files, index.Entry{FileInfo: f})
+		}
+		return nil
+	})
+	if err != nil {
+		fs.logger.Error("[FileService] Failed to browse files: %v", err)
+		return nil, err
+	}
+	return result, nil
+}
+
+// FileIndexStatus returns the state of a project's file index, or index.ErrNotBuilt
+func (fs *FileService) FileIndexStatus(projectID string) (*index.Status, error) {
+	if fs.index == nil {
+		return nil, ErrFileIndexDisabled
+	}
+	return fs.index.Status(projectID)
+}
+
+// RescanFileIndex updates a project's file index from disk: the given folder-relative paths,
+// or the whole folder when there are none
+func (fs *FileService) RescanFileIndex(ctx context.Context, projectID string, paths []string) (*index.Status, error) {
+	if fs.index == nil {
+		return nil, ErrFileIndexDisabled
+	}
+	var err error
+	if len(paths) == 0 {
+		err = fs.index.Rebuild(ctx, projectID)
+	} else {
+		err = fs.index.Rescan(ctx, projectID, paths)
+	}
+	if err != nil {
+		fs.logger.Error("[FileService] Failed to rescan file index: %v", err)
+		return nil, err
+	}
+	return fs.index.Status(projectID)
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"errors"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/vidsync/agent/internal/api"
+)
+
+// listingFiles is a folder as a walk reports it: the folder itself, a directory and four files
+func listingFiles() []api.FileInfo {
+	base := time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+	file := func(p string, size int64, minute int, dir bool) api.FileInfo {
+		return api.FileInfo{
+			Name:        path.Base(p),
+			Path:        filepath.FromSlash(p),
+			Size:        size,
+			IsDirectory: dir,
+			ModTime:     base.Add(time.Duration(minute) * time.Minute),
+		}
+	}
+	return []api.FileInfo{
+		file(".", 0, 9, true),
+		file("a", 0, 5, true),
+		file("a/Clip.mov", 30, 2, false),
+		file("a/b.wav", 10, 1, false),
+		file("B.txt", 20, 3, false),
+		file("c.mov", 30, 0, false),
+	}
+}
+
+// listAll pages through a listing and returns the paths of every page in order
+func listAll(t *testing.T, opts FileListOptions) []string {
+	t.Helper()
+	normalizeFileListOptions(&opts)
+	walk := func(add func(api.FileInfo) error) error {
+		for _, f := range listingFiles() {
+			if err := add(f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	var paths []string
+	var after *fileListCursor
+	total := -1
+	for pages := 0; ; pages++ {
+		if pages > 10 {
+			t.Fatalf("listing doesn't end; paths so far: %v", paths)
+		}
+		page, err := pageFileList(&opts, after, walk)
+		if err != nil {
+			t.Fatalf("pageFileList: %v", err)
+		}
+		if total >= 0 && page.Total != total {
+			t.Errorf("page %d has total %d, earlier pages %d", pages, page.Total, total)
+		}
+		total = page.Total
+		if len(page.Files) > opts.Limit {
+			t.Errorf("page %d has %d entries, limit %d", pages, len(page.Files), opts.Limit)
+		}
+		for _, f := range page.Files {
+			paths = append(paths, filepath.ToSlash(f.Path))
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		after, err = decodeFileListCursor(page.NextCursor, opts)
+		if err != nil {
+			t.Fatalf("decodeFileListCursor(%q): %v", page.NextCursor, err)
+		}
+	}
+	if total != len(paths) {
+		t.Errorf("total = %d, listed %d entries", total, len(paths))
+	}
+	return paths
+}
+
+func TestFileListPaging(t *testing.T) {
+	tests := []struct {
+		name string
+		opts FileListOptions
+		want []string
+	}{
+		{
+			name: "path",
+			opts: FileListOptions{Limit: 2},
+			want: []string{"B.txt", "a", "a/Clip.mov", "a/b.wav", "c.mov"},
+		},
+		{
+			name: "path descending",
+			opts: FileListOptions{Limit: 2, Desc: true},
+			want: []string{"c.mov", "a/b.wav", "a/Clip.mov", "a", "B.txt"},
+		},
+		{
+			name: "name ignores case",
+			opts: FileListOptions{Limit: 2, Sort: SortByName},
+			want: []string{"a", "B.txt", "a/b.wav", "c.mov", "a/Clip.mov"},
+		},
+		{
+			name: "size descending, ties by path",
+			opts: FileListOptions{Limit: 2, Sort: SortBySize, Desc: true},
+			want: []string{"c.mov", "a/Clip.mov", "B.txt", "a/b.wav", "a"},
+		},
+		{
+			name: "mtime, one per page",
+			opts: FileListOptions{Limit: 1, Sort: SortByMtime},
+			want: []string{"c.mov", "a/b.wav", "a/Clip.mov", "B.txt", "a"},
+		},
+		{
+			name: "page as large as the listing",
+			opts: FileListOptions{Limit: 5},
+			want: []string{"B.txt", "a", "a/Clip.mov", "a/b.wav", "c.mov"},
+		},
+		{
+			name: "extensions leave out directories",
+			opts: FileListOptions{Limit: 1, Extensions: []string{"MOV"}},
+			want: []string{"a/Clip.mov", "c.mov"},
+		},
+		{
+			name: "prefix and size range",
+			opts: FileListOptions{Limit: 2, Prefix: "/a/", MinSize: 10, MaxSize: 20},
+			want: []string{"a/b.wav"},
+		},
+		{
+			name: "nothing matches",
+			opts: FileListOptions{Limit: 2, Prefix: "missing/"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := listAll(t, tt.opts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("listing = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDecodeFileListCursor(t *testing.T) {
+	bySize := FileListOptions{Sort: SortBySize}
+	cursor := encodeFileListCursor(bySize.cursorFor(api.FileInfo{Path: "a.mov", Size: 10}))
+
+	tests := []struct {
+		name   string
+		cursor string
+		opts   FileListOptions
+		ok     bool
+	}{
+		{"same order", cursor, FileListOptions{Sort: SortBySize}, true},
+		{"other order", cursor, FileListOptions{Sort: SortByPath}, false},
+		{"other direction", cursor, FileListOptions{Sort: SortBySize, Desc: true}, false},
+		{"not base64", "!!", FileListOptions{Sort: SortBySize}, false},
+		{"not JSON", "bm90IGpzb24", FileListOptions{Sort: SortBySize}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := decodeFileListCursor(tt.cursor, tt.opts)
+			if tt.ok {
+				if err != nil || c.Path != "a.mov" || c.Num != 10 {
+					t.Errorf("decodeFileListCursor = %+v, %v; want the cursor of a.mov", c, err)
+				}
+			} else if !errors.Is(err, ErrInvalidCursor) {
+				t.Errorf("decodeFileListCursor = %+v, %v; want ErrInvalidCursor", c, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,160 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/vidsync/agent/internal/api"
+	"github.com/vidsync/agent/internal/ignore"
+	"github.com/vidsync/agent/internal/sequence"
+)
+
+// sequenceCollapser replaces the frames of numbered image sequences in a walk with one entry per sequence
+// Entries must arrive in walk order; each sequence entry is emitted where its pattern sorts among its
+// siblings, so the output is in walk order too and can be diffed like any listing
+type sequenceCollapser struct {
+	frames frameLister
+	emit   func(api.FileInfo) error
+	dirs   []*sequenceDir // Directories the walk is inside, outermost first
+}
+
+// frameLister returns the files of a directory that may be sequence frames, given its folder-relative path
+type frameLister func(dir string) []sequence.File
+
+// sequenceDir is a directory whose sequences were detected when the walk entered it
+type sequenceDir struct {
+	path    string
+	pending []api.FileInfo  // Sequence entries not emitted yet, in name order
+	frames  map[string]bool // Names of the files collapsed into a sequence
+}
+
+// newSequenceCollapser creates a collapser that finds each directory's frames with frames
+// and passes entries on to emit
+func newSequenceCollapser(frames frameLister, emit func(api.FileInfo) error) *sequenceCollapser {
+	return &sequenceCollapser{frames: frames, emit: emit}
+}
+
+// Add passes on the next entry of the walk, unless it is a frame of a sequence
+func (c *sequenceCollapser) Add(f api.FileInfo) error {
+	parent := filepath.Dir(f.Path)
+	if f.Path == "." {
+		parent = "" // The folder itself
+	}
+
+	// Finish the directories the walk has left
+	for len(c.dirs) > 0 && !isWithinDir(parent, c.dirs[len(c.dirs)-1].path) {
+		if err := c.pop(); err != nil {
+			return err
+		}
+	}
+
+	if n := len(c.dirs); n > 0 && c.dirs[n-1].path == parent {
+		dir := c.dirs[n-1]
+		if err := dir.emitBefore(f.Name, c.emit); err != nil {
+			return err
+		}
+		if !f.IsDirectory && dir.frames[f.Name] {
+			return nil
+		}
+	}
+
+	if err := c.emit(f); err != nil {
+		return err
+	}
+	if f.IsDirectory {
+		c.dirs = append(c.dirs, c.scanDir(f.Path))
+	}
+	return nil
+}
+
+// Close emits the sequences of the directories still open
+func (c *sequenceCollapser) Close() error {
+	for len(c.dirs) > 0 {
+		if err := c.pop(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// pop finishes the innermost open directory
+func (c *sequenceCollapser) pop() error {
+	dir := c.dirs[len(c.dirs)-1]
+	c.dirs = c.dirs[:len(c.dirs)-1]
+	for _, seq := range dir.pending {
+		if err := c.emit(seq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanDir detects the sequences among a directory's files before the walk visits them
+func (c *sequenceCollapser) scanDir(relPath string) *sequenceDir {
+	dir := &sequenceDir{path: relPath, frames: make(map[string]bool)}
+
+	for _, seq := range sequence.Detect(c.frames(relPath)) {
+		info := seq.Info
+		dir.pending = append(dir.pending, api.FileInfo{
+			Name:     info.Pattern,
+			Path:     filepath.Join(relPath, info.Pattern),
+			Size:     seq.Size,
+			ModTime:  seq.ModTime,
+			Sequence: &info,
+		})
+		for _, name := range seq.Names {
+			dir.frames[name] = true
+		}
+	}
+	sort.Slice(dir.pending, func(i, j int) bool {
+		return dir.pending[i].Name < dir.pending[j].Name
+	})
+	return dir
+}
+
+// emitBefore emits the pending sequences whose names sort before name
+func (d *sequenceDir) emitBefore(name string, emit func(api.FileInfo) error) error {
+	for len(d.pending) > 0 && d.pending[0].Name < name {
+		if err := emit(d.pending[0]); err != nil {
+			return err
+		}
+		d.pending = d.pending[1:]
+	}
+	return nil
+}
+
+// isWithinDir reports whether path is dir or inside it
+func isWithinDir(path, dir string) bool {
+	return dir == "." || path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// diskFrames lists frames by reading directories below root, skipping ignored files
+func diskFrames(root string, ignores *ignore.Matcher) frameLister {
+	return func(dir string) []sequence.File {
+		entries, err := os.ReadDir(filepath.Join(root, dir))
+		if err != nil {
+			return nil // The walk skips it too
+		}
+
+		var files []sequence.File
+		for _, e := range entries {
+			if e.IsDir() {
+				continue
+			}
+			if _, ok := sequence.ParseFrame(e.Name()); !ok {
+				continue
+			}
+			if ignores.Match(filepath.ToSlash(filepath.Join(dir, e.Name()))) {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			files = append(files, sequence.File{Name: e.Name(), Size: info.Size(), ModTime: info.ModTime()})
+		}
+		return files
+	}
+}
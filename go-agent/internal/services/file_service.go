@@ -1,15 +1,26 @@
 package services
 
 import (
-	"bytes"
-	"compress/gzip"
 	"context"
-	"encoding/json"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
 	"strings"
+	stdsync "sync"
 	"time"
 
 	"github.com/vidsync/agent/internal/api"
+	"github.com/vidsync/agent/internal/encryption"
+	"github.com/vidsync/agent/internal/hasher"
+	"github.com/vidsync/agent/internal/ignore"
+	"github.com/vidsync/agent/internal/index"
+	"github.com/vidsync/agent/internal/media"
+	"github.com/vidsync/agent/internal/signing"
 	"github.com/vidsync/agent/internal/util"
 )
 
@@ -19,8 +30,32 @@ type FileService struct {
 	cloudClient     *api.CloudClient
 	logger          *util.Logger
 	progressTracker *SnapshotProgressTracker
+	snapshots       *SnapshotStore   // Previous snapshots for delta uploads, nil to always upload in full
+	history         *SnapshotHistory // Last snapshots kept for diffs, nil to keep none
+	hasher          *hasher.Hasher   // Content hasher for snapshots, nil to skip hashing
+	prober          *media.Prober    // Video metadata reader, nil to skip clip metadata
+	expandSequences bool             // List image sequence frames individually in snapshots
+	uploadPartSize  int64            // Part size of resumable snapshot uploads, 0 for the client default
+	index           *FileIndex       // Persistent file index, nil to walk the disk on every read
+
+	signer     SnapshotSigner       // Signs uploaded snapshots, nil to upload them unsigned
+	signingKey *api.SigningKey      // Public half of the signer's key, registered with the cloud for owned projects
+	pins       *signing.PinStore    // Registered signing keys seen per project, nil to skip pinning
+	keys       *encryption.KeyStore // Snapshot encryption keys per project, nil to never encrypt
+
+	registeredMu stdsync.Mutex
+	registered   map[string]bool // Projects the cloud has our signing key for
+
+	runningMu stdsync.Mutex
+	running   map[string]bool // Projects with a snapshot being generated
 }
 
+// SnapshotSigner signs the digest of a snapshot document
+type SnapshotSigner func(digest []byte) signing.Signature
+
+// ErrSnapshotInProgress is returned when a project's snapshot is already being generated
+var ErrSnapshotInProgress = errors.New("snapshot already in progress")
+
 // NewFileService creates a new file service
 func NewFileService(syncClient *api.SyncthingClient, cloudClient *api.CloudClient, logger *util.Logger) *FileService {
 	return &FileService{
@@ -28,6 +63,8 @@ func NewFileService(syncClient *api.SyncthingClient, cloudClient *api.CloudClien
 		cloudClient:     cloudClient,
 		logger:          logger,
 		progressTracker: NewSnapshotProgressTracker(),
+		running:         make(map[string]bool),
+		registered:      make(map[string]bool),
 	}
 }
 
@@ -38,48 +75,174 @@ func NewFileServiceWithTracker(syncClient *api.SyncthingClient, cloudClient *api
 		cloudClient:     cloudClient,
 		logger:          logger,
 		progressTracker: tracker,
+		running:         make(map[string]bool),
+		registered:      make(map[string]bool),
 	}
 }
 
+// SetSnapshotStore enables delta snapshot uploads against the snapshots kept in store
+func (fs *FileService) SetSnapshotStore(store *SnapshotStore) {
+	fs.snapshots = store
+}
+
+// SetSnapshotHistory keeps generated snapshots in history so they can be listed and compared
+func (fs *FileService) SetSnapshotHistory(history *SnapshotHistory) {
+	fs.history = history
+}
+
+// SetHasher makes snapshots include content hashes computed by h
+func (fs *FileService) SetHasher(h *hasher.Hasher) {
+	fs.hasher = h
+}
+
+// SetMediaProber makes snapshots and file lists include video clip metadata read by p
+func (fs *FileService) SetMediaProber(p *media.Prober) {
+	fs.prober = p
+}
+
+// SetExpandSequences makes snapshots list the frames of image sequences individually instead of one entry per sequence
+func (fs *FileService) SetExpandSequences(expand bool) {
+	fs.expandSequences = expand
+}
+
+// SetUploadPartSize sets the part size snapshots are uploaded in
+func (fs *FileService) SetUploadPartSize(size int64) {
+	fs.uploadPartSize = size
+}
+
+// SetFileIndex makes file listings, trees, searches and snapshots read the project folders from idx
+func (fs *FileService) SetFileIndex(idx *FileIndex) {
+	fs.index = idx
+}
+
+// SetSnapshotSigner makes uploaded snapshots carry a signature made by signer with publicKey's private half
+// The key is registered with the cloud for the projects this device owns, which then refuses other signers
+func (fs *FileService) SetSnapshotSigner(signer SnapshotSigner, publicKey ed25519.PublicKey, deviceID string) {
+	fs.signer = signer
+	fs.signingKey = &api.SigningKey{
+		Algorithm: signing.Algorithm,
+		PublicKey: base64.StdEncoding.EncodeToString(publicKey),
+		DeviceID:  deviceID,
+	}
+}
+
+// SetSigningPins makes snapshot verification flag a registered signing key that changed since the one pinned in pins
+func (fs *FileService) SetSigningPins(pins *signing.PinStore) {
+	fs.pins = pins
+}
+
+// SetSnapshotKeys makes uploaded snapshots of projects with a key in keys encrypted
+func (fs *FileService) SetSnapshotKeys(keys *encryption.KeyStore) {
+	fs.keys = keys
+}
+
+// ForgetSnapshots drops the locally kept snapshot and file index of a removed project
+func (fs *FileService) ForgetSnapshots(projectID string) {
+	if fs.index != nil {
+		fs.index.Forget(projectID)
+	}
+	if fs.snapshots != nil {
+		if err := fs.snapshots.Delete(projectID); err != nil {
+			fs.logger.Warn("[FileService] Failed to remove snapshot base: %v", err)
+		}
+	}
+	if fs.history != nil {
+		if err := fs.history.Delete(projectID); err != nil {
+			fs.logger.Warn("[FileService] Failed to remove snapshot history: %v", err)
+		}
+	}
+	fs.registeredMu.Lock()
+	delete(fs.registered, projectID)
+	fs.registeredMu.Unlock()
+	if fs.pins != nil {
+		if err := fs.pins.Forget(projectID); err != nil {
+			fs.logger.Warn("[FileService] Failed to remove pinned signing key: %v", err)
+		}
+	}
+	if fs.keys != nil {
+		if err := fs.keys.Delete(projectID); err != nil {
+			fs.logger.Warn("[FileService] Failed to remove snapshot key: %v", err)
+		}
+	}
+}
+
+// HasSnapshotBase reports whether a snapshot of the project was uploaded before
+func (fs *FileService) HasSnapshotBase(projectID string) bool {
+	return fs.loadSnapshotBase(projectID) != nil
+}
+
 // GetProgressTracker returns the progress tracker
 func (fs *FileService) GetProgressTracker() *SnapshotProgressTracker {
 	return fs.progressTracker
 }
 
-// GetFiles gets a list of files in a project folder
-func (fs *FileService) GetFiles(ctx context.Context, projectID, limit, offset string) (map[string]interface{}, error) {
-	fs.logger.Debug("[FileService] Getting files for project: %s", projectID)
-
-	// Get folder status
-	status, err := fs.syncClient.GetFolderStatus(projectID)
+// folderPath returns the local path of a project's Syncthing folder
+func (fs *FileService) folderPath(projectID string) (string, error) {
+	folder, err := fs.syncClient.GetFolder(projectID)
 	if err != nil {
-		fs.logger.Error("[FileService] Failed to get folder status: %v", err)
-		return nil, err
+		return "", err
 	}
-
-	// Get folder path from status
-	folderPath, ok := status["path"].(string)
-	if !ok || folderPath == "" {
-		fs.logger.Error("[FileService] Could not determine folder path")
-		return nil, fmt.Errorf("folder path not available")
+	if folder.Path == "" {
+		return "", fmt.Errorf("folder path not available in config")
 	}
+	return folder.Path, nil
+}
 
-	// Browse files with depth limit
-	files, err := fs.syncClient.BrowseFiles(folderPath, 5)
-	if err != nil {
-		fs.logger.Error("[FileService] Failed to browse files: %v", err)
-		return nil, err
+// ignoreMatcher returns the project's .stignore matcher, or nil if unavailable
+func (fs *FileService) ignoreMatcher(projectID string) *ignore.Matcher {
+	return loadIgnoreMatcher(fs.syncClient, fs.logger, projectID)
+}
+
+// walkFiles calls fn for every entry of a project folder in walk order, with image sequences collapsed
+// unless expandSequences is set; entries come from the file index when there is one, with the
+// content hashes recorded for them
+func (fs *FileService) walkFiles(ctx context.Context, projectID, folderPath string, expandSequences bool, fn func(api.FileInfo) error) error {
+	var walk func(visit func(api.FileInfo) error) error
+	var frames frameLister
+	if fs.index != nil {
+		err := fs.index.Ensure(ctx, projectID, folderPath)
+		if err == nil {
+			frames = fs.index.frames(projectID)
+			walk = func(visit func(api.FileInfo) error) error {
+				return fs.index.store.Walk(projectID, func(e index.Entry) error {
+					return visit(e.FileInfo)
+				})
+			}
+		} else if ctx.Err() != nil {
+			return ctx.Err()
+		} else {
+			fs.logger.Warn("[FileService] File index unavailable, walking the folder: %v", err)
+		}
+	}
+	if walk == nil {
+		ignores := fs.ignoreMatcher(projectID)
+		frames = diskFrames(folderPath, ignores)
+		walk = func(visit func(api.FileInfo) error) error {
+			return fs.syncClient.WalkFiles(folderPath, 0, ignores, visit) // Full depth, minus ignored paths, as Syncthing syncs them
+		}
 	}
 
-	return map[string]interface{}{
-		"projectId": projectID,
-		"files":     files,
-		"status":    status,
-	}, nil
+	emit := fn
+	var sequences *sequenceCollapser
+	if !expandSequences {
+		sequences = newSequenceCollapser(frames, fn)
+		emit = sequences.Add
+	}
+	err := walk(func(f api.FileInfo) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return emit(f)
+	})
+	if err == nil && sequences != nil {
+		err = sequences.Close()
+	}
+	return err
 }
 
 // GetFileTree gets the file tree structure of a project
-func (fs *FileService) GetFileTree(ctx context.Context, projectID string) (map[string]interface{}, error) {
+// Numbered image sequences are listed as one entry each unless expandSequences is set
+func (fs *FileService) GetFileTree(ctx context.Context, projectID string, expandSequences bool) (map[string]interface{}, error) {
 	fs.logger.Debug("[FileService] Getting file tree for project: %s", projectID)
 
 	// Get folder status
@@ -89,19 +252,24 @@ func (fs *FileService) GetFileTree(ctx context.Context, projectID string) (map[s
 		return nil, err
 	}
 
-	// Get folder path from status
-	folderPath, ok := status["path"].(string)
-	if !ok || folderPath == "" {
-		fs.logger.Error("[FileService] Could not determine folder path")
-		return nil, fmt.Errorf("folder path not available")
+	// Get folder path from config
+	folderPath, err := fs.folderPath(projectID)
+	if err != nil {
+		fs.logger.Error("[FileService] Could not determine folder path: %v", err)
+		return nil, err
 	}
 
-	// Browse files
-	files, err := fs.syncClient.BrowseFiles(folderPath, 0) // No depth limit for tree
+	// Browse files, no depth limit for tree
+	var files []api.FileInfo
+	err = fs.walkFiles(ctx, projectID, folderPath, expandSequences, func(f api.FileInfo) error {
+		files = append(files, f)
+		return nil
+	})
 	if err != nil {
 		fs.logger.Error("[FileService] Failed to browse files: %v", err)
 		return nil, err
 	}
+	fs.attachMedia(folderPath, files)
 
 	// Build tree structure
 	tree := buildTree(files)
@@ -114,21 +282,77 @@ func (fs *FileService) GetFileTree(ctx context.Context, projectID string) (map[s
 }
 
 // SnapshotMetadata represents snapshot metadata for storage
+// The document's "files" array is streamed after these fields
 type SnapshotMetadata struct {
-	ProjectID  string         `json:"projectId"`
-	CreatedAt  time.Time      `json:"createdAt"`
-	Files      []api.FileInfo `json:"files"`
-	FileCount  int            `json:"fileCount"`
-	TotalSize  int64          `json:"totalSize"`
-	SyncStatus interface{}    `json:"syncStatus"`
+	Kind       string      `json:"kind"`
+	ProjectID  string      `json:"projectId"`
+	CreatedAt  time.Time   `json:"createdAt"`
+	FileCount  int         `json:"fileCount"`
+	TotalSize  int64       `json:"totalSize"`
+	SyncStatus interface{} `json:"syncStatus"`
 }
 
 // WaitForScanCompletion waits for Syncthing folder to complete scanning
-// Polls status every 500ms up to maxWaitSeconds
+// Waits on StateChanged events when the event stream is connected,
+// otherwise falls back to polling folder status
 // Returns immediately when state becomes idle (scan complete)
 func (fs *FileService) WaitForScanCompletion(ctx context.Context, projectID string, maxWaitSeconds int) error {
 	fs.logger.Info("[FileService] Waiting for folder scan completion: %s", projectID)
 
+	events := fs.syncClient.Events()
+	if !events.IsConnected() {
+		fs.logger.Debug("[FileService] Event stream not connected, polling folder status")
+		return fs.pollScanCompletion(ctx, projectID, maxWaitSeconds)
+	}
+
+	// Subscribe before checking status so a transition can't slip in between
+	ch := events.Subscribe()
+	defer events.Unsubscribe(ch)
+
+	status, err := fs.syncClient.GetFolderStatus(projectID)
+	if err == nil {
+		if state, ok := status["state"].(string); ok && !isFolderBusy(state) {
+			fs.logger.Info("[FileService] Folder already idle, state: %s", state)
+			return nil
+		}
+	}
+
+	timeout := time.NewTimer(time.Duration(maxWaitSeconds) * time.Second)
+	defer timeout.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+
+		case <-timeout.C:
+			fs.logger.Warn("[FileService] Scan completion timeout after %d seconds", maxWaitSeconds)
+			return fmt.Errorf("scan completion timeout")
+
+		case evt, ok := <-ch:
+			if !ok {
+				return fmt.Errorf("event stream closed")
+			}
+			if evt.Type != "StateChanged" {
+				continue
+			}
+
+			var data api.StateChangedData
+			if err := evt.DecodeData(&data); err != nil || data.Folder != projectID {
+				continue
+			}
+
+			fs.logger.Debug("[FileService] Folder state: %s -> %s", data.From, data.To)
+			if !isFolderBusy(data.To) {
+				fs.logger.Info("[FileService] Folder scan completed, state: %s", data.To)
+				return nil
+			}
+		}
+	}
+}
+
+// pollScanCompletion polls folder status every 500ms up to maxWaitSeconds
+func (fs *FileService) pollScanCompletion(ctx context.Context, projectID string, maxWaitSeconds int) error {
 	deadline := time.Now().Add(time.Duration(maxWaitSeconds) * time.Second)
 	pollInterval := 500 * time.Millisecond
 
@@ -157,7 +381,7 @@ func (fs *FileService) WaitForScanCompletion(ctx context.Context, projectID stri
 		state, ok := status["state"].(string)
 		if ok {
 			fs.logger.Debug("[FileService] Folder state: %s", state)
-			if state != "scanning" && state != "syncing" {
+			if !isFolderBusy(state) {
 				// State is "idle" or other non-busy state - EXIT IMMEDIATELY
 				fs.logger.Info("[FileService] Folder scan completed, state: %s", state)
 				return nil
@@ -168,16 +392,28 @@ func (fs *FileService) WaitForScanCompletion(ctx context.Context, projectID stri
 	}
 }
 
+// isFolderBusy reports whether a Syncthing folder state means a scan or sync is still running
+func isFolderBusy(state string) bool {
+	return state == "scanning" || state == "syncing"
+}
+
 // GenerateSnapshot generates a snapshot of current project files and uploads to cloud
 // NOTE: Caller (ProjectService) is responsible for calling WaitForScanCompletion first!
 // This implements the event order:
 // 1. Project created in database (done by caller)
 // 2. Syncthing folder created (done by caller)
 // 3. Wait for Syncthing folder scan to complete (done by caller before calling this)
-// 4. Browse files and create snapshot JSON (this method - Step 1)
-// 5. Upload snapshot to Supabase storage (this method - Step 2)
+// 4. Walk files into a local listing (this method - Step 1)
+// 5. Stream the snapshot JSON from the listing through gzip into the upload (this method - Step 2)
+// Memory use doesn't depend on the number of files
 // Emits progress updates via progressTracker
+// Returns ErrSnapshotInProgress if the project's snapshot is already being generated
 func (fs *FileService) GenerateSnapshot(ctx context.Context, projectID, accessToken string) (map[string]interface{}, error) {
+	if !fs.startSnapshot(projectID) {
+		return nil, ErrSnapshotInProgress
+	}
+	defer fs.finishSnapshot(projectID)
+
 	fs.logger.Info("[FileService] Generating snapshot for project: %s", projectID)
 
 	// Initialize progress tracking
@@ -189,30 +425,30 @@ func (fs *FileService) GenerateSnapshot(ctx context.Context, projectID, accessTo
 
 	// Step 1: Get folder config to retrieve path
 	fs.logger.Debug("[FileService] Step 1: Getting folder configuration...")
-	fs.progressTracker.UpdateProgress(projectID, "browsing", 1, 0, 0, "Getting folder configuration...")
-	folderConfig, err := fs.syncClient.GetFolderConfig(projectID)
+	fs.progressTracker.SetStep(projectID, StepBrowsing, "Getting folder configuration...")
+	folderPath, err := fs.folderPath(projectID)
 	if err != nil {
-		fs.logger.Error("[FileService] Failed to get folder config: %v", err)
+		fs.logger.Error("[FileService] Failed to get folder path: %v", err)
 		fs.progressTracker.FailSnapshot(projectID, fmt.Sprintf("Failed to get folder config: %v", err))
 		return nil, err
 	}
 
-	folderPath, ok := folderConfig["path"].(string)
-	if !ok || folderPath == "" {
-		fs.logger.Error("[FileService] Could not determine folder path from config")
-		fs.progressTracker.FailSnapshot(projectID, "Folder path not available in config")
-		return nil, fmt.Errorf("folder path not available in config")
-	}
-
-	// Step 2: Browse files to create snapshot
+	// Step 2: Walk files into a listing on disk, hashing them on the way when enabled
 	fs.logger.Debug("[FileService] Step 2: Browsing files from folder: %s", folderPath)
-	fs.progressTracker.UpdateProgress(projectID, "browsing", 2, 0, 0, "Browsing files in folder...")
-	files, err := fs.syncClient.BrowseFiles(folderPath, 0) // Full depth for complete snapshot
+	scanStep := StepBrowsing
+	if fs.hasher != nil {
+		scanStep = StepHashing
+	}
+	expectedEntries, expectedSize := fs.expectedListing(projectID)
+	fs.progressTracker.Expect(projectID, expectedEntries, expectedSize)
+	fs.progressTracker.SetStep(projectID, scanStep, "Browsing files in folder...")
+	listing, err := fs.writeListing(ctx, projectID, folderPath)
 	if err != nil {
 		fs.logger.Error("[FileService] Failed to browse files: %v", err)
 		fs.progressTracker.FailSnapshot(projectID, fmt.Sprintf("Failed to browse files: %v", err))
 		return nil, err
 	}
+	defer os.Remove(listing.Path()) // Already moved away if it became the snapshot base
 
 	// Step 3: Get folder status for sync metadata
 	fs.logger.Debug("[FileService] Step 3: Getting folder sync status...")
@@ -224,73 +460,368 @@ func (fs *FileService) GenerateSnapshot(ctx context.Context, projectID, accessTo
 
 	// Step 4: Build snapshot metadata
 	fs.logger.Debug("[FileService] Step 4: Building snapshot metadata...")
-	totalSize := int64(0)
-	for _, f := range files {
-		totalSize += f.Size
-	}
-
+	fileCount, totalSize := listing.FileCount, listing.TotalSize
 	snapshot := &SnapshotMetadata{
+		Kind:       SnapshotKindFull,
 		ProjectID:  projectID,
 		CreatedAt:  time.Now(),
-		Files:      files,
-		FileCount:  len(files),
+		FileCount:  fileCount,
 		TotalSize:  totalSize,
 		SyncStatus: status,
 	}
 
-	fs.progressTracker.UpdateProgress(projectID, "compressing", 4, len(files), totalSize, fmt.Sprintf("Processing %d files (%s total)...", len(files), formatBytesSize(totalSize)))
+	fs.progressTracker.SetStep(projectID, StepCompressing, fmt.Sprintf("Processing %d files (%s total)...", fileCount, formatBytesSize(totalSize)))
 
-	// Step 5: Serialize snapshot to JSON
-	fs.logger.Debug("[FileService] Step 5: Serializing snapshot to JSON...")
-	snapshotJSON, err := json.Marshal(snapshot)
-	if err != nil {
-		fs.logger.Error("[FileService] Failed to serialize snapshot: %v", err)
-		fs.progressTracker.FailSnapshot(projectID, fmt.Sprintf("Failed to serialize snapshot: %v", err))
-		return nil, err
-	}
+	// Step 5: Choose between a full snapshot and a delta against the previous upload
+	fs.logger.Debug("[FileService] Step 5: Preparing snapshot document...")
+	doc := fs.snapshotDocument(snapshot, fs.loadSnapshotBase(projectID), listing.Path())
 
 	// Step 6: Upload snapshot to cloud storage
 	fs.logger.Debug("[FileService] Step 6: Uploading snapshot to cloud storage...")
-	fs.progressTracker.UpdateProgress(projectID, "uploading", 5, len(files), totalSize, "Uploading snapshot to cloud storage...")
-	snapshotURL, err := fs.uploadSnapshotToCloud(ctx, projectID, snapshotJSON, accessToken)
+	fs.progressTracker.SetStep(projectID, StepUploading, "Uploading snapshot to cloud storage...")
+	snapshotURL, err := fs.uploadSnapshotToCloud(ctx, projectID, doc, accessToken)
+	if err != nil && doc.Kind == SnapshotKindDelta && isBaseMismatch(err) {
+		// The cloud no longer points at our base (e.g. another upload replaced it): start a new chain
+		fs.logger.Warn("[FileService] Cloud rejected delta base, uploading full snapshot instead")
+		doc = fullSnapshotDocument(snapshot, listing.Path())
+		snapshotURL, err = fs.uploadSnapshotToCloud(ctx, projectID, doc, accessToken)
+	}
+	uploadErr := ""
 	if err != nil {
-		fs.logger.Warn("[FileService] Failed to upload snapshot to cloud: %v", err)
+		uploadErr = err.Error()
+		fs.logger.Error("[FileService] Failed to upload snapshot to cloud: %v", err)
 		// IMPORTANT: Mark as completed even if upload fails
 		// Snapshot generation is successful, upload is optional
 		// This stops polling immediately and prevents continuous retry attempts
 		fs.progressTracker.CompleteSnapshot(projectID, "")
 		fs.logger.Info("[FileService] Snapshot generated (upload failed but local snapshot valid)")
+		fs.recordSnapshot(snapshot, "", doc, listing.Path())
 	} else {
 		fs.logger.Info("[FileService] Snapshot uploaded to: %s", snapshotURL)
 		fs.progressTracker.CompleteSnapshot(projectID, snapshotURL)
+		fs.recordSnapshot(snapshot, snapshotURL, doc, listing.Path())
+		fs.saveSnapshotBase(snapshot, snapshotURL, doc, listing.Path())
 	}
 
 	fs.logger.Info("[FileService] Snapshot generated successfully for project: %s", projectID)
-	return map[string]interface{}{
+	result := map[string]interface{}{
 		"ok":          true,
 		"projectId":   projectID,
-		"fileCount":   len(files),
+		"fileCount":   fileCount,
 		"totalSize":   totalSize,
 		"snapshotUrl": snapshotURL,
+		"kind":        doc.Kind,
+		"changes":     doc.Changes,
 		"createdAt":   snapshot.CreatedAt,
-	}, nil
+	}
+	if uploadErr != "" {
+		result["uploadError"] = uploadErr
+	}
+	return result, nil
+}
+
+// expectedListing returns the entry count and size of the project's previous snapshot, 0 when there is none
+func (fs *FileService) expectedListing(projectID string) (int, int64) {
+	if base := fs.loadSnapshotBase(projectID); base != nil {
+		return base.FileCount, base.TotalSize
+	}
+	if fs.history != nil {
+		if records, err := fs.history.List(projectID); err == nil && len(records) > 0 {
+			return records[0].FileCount, records[0].TotalSize
+		}
+	}
+	return 0, 0
 }
 
-// uploadSnapshotToCloud uploads snapshot directly to Supabase Storage then updates project via Cloud API
-// Flow:
-// 1. Compress snapshot JSON with gzip
-// 2. Upload to Supabase Storage (project-snapshots bucket)
-// 3. Get public URL from Supabase
-// 4. Update project snapshot_url via Cloud API (small request)
-func (fs *FileService) uploadSnapshotToCloud(ctx context.Context, projectID string, snapshotJSON []byte, accessToken string) (string, error) {
+// startSnapshot claims a project for snapshot generation, reporting false if it is already claimed
+func (fs *FileService) startSnapshot(projectID string) bool {
+	fs.runningMu.Lock()
+	defer fs.runningMu.Unlock()
+	if fs.running[projectID] {
+		return false
+	}
+	fs.running[projectID] = true
+	return true
+}
+
+// finishSnapshot releases a project claimed by startSnapshot
+func (fs *FileService) finishSnapshot(projectID string) {
+	fs.runningMu.Lock()
+	defer fs.runningMu.Unlock()
+	delete(fs.running, projectID)
+}
+
+// hashBatchSize is how many entries are buffered between the walk and the hasher
+const hashBatchSize = 1024
+
+// writeListing walks a project folder into a new listing, filling in content hashes when a hasher is set
+// The listing is created in the snapshot store so it can become the next delta base
+func (fs *FileService) writeListing(ctx context.Context, projectID, folderPath string) (*listingWriter, error) {
+	var listing *listingWriter
+	var err error
+	if fs.snapshots != nil {
+		listing, err = fs.snapshots.newListing()
+	} else {
+		listing, err = createListing("")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var hashed hasher.Progress
+	batch := make([]api.FileInfo, 0, hashBatchSize)
+	flush := func() error {
+		if fs.hasher != nil && len(batch) > 0 {
+			result, err := fs.hasher.HashFiles(ctx, folderPath, batch, func(p hasher.Progress) {
+				fs.progressTracker.SetHashed(projectID, hashed.BytesDone+p.BytesDone)
+			})
+			if err != nil {
+				return err
+			}
+			hashed.Files += result.Files
+			hashed.Done += result.Done
+			hashed.Cached += result.Cached
+			hashed.Failed += result.Failed
+			hashed.BytesHashed += result.BytesHashed
+			hashed.BytesDone += result.BytesDone
+			fs.recordHashes(projectID, batch)
+		} else {
+			clearHashes(batch)
+		}
+		fs.attachMedia(folderPath, batch)
+		for _, f := range batch {
+			if err := listing.Write(f); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	add := func(f api.FileInfo) error {
+		fs.progressTracker.AddWalked(projectID, f)
+		batch = append(batch, f)
+		if len(batch) == hashBatchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	// Image sequences become one entry each, emitted in walk order so listings stay comparable
+	start := time.Now()
+	err = fs.walkFiles(ctx, projectID, folderPath, fs.expandSequences, add)
+	if err == nil {
+		fs.progressTracker.FinishWalk(projectID)
+		err = flush()
+	}
+	if err == nil {
+		err = listing.Close()
+	}
+	if err != nil {
+		listing.Discard()
+		return nil, err
+	}
+
+	if fs.hasher != nil {
+		fs.logger.Info("[FileService] Hashed %d files in %v: %d from cache, %d failed, %s read",
+			hashed.Files, time.Since(start).Round(time.Millisecond), hashed.Cached, hashed.Failed, formatBytesSize(hashed.BytesHashed))
+	}
+	return listing, nil
+}
+
+// recordHashes keeps the content hashes of files in the file index, so they aren't computed again
+func (fs *FileService) recordHashes(projectID string, files []api.FileInfo) {
+	if fs.index == nil {
+		return
+	}
+	if err := fs.index.store.SetHashes(projectID, files); err != nil {
+		fs.logger.Warn("[FileService] Failed to record file hashes: %v", err)
+	}
+}
+
+// clearHashes drops the hashes files were read with, for output that shouldn't have them
+func clearHashes(files []api.FileInfo) {
+	for i := range files {
+		files[i].Hash = ""
+	}
+}
+
+// attachMedia fills in clip metadata for the video files among files
+func (fs *FileService) attachMedia(folderPath string, files []api.FileInfo) {
+	if fs.prober == nil {
+		return
+	}
+	for i, f := range files {
+		if !f.IsDirectory && media.Supported(f.Name) {
+			files[i].Media = fs.prober.Probe(filepath.Join(folderPath, f.Path), f.Size, f.ModTime)
+		}
+	}
+}
+
+// loadSnapshotBase returns the previously uploaded snapshot, or nil when deltas aren't possible
+func (fs *FileService) loadSnapshotBase(projectID string) *SnapshotBase {
+	if fs.snapshots == nil {
+		return nil
+	}
+	base, err := fs.snapshots.Load(projectID)
+	if err != nil {
+		fs.logger.Warn("[FileService] Failed to load previous snapshot, uploading in full: %v", err)
+		return nil
+	}
+	return base
+}
+
+// snapshotDocument returns a delta against base, or a full snapshot when a delta isn't worthwhile
+func (fs *FileService) snapshotDocument(snapshot *SnapshotMetadata, base *SnapshotBase, listingPath string) *snapshotDocument {
+	var counts deltaCounts
+	if base != nil {
+		var err error
+		if counts, err = countDelta(fs.snapshots.ListingPath(base.ProjectID), listingPath); err != nil {
+			fs.logger.Warn("[FileService] Failed to compare with previous snapshot, uploading in full: %v", err)
+			base = nil
+		}
+	}
+
+	if reason := snapshotFallbackReason(base, counts, snapshot.FileCount); reason != "" {
+		fs.logger.Info("[FileService] Uploading full snapshot: %s", reason)
+		return fullSnapshotDocument(snapshot, listingPath)
+	}
+
+	fs.logger.Info("[FileService] Uploading delta snapshot: %d added, %d modified, %d removed (chain length %d)",
+		counts.Added, counts.Modified, counts.Removed, base.ChainLength+1)
+	doc := deltaSnapshotDocument(&SnapshotDelta{
+		Kind:        SnapshotKindDelta,
+		ProjectID:   snapshot.ProjectID,
+		CreatedAt:   snapshot.CreatedAt,
+		BaseURL:     base.SnapshotURL,
+		ChainLength: base.ChainLength + 1,
+		FileCount:   snapshot.FileCount,
+		TotalSize:   snapshot.TotalSize,
+		SyncStatus:  snapshot.SyncStatus,
+	}, fs.snapshots.ListingPath(base.ProjectID), listingPath)
+	doc.Changes = counts.Total()
+	return doc
+}
+
+// saveSnapshotBase records an uploaded snapshot's listing as the base for the next delta
+func (fs *FileService) saveSnapshotBase(snapshot *SnapshotMetadata, snapshotURL string, doc *snapshotDocument, listingPath string) {
+	if fs.snapshots == nil {
+		return
+	}
+
+	err := fs.snapshots.Commit(&SnapshotBase{
+		ProjectID:   snapshot.ProjectID,
+		SnapshotURL: snapshotURL,
+		ChainLength: doc.ChainLength,
+		CreatedAt:   snapshot.CreatedAt,
+		FileCount:   snapshot.FileCount,
+		TotalSize:   snapshot.TotalSize,
+	}, listingPath)
+	if err != nil {
+		// Drop the stale base so the next snapshot is uploaded in full
+		fs.logger.Warn("[FileService] Failed to save snapshot base: %v", err)
+		fs.snapshots.Delete(snapshot.ProjectID)
+	}
+}
+
+// recordSnapshot adds a generated snapshot to the local history
+func (fs *FileService) recordSnapshot(snapshot *SnapshotMetadata, snapshotURL string, doc *snapshotDocument, listingPath string) {
+	if fs.history == nil {
+		return
+	}
+
+	err := fs.history.Record(&SnapshotRecord{
+		ProjectID:   snapshot.ProjectID,
+		CreatedAt:   snapshot.CreatedAt,
+		Kind:        doc.Kind,
+		SnapshotURL: snapshotURL,
+		FileCount:   snapshot.FileCount,
+		TotalSize:   snapshot.TotalSize,
+	}, listingPath)
+	if err != nil {
+		fs.logger.Warn("[FileService] Failed to keep snapshot in history: %v", err)
+	}
+}
+
+// ListSnapshots lists the snapshots of a project kept in the local history, newest first
+func (fs *FileService) ListSnapshots(ctx context.Context, projectID string) ([]SnapshotRecord, error) {
+	if fs.history == nil {
+		return []SnapshotRecord{}, nil
+	}
+	return fs.history.List(projectID)
+}
+
+// DiffSnapshots compares two kept snapshots of a project
+// from and to are snapshot IDs, "latest", RFC 3339 times or dates; a time picks the last snapshot taken by then
+// to defaults to the latest snapshot
+func (fs *FileService) DiffSnapshots(ctx context.Context, projectID, from, to string) (*SnapshotDiff, error) {
+	if fs.history == nil {
+		return nil, ErrSnapshotNotFound
+	}
+
+	fromRec, err := fs.history.Resolve(projectID, from)
+	if err != nil {
+		return nil, err
+	}
+	toRec, err := fs.history.Resolve(projectID, to)
+	if err != nil {
+		return nil, err
+	}
+
+	fs.logger.Debug("[FileService] Diffing snapshots %s..%s of project %s", fromRec.ID, toRec.ID, projectID)
+	diff, err := diffSnapshotListings(
+		fs.history.ListingPath(projectID, fromRec.ID),
+		fs.history.ListingPath(projectID, toRec.ID),
+	)
+	if err != nil {
+		return nil, err
+	}
+	diff.ProjectID = projectID
+	diff.From = fromRec
+	diff.To = toRec
+	return diff, nil
+}
+
+// uploadSnapshotToCloud uploads a snapshot document to the Cloud API, which stores it and updates the project
+// The compressed document is spooled to a temporary file and sent in resumable parts, so a retry
+// continues where the connection dropped instead of starting over
+func (fs *FileService) uploadSnapshotToCloud(ctx context.Context, projectID string, doc *snapshotDocument, accessToken string) (string, error) {
 	const maxRetries = 3
 	const initialBackoff = 1 * time.Second
 
+	if err := fs.signSnapshot(doc); err != nil {
+		return "", err
+	}
+	fs.ensureSigningKey(projectID, accessToken)
+
+	spool, up, err := fs.spoolSnapshot(projectID, doc)
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare snapshot upload: %w", err)
+	}
+	defer func() {
+		spool.file.Close()
+		os.Remove(spool.file.Name())
+	}()
+
+	uploaded := false
+	defer func() {
+		if uploaded {
+			return
+		}
+		// Free the parts the cloud holds for an upload we gave up on; ctx may be done already
+		abortCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := fs.cloudClient.AbortUpload(abortCtx, up, accessToken); err != nil {
+			fs.logger.Warn("[FileService] Failed to abort snapshot upload: %v", err)
+		}
+	}()
+
 	var lastErr error
 	for attempt := 0; attempt < maxRetries; attempt++ {
 		// Execute upload attempt
-		snapshotURL, err := fs.uploadSnapshotAttempt(ctx, projectID, snapshotJSON, accessToken)
+		snapshotURL, err := fs.uploadSnapshotAttempt(ctx, projectID, up, spool, accessToken)
 		if err == nil {
+			uploaded = true
 			return snapshotURL, nil
 		}
 
@@ -319,56 +850,101 @@ func (fs *FileService) uploadSnapshotToCloud(ctx context.Context, projectID stri
 	return "", fmt.Errorf("upload failed after %d attempts: %w", maxRetries, lastErr)
 }
 
-// uploadSnapshotAttempt performs a single upload attempt:
-// 1. Compress JSON with gzip
-// 2. POST to Cloud API /projects/:projectId/snapshot with multipart form
-// 3. Cloud API handles upload to storage and metadata update atomically
-func (fs *FileService) uploadSnapshotAttempt(ctx context.Context, projectID string, snapshotJSON []byte, accessToken string) (string, error) {
-	// Parse snapshot to extract metadata
-	var snapshotData map[string]interface{}
-	if err := json.Unmarshal(snapshotJSON, &snapshotData); err != nil {
-		return "", fmt.Errorf("failed to parse snapshot JSON: %w", err)
-	}
+// snapshotSpool is a compressed, and encrypted if the project has a key, snapshot ready to upload
+type snapshotSpool struct {
+	file *os.File
+	size int64
+}
 
-	// Extract metadata from snapshot
-	fileCount := 0
-	totalSize := int64(0)
+// spoolSnapshot compresses a snapshot document into a temporary file and describes its upload
+func (fs *FileService) spoolSnapshot(projectID string, doc *snapshotDocument) (*snapshotSpool, *api.ResumableUpload, error) {
+	fields := map[string]string{
+		"fileCount": fmt.Sprintf("%d", doc.FileCount),
+		"totalSize": fmt.Sprintf("%d", doc.TotalSize),
+	}
+	if doc.Kind == SnapshotKindDelta {
+		fields["kind"] = doc.Kind
+		fields["baseUrl"] = doc.BaseURL
+	}
+	if sig := doc.Signature; sig != nil {
+		fields["signature"] = sig.Signature
+		fields["publicKey"] = sig.PublicKey
+		fields["signatureAlgorithm"] = sig.Algorithm
+		fields["signedBy"] = sig.DeviceID
+	}
 
-	if fc, ok := snapshotData["fileCount"].(float64); ok {
-		fileCount = int(fc)
+	// Projects with a key get their snapshot encrypted after compression; the counts above stay readable
+	key, err := fs.snapshotKeyFor(projectID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read snapshot key: %w", err)
 	}
-	if ts, ok := snapshotData["totalSize"].(float64); ok {
-		totalSize = int64(ts)
+	filename := "snapshot.json.gz"
+	if key != nil {
+		fields["encryption"] = encryption.Algorithm
+		fields["keyId"] = encryption.KeyID(key)
+		filename += ".enc"
 	}
 
-	// Step 1: Compress snapshot with gzip
-	fs.logger.Debug("[FileService] Compressing snapshot for storage...")
-	compressedBuffer := bytes.Buffer{}
-	gzipWriter := gzip.NewWriter(&compressedBuffer)
-	if _, err := gzipWriter.Write(snapshotJSON); err != nil {
-		return "", fmt.Errorf("failed to compress snapshot: %w", err)
+	file, err := os.CreateTemp("", "vidsync-snapshot-*")
+	if err != nil {
+		return nil, nil, err
 	}
-	if err := gzipWriter.Close(); err != nil {
-		return "", fmt.Errorf("failed to close gzip writer: %w", err)
+	fail := func(err error) (*snapshotSpool, *api.ResumableUpload, error) {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, nil, err
 	}
 
-	compressedSize := compressedBuffer.Len()
-	originalSize := len(snapshotJSON)
-	fs.logger.Info("[FileService] Compressed: %d → %d bytes (%.1f%%)", originalSize, compressedSize, float64(compressedSize)*100/float64(originalSize))
+	fs.progressTracker.StartUpload(projectID, doc.Size)
+	out := &countingWriter{w: file}
+	var w io.Writer = out
+	var enc *encryption.Writer
+	if key != nil {
+		if enc, err = encryption.NewWriter(w, key); err != nil {
+			return fail(err)
+		}
+		w = enc
+	}
+	originalSize, compressedSize, err := doc.WriteGzip(w, func(n int64) { fs.progressTracker.AddCompressed(projectID, n) })
+	if err != nil {
+		return fail(err)
+	}
+	if enc != nil {
+		if err := enc.Close(); err != nil {
+			return fail(err)
+		}
+	}
+	if originalSize > 0 {
+		fs.logger.Info("[FileService] Compressed: %d → %d bytes (%.1f%%)", originalSize, compressedSize, float64(compressedSize)*100/float64(originalSize))
+	}
+	fs.progressTracker.StartSending(projectID, out.n)
+
+	up := &api.ResumableUpload{
+		Endpoint: fmt.Sprintf("/projects/%s/snapshot", projectID),
+		FileName: filename,
+		Fields:   fields,
+		PartSize: fs.uploadPartSize,
+		Progress: func(n int64) { fs.progressTracker.AddUploaded(projectID, n) },
+	}
+	return &snapshotSpool{file: file, size: out.n}, up, nil
+}
 
-	// Step 2: Upload to Cloud API with multipart form
-	// Cloud API will handle: upload to Supabase + update project metadata
+// uploadSnapshotAttempt performs a single upload attempt:
+// 1. Send the spooled snapshot in parts, resuming the session of earlier attempts, and commit it
+// 2. Cloud API verifies the file and handles upload to storage and metadata update atomically
+// 3. Clouds without resumable uploads get the whole file in one multipart POST to /projects/:projectId/snapshot
+func (fs *FileService) uploadSnapshotAttempt(ctx context.Context, projectID string, up *api.ResumableUpload, spool *snapshotSpool, accessToken string) (string, error) {
 	fs.logger.Debug("[FileService] Uploading compressed snapshot to Cloud API...")
-	endpoint := fmt.Sprintf("/projects/%s/snapshot", projectID)
-
-	// Build form fields
-	formFields := map[string]string{
-		"fileCount": fmt.Sprintf("%d", fileCount),
-		"totalSize": fmt.Sprintf("%d", totalSize),
+	response, err := fs.cloudClient.Upload(ctx, up, spool.file, spool.size, accessToken)
+	if errors.Is(err, api.ErrResumableUnsupported) {
+		fs.logger.Info("[FileService] Cloud API has no resumable uploads, sending snapshot in one request")
+		fs.progressTracker.StartSending(projectID, spool.size)
+		response, err = fs.cloudClient.PostMultipartStreamWithAuth(ctx, up.Endpoint, "file", up.FileName, up.Fields, func(w io.Writer) error {
+			w = &countingWriter{w: w, add: up.Progress}
+			_, err := io.Copy(w, io.NewSectionReader(spool.file, 0, spool.size))
+			return err
+		}, accessToken)
 	}
-
-	// Call Cloud API with multipart request
-	response, err := fs.cloudClient.PostMultipartWithAuth(endpoint, "file", compressedBuffer.Bytes(), formFields, accessToken)
 	if err != nil {
 		return "", fmt.Errorf("failed to upload snapshot to Cloud API: %w", err)
 	}
@@ -429,6 +1005,12 @@ func (fs *FileService) isRetryableError(err error) bool {
 	return false
 }
 
+// isBaseMismatch reports whether the cloud rejected a delta because its base is no longer current
+func isBaseMismatch(err error) bool {
+	var statusErr *api.StatusError
+	return errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusConflict && statusErr.Code() == api.CodeDeltaBaseMismatch
+}
+
 // buildTree converts flat file list to hierarchical structure
 func buildTree(files []api.FileInfo) map[string]interface{} {
 	root := map[string]interface{}{
@@ -453,6 +1035,13 @@ func buildTree(files []api.FileInfo) map[string]interface{} {
 			"modTime": file.ModTime,
 		}
 
+		if file.Media != nil {
+			node["media"] = file.Media
+		}
+		if file.Sequence != nil {
+			node["sequence"] = file.Sequence
+		}
+
 		if file.IsDirectory {
 			node["type"] = "directory"
 			node["children"] = []interface{}{}
@@ -463,40 +1052,20 @@ func buildTree(files []api.FileInfo) map[string]interface{} {
 		nodes[file.Path] = node
 	}
 
-	// Build parent-child relationships
-	for path, node := range nodes {
-		if path == "" {
+	// Attach each node to its directory, or the closest listed ancestor
+	for _, file := range files {
+		node, ok := nodes[file.Path]
+		if !ok || file.Path == "" {
 			continue
 		}
-
-		// Find parent directory
-		// This is simplified - in real implementation would use filepath.Dir
-		parent := ""
-		for p := range nodes {
-			if p != "" && p != path {
-				// Simple heuristic: if p is a prefix of path and is a directory
-				// This is not perfect but works for basic cases
-				if _, ok := nodes[p]; ok {
-					if parentNode, ok := nodes[p]; ok {
-						if t, ok := parentNode["type"].(string); ok && t == "directory" {
-							if len(p) > len(parent) {
-								parent = p
-							}
-						}
-					}
-				}
-			}
-		}
-
-		if parent == "" {
-			parent = ""
-		}
-
-		if parentNode, ok := nodes[parent]; ok {
-			if children, ok := parentNode["children"].([]interface{}); ok {
-				parentNode["children"] = append(children, node)
+		parent := root
+		for dir := filepath.Dir(file.Path); dir != "." && dir != string(filepath.Separator); dir = filepath.Dir(dir) {
+			if p, ok := nodes[dir]; ok && p["type"] == "directory" {
+				parent = p
+				break
 			}
 		}
+		parent["children"] = append(parent["children"].([]interface{}), node)
 	}
 
 	return root
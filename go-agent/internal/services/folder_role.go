@@ -0,0 +1,126 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// Folder types (roles) a project can have on this device
+const (
+	FolderTypeSendReceive = "sendreceive"
+	FolderTypeSendOnly    = "sendonly"
+	FolderTypeReceiveOnly = "receiveonly"
+)
+
+// ErrFolderTypeMismatch is returned when an operation doesn't apply to the folder's type
+var ErrFolderTypeMismatch = errors.New("operation not supported for folder type")
+
+// maxLocalChanges caps the local change list in a single response
+const maxLocalChanges = 1000
+
+// FolderRole is a project's folder type on this device
+type FolderRole struct {
+	ProjectID    string `json:"projectId"`
+	FolderType   string `json:"folderType"`
+	LocalChanges int    `json:"localChanges"` // receiveonly: files changed locally that won't sync
+}
+
+// GetFolderRole gets the folder type of a project on this device
+func (ss *SyncService) GetFolderRole(ctx context.Context, projectID string) (*FolderRole, error) {
+	folder, err := ss.syncClient.GetFolder(projectID)
+	if err != nil {
+		ss.logger.Error("[SyncService] Failed to get folder config: %v", err)
+		return nil, err
+	}
+
+	role := &FolderRole{ProjectID: projectID, FolderType: folder.Type}
+	if folder.Type == FolderTypeReceiveOnly {
+		if status, err := ss.syncClient.GetFolderStatus(projectID); err == nil {
+			if n, ok := status["receiveOnlyTotalItems"].(float64); ok {
+				role.LocalChanges = int(n)
+			}
+		}
+	}
+	return role, nil
+}
+
+// SetFolderRole switches a project between sendreceive, sendonly and receiveonly on this device
+func (ss *SyncService) SetFolderRole(ctx context.Context, projectID, folderType string) (*FolderRole, error) {
+	switch folderType {
+	case FolderTypeSendReceive, FolderTypeSendOnly, FolderTypeReceiveOnly:
+	default:
+		return nil, fmt.Errorf("invalid folder type: %s", folderType)
+	}
+
+	ss.logger.Info("[SyncService] Setting folder type of %s to %s", projectID, folderType)
+	if err := ss.syncClient.SetFolderType(projectID, folderType); err != nil {
+		ss.logger.Error("[SyncService] Failed to set folder type: %v", err)
+		return nil, err
+	}
+
+	return ss.GetFolderRole(ctx, projectID)
+}
+
+// GetLocalChanges lists files changed locally in a receive-only project
+// These are the changes a revert would discard
+func (ss *SyncService) GetLocalChanges(ctx context.Context, projectID string) (map[string]interface{}, error) {
+	if err := ss.requireFolderType(projectID, FolderTypeReceiveOnly); err != nil {
+		return nil, err
+	}
+
+	changed, err := ss.syncClient.GetLocalChanged(projectID, 1, maxLocalChanges)
+	if err != nil {
+		ss.logger.Error("[SyncService] Failed to get local changes: %v", err)
+		return nil, err
+	}
+
+	return map[string]interface{}{
+		"projectId": projectID,
+		"files":     changed.Files,
+		"count":     len(changed.Files),
+		"truncated": len(changed.Files) == maxLocalChanges,
+	}, nil
+}
+
+// RevertLocalChanges discards local changes in a receive-only project
+// so it matches what the other devices have
+func (ss *SyncService) RevertLocalChanges(ctx context.Context, projectID string) error {
+	if err := ss.requireFolderType(projectID, FolderTypeReceiveOnly); err != nil {
+		return err
+	}
+
+	ss.logger.Info("[SyncService] Reverting local changes in project: %s", projectID)
+	if err := ss.syncClient.Revert(projectID); err != nil {
+		ss.logger.Error("[SyncService] Failed to revert folder: %v", err)
+		return err
+	}
+	return nil
+}
+
+// OverrideRemoteChanges pushes the local state of a send-only project to every device
+func (ss *SyncService) OverrideRemoteChanges(ctx context.Context, projectID string) error {
+	if err := ss.requireFolderType(projectID, FolderTypeSendOnly); err != nil {
+		return err
+	}
+
+	ss.logger.Info("[SyncService] Overriding remote changes in project: %s", projectID)
+	if err := ss.syncClient.Override(projectID); err != nil {
+		ss.logger.Error("[SyncService] Failed to override folder: %v", err)
+		return err
+	}
+	return nil
+}
+
+// requireFolderType fails with ErrFolderTypeMismatch unless the project has the given type
+func (ss *SyncService) requireFolderType(projectID, folderType string) error {
+	folder, err := ss.syncClient.GetFolder(projectID)
+	if err != nil {
+		ss.logger.Error("[SyncService] Failed to get folder config: %v", err)
+		return err
+	}
+	if folder.Type != folderType {
+		return fmt.Errorf("%w: %s folder is %s, requires %s", ErrFolderTypeMismatch, projectID, folder.Type, folderType)
+	}
+	return nil
+}
@@ -0,0 +1,159 @@
+package services
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/vidsync/agent/internal/api"
+	"github.com/vidsync/agent/internal/ignore"
+	"github.com/vidsync/agent/internal/util"
+)
+
+// IgnoreService manages per-project .stignore patterns
+type IgnoreService struct {
+	syncClient  *api.SyncthingClient
+	cloudClient *api.CloudClient
+	logger      *util.Logger
+	index       *FileIndex // Rebuilt when patterns change, nil if there is none
+}
+
+// NewIgnoreService creates a new ignore service
+func NewIgnoreService(syncClient *api.SyncthingClient, cloudClient *api.CloudClient, logger *util.Logger) *IgnoreService {
+	return &IgnoreService{
+		syncClient:  syncClient,
+		cloudClient: cloudClient,
+		logger:      logger,
+	}
+}
+
+// SetFileIndex has idx rebuild a project's index when its patterns change
+func (is *IgnoreService) SetFileIndex(idx *FileIndex) {
+	is.index = idx
+}
+
+// ProjectIgnores is the ignore configuration of a project
+type ProjectIgnores struct {
+	ProjectID string   `json:"projectId"`
+	Patterns  []string `json:"patterns"`
+	Expanded  []string `json:"expanded,omitempty"`
+	Includes  []string `json:"includes,omitempty"` // #include files, applied through the expanded patterns
+	Presets   []string `json:"presets"`            // Presets whose patterns are all present
+	Error     string   `json:"error,omitempty"`
+}
+
+// SetIgnoresRequest replaces a project's ignore patterns
+type SetIgnoresRequest struct {
+	Patterns []string `json:"patterns"`
+	Presets  []string `json:"presets,omitempty"` // Preset names appended after Patterns
+}
+
+// GetIgnores gets the ignore patterns of a project
+func (is *IgnoreService) GetIgnores(ctx context.Context, projectID string) (*ProjectIgnores, error) {
+	is.logger.Debug("[IgnoreService] Getting ignores for project: %s", projectID)
+
+	ignores, err := is.syncClient.GetIgnores(projectID)
+	if err != nil {
+		is.logger.Error("[IgnoreService] Failed to get ignores: %v", err)
+		return nil, err
+	}
+
+	result := &ProjectIgnores{
+		ProjectID: projectID,
+		Patterns:  ignores.Ignore,
+		Expanded:  ignores.Expanded,
+		Presets:   activePresets(ignores.Ignore),
+		Error:     ignores.Error,
+	}
+	if matcher, err := ignore.Parse(ignores.Ignore); err == nil {
+		result.Includes = matcher.Includes() // Expanded has the #include lines already replaced
+	}
+	return result, nil
+}
+
+// SetIgnores validates and replaces the ignore patterns of a project, then rescans it
+func (is *IgnoreService) SetIgnores(ctx context.Context, projectID string, req *SetIgnoresRequest) (*ProjectIgnores, error) {
+	is.logger.Info("[IgnoreService] Setting %d ignore patterns (%d presets) for project: %s", len(req.Patterns), len(req.Presets), projectID)
+
+	lines := ignore.Merge(nil, req.Patterns...)
+	for _, name := range req.Presets {
+		preset, ok := ignore.GetPreset(name)
+		if !ok {
+			return nil, fmt.Errorf("unknown ignore preset: %s", name)
+		}
+		lines = ignore.Merge(lines, preset.Patterns...)
+	}
+
+	if errs := ignore.Validate(lines); len(errs) > 0 {
+		return nil, errs
+	}
+
+	if err := is.syncClient.SetIgnores(projectID, lines); err != nil {
+		is.logger.Error("[IgnoreService] Failed to set ignores: %v", err)
+		return nil, err
+	}
+
+	if is.index != nil {
+		is.index.Invalidate(projectID)
+	}
+
+	// Syncthing only applies new patterns to files on the next scan
+	if err := is.syncClient.Rescan(projectID); err != nil {
+		is.logger.Warn("[IgnoreService] Rescan after ignore change failed: %v", err)
+	}
+
+	is.logger.Info("[IgnoreService] Ignore patterns updated for project: %s", projectID)
+	return is.GetIgnores(ctx, projectID)
+}
+
+// ListPresets returns the built-in ignore presets
+func (is *IgnoreService) ListPresets() []ignore.Preset {
+	return ignore.Presets()
+}
+
+// activePresets returns the names of presets whose patterns are all in lines
+func activePresets(lines []string) []string {
+	present := make(map[string]bool, len(lines))
+	for _, l := range lines {
+		present[l] = true
+	}
+
+	active := []string{}
+	for _, preset := range ignore.Presets() {
+		all := true
+		for _, p := range preset.Patterns {
+			if !present[p] {
+				all = false
+				break
+			}
+		}
+		if all {
+			active = append(active, preset.Name)
+		}
+	}
+	return active
+}
+
+// loadIgnoreMatcher builds a matcher from a project's .stignore
+// Returns nil (only Syncthing's own files ignored) if the patterns can't be loaded
+func loadIgnoreMatcher(syncClient *api.SyncthingClient, logger *util.Logger, projectID string) *ignore.Matcher {
+	ignores, err := syncClient.GetIgnores(projectID)
+	if err != nil {
+		logger.Warn("[IgnoreService] Could not load ignores for %s: %v", projectID, err)
+		return nil
+	}
+	matcher, err := ignore.Parse(matchPatterns(ignores))
+	if err != nil {
+		logger.Warn("[IgnoreService] Invalid ignores for %s: %v", projectID, err)
+		return nil
+	}
+	return matcher
+}
+
+// matchPatterns returns the patterns Syncthing actually applies, with #include files expanded
+// Falls back to the raw lines when Syncthing didn't report an expansion
+func matchPatterns(ignores *api.Ignores) []string {
+	if len(ignores.Expanded) > 0 {
+		return ignores.Expanded
+	}
+	return ignores.Ignore
+}
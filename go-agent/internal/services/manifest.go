@@ -0,0 +1,562 @@
+package services
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vidsync/agent/internal/api"
+	"github.com/vidsync/agent/internal/media"
+	"github.com/vidsync/agent/internal/sequence"
+)
+
+// Manifest formats
+const (
+	ManifestCSV    = "csv"
+	ManifestNDJSON = "ndjson"
+	ManifestJSON   = "json"
+)
+
+// Sync states of a file on a device
+const (
+	SyncStateSynced  = "synced"
+	SyncStateSyncing = "syncing" // The local device is downloading it
+	SyncStateNeeded  = "needed"  // The device doesn't have the current version
+	SyncStateChanged = "changed" // Changed locally in a receive-only folder
+)
+
+var (
+	// ErrHashingDisabled is returned when a manifest asks for hashes and file hashing is turned off
+	ErrHashingDisabled = errors.New("file hashing is disabled")
+	// ErrMediaDisabled is returned when a manifest asks for media metadata and probing is turned off
+	ErrMediaDisabled = errors.New("media metadata is disabled")
+)
+
+// manifestNeedPage is how many need entries are fetched from Syncthing per request
+const manifestNeedPage = 1000
+
+// ManifestOptions selects the entries and optional columns of a manifest
+type ManifestOptions struct {
+	Prefix          string   // Only paths starting with it, slash-separated
+	Extensions      []string // Only files with one of these extensions, all when empty
+	Hash            bool     // Content hashes
+	Media           bool     // Clip metadata of video files
+	Sync            bool     // Sync state on every device sharing the project
+	ExpandSequences bool     // List each frame of an image sequence instead of one entry per sequence
+}
+
+// ManifestDevice is a device whose sync state a manifest reports
+type ManifestDevice struct {
+	ID    string `json:"id"`
+	Name  string `json:"name,omitempty"`
+	Local bool   `json:"local"`
+}
+
+// ManifestEntry is one file of a manifest
+type ManifestEntry struct {
+	Path     string            `json:"path"` // Slash-separated, relative to the project folder
+	Name     string            `json:"name"`
+	Size     int64             `json:"size"`
+	ModTime  time.Time         `json:"modTime"`
+	Hash     string            `json:"hash,omitempty"`
+	Media    *media.Metadata   `json:"media,omitempty"`
+	Sequence *sequence.Info    `json:"sequence,omitempty"`
+	Sync     map[string]string `json:"sync,omitempty"` // Device ID -> sync state
+}
+
+// Manifest is a project's file listing, resolved up to the walk so errors surface before anything is written
+type Manifest struct {
+	ProjectID   string
+	GeneratedAt time.Time
+	Devices     []ManifestDevice
+
+	fs         *FileService
+	opts       ManifestOptions
+	folderPath string
+	states     []deviceSyncStates // In the order of Devices
+}
+
+// deviceSyncStates holds the files not in sync on one device
+type deviceSyncStates struct {
+	all   string            // State of every file, when the device doesn't report per file (e.g. paused)
+	files map[string]string // Slash-separated path -> state; missing means synced
+}
+
+// PrepareManifest checks the options and gathers the sync states a manifest of the project needs
+func (fs *FileService) PrepareManifest(ctx context.Context, projectID string, opts ManifestOptions) (*Manifest, error) {
+	if opts.Hash && fs.hasher == nil {
+		return nil, ErrHashingDisabled
+	}
+	if opts.Media && fs.prober == nil {
+		return nil, ErrMediaDisabled
+	}
+
+	folderPath, err := fs.folderPath(projectID)
+	if err != nil {
+		fs.logger.Error("[FileService] Could not determine folder path: %v", err)
+		return nil, err
+	}
+
+	opts.Prefix = strings.TrimPrefix(filepath.ToSlash(opts.Prefix), "/")
+	extensions := make([]string, 0, len(opts.Extensions))
+	for _, ext := range opts.Extensions {
+		extensions = append(extensions, "."+strings.TrimPrefix(strings.ToLower(ext), "."))
+	}
+	opts.Extensions = extensions
+
+	manifest := &Manifest{
+		ProjectID:   projectID,
+		GeneratedAt: time.Now(),
+		Devices:     []ManifestDevice{},
+		fs:          fs,
+		opts:        opts,
+		folderPath:  folderPath,
+	}
+	if opts.Sync {
+		if err := fs.loadManifestSyncStates(manifest); err != nil {
+			fs.logger.Error("[FileService] Failed to get sync states: %v", err)
+			return nil, err
+		}
+	}
+	return manifest, nil
+}
+
+// loadManifestSyncStates lists the project's devices, local first, with the files each one lacks
+func (fs *FileService) loadManifestSyncStates(m *Manifest) error {
+	folder, err := fs.syncClient.GetFolder(m.ProjectID)
+	if err != nil {
+		return err
+	}
+	myID, err := fs.syncClient.GetMyID()
+	if err != nil {
+		return err
+	}
+
+	names := map[string]string{}
+	if devices, err := fs.syncClient.GetDevices(); err == nil {
+		for _, d := range devices {
+			names[d.DeviceID] = d.Name
+		}
+	}
+
+	local, err := fs.localSyncStates(m.ProjectID, folder.Type == FolderTypeReceiveOnly)
+	if err != nil {
+		return err
+	}
+	m.Devices = append(m.Devices, ManifestDevice{ID: myID, Name: names[myID], Local: true})
+	m.states = append(m.states, local)
+
+	for _, d := range folder.Devices {
+		if d.DeviceID == myID {
+			continue
+		}
+		remote, err := fs.remoteSyncStates(m.ProjectID, d.DeviceID)
+		if err != nil {
+			return err
+		}
+		m.Devices = append(m.Devices, ManifestDevice{ID: d.DeviceID, Name: names[d.DeviceID]})
+		m.states = append(m.states, remote)
+	}
+	return nil
+}
+
+// localSyncStates collects the files the local device is downloading, still needs, or changed in a receive-only folder
+func (fs *FileService) localSyncStates(projectID string, receiveOnly bool) (deviceSyncStates, error) {
+	states := deviceSyncStates{files: map[string]string{}}
+
+	for page := 1; ; page++ {
+		need, err := fs.syncClient.GetNeed(projectID, page, manifestNeedPage)
+		if err != nil {
+			return states, err
+		}
+		for _, f := range need.Progress {
+			states.files[filepath.ToSlash(f.Name)] = SyncStateSyncing
+		}
+		for _, f := range need.Queued {
+			states.files[filepath.ToSlash(f.Name)] = SyncStateNeeded
+		}
+		for _, f := range need.Rest {
+			states.files[filepath.ToSlash(f.Name)] = SyncStateNeeded
+		}
+		if len(need.Progress)+len(need.Queued)+len(need.Rest) < manifestNeedPage {
+			break
+		}
+	}
+
+	if receiveOnly {
+		for page := 1; ; page++ {
+			changed, err := fs.syncClient.GetLocalChanged(projectID, page, manifestNeedPage)
+			if err != nil {
+				return states, err
+			}
+			for _, f := range changed.Files {
+				states.files[filepath.ToSlash(f.Name)] = SyncStateChanged
+			}
+			if len(changed.Files) < manifestNeedPage {
+				break
+			}
+		}
+	}
+	return states, nil
+}
+
+// remoteSyncStates collects the files a remote device still needs
+// A device that isn't reachable or doesn't share the folder gets its remote state for every file
+func (fs *FileService) remoteSyncStates(projectID, deviceID string) (deviceSyncStates, error) {
+	states := deviceSyncStates{files: map[string]string{}}
+
+	if completion, err := fs.syncClient.GetCompletion(projectID, deviceID); err == nil {
+		if completion.RemoteState != "" && completion.RemoteState != "valid" {
+			states.all = completion.RemoteState
+			return states, nil
+		}
+	}
+
+	for page := 1; ; page++ {
+		need, err := fs.syncClient.GetRemoteNeed(projectID, deviceID, page, manifestNeedPage)
+		if err != nil {
+			return states, err
+		}
+		for _, f := range need.Files {
+			states.files[filepath.ToSlash(f.Name)] = SyncStateNeeded
+		}
+		if len(need.Files) < manifestNeedPage {
+			break
+		}
+	}
+	return states, nil
+}
+
+// ManifestContentType returns the MIME type of a manifest format
+func ManifestContentType(format string) string {
+	switch format {
+	case ManifestCSV:
+		return "text/csv; charset=utf-8"
+	case ManifestNDJSON:
+		return "application/x-ndjson"
+	}
+	return "application/json"
+}
+
+// Write walks the project folder and writes the manifest to w in format as entries are found
+// Memory use doesn't depend on the number of files
+func (m *Manifest) Write(ctx context.Context, w io.Writer, format string) error {
+	bw := bufio.NewWriter(w)
+	enc, err := m.encoder(bw, format)
+	if err != nil {
+		return err
+	}
+
+	if err := enc.Begin(); err != nil {
+		return err
+	}
+
+	fs := m.fs
+	batch := make([]api.FileInfo, 0, hashBatchSize)
+	flush := func() error {
+		if m.opts.Hash && len(batch) > 0 {
+			if _, err := fs.hasher.HashFiles(ctx, m.folderPath, batch, nil); err != nil {
+				return err
+			}
+			fs.recordHashes(m.ProjectID, batch)
+		} else {
+			clearHashes(batch)
+		}
+		if m.opts.Media {
+			fs.attachMedia(m.folderPath, batch)
+		}
+		for _, f := range batch {
+			if err := enc.Entry(m.entry(f)); err != nil {
+				return err
+			}
+		}
+		batch = batch[:0]
+		return nil
+	}
+
+	add := func(f api.FileInfo) error {
+		if !m.includes(f) {
+			return nil
+		}
+		batch = append(batch, f)
+		if len(batch) == hashBatchSize {
+			return flush()
+		}
+		return nil
+	}
+
+	err = fs.walkFiles(ctx, m.ProjectID, m.folderPath, m.opts.ExpandSequences, add)
+	if err == nil {
+		err = flush()
+	}
+	if err == nil {
+		err = enc.End()
+	}
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// encoder returns the writer of the manifest's entries in format
+func (m *Manifest) encoder(w io.Writer, format string) (manifestEncoder, error) {
+	switch format {
+	case ManifestCSV:
+		return newManifestCSV(w, m), nil
+	case ManifestNDJSON:
+		return &manifestNDJSON{enc: json.NewEncoder(w)}, nil
+	case ManifestJSON:
+		return &manifestJSON{w: w, m: m}, nil
+	}
+	return nil, fmt.Errorf("unknown manifest format %q", format)
+}
+
+// includes reports whether an entry passes the manifest's filters; directories are never listed
+func (m *Manifest) includes(f api.FileInfo) bool {
+	if f.IsDirectory {
+		return false
+	}
+	if m.opts.Prefix != "" && !strings.HasPrefix(filepath.ToSlash(f.Path), m.opts.Prefix) {
+		return false
+	}
+	if len(m.opts.Extensions) == 0 {
+		return true
+	}
+	ext := strings.ToLower(filepath.Ext(f.Name))
+	for _, want := range m.opts.Extensions {
+		if ext == want {
+			return true
+		}
+	}
+	return false
+}
+
+// entry converts a walked file into a manifest entry with its sync states
+func (m *Manifest) entry(f api.FileInfo) *ManifestEntry {
+	e := &ManifestEntry{
+		Path:     filepath.ToSlash(f.Path),
+		Name:     f.Name,
+		Size:     f.Size,
+		ModTime:  f.ModTime,
+		Hash:     f.Hash,
+		Media:    f.Media,
+		Sequence: f.Sequence,
+	}
+	if len(m.Devices) > 0 {
+		e.Sync = make(map[string]string, len(m.Devices))
+		for i, d := range m.Devices {
+			e.Sync[d.ID] = m.states[i].state(f)
+		}
+	}
+	return e
+}
+
+// syncStateRank orders states so a sequence reports its least synced frame
+var syncStateRank = map[string]int{
+	SyncStateSynced:  0,
+	SyncStateChanged: 1,
+	SyncStateSyncing: 2,
+	SyncStateNeeded:  3,
+}
+
+// state returns the sync state of an entry on the device; a sequence takes the state of its least synced frame
+func (s deviceSyncStates) state(f api.FileInfo) string {
+	if s.all != "" {
+		return s.all
+	}
+	if f.Sequence == nil {
+		if state, ok := s.files[filepath.ToSlash(f.Path)]; ok {
+			return state
+		}
+		return SyncStateSynced
+	}
+
+	worst := SyncStateSynced
+	if len(s.files) == 0 {
+		return worst
+	}
+	dir := path.Dir(filepath.ToSlash(f.Path))
+	missing := f.Sequence.Missing
+	for n := f.Sequence.First; n <= f.Sequence.Last; n++ {
+		// Jump over gaps so only frames that exist are looked up
+		if len(missing) > 0 && n == missing[0].First {
+			n = missing[0].Last
+			missing = missing[1:]
+			continue
+		}
+		if state, ok := s.files[path.Join(dir, fmt.Sprintf(f.Sequence.Pattern, n))]; ok && syncStateRank[state] > syncStateRank[worst] {
+			worst = state
+		}
+	}
+	return worst
+}
+
+// manifestEncoder writes manifest entries in one format
+type manifestEncoder interface {
+	Begin() error
+	Entry(e *ManifestEntry) error
+	End() error
+}
+
+// manifestCSV writes one row per entry under a header row, with a column per device when sync states are included
+type manifestCSV struct {
+	w *csv.Writer
+	m *Manifest
+}
+
+func newManifestCSV(w io.Writer, m *Manifest) *manifestCSV {
+	return &manifestCSV{w: csv.NewWriter(w), m: m}
+}
+
+func (c *manifestCSV) Begin() error {
+	header := []string{"path", "name", "size", "modTime", "frames"}
+	if c.m.opts.Hash {
+		header = append(header, "hash")
+	}
+	if c.m.opts.Media {
+		header = append(header, "container", "duration", "width", "height", "frameRate", "codec", "timecode", "creationTime")
+	}
+	for _, d := range c.m.Devices {
+		header = append(header, "sync:"+deviceLabel(d))
+	}
+	return c.write(header)
+}
+
+func (c *manifestCSV) Entry(e *ManifestEntry) error {
+	frames := ""
+	if e.Sequence != nil {
+		frames = strconv.Itoa(e.Sequence.Frames)
+	}
+	row := []string{e.Path, e.Name, strconv.FormatInt(e.Size, 10), e.ModTime.UTC().Format(time.RFC3339), frames}
+	if c.m.opts.Hash {
+		row = append(row, e.Hash)
+	}
+	if c.m.opts.Media {
+		row = append(row, mediaColumns(e.Media)...)
+	}
+	for _, d := range c.m.Devices {
+		row = append(row, e.Sync[d.ID])
+	}
+	return c.write(row)
+}
+
+func (c *manifestCSV) End() error {
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// write writes a row with its cells made safe to open in a spreadsheet
+func (c *manifestCSV) write(row []string) error {
+	for i, cell := range row {
+		row[i] = csvCell(cell)
+	}
+	return c.w.Write(row)
+}
+
+// csvCell quotes a cell that a spreadsheet would otherwise run as a formula, such as a file named "=cmd()"
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// mediaColumns formats clip metadata as CSV cells, empty for files that aren't clips
+func mediaColumns(meta *media.Metadata) []string {
+	if meta == nil {
+		return make([]string, 8)
+	}
+	number := func(v float64) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	integer := func(v int) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.Itoa(v)
+	}
+	created := ""
+	if meta.CreationTime != nil {
+		created = meta.CreationTime.UTC().Format(time.RFC3339)
+	}
+	return []string{
+		meta.Container, number(meta.Duration), integer(meta.Width), integer(meta.Height),
+		number(meta.FrameRate), meta.Codec, meta.Timecode, created,
+	}
+}
+
+// deviceLabel names a device in a column header, by name when it has one
+func deviceLabel(d ManifestDevice) string {
+	if d.Name != "" {
+		return d.Name
+	}
+	if len(d.ID) > 7 {
+		return d.ID[:7] // Syncthing's short device ID
+	}
+	return d.ID
+}
+
+// manifestNDJSON writes one JSON object per line
+type manifestNDJSON struct {
+	enc *json.Encoder
+}
+
+func (n *manifestNDJSON) Begin() error { return nil }
+
+func (n *manifestNDJSON) Entry(e *ManifestEntry) error { return n.enc.Encode(e) }
+
+func (n *manifestNDJSON) End() error { return nil }
+
+// manifestJSON writes one document with the manifest's header fields and a "files" array
+type manifestJSON struct {
+	w     io.Writer
+	m     *Manifest
+	first bool
+}
+
+func (j *manifestJSON) Begin() error {
+	header, err := json.Marshal(map[string]interface{}{
+		"projectId":   j.m.ProjectID,
+		"generatedAt": j.m.GeneratedAt,
+		"devices":     j.m.Devices,
+	})
+	if err != nil {
+		return err
+	}
+	header = header[:len(header)-1] // Drop the closing brace, the files follow
+	j.first = true
+	_, err = fmt.Fprintf(j.w, `%s,"files":[`, header)
+	return err
+}
+
+func (j *manifestJSON) Entry(e *ManifestEntry) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if !j.first {
+		if _, err := io.WriteString(j.w, ","); err != nil {
+			return err
+		}
+	}
+	j.first = false
+	_, err = j.w.Write(data)
+	return err
+}
+
+func (j *manifestJSON) End() error {
+	_, err := io.WriteString(j.w, "]}\n")
+	return err
+}
@@ -0,0 +1,167 @@
+package services
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vidsync/agent/internal/media"
+	"github.com/vidsync/agent/internal/sequence"
+)
+
+var manifestTime = time.Date(2024, 3, 15, 10, 0, 0, 0, time.UTC)
+
+// encodeManifest writes entries the way Manifest.Write does once the folder is walked
+func encodeManifest(t *testing.T, m *Manifest, format string, entries []*ManifestEntry) string {
+	t.Helper()
+	var buf bytes.Buffer
+	enc, err := m.encoder(&buf, format)
+	if err != nil {
+		t.Fatalf("encoder(%q): %v", format, err)
+	}
+	if err := enc.Begin(); err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	for _, e := range entries {
+		if err := enc.Entry(e); err != nil {
+			t.Fatalf("Entry: %v", err)
+		}
+	}
+	if err := enc.End(); err != nil {
+		t.Fatalf("End: %v", err)
+	}
+	return buf.String()
+}
+
+func TestManifestCSV(t *testing.T) {
+	clip := &ManifestEntry{
+		Path: "a/clip.mov", Name: "clip.mov", Size: 1024, ModTime: manifestTime, Hash: "abc",
+		Media: &media.Metadata{Container: "mov", Duration: 12.5, Width: 1920, Height: 1080, FrameRate: 25, Codec: "apch", Timecode: "01:00:00:00"},
+		Sync:  map[string]string{"DEVICE1-LOCAL": SyncStateSynced, "DEVICE2-REMOTE": SyncStateNeeded},
+	}
+	frames := &ManifestEntry{
+		Path: "plates/shot_%04d.exr", Name: "shot_%04d.exr", Size: 300, ModTime: manifestTime,
+		Sequence: &sequence.Info{Pattern: "shot_%04d.exr", First: 1, Last: 3, Frames: 3, Padding: 4},
+	}
+	devices := []ManifestDevice{{ID: "DEVICE1-LOCAL", Name: "Edit bay", Local: true}, {ID: "DEVICE2-REMOTE"}}
+
+	tests := []struct {
+		name    string
+		opts    ManifestOptions
+		devices []ManifestDevice
+		entries []*ManifestEntry
+		want    string
+	}{
+		{
+			name:    "plain",
+			entries: []*ManifestEntry{clip, frames},
+			want: "path,name,size,modTime,frames\n" +
+				"a/clip.mov,clip.mov,1024,2024-03-15T10:00:00Z,\n" +
+				"plates/shot_%04d.exr,shot_%04d.exr,300,2024-03-15T10:00:00Z,3\n",
+		},
+		{
+			name:    "every column",
+			opts:    ManifestOptions{Hash: true, Media: true, Sync: true},
+			devices: devices,
+			entries: []*ManifestEntry{clip, frames},
+			want: "path,name,size,modTime,frames,hash,container,duration,width,height,frameRate,codec,timecode,creationTime,sync:Edit bay,sync:DEVICE2\n" +
+				"a/clip.mov,clip.mov,1024,2024-03-15T10:00:00Z,,abc,mov,12.5,1920,1080,25,apch,01:00:00:00,,synced,needed\n" +
+				"plates/shot_%04d.exr,shot_%04d.exr,300,2024-03-15T10:00:00Z,3,,,,,,,,,,,\n",
+		},
+		{
+			name:    "no entries",
+			opts:    ManifestOptions{Hash: true},
+			entries: nil,
+			want:    "path,name,size,modTime,frames,hash\n",
+		},
+		{
+			name: "formulas are not run by spreadsheets",
+			entries: []*ManifestEntry{
+				{Path: "=HYPERLINK(\"x\").mov", Name: "=HYPERLINK(\"x\").mov", Size: 1, ModTime: manifestTime},
+				{Path: "+1.mov", Name: "+1.mov", Size: 2, ModTime: manifestTime},
+				{Path: "-1.mov", Name: "-1.mov", Size: 3, ModTime: manifestTime},
+				{Path: "@SUM.mov", Name: "@SUM.mov", Size: 4, ModTime: manifestTime},
+				{Path: "a/=b.mov", Name: "=b.mov", Size: 5, ModTime: manifestTime},
+			},
+			want: "path,name,size,modTime,frames\n" +
+				"\"'=HYPERLINK(\"\"x\"\").mov\",\"'=HYPERLINK(\"\"x\"\").mov\",1,2024-03-15T10:00:00Z,\n" +
+				"'+1.mov,'+1.mov,2,2024-03-15T10:00:00Z,\n" +
+				"'-1.mov,'-1.mov,3,2024-03-15T10:00:00Z,\n" +
+				"'@SUM.mov,'@SUM.mov,4,2024-03-15T10:00:00Z,\n" +
+				"a/=b.mov,'=b.mov,5,2024-03-15T10:00:00Z,\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manifest{ProjectID: "p", GeneratedAt: manifestTime, Devices: tt.devices, opts: tt.opts}
+			if m.Devices == nil {
+				m.Devices = []ManifestDevice{}
+			}
+			if got := encodeManifest(t, m, ManifestCSV, tt.entries); got != tt.want {
+				t.Errorf("CSV =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestManifestJSON(t *testing.T) {
+	entries := []*ManifestEntry{
+		{Path: "a/clip.mov", Name: "clip.mov", Size: 1024, ModTime: manifestTime, Hash: "abc"},
+		{Path: "b.wav", Name: "b.wav", Size: 10, ModTime: manifestTime, Sync: map[string]string{"DEVICE1": SyncStateSyncing}},
+	}
+	devices := []ManifestDevice{{ID: "DEVICE1", Local: true}}
+
+	tests := []struct {
+		name    string
+		entries []*ManifestEntry
+	}{
+		{"no entries", nil},
+		{"one entry", entries[:1]},
+		{"several entries", entries},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Manifest{ProjectID: "p", GeneratedAt: manifestTime, Devices: devices}
+			wantFiles := []ManifestEntry{}
+			for _, e := range tt.entries {
+				wantFiles = append(wantFiles, *e)
+			}
+
+			var doc struct {
+				ProjectID   string           `json:"projectId"`
+				GeneratedAt time.Time        `json:"generatedAt"`
+				Devices     []ManifestDevice `json:"devices"`
+				Files       []ManifestEntry  `json:"files"`
+			}
+			out := encodeManifest(t, m, ManifestJSON, tt.entries)
+			if err := json.Unmarshal([]byte(out), &doc); err != nil {
+				t.Fatalf("JSON manifest doesn't parse: %v\n%s", err, out)
+			}
+			if doc.ProjectID != "p" || !doc.GeneratedAt.Equal(manifestTime) || !reflect.DeepEqual(doc.Devices, devices) {
+				t.Errorf("header = %q, %v, %+v", doc.ProjectID, doc.GeneratedAt, doc.Devices)
+			}
+			if !reflect.DeepEqual(doc.Files, wantFiles) {
+				t.Errorf("files = %+v, want %+v", doc.Files, wantFiles)
+			}
+
+			// NDJSON has the same entries, one per line and no header
+			out = encodeManifest(t, m, ManifestNDJSON, tt.entries)
+			lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+			if out == "" {
+				lines = nil
+			}
+			if len(lines) != len(wantFiles) {
+				t.Fatalf("NDJSON has %d lines, want %d:\n%s", len(lines), len(wantFiles), out)
+			}
+			for i, line := range lines {
+				var e ManifestEntry
+				if err := json.Unmarshal([]byte(line), &e); err != nil || !reflect.DeepEqual(e, wantFiles[i]) {
+					t.Errorf("NDJSON line %d = %s (%v), want %+v", i, line, err, wantFiles[i])
+				}
+			}
+		})
+	}
+}
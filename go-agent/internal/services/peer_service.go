@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/vidsync/agent/internal/api"
+	"github.com/vidsync/agent/internal/util"
+)
+
+// Peer connection types
+const (
+	PeerConnectionDirect = "direct"
+	PeerConnectionRelay  = "relay"
+)
+
+// PeerStatus is the connection status of one device sharing a project
+type PeerStatus struct {
+	DeviceID       string     `json:"deviceId"`
+	Name           string     `json:"name,omitempty"`
+	IsSelf         bool       `json:"isSelf"`
+	Connected      bool       `json:"connected"`
+	Paused         bool       `json:"paused"`
+	ConnectionType string     `json:"connectionType,omitempty"` // direct, relay
+	Transport      string     `json:"transport,omitempty"`      // Syncthing connection type, e.g. tcp-client, quic-server
+	Address        string     `json:"address,omitempty"`
+	IsLAN          bool       `json:"isLan"`
+	OverNebula     bool       `json:"overNebula"`
+	LastSeen       *time.Time `json:"lastSeen,omitempty"`
+	ClientVersion  string     `json:"clientVersion,omitempty"`
+}
+
+// PeerService reports which devices of a project are online and how they connect
+type PeerService struct {
+	syncClient  *api.SyncthingClient
+	cloudClient *api.CloudClient
+	logger      *util.Logger
+	overlay     func() []*net.IPNet // Nebula overlay subnets, nil when Nebula is unavailable
+}
+
+// NewPeerService creates a new peer service
+func NewPeerService(syncClient *api.SyncthingClient, cloudClient *api.CloudClient, logger *util.Logger) *PeerService {
+	return &PeerService{
+		syncClient:  syncClient,
+		cloudClient: cloudClient,
+		logger:      logger,
+	}
+}
+
+// SetOverlayNetworks sets how to look up the Nebula overlay subnets
+// Connections to addresses inside them are reported as going over Nebula
+func (ps *PeerService) SetOverlayNetworks(overlay func() []*net.IPNet) {
+	ps.overlay = overlay
+}
+
+// GetProjectPeers lists the devices sharing a project with their connection status
+func (ps *PeerService) GetProjectPeers(ctx context.Context, projectID string) ([]PeerStatus, error) {
+	folder, err := ps.syncClient.GetFolder(projectID)
+	if err != nil {
+		ps.logger.Error("[PeerService] Failed to get folder config: %v", err)
+		return nil, err
+	}
+
+	myID, err := ps.syncClient.GetMyID()
+	if err != nil {
+		ps.logger.Error("[PeerService] Failed to get local device ID: %v", err)
+		return nil, err
+	}
+
+	connections, err := ps.syncClient.GetConnections()
+	if err != nil {
+		ps.logger.Warn("[PeerService] Failed to get connections: %v", err)
+		connections = &api.Connections{}
+	}
+
+	stats, err := ps.syncClient.GetDeviceStats()
+	if err != nil {
+		ps.logger.Warn("[PeerService] Failed to get device stats: %v", err)
+		stats = map[string]api.DeviceStatistics{}
+	}
+
+	names := map[string]string{}
+	if devices, err := ps.syncClient.GetDevices(); err == nil {
+		for _, d := range devices {
+			names[d.DeviceID] = d.Name
+		}
+	}
+
+	var overlay []*net.IPNet
+	if ps.overlay != nil {
+		overlay = ps.overlay()
+	}
+
+	peers := []PeerStatus{}
+	for _, d := range folder.Devices {
+		peer := PeerStatus{
+			DeviceID: d.DeviceID,
+			Name:     names[d.DeviceID],
+			IsSelf:   d.DeviceID == myID,
+		}
+		if peer.IsSelf {
+			peer.Connected = true
+			peers = append(peers, peer)
+			continue
+		}
+
+		if conn, ok := connections.Connections[d.DeviceID]; ok {
+			applyConnection(&peer, conn, overlay)
+		}
+		if stat, ok := stats[d.DeviceID]; ok && !stat.LastSeen.IsZero() && stat.LastSeen.Year() > 1970 {
+			lastSeen := stat.LastSeen
+			peer.LastSeen = &lastSeen
+		}
+
+		peers = append(peers, peer)
+	}
+
+	return peers, nil
+}
+
+// RunPeerMonitor emits per-project peerConnected/peerDisconnected events
+// when Syncthing reports a device connecting or disconnecting
+func (ps *PeerService) RunPeerMonitor(ctx context.Context, emitter EventEmitter) {
+	events := ps.syncClient.Events()
+	ch := events.Subscribe()
+	defer events.Unsubscribe(ch)
+
+	ps.logger.Info("[PeerService] Peer monitor started")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-ch:
+			if !ok {
+				return
+			}
+
+			var deviceID, eventType string
+			switch evt.Type {
+			case "DeviceConnected":
+				var data api.DeviceConnectedData
+				if evt.DecodeData(&data) != nil {
+					continue
+				}
+				deviceID, eventType = data.ID, "peerConnected"
+			case "DeviceDisconnected":
+				var data api.DeviceDisconnectedData
+				if evt.DecodeData(&data) != nil {
+					continue
+				}
+				deviceID, eventType = data.ID, "peerDisconnected"
+			default:
+				continue
+			}
+
+			ps.emitPeerChange(ctx, deviceID, eventType, emitter)
+		}
+	}
+}
+
+// emitPeerChange emits a peer event for every project shared with deviceID
+func (ps *PeerService) emitPeerChange(ctx context.Context, deviceID, eventType string, emitter EventEmitter) {
+	folders, err := ps.syncClient.GetFolders()
+	if err != nil {
+		ps.logger.Warn("[PeerService] Failed to get folders: %v", err)
+		return
+	}
+
+	for _, folder := range folders {
+		if !folder.HasDevice(deviceID) {
+			continue
+		}
+
+		peers, err := ps.GetProjectPeers(ctx, folder.ID)
+		if err != nil {
+			continue
+		}
+		for _, peer := range peers {
+			if peer.DeviceID != deviceID {
+				continue
+			}
+			ps.logger.Info("[PeerService] %s: %s (%s) in project %s", eventType, peer.Name, deviceID, folder.ID)
+			emit(emitter, folder.ID, eventType, "", peer.Name, map[string]interface{}{
+				"peer": peer,
+			})
+		}
+	}
+}
+
+// applyConnection fills connection details from a Syncthing connection entry
+func applyConnection(peer *PeerStatus, conn api.Connection, overlay []*net.IPNet) {
+	peer.Connected = conn.Connected
+	peer.Paused = conn.Paused
+	if !conn.Connected {
+		return
+	}
+
+	peer.Transport = conn.Type
+	peer.Address = conn.Address
+	peer.IsLAN = conn.IsLocal
+	peer.ClientVersion = conn.ClientVersion
+
+	peer.ConnectionType = PeerConnectionDirect
+	if strings.Contains(conn.Type, "relay") {
+		peer.ConnectionType = PeerConnectionRelay
+	}
+
+	if ip := addressIP(conn.Address); ip != nil {
+		for _, network := range overlay {
+			if network.Contains(ip) {
+				peer.OverNebula = true
+				break
+			}
+		}
+	}
+}
+
+// addressIP extracts the IP from a Syncthing connection address such as
+// "192.168.1.5:22000", "[fe80::1]:22000" or "tcp://10.99.1.4:22000"
+func addressIP(address string) net.IP {
+	if i := strings.Index(address, "://"); i >= 0 {
+		address = address[i+3:]
+	}
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		host = address
+	}
+	return net.ParseIP(host)
+}
@@ -0,0 +1,501 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	stdsync "sync"
+	"time"
+
+	"github.com/vidsync/agent/internal/api"
+	"github.com/vidsync/agent/internal/util"
+)
+
+// membershipTTL is how long cloud membership lookups are cached
+const membershipTTL = 1 * time.Minute
+
+// Auto-accept retries of a failing request back off from acceptRetryMin to acceptRetryMax
+const (
+	acceptRetryMin = 1 * time.Minute
+	acceptRetryMax = 1 * time.Hour
+)
+
+// PendingService auto-accepts pending Syncthing devices and folders from project members
+// Requests that don't match cloud membership are surfaced for manual approval
+type PendingService struct {
+	syncClient  *api.SyncthingClient
+	cloudClient *api.CloudClient
+	logger      *util.Logger
+	syncRoot    string // Cloud-supplied download paths must be inside it
+
+	mu          stdsync.Mutex
+	memberships map[string]cachedMembership // projectID -> membership
+	projects    []string                    // Project IDs the signed-in user can access
+	projectsAt  time.Time
+	notified    map[string]bool // Pending requests already announced
+	failures    map[string]acceptFailure
+}
+
+// acceptFailure tracks an auto-accept that keeps failing
+type acceptFailure struct {
+	count   int
+	retryAt time.Time
+}
+
+type cachedMembership struct {
+	members   *api.ProjectMemberDevices // nil when the user has no access
+	fetchedAt time.Time
+}
+
+// NewPendingService creates a new pending request service
+func NewPendingService(syncClient *api.SyncthingClient, cloudClient *api.CloudClient, logger *util.Logger) *PendingService {
+	return &PendingService{
+		syncClient:  syncClient,
+		cloudClient: cloudClient,
+		logger:      logger,
+		memberships: make(map[string]cachedMembership),
+		notified:    make(map[string]bool),
+		failures:    make(map[string]acceptFailure),
+	}
+}
+
+// SetSyncRoot sets the directory download paths from the cloud must be inside
+func (ps *PendingService) SetSyncRoot(root string) {
+	ps.syncRoot = root
+}
+
+// PendingDeviceRequest is an unknown device that wants to connect
+type PendingDeviceRequest struct {
+	DeviceID   string    `json:"deviceId"`
+	Name       string    `json:"name"`
+	Address    string    `json:"address,omitempty"`
+	Time       time.Time `json:"time"`
+	Known      bool      `json:"known"`                // Belongs to a member of one of our projects
+	ProjectIDs []string  `json:"projectIds,omitempty"` // Projects the device's owner is a member of
+}
+
+// PendingFolderRequest is a folder a remote device offered to share
+type PendingFolderRequest struct {
+	FolderID   string    `json:"folderId"`
+	Label      string    `json:"label"`
+	DeviceID   string    `json:"deviceId"`
+	DeviceName string    `json:"deviceName,omitempty"`
+	Time       time.Time `json:"time"`
+	Known      bool      `json:"known"`                // Offered by a member of the matching project
+	FolderType string    `json:"folderType,omitempty"` // Type used when accepted
+	Path       string    `json:"path,omitempty"`       // Download path used when accepted
+}
+
+// PendingRequests lists pending devices and folders
+type PendingRequests struct {
+	Devices []PendingDeviceRequest `json:"devices"`
+	Folders []PendingFolderRequest `json:"folders"`
+}
+
+// AcceptFolderRequest accepts a pending folder, optionally overriding path and type
+type AcceptFolderRequest struct {
+	DeviceID   string `json:"deviceId"`
+	Path       string `json:"path,omitempty"`
+	FolderType string `json:"folderType,omitempty"` // sendreceive, receiveonly
+}
+
+// ListPending lists pending devices and folders and whether they match project membership
+func (ps *PendingService) ListPending(ctx context.Context) (*PendingRequests, error) {
+	devices, err := ps.syncClient.GetPendingDevices()
+	if err != nil {
+		ps.logger.Error("[PendingService] Failed to get pending devices: %v", err)
+		return nil, err
+	}
+
+	folders, err := ps.syncClient.GetPendingFolders()
+	if err != nil {
+		ps.logger.Error("[PendingService] Failed to get pending folders: %v", err)
+		return nil, err
+	}
+
+	result := &PendingRequests{
+		Devices: []PendingDeviceRequest{},
+		Folders: []PendingFolderRequest{},
+	}
+
+	for deviceID, d := range devices {
+		req := PendingDeviceRequest{DeviceID: deviceID, Name: d.Name, Address: d.Address, Time: d.Time}
+		for _, projectID := range ps.accessibleProjects() {
+			members := ps.membership(projectID)
+			if member, ok := findMemberDevice(members, deviceID); ok {
+				req.Known = true
+				req.ProjectIDs = append(req.ProjectIDs, projectID)
+				if member.DeviceName != "" {
+					req.Name = member.DeviceName
+				}
+			}
+		}
+		result.Devices = append(result.Devices, req)
+	}
+
+	for folderID, f := range folders {
+		members := ps.membership(folderID)
+		for deviceID, offer := range f.OfferedBy {
+			req := PendingFolderRequest{FolderID: folderID, Label: offer.Label, DeviceID: deviceID, Time: offer.Time}
+			if member, ok := findMemberDevice(members, deviceID); ok && !offer.ReceiveEncrypted {
+				req.Known = true
+				req.DeviceName = member.DeviceName
+				req.FolderType = folderTypeForRole(members.Role)
+				req.Path = expandHome(members.DownloadPath)
+			}
+			result.Folders = append(result.Folders, req)
+		}
+	}
+
+	sort.Slice(result.Devices, func(i, j int) bool { return result.Devices[i].Time.Before(result.Devices[j].Time) })
+	sort.Slice(result.Folders, func(i, j int) bool { return result.Folders[i].Time.Before(result.Folders[j].Time) })
+	return result, nil
+}
+
+// AcceptDevice adds a pending device to Syncthing
+func (ps *PendingService) AcceptDevice(ctx context.Context, deviceID, name string) error {
+	ps.logger.Info("[PendingService] Accepting device: %s (%s)", deviceID, name)
+
+	if _, err := ps.syncClient.GetDevice(deviceID); err == nil {
+		return nil // Already configured
+	}
+	if err := ps.syncClient.AddDevice(deviceID, name); err != nil {
+		ps.logger.Error("[PendingService] Failed to add device: %v", err)
+		return err
+	}
+	return nil
+}
+
+// AcceptFolder adds a pending folder shared by a device
+// Path and type default to the project's download path and the user's project role
+func (ps *PendingService) AcceptFolder(ctx context.Context, folderID string, req *AcceptFolderRequest) (*PendingFolderRequest, error) {
+	ps.logger.Info("[PendingService] Accepting folder %s from %s", folderID, req.DeviceID)
+
+	// Folder already exists locally: the device just needs to be added to it
+	if _, err := ps.syncClient.GetFolder(folderID); err == nil {
+		if err := ps.syncClient.AddDeviceToFolder(folderID, req.DeviceID); err != nil {
+			ps.logger.Error("[PendingService] Failed to share folder with device: %v", err)
+			return nil, err
+		}
+		return &PendingFolderRequest{FolderID: folderID, DeviceID: req.DeviceID}, nil
+	}
+
+	label := folderID
+	if folders, err := ps.syncClient.GetPendingFolders(); err == nil {
+		if offer, ok := folders[folderID].OfferedBy[req.DeviceID]; ok && offer.Label != "" {
+			label = offer.Label
+		}
+	}
+
+	folderPath := req.Path
+	folderType := req.FolderType
+	if members := ps.membership(folderID); members != nil {
+		if folderPath == "" {
+			cloudPath, err := ps.checkDownloadPath(members.DownloadPath)
+			if err != nil {
+				return nil, err
+			}
+			folderPath = cloudPath
+		}
+		if folderType == "" {
+			folderType = folderTypeForRole(members.Role)
+		}
+	}
+	if folderPath == "" {
+		return nil, fmt.Errorf("no download path for folder %s", folderID)
+	}
+	if !filepath.IsAbs(folderPath) {
+		return nil, fmt.Errorf("folder path must be absolute: %s", folderPath)
+	}
+	if folderType == "" {
+		folderType = "receiveonly"
+	}
+
+	if err := os.MkdirAll(folderPath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create folder path: %w", err)
+	}
+
+	var err error
+	switch folderType {
+	case "receiveonly":
+		err = ps.syncClient.AddFolderReceiveOnly(folderID, label, folderPath, req.DeviceID)
+	case "sendreceive":
+		if err = ps.syncClient.AddFolder(folderID, label, folderPath, nil); err == nil {
+			err = ps.syncClient.AddDeviceToFolder(folderID, req.DeviceID)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported folder type: %s", folderType)
+	}
+	if err != nil {
+		ps.logger.Error("[PendingService] Failed to add folder: %v", err)
+		return nil, err
+	}
+
+	ps.logger.Info("[PendingService] Folder %s accepted at %s (%s)", folderID, folderPath, folderType)
+	return &PendingFolderRequest{
+		FolderID:   folderID,
+		Label:      label,
+		DeviceID:   req.DeviceID,
+		FolderType: folderType,
+		Path:       folderPath,
+	}, nil
+}
+
+// RejectDevice dismisses a pending device
+func (ps *PendingService) RejectDevice(ctx context.Context, deviceID string) error {
+	ps.logger.Info("[PendingService] Dismissing pending device: %s", deviceID)
+	return ps.syncClient.DismissPendingDevice(deviceID)
+}
+
+// RejectFolder dismisses a pending folder offer
+func (ps *PendingService) RejectFolder(ctx context.Context, folderID, deviceID string) error {
+	ps.logger.Info("[PendingService] Dismissing pending folder %s from %s", folderID, deviceID)
+	return ps.syncClient.DismissPendingFolder(folderID, deviceID)
+}
+
+// RunAutoAccept processes pending requests when Syncthing reports changes and every interval
+// Known members are accepted automatically; everything else is announced once as an event
+func (ps *PendingService) RunAutoAccept(ctx context.Context, interval time.Duration, emitter EventEmitter) {
+	events := ps.syncClient.Events()
+	ch := events.Subscribe()
+	defer events.Unsubscribe(ch)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	ps.logger.Info("[PendingService] Auto-accept started (interval %v)", interval)
+	ps.processPending(ctx, emitter)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-ch:
+			if !ok {
+				return
+			}
+			if evt.Type == "PendingDevicesChanged" || evt.Type == "PendingFoldersChanged" {
+				ps.processPending(ctx, emitter)
+			}
+		case <-ticker.C:
+			ps.processPending(ctx, emitter)
+		}
+	}
+}
+
+func (ps *PendingService) processPending(ctx context.Context, emitter EventEmitter) {
+	pending, err := ps.ListPending(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, d := range pending.Devices {
+		if !d.Known {
+			ps.notifyOnce("device/"+d.DeviceID, func() {
+				emit(emitter, "", "pendingDevice", "", d.Name, map[string]interface{}{
+					"deviceId": d.DeviceID,
+					"address":  d.Address,
+				})
+			})
+			continue
+		}
+
+		key := "device/" + d.DeviceID
+		if !ps.retryDue(key) {
+			continue
+		}
+		if err := ps.AcceptDevice(ctx, d.DeviceID, d.Name); err != nil {
+			ps.acceptFailed(key, err, func() {
+				emit(emitter, "", "deviceAcceptFailed", "", err.Error(), map[string]interface{}{
+					"deviceId": d.DeviceID,
+					"name":     d.Name,
+				})
+			})
+			continue
+		}
+		ps.acceptSucceeded(key)
+		emit(emitter, "", "deviceAccepted", "", d.Name, map[string]interface{}{
+			"deviceId":   d.DeviceID,
+			"projectIds": d.ProjectIDs,
+		})
+	}
+
+	for _, f := range pending.Folders {
+		if !f.Known {
+			ps.notifyOnce("folder/"+f.FolderID+"/"+f.DeviceID, func() {
+				emit(emitter, f.FolderID, "pendingFolder", "", f.Label, map[string]interface{}{
+					"deviceId": f.DeviceID,
+					"label":    f.Label,
+				})
+			})
+			continue
+		}
+
+		key := "folder/" + f.FolderID + "/" + f.DeviceID
+		if !ps.retryDue(key) {
+			continue
+		}
+		accepted, err := ps.AcceptFolder(ctx, f.FolderID, &AcceptFolderRequest{DeviceID: f.DeviceID})
+		if err != nil {
+			ps.acceptFailed(key, err, func() {
+				emit(emitter, f.FolderID, "folderAcceptFailed", f.Path, err.Error(), map[string]interface{}{
+					"deviceId": f.DeviceID,
+					"label":    f.Label,
+				})
+			})
+			continue
+		}
+		ps.acceptSucceeded(key)
+		emit(emitter, f.FolderID, "folderAccepted", accepted.Path, f.Label, map[string]interface{}{
+			"deviceId":   f.DeviceID,
+			"folderType": accepted.FolderType,
+		})
+	}
+}
+
+// notifyOnce runs fn the first time key is seen
+func (ps *PendingService) notifyOnce(key string, fn func()) {
+	ps.mu.Lock()
+	seen := ps.notified[key]
+	ps.notified[key] = true
+	ps.mu.Unlock()
+
+	if !seen {
+		fn()
+	}
+}
+
+// retryDue reports whether a failed auto-accept may be tried again
+func (ps *PendingService) retryDue(key string) bool {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	failure, ok := ps.failures[key]
+	return !ok || !time.Now().Before(failure.retryAt)
+}
+
+// acceptFailed logs a failed auto-accept, announces it once and backs off before the next try
+func (ps *PendingService) acceptFailed(key string, err error, announce func()) {
+	ps.mu.Lock()
+	failure := ps.failures[key]
+	failure.count++
+	delay := acceptRetryMin << uint(min(failure.count-1, 6))
+	if delay > acceptRetryMax {
+		delay = acceptRetryMax
+	}
+	failure.retryAt = time.Now().Add(delay)
+	ps.failures[key] = failure
+	ps.mu.Unlock()
+
+	ps.logger.Warn("[PendingService] Auto-accept of %s failed (attempt %d, retrying in %v): %v", key, failure.count, delay, err)
+	ps.notifyOnce("failed/"+key, announce)
+}
+
+// acceptSucceeded clears the backoff of a request
+func (ps *PendingService) acceptSucceeded(key string) {
+	ps.mu.Lock()
+	delete(ps.failures, key)
+	delete(ps.notified, "failed/"+key)
+	ps.mu.Unlock()
+}
+
+// checkDownloadPath expands a download path from the cloud and requires it to be
+// absolute and inside the sync root, so a project can't make the agent create folders elsewhere
+func (ps *PendingService) checkDownloadPath(p string) (string, error) {
+	if p == "" {
+		return "", nil
+	}
+	expanded := expandHome(p)
+	if !filepath.IsAbs(expanded) {
+		return "", fmt.Errorf("download path must be absolute: %s", p)
+	}
+	expanded = filepath.Clean(expanded)
+	if ps.syncRoot == "" {
+		return "", fmt.Errorf("no sync root configured for download path %s", p)
+	}
+	root := filepath.Clean(ps.syncRoot)
+	rel, err := filepath.Rel(root, expanded)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("download path %s is outside the sync root %s", p, root)
+	}
+	return expanded, nil
+}
+
+// accessibleProjects returns the IDs of projects the signed-in user can access
+func (ps *PendingService) accessibleProjects() []string {
+	ps.mu.Lock()
+	if time.Since(ps.projectsAt) < membershipTTL {
+		projects := ps.projects
+		ps.mu.Unlock()
+		return projects
+	}
+	ps.mu.Unlock()
+
+	projects, err := ps.cloudClient.ListProjectIDsWithAuth(ps.cloudClient.SessionToken())
+	if err != nil {
+		ps.logger.Debug("[PendingService] Could not list cloud projects: %v", err)
+	}
+
+	ps.mu.Lock()
+	ps.projects = projects
+	ps.projectsAt = time.Now()
+	ps.mu.Unlock()
+	return projects
+}
+
+// membership returns the cloud device membership of a project, or nil if unavailable
+func (ps *PendingService) membership(projectID string) *api.ProjectMemberDevices {
+	ps.mu.Lock()
+	cached, ok := ps.memberships[projectID]
+	ps.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < membershipTTL {
+		return cached.members
+	}
+
+	members, err := ps.cloudClient.GetProjectMemberDevices(projectID, ps.cloudClient.SessionToken())
+	if err != nil {
+		ps.logger.Debug("[PendingService] No membership for %s: %v", projectID, err)
+		members = nil
+	}
+
+	ps.mu.Lock()
+	ps.memberships[projectID] = cachedMembership{members: members, fetchedAt: time.Now()}
+	ps.mu.Unlock()
+	return members
+}
+
+// findMemberDevice finds a Syncthing device in a project's membership
+func findMemberDevice(members *api.ProjectMemberDevices, deviceID string) (api.MemberDevice, bool) {
+	if members == nil {
+		return api.MemberDevice{}, false
+	}
+	for _, d := range members.Devices {
+		if d.SyncthingID == deviceID {
+			return d, true
+		}
+	}
+	return api.MemberDevice{}, false
+}
+
+// folderTypeForRole maps the signed-in user's project role to a folder type
+// Invitees only receive, matching how projects are shared from the owner
+func folderTypeForRole(role string) string {
+	if role == "owner" {
+		return "sendreceive"
+	}
+	return "receiveonly"
+}
+
+// expandHome expands a leading "~" to the user's home directory
+func expandHome(p string) string {
+	if p != "~" && !strings.HasPrefix(p, "~/") {
+		return p
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return p
+	}
+	return filepath.Join(home, strings.TrimPrefix(p, "~"))
+}
@@ -3,7 +3,6 @@ package services
 import (
 	"context"
 	"fmt"
-	"time"
 
 	"github.com/vidsync/agent/internal/api"
 	"github.com/vidsync/agent/internal/util"
@@ -14,6 +13,9 @@ type ProjectService struct {
 	syncClient  *api.SyncthingClient
 	cloudClient *api.CloudClient
 	fileService *FileService
+	peerService *PeerService
+	scheduler   *SnapshotScheduler
+	jobs        *SnapshotJobManager
 	logger      *util.Logger
 }
 
@@ -27,6 +29,26 @@ func NewProjectService(syncClient *api.SyncthingClient, cloudClient *api.CloudCl
 	}
 }
 
+// SetFileService shares the agent's file service, so snapshots use its progress tracker and snapshot store
+func (ps *ProjectService) SetFileService(fileService *FileService) {
+	ps.fileService = fileService
+}
+
+// SetPeerService adds peer connection status to project details
+func (ps *ProjectService) SetPeerService(peerService *PeerService) {
+	ps.peerService = peerService
+}
+
+// SetSnapshotScheduler lets project removal drop the project's snapshot refresh policy
+func (ps *ProjectService) SetSnapshotScheduler(scheduler *SnapshotScheduler) {
+	ps.scheduler = scheduler
+}
+
+// SetSnapshotJobs runs the initial snapshot of new projects as a job and cancels jobs of removed projects
+func (ps *ProjectService) SetSnapshotJobs(jobs *SnapshotJobManager) {
+	ps.jobs = jobs
+}
+
 // CreateProjectRequest is the request to create a project
 type CreateProjectRequest struct {
 	ProjectID   string
@@ -35,6 +57,18 @@ type CreateProjectRequest struct {
 	DeviceID    string
 	OwnerID     string
 	AccessToken string
+	Versioning  *VersioningSettings // Optional, Syncthing's folder defaults when nil
+}
+
+// versioningConfig validates the requested versioning and converts it for Syncthing
+func (req *CreateProjectRequest) versioningConfig() (*api.VersioningConfig, error) {
+	if req.Versioning == nil {
+		return nil, nil
+	}
+	if err := req.Versioning.Validate(); err != nil {
+		return nil, err
+	}
+	return req.Versioning.ToConfig(), nil
 }
 
 // CreateProjectResponse is the response from creating a project
@@ -50,9 +84,14 @@ func (ps *ProjectService) CreateProject(ctx context.Context, req *CreateProjectR
 	ps.logger.Debug("[ProjectService] CreateProject request: projectId=%s, name=%s, localPath=%s, deviceId=%s, ownerId=%s",
 		req.ProjectID, req.Name, req.LocalPath, req.DeviceID, req.OwnerID)
 
+	versioning, err := req.versioningConfig()
+	if err != nil {
+		return &CreateProjectResponse{OK: false, Error: err.Error()}, err
+	}
+
 	// Create folder in Syncthing
 	ps.logger.Info("[ProjectService] STEP 1: Creating Syncthing folder for project: %s", req.ProjectID)
-	err := ps.syncClient.AddFolder(req.ProjectID, req.Name, req.LocalPath)
+	err = ps.syncClient.AddFolder(req.ProjectID, req.Name, req.LocalPath, versioning)
 	if err != nil {
 		ps.logger.Error("[ProjectService] STEP 1 FAILED: Failed to create Syncthing folder: %v", err)
 		return &CreateProjectResponse{OK: false, Error: err.Error()}, err
@@ -82,6 +121,7 @@ func (ps *ProjectService) CreateProject(ctx context.Context, req *CreateProjectR
 		// Don't fail - local folder was created, cloud update is secondary
 	} else {
 		ps.logger.Info("[ProjectService] STEP 2 SUCCESS: Cloud notified about project creation")
+		ps.registerSigningKey(req.ProjectID, req.AccessToken)
 	}
 
 	ps.logger.Info("[ProjectService] CreateProject completed successfully: %s", req.ProjectID)
@@ -101,6 +141,11 @@ func (ps *ProjectService) CreateProjectWithSnapshot(ctx context.Context, req *Cr
 	ps.logger.Debug("[ProjectService] CreateProjectWithSnapshot request: projectId=%s, name=%s, localPath=%s, deviceId=%s, ownerId=%s",
 		req.ProjectID, req.Name, req.LocalPath, req.DeviceID, req.OwnerID)
 
+	versioning, err := req.versioningConfig()
+	if err != nil {
+		return &CreateProjectResponse{OK: false, Error: err.Error()}, err
+	}
+
 	// STEP 1: Create project in cloud database first
 	ps.logger.Info("[ProjectService] STEP 1: Creating project in cloud database...")
 	payload := map[string]interface{}{
@@ -141,55 +186,49 @@ func (ps *ProjectService) CreateProjectWithSnapshot(ctx context.Context, req *Cr
 	}
 
 	ps.logger.Info("[ProjectService] Using projectId for subsequent steps: %s", projectID)
+	ps.registerSigningKey(projectID, req.AccessToken)
 
 	// STEP 2: Create Syncthing folder
 	ps.logger.Info("[ProjectService] STEP 2: Creating Syncthing folder...")
 	ps.logger.Debug("[ProjectService] STEP 2: Adding folder to Syncthing: id=%s, label=%s, path=%s", projectID, req.Name, req.LocalPath)
-	err = ps.syncClient.AddFolder(projectID, req.Name, req.LocalPath)
+	err = ps.syncClient.AddFolder(projectID, req.Name, req.LocalPath, versioning)
 	if err != nil {
 		ps.logger.Error("[ProjectService] STEP 2 FAILED: Failed to create Syncthing folder: %v", err)
 		return &CreateProjectResponse{OK: false, Error: err.Error()}, err
 	}
 	ps.logger.Info("[ProjectService] STEP 2 SUCCESS: Syncthing folder created: %s", projectID)
 
-	// STEP 3: Asynchronously generate snapshot (don't block project creation)
-	// Return success immediately, snapshot generation happens in background
-	go func() {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
-		defer cancel()
-
-		ps.logger.Info("[ProjectService] STEP 3: Starting background snapshot generation...")
-
-		// Wait for folder scan to complete
-		ps.logger.Info("[ProjectService] STEP 3a: Waiting for Syncthing folder scan to complete...")
-		err := ps.fileService.WaitForScanCompletion(ctx, projectID, 120)
-		if err != nil {
-			ps.logger.Error("[ProjectService] STEP 3a FAILED: Failed to wait for scan: %v", err)
-			return
-		}
-		ps.logger.Info("[ProjectService] STEP 3a SUCCESS: Folder scan completed")
-
-		// Generate snapshot
-		ps.logger.Info("[ProjectService] STEP 3b: Generating file snapshot...")
-		_, err = ps.fileService.GenerateSnapshot(ctx, projectID, req.AccessToken)
-		if err != nil {
-			ps.logger.Error("[ProjectService] STEP 3b FAILED: Failed to generate snapshot: %v", err)
-			// Don't fail - snapshot is optional
-			return
-		}
-		ps.logger.Info("[ProjectService] STEP 3b SUCCESS: File snapshot generated and uploaded")
-	}()
+	// STEP 3: Queue snapshot generation as a background job (don't block project creation)
+	// The job waits for the folder scan to complete, then generates and uploads the snapshot
+	if ps.jobs != nil {
+		job, _ := ps.jobs.Submit(projectID, req.AccessToken, TriggerProjectCreate)
+		ps.logger.Info("[ProjectService] STEP 3: Snapshot job queued: %s", job.ID)
+	} else {
+		ps.logger.Warn("[ProjectService] STEP 3 SKIPPED: No snapshot job manager configured")
+	}
 
 	ps.logger.Info("[ProjectService] CreateProjectWithSnapshot completed successfully: %s", projectID)
 	return &CreateProjectResponse{OK: true, ProjectID: projectID}, nil
 }
 
+// registerSigningKey registers this device's snapshot signing key for a project it just created
+// Failures only log: the key is registered again before the first snapshot upload
+func (ps *ProjectService) registerSigningKey(projectID, accessToken string) {
+	if ps.fileService == nil || ps.fileService.signer == nil {
+		return
+	}
+	if err := ps.fileService.RegisterSigningKey(projectID, accessToken, false); err != nil {
+		ps.logger.Warn("[ProjectService] Failed to register snapshot signing key: %v", err)
+	}
+}
+
 // GetProjectResponse is the response from getting project details
 type GetProjectResponse struct {
-	ProjectID string      `json:"projectId"`
-	Name      string      `json:"name"`
-	LocalPath string      `json:"localPath"`
-	Status    interface{} `json:"status,omitempty"`
+	ProjectID string       `json:"projectId"`
+	Name      string       `json:"name"`
+	LocalPath string       `json:"localPath"`
+	Status    interface{}  `json:"status,omitempty"`
+	Devices   []PeerStatus `json:"devices,omitempty"`
 }
 
 // GetProject gets project details with Syncthing status
@@ -203,10 +242,21 @@ func (ps *ProjectService) GetProject(ctx context.Context, projectID string) (*Ge
 		return nil, err
 	}
 
-	return &GetProjectResponse{
+	response := &GetProjectResponse{
 		ProjectID: projectID,
 		Status:    status,
-	}, nil
+	}
+
+	// Peer status is best-effort, folder status is what callers rely on
+	if ps.peerService != nil {
+		if peers, err := ps.peerService.GetProjectPeers(ctx, projectID); err == nil {
+			response.Devices = peers
+		} else {
+			ps.logger.Warn("[ProjectService] Failed to get peer status: %v", err)
+		}
+	}
+
+	return response, nil
 }
 
 // DeleteProject deletes a project and its Syncthing folder
@@ -220,6 +270,14 @@ func (ps *ProjectService) DeleteProject(ctx context.Context, projectID, accessTo
 		return err
 	}
 
+	ps.fileService.ForgetSnapshots(projectID)
+	if ps.scheduler != nil {
+		ps.scheduler.Forget(projectID)
+	}
+	if ps.jobs != nil {
+		ps.jobs.Forget(projectID)
+	}
+
 	ps.logger.Info("[ProjectService] Syncthing folder removed, notifying cloud...")
 
 	// Notify cloud about project deletion (non-blocking)
@@ -0,0 +1,173 @@
+package services
+
+import (
+	"time"
+
+	"github.com/vidsync/agent/internal/api"
+)
+
+// Snapshot document kinds
+const (
+	SnapshotKindFull  = "full"
+	SnapshotKindDelta = "delta"
+)
+
+// Delta entry operations
+const (
+	deltaAdded    = "added"
+	deltaModified = "modified"
+	deltaRemoved  = "removed"
+)
+
+const (
+	// maxSnapshotChain is how many deltas may follow a full snapshot before the next one is full again
+	maxSnapshotChain = 20
+	// maxDeltaRatio is the share of changed entries above which a full snapshot is cheaper than a delta
+	maxDeltaRatio = 0.5
+)
+
+// SnapshotDelta is the change set between a project's previous snapshot and its current files
+// Readers rebuild the full listing by applying it to the snapshot at BaseURL
+// The document's "added" and "modified" entry arrays and its "removed" path array are streamed after these fields
+type SnapshotDelta struct {
+	Kind        string      `json:"kind"`
+	ProjectID   string      `json:"projectId"`
+	CreatedAt   time.Time   `json:"createdAt"`
+	BaseURL     string      `json:"baseUrl"`
+	ChainLength int         `json:"chainLength"`
+	FileCount   int         `json:"fileCount"` // Totals of the resulting listing, not of the delta
+	TotalSize   int64       `json:"totalSize"`
+	SyncStatus  interface{} `json:"syncStatus"`
+}
+
+// deltaCounts is the number of entries a delta touches, by operation
+type deltaCounts struct {
+	Added    int
+	Modified int
+	Removed  int
+}
+
+// Total returns the number of entries the delta touches
+func (c deltaCounts) Total() int {
+	return c.Added + c.Modified + c.Removed
+}
+
+// diffListings merges two listings in walk order and calls fn for every added, modified or removed entry
+// Removed entries carry the previous version
+func diffListings(basePath, currentPath string, fn func(op string, f api.FileInfo) error) error {
+	return mergeListings(basePath, currentPath, func(old, cur *api.FileInfo) error {
+		switch {
+		case cur == nil:
+			return fn(deltaRemoved, *old)
+		case old == nil:
+			return fn(deltaAdded, *cur)
+		case fileChanged(*old, *cur):
+			return fn(deltaModified, *cur)
+		}
+		return nil
+	})
+}
+
+// mergeListings walks two listings in walk order side by side, calling fn once per path
+// old or cur is nil when the path is only in the other listing
+func mergeListings(basePath, currentPath string, fn func(old, cur *api.FileInfo) error) error {
+	base, err := openListing(basePath)
+	if err != nil {
+		return err
+	}
+	defer base.Close()
+
+	current, err := openListing(currentPath)
+	if err != nil {
+		return err
+	}
+	defer current.Close()
+
+	old, hasOld, err := base.Next()
+	if err != nil {
+		return err
+	}
+	cur, hasCur, err := current.Next()
+	if err != nil {
+		return err
+	}
+
+	for hasOld || hasCur {
+		order := 0
+		switch {
+		case !hasOld:
+			order = 1
+		case !hasCur:
+			order = -1
+		default:
+			order = compareWalkOrder(old.Path, cur.Path)
+		}
+
+		switch {
+		case order < 0:
+			err = fn(&old, nil)
+		case order > 0:
+			err = fn(nil, &cur)
+		default:
+			err = fn(&old, &cur)
+		}
+		if err != nil {
+			return err
+		}
+
+		if order <= 0 {
+			if old, hasOld, err = base.Next(); err != nil {
+				return err
+			}
+		}
+		if order >= 0 {
+			if cur, hasCur, err = current.Next(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// countDelta counts the changes between two listings
+func countDelta(basePath, currentPath string) (deltaCounts, error) {
+	var counts deltaCounts
+	err := diffListings(basePath, currentPath, func(op string, _ api.FileInfo) error {
+		switch op {
+		case deltaAdded:
+			counts.Added++
+		case deltaModified:
+			counts.Modified++
+		case deltaRemoved:
+			counts.Removed++
+		}
+		return nil
+	})
+	return counts, err
+}
+
+// fileChanged reports whether a listing entry differs from its previous version
+// Hashes are only compared when both sides have one, so turning hashing on doesn't touch every entry
+// Clip metadata appearing or disappearing counts, so readers pick it up once it is readable
+func fileChanged(old, cur api.FileInfo) bool {
+	return old.Size != cur.Size ||
+		old.IsDirectory != cur.IsDirectory ||
+		!old.ModTime.Equal(cur.ModTime) ||
+		(old.Hash != "" && cur.Hash != "" && old.Hash != cur.Hash) ||
+		(old.Media == nil) != (cur.Media == nil)
+}
+
+// snapshotFallbackReason returns why a snapshot must be uploaded in full, or "" if a delta is fine
+func snapshotFallbackReason(base *SnapshotBase, counts deltaCounts, fileCount int) string {
+	switch {
+	case base == nil:
+		return "no previous snapshot"
+	case base.SnapshotURL == "":
+		return "previous snapshot was never uploaded"
+	case base.ChainLength >= maxSnapshotChain:
+		return "delta chain too long"
+	case float64(counts.Total()) > maxDeltaRatio*float64(fileCount):
+		return "too many changes"
+	}
+	return ""
+}
@@ -0,0 +1,172 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/vidsync/agent/internal/api"
+	"github.com/vidsync/agent/internal/signing"
+)
+
+// snapshotDocument describes a snapshot JSON document that is generated while it is uploaded
+type snapshotDocument struct {
+	Kind        string
+	BaseURL     string // Delta base, "" for full snapshots
+	ChainLength int    // Deltas since the last full snapshot, including this one
+	FileCount   int
+	TotalSize   int64
+	Changes     int   // Entries the document lists
+	Size        int64 // Bytes of the document's JSON, 0 until Digest measures it
+
+	Signature *signing.Signature // Device signature of the document's JSON, nil if unsigned
+
+	header interface{}   // Top-level fields: *SnapshotMetadata or *SnapshotDelta
+	arrays []streamArray // Arrays written after the header fields
+}
+
+// streamArray is a JSON array field whose elements are produced one at a time
+type streamArray struct {
+	name string
+	each func(emit func(interface{}) error) error
+}
+
+// fullSnapshotDocument lists every entry of the listing at listingPath
+func fullSnapshotDocument(header *SnapshotMetadata, listingPath string) *snapshotDocument {
+	return &snapshotDocument{
+		Kind:      SnapshotKindFull,
+		FileCount: header.FileCount,
+		TotalSize: header.TotalSize,
+		Changes:   header.FileCount,
+		header:    header,
+		arrays: []streamArray{{
+			name: "files",
+			each: func(emit func(interface{}) error) error {
+				return eachListingEntry(listingPath, func(f api.FileInfo) error { return emit(f) })
+			},
+		}},
+	}
+}
+
+// deltaSnapshotDocument lists the changes between the listings at basePath and currentPath
+func deltaSnapshotDocument(header *SnapshotDelta, basePath, currentPath string) *snapshotDocument {
+	changes := func(op string, value func(api.FileInfo) interface{}) func(func(interface{}) error) error {
+		return func(emit func(interface{}) error) error {
+			return diffListings(basePath, currentPath, func(entryOp string, f api.FileInfo) error {
+				if entryOp != op {
+					return nil
+				}
+				return emit(value(f))
+			})
+		}
+	}
+	entry := func(f api.FileInfo) interface{} { return f }
+	path := func(f api.FileInfo) interface{} { return f.Path }
+
+	return &snapshotDocument{
+		Kind:        SnapshotKindDelta,
+		BaseURL:     header.BaseURL,
+		ChainLength: header.ChainLength,
+		FileCount:   header.FileCount,
+		TotalSize:   header.TotalSize,
+		header:      header,
+		arrays: []streamArray{
+			{name: deltaAdded, each: changes(deltaAdded, entry)},
+			{name: deltaModified, each: changes(deltaModified, entry)},
+			{name: deltaRemoved, each: changes(deltaRemoved, path)},
+		},
+	}
+}
+
+// WriteJSON writes the document as JSON
+func (d *snapshotDocument) WriteJSON(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	header, err := json.Marshal(d.header)
+	if err != nil {
+		return err
+	}
+	header = bytes.TrimSuffix(bytes.TrimSpace(header), []byte("}"))
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	for _, array := range d.arrays {
+		if _, err := fmt.Fprintf(bw, ",%q:[", array.name); err != nil {
+			return err
+		}
+		first := true
+		err := array.each(func(v interface{}) error {
+			data, err := json.Marshal(v)
+			if err != nil {
+				return err
+			}
+			if !first {
+				if err := bw.WriteByte(','); err != nil {
+					return err
+				}
+			}
+			first = false
+			_, err = bw.Write(data)
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		if err := bw.WriteByte(']'); err != nil {
+			return err
+		}
+	}
+
+	if err := bw.WriteByte('}'); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Digest returns the SHA-256 digest of the document's JSON, which is what gets signed
+func (d *snapshotDocument) Digest() ([]byte, error) {
+	h := sha256.New()
+	cw := &countingWriter{w: h}
+	if err := d.WriteJSON(cw); err != nil {
+		return nil, err
+	}
+	d.Size = cw.n
+	return h.Sum(nil), nil
+}
+
+// WriteGzip writes the document as gzipped JSON and returns the uncompressed and compressed sizes
+// progress, when set, receives the size of each piece of JSON as it is compressed
+func (d *snapshotDocument) WriteGzip(w io.Writer, progress func(int64)) (int64, int64, error) {
+	compressed := &countingWriter{w: w}
+	gz := gzip.NewWriter(compressed)
+	raw := &countingWriter{w: gz, add: progress}
+	if err := d.WriteJSON(raw); err != nil {
+		gz.Close()
+		return raw.n, compressed.n, err
+	}
+	if err := gz.Close(); err != nil {
+		return raw.n, compressed.n, err
+	}
+	return raw.n, compressed.n, nil
+}
+
+// countingWriter counts the bytes written through it, passing each write's size to add when set
+type countingWriter struct {
+	w   io.Writer
+	n   int64
+	add func(int64)
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	if cw.add != nil {
+		cw.add(int64(n))
+	}
+	return n, err
+}
@@ -0,0 +1,290 @@
+package services
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/vidsync/agent/internal/api"
+	"github.com/vidsync/agent/internal/encryption"
+)
+
+var (
+	// ErrEncryptionUnavailable is returned when no key store is configured
+	ErrEncryptionUnavailable = errors.New("snapshot encryption is not available")
+	// ErrSnapshotKeyMissing is returned when a snapshot is encrypted and the project has no key on this device
+	ErrSnapshotKeyMissing = errors.New("snapshot is encrypted and no key is set for the project")
+)
+
+// SnapshotKey is a project's snapshot encryption key, shared with project members outside the cloud
+type SnapshotKey struct {
+	ProjectID string `json:"projectId"`
+	Enabled   bool   `json:"enabled"`
+	Algorithm string `json:"algorithm,omitempty"`
+	KeyID     string `json:"keyId,omitempty"`
+	Key       string `json:"key,omitempty"` // Base64, only set by ExportSnapshotKey
+}
+
+// RemoteSnapshot is a project's cloud snapshot with its deltas applied
+type RemoteSnapshot struct {
+	ProjectID   string         `json:"projectId"`
+	SnapshotURL string         `json:"snapshotUrl"`
+	Encrypted   bool           `json:"encrypted"`
+	CreatedAt   time.Time      `json:"createdAt"`
+	FileCount   int            `json:"fileCount"`
+	TotalSize   int64          `json:"totalSize"`
+	Files       []api.FileInfo `json:"files"`
+}
+
+// remoteDocument is a downloaded snapshot document, full or delta
+type remoteDocument struct {
+	Kind      string         `json:"kind"`
+	BaseURL   string         `json:"baseUrl"`
+	CreatedAt time.Time      `json:"createdAt"`
+	FileCount int            `json:"fileCount"`
+	TotalSize int64          `json:"totalSize"`
+	Files     []api.FileInfo `json:"files"`
+	Added     []api.FileInfo `json:"added"`
+	Modified  []api.FileInfo `json:"modified"`
+	Removed   []string       `json:"removed"`
+}
+
+// GetSnapshotKey describes a project's snapshot encryption key without the key itself
+func (fs *FileService) GetSnapshotKey(projectID string) (*SnapshotKey, error) {
+	if fs.keys == nil {
+		return nil, ErrEncryptionUnavailable
+	}
+	key, err := fs.keys.Get(projectID)
+	if err != nil {
+		return nil, err
+	}
+	return snapshotKey(projectID, key), nil
+}
+
+// ExportSnapshotKey returns a project's snapshot encryption key, including the key, to share with members
+func (fs *FileService) ExportSnapshotKey(projectID string) (*SnapshotKey, error) {
+	if fs.keys == nil {
+		return nil, ErrEncryptionUnavailable
+	}
+	key, err := fs.keys.Get(projectID)
+	if err != nil {
+		return nil, err
+	}
+	result := snapshotKey(projectID, key)
+	if key != nil {
+		result.Key = base64.StdEncoding.EncodeToString(key)
+		fs.logger.Info("[FileService] Snapshot key %s of %s exported", result.KeyID, projectID)
+	}
+	return result, nil
+}
+
+// SetSnapshotKey encrypts a project's snapshots with key from now on, generating a key when none is given
+// Owners generate the key; members import the one the owner shares with them
+func (fs *FileService) SetSnapshotKey(projectID string, key []byte) (*SnapshotKey, error) {
+	if fs.keys == nil {
+		return nil, ErrEncryptionUnavailable
+	}
+	if key == nil {
+		var err error
+		if key, err = encryption.NewKey(); err != nil {
+			return nil, err
+		}
+	}
+	if len(key) != encryption.KeySize {
+		return nil, fmt.Errorf("snapshot key must be %d bytes", encryption.KeySize)
+	}
+	if err := fs.keys.Set(projectID, key); err != nil {
+		return nil, err
+	}
+	fs.resetSnapshotBase(projectID)
+
+	fs.logger.Info("[FileService] Snapshot encryption enabled for %s (key %s)", projectID, encryption.KeyID(key))
+	return snapshotKey(projectID, key), nil
+}
+
+// DeleteSnapshotKey stops encrypting a project's snapshots and forgets its key
+func (fs *FileService) DeleteSnapshotKey(projectID string) error {
+	if fs.keys == nil {
+		return ErrEncryptionUnavailable
+	}
+	if err := fs.keys.Delete(projectID); err != nil {
+		return err
+	}
+	fs.resetSnapshotBase(projectID)
+	fs.logger.Info("[FileService] Snapshot encryption disabled for %s", projectID)
+	return nil
+}
+
+// resetSnapshotBase makes the next upload a full snapshot, so a delta never builds on a differently encrypted base
+func (fs *FileService) resetSnapshotBase(projectID string) {
+	if fs.snapshots == nil {
+		return
+	}
+	if err := fs.snapshots.Delete(projectID); err != nil {
+		fs.logger.Warn("[FileService] Failed to remove snapshot base: %v", err)
+	}
+}
+
+func snapshotKey(projectID string, key []byte) *SnapshotKey {
+	if key == nil {
+		return &SnapshotKey{ProjectID: projectID}
+	}
+	return &SnapshotKey{
+		ProjectID: projectID,
+		Enabled:   true,
+		Algorithm: encryption.Algorithm,
+		KeyID:     encryption.KeyID(key),
+	}
+}
+
+// snapshotKeyFor returns the key a project's snapshots are encrypted with, nil to upload them in the clear
+func (fs *FileService) snapshotKeyFor(projectID string) ([]byte, error) {
+	if fs.keys == nil {
+		return nil, nil
+	}
+	return fs.keys.Get(projectID)
+}
+
+// GetRemoteSnapshot downloads a project's cloud snapshot, decrypting it if needed, and applies its deltas
+func (fs *FileService) GetRemoteSnapshot(ctx context.Context, projectID, accessToken string) (*RemoteSnapshot, error) {
+	if accessToken == "" {
+		accessToken = fs.cloudClient.SessionToken()
+	}
+
+	snapshotURL, err := fs.cloudClient.GetProjectSnapshotURL(projectID, accessToken)
+	if err != nil {
+		fs.logger.Error("[FileService] Failed to get project snapshot: %v", err)
+		return nil, err
+	}
+	if snapshotURL == "" {
+		return nil, ErrSnapshotNotFound
+	}
+
+	// Collect the chain back to its full snapshot, newest first
+	var chain []*remoteDocument
+	encrypted := false
+	for url := snapshotURL; url != ""; {
+		if len(chain) == maxVerifyChain {
+			return nil, fmt.Errorf("snapshot delta chain longer than %d", maxVerifyChain)
+		}
+		doc, enc, err := fs.loadRemoteDocument(ctx, projectID, url)
+		if err != nil {
+			return nil, err
+		}
+		encrypted = encrypted || enc
+		chain = append(chain, doc)
+		if doc.Kind != SnapshotKindDelta {
+			break
+		}
+		url = doc.BaseURL
+	}
+
+	files := chain[len(chain)-1].Files
+	for i := len(chain) - 2; i >= 0; i-- {
+		files = applyRemoteDelta(files, chain[i])
+	}
+	if files == nil {
+		files = []api.FileInfo{}
+	}
+
+	return &RemoteSnapshot{
+		ProjectID:   projectID,
+		SnapshotURL: snapshotURL,
+		Encrypted:   encrypted,
+		CreatedAt:   chain[0].CreatedAt,
+		FileCount:   chain[0].FileCount,
+		TotalSize:   chain[0].TotalSize,
+		Files:       files,
+	}, nil
+}
+
+// loadRemoteDocument downloads and parses one snapshot document
+func (fs *FileService) loadRemoteDocument(ctx context.Context, projectID, url string) (*remoteDocument, bool, error) {
+	body, encrypted, err := fs.openSnapshot(ctx, projectID, url)
+	if err != nil {
+		return nil, false, err
+	}
+	defer body.Close()
+
+	var doc remoteDocument
+	if err := json.NewDecoder(body).Decode(&doc); err != nil {
+		return nil, false, fmt.Errorf("failed to parse snapshot %s: %w", url, err)
+	}
+	return &doc, encrypted, nil
+}
+
+// applyRemoteDelta rebuilds a listing from its previous version and a delta, keeping the previous order
+func applyRemoteDelta(files []api.FileInfo, delta *remoteDocument) []api.FileInfo {
+	removed := make(map[string]bool, len(delta.Removed))
+	for _, path := range delta.Removed {
+		removed[path] = true
+	}
+	modified := make(map[string]api.FileInfo, len(delta.Modified))
+	for _, f := range delta.Modified {
+		modified[f.Path] = f
+	}
+
+	out := make([]api.FileInfo, 0, len(files)+len(delta.Added))
+	for _, f := range files {
+		if removed[f.Path] {
+			continue
+		}
+		if m, ok := modified[f.Path]; ok {
+			f = m
+		}
+		out = append(out, f)
+	}
+	return append(out, delta.Added...)
+}
+
+// openSnapshot downloads a snapshot document and returns its JSON, decrypted and decompressed
+// Reports whether the document was encrypted
+func (fs *FileService) openSnapshot(ctx context.Context, projectID, url string) (io.ReadCloser, bool, error) {
+	body, err := fs.cloudClient.Download(ctx, url)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to download snapshot %s: %w", url, err)
+	}
+
+	br := bufio.NewReader(body)
+	var compressed io.Reader = br
+	head, _ := br.Peek(encryption.MagicSize)
+	encrypted := encryption.IsEncrypted(head)
+	if encrypted {
+		key, err := fs.snapshotKeyFor(projectID)
+		if err != nil {
+			body.Close()
+			return nil, false, err
+		}
+		if key == nil {
+			body.Close()
+			return nil, false, ErrSnapshotKeyMissing
+		}
+		if compressed, err = encryption.NewReader(br, key); err != nil {
+			body.Close()
+			return nil, false, fmt.Errorf("failed to decrypt snapshot %s: %w", url, err)
+		}
+	}
+
+	gz, err := gzip.NewReader(compressed)
+	if err != nil {
+		body.Close()
+		return nil, false, fmt.Errorf("failed to read snapshot %s: %w", url, err)
+	}
+	return &snapshotReader{Reader: gz, body: body}, encrypted, nil
+}
+
+// snapshotReader reads a decompressed snapshot and closes its download
+type snapshotReader struct {
+	io.Reader
+	body io.Closer
+}
+
+func (r *snapshotReader) Close() error {
+	return r.body.Close()
+}
@@ -0,0 +1,375 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	stdsync "sync"
+	"time"
+
+	"github.com/vidsync/agent/internal/api"
+)
+
+// ErrSnapshotNotFound is returned when a snapshot reference matches no kept snapshot
+var ErrSnapshotNotFound = errors.New("snapshot not found")
+
+// snapshotIDFormat names snapshots after their creation time, so IDs sort chronologically
+// Snapshots taken in the same millisecond get a "-01" to "-99" suffix, which keeps the order
+const snapshotIDFormat = "20060102T150405.000Z"
+
+// maxSnapshotIDSuffix is how many snapshots can share a millisecond
+const maxSnapshotIDSuffix = 99
+
+// SnapshotRecord describes a snapshot kept in the local history
+type SnapshotRecord struct {
+	ID          string    `json:"id"`
+	ProjectID   string    `json:"projectId"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Kind        string    `json:"kind"`                  // How it was uploaded: full or delta
+	SnapshotURL string    `json:"snapshotUrl,omitempty"` // Empty when the upload failed
+	FileCount   int       `json:"fileCount"`
+	TotalSize   int64     `json:"totalSize"`
+}
+
+// SnapshotHistory keeps the listings of each project's last snapshots on disk
+type SnapshotHistory struct {
+	dir  string
+	keep int
+	mu   stdsync.Mutex
+}
+
+// NewSnapshotHistory creates a history rooted at dir that keeps the last keep snapshots per project
+func NewSnapshotHistory(dir string, keep int) *SnapshotHistory {
+	return &SnapshotHistory{dir: dir, keep: keep}
+}
+
+// projectDir returns the directory holding a project's snapshots
+func (h *SnapshotHistory) projectDir(projectID string) string {
+	return filepath.Join(h.dir, filepath.Base(projectID))
+}
+
+// ListingPath returns the file holding a kept snapshot's entries
+func (h *SnapshotHistory) ListingPath(projectID, id string) string {
+	return filepath.Join(h.projectDir(projectID), id+".jsonl.gz")
+}
+
+// Record adds a snapshot whose entries are in listingPath, dropping the oldest beyond the limit
+// The listing is linked, or copied where linking isn't possible, so the caller keeps its file
+func (h *SnapshotHistory) Record(rec *SnapshotRecord, listingPath string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	dir := h.projectDir(rec.ProjectID)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	id, target, err := h.claimListingLocked(rec.ProjectID, rec.CreatedAt, listingPath)
+	if err != nil {
+		return err
+	}
+	rec.ID = id
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		os.Remove(target)
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, rec.ID+".json"), data, 0600); err != nil {
+		os.Remove(target)
+		return err
+	}
+
+	return h.pruneLocked(rec.ProjectID)
+}
+
+// claimListingLocked places the listing under the first free ID for createdAt
+// Listings are never replaced: a taken ID fails the link or exclusive create, and the next suffix is tried
+func (h *SnapshotHistory) claimListingLocked(projectID string, createdAt time.Time, listingPath string) (string, string, error) {
+	base := createdAt.UTC().Format(snapshotIDFormat)
+	for n := 0; n <= maxSnapshotIDSuffix; n++ {
+		id := base
+		if n > 0 {
+			id = fmt.Sprintf("%s-%02d", base, n)
+		}
+		target := h.ListingPath(projectID, id)
+		err := os.Link(listingPath, target)
+		if err != nil && !errors.Is(err, fs.ErrExist) {
+			err = copyFile(listingPath, target)
+		}
+		if errors.Is(err, fs.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", "", err
+		}
+		return id, target, nil
+	}
+	return "", "", fmt.Errorf("more than %d snapshots at %s", maxSnapshotIDSuffix+1, base)
+}
+
+// List returns a project's kept snapshots, newest first
+func (h *SnapshotHistory) List(projectID string) ([]SnapshotRecord, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.listLocked(projectID)
+}
+
+// Resolve finds a kept snapshot by ID, or the newest one taken at or before a time
+// ref is a snapshot ID, "latest", an RFC 3339 time, or a date (meaning the end of that day, local time)
+func (h *SnapshotHistory) Resolve(projectID, ref string) (*SnapshotRecord, error) {
+	records, err := h.List(projectID)
+	if err != nil {
+		return nil, err
+	}
+
+	if ref == "" || ref == "latest" {
+		if len(records) == 0 {
+			return nil, ErrSnapshotNotFound
+		}
+		return &records[0], nil
+	}
+
+	for i := range records {
+		if records[i].ID == ref {
+			return &records[i], nil
+		}
+	}
+
+	var at time.Time
+	if t, err := time.Parse(time.RFC3339, ref); err == nil {
+		at = t
+	} else if d, err := time.ParseInLocation("2006-01-02", ref, time.Local); err == nil {
+		at = d.AddDate(0, 0, 1).Add(-time.Nanosecond)
+	} else {
+		return nil, ErrSnapshotNotFound
+	}
+	for i := range records {
+		if !records[i].CreatedAt.After(at) {
+			return &records[i], nil
+		}
+	}
+	return nil, ErrSnapshotNotFound
+}
+
+// Delete removes all kept snapshots of a project
+func (h *SnapshotHistory) Delete(projectID string) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return os.RemoveAll(h.projectDir(projectID))
+}
+
+func (h *SnapshotHistory) listLocked(projectID string) ([]SnapshotRecord, error) {
+	matches, err := filepath.Glob(filepath.Join(h.projectDir(projectID), "*.json"))
+	if err != nil {
+		return nil, err
+	}
+
+	records := []SnapshotRecord{}
+	for _, path := range matches {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var rec SnapshotRecord
+		if err := json.Unmarshal(data, &rec); err != nil {
+			continue
+		}
+		if _, err := os.Stat(h.ListingPath(projectID, rec.ID)); err != nil {
+			continue // Listing lost, nothing to diff against
+		}
+		records = append(records, rec)
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].ID > records[j].ID
+	})
+	return records, nil
+}
+
+// pruneLocked removes a project's snapshots beyond the kept number
+func (h *SnapshotHistory) pruneLocked(projectID string) error {
+	records, err := h.listLocked(projectID)
+	if err != nil || len(records) <= h.keep {
+		return err
+	}
+	for _, rec := range records[h.keep:] {
+		os.Remove(filepath.Join(h.projectDir(projectID), rec.ID+".json"))
+		os.Remove(h.ListingPath(projectID, rec.ID))
+	}
+	return nil
+}
+
+// copyFile copies src to a new file at dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		os.Remove(dst)
+		return err
+	}
+	return out.Close()
+}
+
+// SnapshotDiff is what changed between two kept snapshots
+type SnapshotDiff struct {
+	ProjectID string          `json:"projectId"`
+	From      *SnapshotRecord `json:"from"`
+	To        *SnapshotRecord `json:"to"`
+	Added     []api.FileInfo  `json:"added"`
+	Removed   []api.FileInfo  `json:"removed"`
+	Modified  []ModifiedFile  `json:"modified"`
+	Moved     []MovedFile     `json:"moved"`
+	Summary   DiffSummary     `json:"summary"`
+}
+
+// ModifiedFile is an entry whose content or metadata changed
+type ModifiedFile struct {
+	Path      string       `json:"path"`
+	SizeDelta int64        `json:"sizeDelta"`
+	Before    api.FileInfo `json:"before"`
+	After     api.FileInfo `json:"after"`
+}
+
+// MovedFile is a file that disappeared from one path and appeared unchanged at another
+type MovedFile struct {
+	From string       `json:"from"`
+	To   string       `json:"to"`
+	File api.FileInfo `json:"file"`
+}
+
+// DiffSummary counts the changes of a diff
+type DiffSummary struct {
+	Added     int   `json:"added"`
+	Removed   int   `json:"removed"`
+	Modified  int   `json:"modified"`
+	Moved     int   `json:"moved"`
+	SizeDelta int64 `json:"sizeDelta"` // Change in total size of the files
+}
+
+// diffSnapshotListings compares two listings, pairing removed and added files that look like the same file as moves
+// Files with content hashes on both sides are paired by hash, others by name, size and modification time
+func diffSnapshotListings(fromPath, toPath string) (*SnapshotDiff, error) {
+	diff := &SnapshotDiff{
+		Added:    []api.FileInfo{},
+		Removed:  []api.FileInfo{},
+		Modified: []ModifiedFile{},
+		Moved:    []MovedFile{},
+	}
+
+	err := mergeListings(fromPath, toPath, func(old, cur *api.FileInfo) error {
+		switch {
+		case old == nil:
+			diff.Added = append(diff.Added, *cur)
+		case cur == nil:
+			diff.Removed = append(diff.Removed, *old)
+		case fileChanged(*old, *cur):
+			diff.Modified = append(diff.Modified, ModifiedFile{Path: cur.Path, SizeDelta: cur.Size - old.Size, Before: *old, After: *cur})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	pairMoves(diff)
+
+	diff.Summary = DiffSummary{
+		Added:    len(diff.Added),
+		Removed:  len(diff.Removed),
+		Modified: len(diff.Modified),
+		Moved:    len(diff.Moved),
+	}
+	for _, f := range diff.Added {
+		if !f.IsDirectory {
+			diff.Summary.SizeDelta += f.Size
+		}
+	}
+	for _, f := range diff.Removed {
+		if !f.IsDirectory {
+			diff.Summary.SizeDelta -= f.Size
+		}
+	}
+	for _, m := range diff.Modified {
+		if !m.After.IsDirectory {
+			diff.Summary.SizeDelta += m.SizeDelta
+		}
+	}
+	return diff, nil
+}
+
+// pairMoves turns removed and added files that match into moves
+func pairMoves(diff *SnapshotDiff) {
+	removedBy := make(map[string][]int)
+	for i, f := range diff.Removed {
+		if f.IsDirectory {
+			continue
+		}
+		for _, key := range moveKeys(f) {
+			removedBy[key] = append(removedBy[key], i)
+		}
+	}
+
+	moved := make(map[int]bool) // Indexes into Removed
+	added := diff.Added[:0]
+	for _, f := range diff.Added {
+		from := -1
+		if !f.IsDirectory {
+		match:
+			for _, key := range moveKeys(f) {
+				for _, i := range removedBy[key] {
+					if !moved[i] && !hashesDiffer(f, diff.Removed[i]) {
+						from = i
+						break match
+					}
+				}
+			}
+		}
+		if from < 0 {
+			added = append(added, f)
+			continue
+		}
+		moved[from] = true
+		diff.Moved = append(diff.Moved, MovedFile{From: diff.Removed[from].Path, To: f.Path, File: f})
+	}
+	diff.Added = added
+
+	removed := diff.Removed[:0]
+	for i, f := range diff.Removed {
+		if !moved[i] {
+			removed = append(removed, f)
+		}
+	}
+	diff.Removed = removed
+}
+
+// moveKeys returns the keys under which a file is matched against files at other paths, strongest first
+// A file keeping its name is preferred over a renamed one with the same size and modification time,
+// which only pairs files that both lack a hash
+func moveKeys(f api.FileInfo) []string {
+	name := fmt.Sprintf("name:%s:%d:%d", strings.ToLower(filepath.Base(f.Path)), f.Size, f.ModTime.UnixNano())
+	if f.Hash != "" {
+		return []string{fmt.Sprintf("hash:%s:%d", f.Hash, f.Size), name}
+	}
+	return []string{name, fmt.Sprintf("meta:%d:%d", f.Size, f.ModTime.UnixNano())}
+}
+
+// hashesDiffer reports whether two files are both hashed with different content
+func hashesDiffer(a, b api.FileInfo) bool {
+	return a.Hash != "" && b.Hash != "" && a.Hash != b.Hash
+}
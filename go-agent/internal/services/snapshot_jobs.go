@@ -0,0 +1,452 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	stdsync "sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/vidsync/agent/internal/api"
+	"github.com/vidsync/agent/internal/jobs"
+	"github.com/vidsync/agent/internal/util"
+)
+
+// Snapshot job triggers
+const (
+	TriggerAPI           = "api"
+	TriggerProjectCreate = "project-create"
+	TriggerScheduler     = "scheduler"
+)
+
+const (
+	snapshotJobKind = "snapshot"
+	// keepFinishedJobs is how many finished jobs are kept per project
+	keepFinishedJobs = 20
+	// jobTokenRetry is how often a job without an access token checks for a signed-in user
+	jobTokenRetry = 15 * time.Second
+	// jobCancelWait is how long a cancellation waits for the job to wind down before answering
+	jobCancelWait = 10 * time.Second
+)
+
+var (
+	// ErrJobNotFound is returned when a project has no job with the requested ID
+	ErrJobNotFound = errors.New("snapshot job not found")
+	// ErrJobFinished is returned when cancelling a job that already finished
+	ErrJobFinished = errors.New("snapshot job already finished")
+	// ErrJobUserChanged fails a job whose only access token belongs to another user than the one it was queued for
+	ErrJobUserChanged = errors.New("signed-in user changed since the snapshot job was queued")
+)
+
+// snapshotJob is a queued or running job
+type snapshotJob struct {
+	job       jobs.Job
+	token     string // Access token to upload with, "" for the signed-in user's
+	cancel    context.CancelFunc
+	cancelled bool // Cancelled on request, as opposed to stopped by shutdown
+	done      chan struct{}
+}
+
+// SnapshotJobManager runs snapshot generation as background jobs
+// A project has at most one queued or running job, and at most a fixed number of jobs run at once
+// Jobs are persisted so those interrupted by a restart are resumed
+type SnapshotJobManager struct {
+	fileService *FileService
+	cloudClient *api.CloudClient
+	logger      *util.Logger
+	store       *jobs.Store // nil to keep jobs in memory only
+	slots       chan struct{}
+
+	mu       stdsync.Mutex
+	ctx      context.Context
+	emitter  EventEmitter
+	active   map[string]*snapshotJob // Queued and running jobs by ID
+	projects map[string]*snapshotJob // Queued or running job of each project
+	recent   []jobs.Job              // Finished jobs, kept when there is no store
+}
+
+// NewSnapshotJobManager creates a job manager running at most concurrency jobs at once
+func NewSnapshotJobManager(fileService *FileService, cloudClient *api.CloudClient, logger *util.Logger, concurrency int) *SnapshotJobManager {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	return &SnapshotJobManager{
+		fileService: fileService,
+		cloudClient: cloudClient,
+		logger:      logger,
+		slots:       make(chan struct{}, concurrency),
+		ctx:         context.Background(),
+		active:      make(map[string]*snapshotJob),
+		projects:    make(map[string]*snapshotJob),
+	}
+}
+
+// SetStore persists jobs in store
+func (m *SnapshotJobManager) SetStore(store *jobs.Store) {
+	m.store = store
+}
+
+// Start resumes the jobs that were unfinished when the agent stopped
+// Jobs run until ctx is done; jobs stopped that way are resumed on the next start
+func (m *SnapshotJobManager) Start(ctx context.Context, emitter EventEmitter) {
+	m.mu.Lock()
+	m.ctx = ctx
+	m.emitter = emitter
+	m.mu.Unlock()
+
+	if m.store == nil {
+		return
+	}
+	unfinished, err := m.store.Unfinished()
+	if err != nil {
+		m.logger.Error("[SnapshotJobs] Failed to load unfinished jobs: %v", err)
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, job := range unfinished {
+		if _, busy := m.projects[job.ProjectID]; busy {
+			now := time.Now()
+			job.Status = jobs.StatusCancelled
+			job.Error = "superseded by another job of the project"
+			job.FinishedAt = &now
+			m.saveLocked(&job)
+			continue
+		}
+		job.Status = jobs.StatusQueued
+		job.Error = ""
+		m.logger.Info("[SnapshotJobs] Resuming snapshot job %s of %s", job.ID, job.ProjectID)
+		m.startLocked(&snapshotJob{job: job})
+	}
+}
+
+// Submit queues a snapshot of a project, or returns the project's queued or running job
+// Reports whether a new job was created; accessToken may be "" to upload as the signed-in user
+func (m *SnapshotJobManager) Submit(projectID, accessToken, trigger string) (*jobs.Job, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if sj, ok := m.projects[projectID]; ok {
+		if sj.token == "" {
+			sj.token = accessToken
+		}
+		job := sj.job
+		return &job, false
+	}
+
+	sj := &snapshotJob{
+		job: jobs.Job{
+			ID:        uuid.New().String(),
+			ProjectID: projectID,
+			Kind:      snapshotJobKind,
+			Trigger:   trigger,
+			UserID:    api.TokenUserID(accessToken),
+			Status:    jobs.StatusQueued,
+			CreatedAt: time.Now(),
+		},
+		token: accessToken,
+	}
+	m.logger.Info("[SnapshotJobs] Queued snapshot job %s of %s (%s)", sj.job.ID, projectID, trigger)
+	m.startLocked(sj)
+
+	job := sj.job
+	return &job, true
+}
+
+// Get returns one of a project's jobs
+func (m *SnapshotJobManager) Get(projectID, id string) (*jobs.Job, error) {
+	m.mu.Lock()
+	if sj, ok := m.active[id]; ok && sj.job.ProjectID == projectID {
+		job := sj.job
+		m.mu.Unlock()
+		return &job, nil
+	}
+	for i := len(m.recent) - 1; i >= 0; i-- {
+		if m.recent[i].ID == id && m.recent[i].ProjectID == projectID {
+			job := m.recent[i]
+			m.mu.Unlock()
+			return &job, nil
+		}
+	}
+	m.mu.Unlock()
+
+	if m.store == nil {
+		return nil, ErrJobNotFound
+	}
+	job, err := m.store.Get(id)
+	if errors.Is(err, jobs.ErrNotFound) || (err == nil && job.ProjectID != projectID) {
+		return nil, ErrJobNotFound
+	}
+	return job, err
+}
+
+// List returns a project's recent jobs, newest first
+func (m *SnapshotJobManager) List(projectID string) ([]jobs.Job, error) {
+	if m.store != nil {
+		return m.store.List(projectID, keepFinishedJobs+1)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := []jobs.Job{}
+	if sj, ok := m.projects[projectID]; ok {
+		list = append(list, sj.job)
+	}
+	for i := len(m.recent) - 1; i >= 0; i-- {
+		if m.recent[i].ProjectID == projectID {
+			list = append(list, m.recent[i])
+		}
+	}
+	return list, nil
+}
+
+// Cancel stops a queued or running job and returns its final state
+func (m *SnapshotJobManager) Cancel(projectID, id string) (*jobs.Job, error) {
+	m.mu.Lock()
+	sj, ok := m.active[id]
+	if !ok || sj.job.ProjectID != projectID {
+		m.mu.Unlock()
+		job, err := m.Get(projectID, id)
+		if err != nil {
+			return nil, err
+		}
+		return job, ErrJobFinished
+	}
+	sj.cancelled = true
+	sj.cancel()
+	m.mu.Unlock()
+
+	m.logger.Info("[SnapshotJobs] Cancelling snapshot job %s of %s", id, projectID)
+	select {
+	case <-sj.done:
+	case <-time.After(jobCancelWait):
+	}
+	return m.Get(projectID, id)
+}
+
+// Wait blocks until a job finishes and returns its final state
+func (m *SnapshotJobManager) Wait(ctx context.Context, projectID, id string) (*jobs.Job, error) {
+	m.mu.Lock()
+	sj, ok := m.active[id]
+	m.mu.Unlock()
+	if !ok {
+		return m.Get(projectID, id)
+	}
+
+	select {
+	case <-sj.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	job := sj.job
+	return &job, nil
+}
+
+// Forget cancels a removed project's job and drops its job history
+func (m *SnapshotJobManager) Forget(projectID string) {
+	m.mu.Lock()
+	if sj, ok := m.projects[projectID]; ok {
+		sj.cancelled = true
+		sj.cancel()
+	}
+	recent := m.recent[:0]
+	for _, job := range m.recent {
+		if job.ProjectID != projectID {
+			recent = append(recent, job)
+		}
+	}
+	m.recent = recent
+	m.mu.Unlock()
+
+	if m.store != nil {
+		if err := m.store.Delete(projectID); err != nil {
+			m.logger.Warn("[SnapshotJobs] Failed to remove jobs of %s: %v", projectID, err)
+		}
+	}
+}
+
+// startLocked registers a queued job and starts its goroutine
+func (m *SnapshotJobManager) startLocked(sj *snapshotJob) {
+	ctx, cancel := context.WithCancel(m.ctx)
+	sj.cancel = cancel
+	sj.done = make(chan struct{})
+	m.active[sj.job.ID] = sj
+	m.projects[sj.job.ProjectID] = sj
+	m.saveLocked(&sj.job)
+	emit(m.emitter, sj.job.ProjectID, "snapshotJobQueued", "", "", map[string]interface{}{"job": sj.job})
+
+	go m.run(ctx, sj)
+}
+
+// run waits for an access token and a free slot, then generates the snapshot
+func (m *SnapshotJobManager) run(ctx context.Context, sj *snapshotJob) {
+	defer close(sj.done)
+	defer sj.cancel()
+
+	token, err := m.waitForToken(ctx, sj)
+	if err == nil {
+		err = m.checkUser(sj, token)
+	}
+	if err != nil {
+		m.finish(sj, nil, err)
+		return
+	}
+
+	select {
+	case m.slots <- struct{}{}:
+	case <-ctx.Done():
+		m.finish(sj, nil, ctx.Err())
+		return
+	}
+	defer func() { <-m.slots }()
+
+	m.mu.Lock()
+	now := time.Now()
+	sj.job.Status = jobs.StatusRunning
+	sj.job.Attempts++
+	sj.job.StartedAt = &now
+	m.saveLocked(&sj.job)
+	job := sj.job
+	m.mu.Unlock()
+	emit(m.emitter, job.ProjectID, "snapshotJobStarted", "", "", map[string]interface{}{"job": job})
+
+	result, err := m.generate(ctx, job.ProjectID, token)
+	m.finish(sj, result, err)
+}
+
+// waitForToken returns the job's access token, waiting for a user to sign in if there is none
+func (m *SnapshotJobManager) waitForToken(ctx context.Context, sj *snapshotJob) (string, error) {
+	waiting := false
+	for {
+		m.mu.Lock()
+		token := sj.token
+		m.mu.Unlock()
+		if token == "" {
+			token = m.cloudClient.SessionToken()
+		}
+		if token != "" {
+			return token, nil
+		}
+
+		if !waiting {
+			m.logger.Info("[SnapshotJobs] Snapshot job %s is waiting for a signed-in user", sj.job.ID)
+			waiting = true
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(jobTokenRetry):
+		}
+	}
+}
+
+// checkUser binds the job to the user of token, or fails it if it was queued for another user
+// A resumed job must not upload one user's project snapshot with another user's session
+func (m *SnapshotJobManager) checkUser(sj *snapshotJob, token string) error {
+	userID := api.TokenUserID(token)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if sj.job.UserID == "" {
+		sj.job.UserID = userID
+		m.saveLocked(&sj.job)
+		return nil
+	}
+	if userID != sj.job.UserID {
+		return ErrJobUserChanged
+	}
+	return nil
+}
+
+// generate waits for Syncthing to finish scanning, then generates and uploads the project's snapshot
+func (m *SnapshotJobManager) generate(ctx context.Context, projectID, token string) (map[string]interface{}, error) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+	defer cancel()
+
+	if err := m.fileService.WaitForScanCompletion(ctx, projectID, 120); err != nil {
+		return nil, err
+	}
+	result, err := m.fileService.GenerateSnapshot(ctx, projectID, token)
+	if err != nil {
+		return nil, err
+	}
+	if url, _ := result["snapshotUrl"].(string); url == "" {
+		if uploadErr, _ := result["uploadError"].(string); uploadErr != "" {
+			return result, fmt.Errorf("snapshot generated but not uploaded: %s", uploadErr)
+		}
+		return result, fmt.Errorf("snapshot generated but not uploaded")
+	}
+	return result, nil
+}
+
+// finish records a job's outcome; jobs stopped by shutdown are left unfinished to be resumed
+func (m *SnapshotJobManager) finish(sj *snapshotJob, result map[string]interface{}, err error) {
+	m.mu.Lock()
+	if m.projects[sj.job.ProjectID] == sj {
+		delete(m.projects, sj.job.ProjectID)
+	}
+	delete(m.active, sj.job.ID)
+
+	if err != nil && !sj.cancelled && m.ctx.Err() != nil {
+		m.mu.Unlock()
+		m.logger.Info("[SnapshotJobs] Snapshot job %s of %s interrupted by shutdown, resuming on next start", sj.job.ID, sj.job.ProjectID)
+		return
+	}
+
+	now := time.Now()
+	job := &sj.job
+	job.FinishedAt = &now
+	if result != nil {
+		job.SnapshotURL, _ = result["snapshotUrl"].(string)
+		job.FileCount, _ = result["fileCount"].(int)
+		job.TotalSize, _ = result["totalSize"].(int64)
+	}
+	eventType := "snapshotJobCompleted"
+	switch {
+	case sj.cancelled:
+		job.Status = jobs.StatusCancelled
+		job.Error = "cancelled"
+		eventType = "snapshotJobCancelled"
+	case err != nil:
+		job.Status = jobs.StatusFailed
+		job.Error = err.Error()
+		eventType = "snapshotJobFailed"
+	default:
+		job.Status = jobs.StatusCompleted
+	}
+	m.saveLocked(job)
+	if m.store != nil {
+		if err := m.store.Prune(job.ProjectID, keepFinishedJobs); err != nil {
+			m.logger.Warn("[SnapshotJobs] Failed to prune jobs of %s: %v", job.ProjectID, err)
+		}
+	} else {
+		m.recent = append(m.recent, *job)
+		if len(m.recent) > 5*keepFinishedJobs {
+			m.recent = m.recent[1:]
+		}
+	}
+	final := *job
+	m.mu.Unlock()
+
+	if err != nil && !sj.cancelled {
+		m.logger.Warn("[SnapshotJobs] Snapshot job %s of %s failed: %v", final.ID, final.ProjectID, err)
+	} else {
+		m.logger.Info("[SnapshotJobs] Snapshot job %s of %s %s", final.ID, final.ProjectID, final.Status)
+	}
+	emit(m.emitter, final.ProjectID, eventType, "", final.Error, map[string]interface{}{"job": final})
+}
+
+// saveLocked persists a job's current state
+func (m *SnapshotJobManager) saveLocked(job *jobs.Job) {
+	if m.store == nil {
+		return
+	}
+	if err := m.store.Save(job); err != nil {
+		m.logger.Warn("[SnapshotJobs] Failed to save job %s: %v", job.ID, err)
+	}
+}
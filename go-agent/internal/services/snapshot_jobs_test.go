@@ -0,0 +1,84 @@
+package services
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"testing"
+
+	"github.com/vidsync/agent/internal/api"
+	"github.com/vidsync/agent/internal/jobs"
+	"github.com/vidsync/agent/internal/util"
+)
+
+// accessToken makes an unsigned JWT for a user; the agent only reads its subject
+func accessToken(userID string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"` + userID + `","role":"authenticated"}`))
+	return "eyJhbGciOiJIUzI1NiJ9." + payload + ".c2lnbmF0dXJl"
+}
+
+func newTestJobManager(t *testing.T) *SnapshotJobManager {
+	t.Helper()
+	m := NewSnapshotJobManager(nil, api.NewCloudClient("http://127.0.0.1:0", ""), util.NewLogger("test"), 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	m.Start(ctx, nil)
+	return m
+}
+
+func TestSnapshotJobSubmitDedupe(t *testing.T) {
+	m := newTestJobManager(t)
+
+	// Without a signed-in user jobs wait for a token, so they stay queued
+	first, created := m.Submit("p", "", TriggerScheduler)
+	if !created || first.Status != jobs.StatusQueued {
+		t.Fatalf("Submit = %+v, %v; want a new queued job", first, created)
+	}
+	again, created := m.Submit("p", "", TriggerAPI)
+	if created || again.ID != first.ID {
+		t.Errorf("second Submit = %s, %v; want the queued job %s", again.ID, created, first.ID)
+	}
+	other, created := m.Submit("q", "", TriggerAPI)
+	if !created || other.ID == first.ID {
+		t.Errorf("Submit of another project = %s, %v; want a job of its own", other.ID, created)
+	}
+
+	cancelled, err := m.Cancel("p", first.ID)
+	if err != nil || cancelled.Status != jobs.StatusCancelled {
+		t.Fatalf("Cancel = %+v, %v; want the job cancelled", cancelled, err)
+	}
+	if _, err := m.Cancel("p", first.ID); !errors.Is(err, ErrJobFinished) {
+		t.Errorf("Cancel of a finished job = %v, want ErrJobFinished", err)
+	}
+	next, created := m.Submit("p", "", TriggerAPI)
+	if !created || next.ID == first.ID {
+		t.Errorf("Submit after Cancel = %s, %v; want a new job", next.ID, created)
+	}
+}
+
+func TestSnapshotJobCheckUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		jobUser  string
+		token    string
+		wantUser string
+		wantErr  error
+	}{
+		{"new job takes the token's user", "", accessToken("user-1"), "user-1", nil},
+		{"same user", "user-1", accessToken("user-1"), "user-1", nil},
+		{"another user", "user-1", accessToken("user-2"), "user-1", ErrJobUserChanged},
+		{"unreadable token", "user-1", "not-a-jwt", "user-1", ErrJobUserChanged},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewSnapshotJobManager(nil, nil, util.NewLogger("test"), 1)
+			sj := &snapshotJob{job: jobs.Job{ID: "j", ProjectID: "p", UserID: tt.jobUser}}
+			if err := m.checkUser(sj, tt.token); !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkUser = %v, want %v", err, tt.wantErr)
+			}
+			if sj.job.UserID != tt.wantUser {
+				t.Errorf("job user = %q, want %q", sj.job.UserID, tt.wantUser)
+			}
+		})
+	}
+}
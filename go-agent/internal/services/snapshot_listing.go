@@ -0,0 +1,153 @@
+package services
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/vidsync/agent/internal/api"
+)
+
+// A listing is a project's file entries on disk: gzipped JSON, one api.FileInfo per line, in walk order
+// Snapshots are built from listings so memory use doesn't grow with the number of files
+
+// listingWriter appends entries to a listing file
+type listingWriter struct {
+	file *os.File
+	gz   *gzip.Writer
+	enc  *json.Encoder
+
+	FileCount int   // Entries written
+	TotalSize int64 // Sum of entry sizes
+}
+
+// createListing creates a listing file in dir, or in the system temp directory when dir is ""
+func createListing(dir string) (*listingWriter, error) {
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+	}
+	f, err := os.CreateTemp(dir, "listing-*.jsonl.gz")
+	if err != nil {
+		return nil, err
+	}
+	gz := gzip.NewWriter(f)
+	return &listingWriter{file: f, gz: gz, enc: json.NewEncoder(gz)}, nil
+}
+
+// Path returns the listing file's path
+func (lw *listingWriter) Path() string {
+	return lw.file.Name()
+}
+
+// Write appends one entry
+func (lw *listingWriter) Write(f api.FileInfo) error {
+	if err := lw.enc.Encode(f); err != nil {
+		return err
+	}
+	lw.FileCount++
+	lw.TotalSize += f.Size
+	return nil
+}
+
+// Close flushes the listing to disk
+func (lw *listingWriter) Close() error {
+	if err := lw.gz.Close(); err != nil {
+		lw.file.Close()
+		return err
+	}
+	return lw.file.Close()
+}
+
+// Discard closes and deletes the listing
+func (lw *listingWriter) Discard() {
+	lw.gz.Close()
+	lw.file.Close()
+	os.Remove(lw.file.Name())
+}
+
+// listingReader reads a listing file entry by entry
+type listingReader struct {
+	file *os.File
+	gz   *gzip.Reader
+	dec  *json.Decoder
+}
+
+// openListing opens a listing file for reading
+func openListing(path string) (*listingReader, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	gz, err := gzip.NewReader(bufio.NewReader(f))
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return &listingReader{file: f, gz: gz, dec: json.NewDecoder(gz)}, nil
+}
+
+// Next returns the next entry, or false at the end of the listing
+func (lr *listingReader) Next() (api.FileInfo, bool, error) {
+	var f api.FileInfo
+	if err := lr.dec.Decode(&f); err != nil {
+		if err == io.EOF {
+			return f, false, nil
+		}
+		return f, false, err
+	}
+	return f, true, nil
+}
+
+// Close closes the listing
+func (lr *listingReader) Close() error {
+	lr.gz.Close()
+	return lr.file.Close()
+}
+
+// eachListingEntry calls fn for every entry of the listing at path
+func eachListingEntry(path string, fn func(api.FileInfo) error) error {
+	lr, err := openListing(path)
+	if err != nil {
+		return err
+	}
+	defer lr.Close()
+
+	for {
+		f, ok, err := lr.Next()
+		if err != nil || !ok {
+			return err
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+}
+
+// compareWalkOrder orders paths the way WalkFiles visits them:
+// the folder itself first, then component by component so a directory's children follow it directly
+func compareWalkOrder(a, b string) int {
+	if a == b {
+		return 0
+	}
+	if a == "." {
+		return -1
+	}
+	if b == "." {
+		return 1
+	}
+
+	ac := strings.Split(filepath.ToSlash(a), "/")
+	bc := strings.Split(filepath.ToSlash(b), "/")
+	for i := 0; i < len(ac) && i < len(bc); i++ {
+		if c := strings.Compare(ac[i], bc[i]); c != 0 {
+			return c
+		}
+	}
+	return len(ac) - len(bc)
+}
@@ -1,53 +1,141 @@
 package services
 
 import (
+	"fmt"
+	"math"
+	"sort"
 	"sync"
 	"time"
+
+	"github.com/vidsync/agent/internal/api"
+)
+
+// Snapshot generation steps, in the order they happen
+const (
+	StepWaiting     = "waiting"
+	StepBrowsing    = "browsing"    // Walking the folder
+	StepHashing     = "hashing"     // Walking the folder and hashing file contents
+	StepCompressing = "compressing" // Preparing the snapshot document
+	StepUploading   = "uploading"   // Compressing the document while it is uploaded
+	StepCompleted   = "completed"
+	StepFailed      = "failed"
+)
+
+// stepNumbers numbers the steps for clients that show them as 1-6
+var stepNumbers = map[string]int{
+	StepWaiting:     1,
+	StepBrowsing:    2,
+	StepHashing:     3,
+	StepCompressing: 4,
+	StepUploading:   5,
+	StepCompleted:   6,
+}
+
+// Share of the overall progress each part of a run takes, in percent
+const (
+	scanShare    = 60 // Walking, and hashing when enabled
+	prepareShare = 5  // Building the document
+	uploadShare  = 35 // Compressing and uploading
+
+	compressShare = 0.2 // Part of the upload share spent compressing before anything is sent
+)
+
+const (
+	progressEmitInterval = 500 * time.Millisecond // Least time between events driven by counters
+	progressBufferSize   = 64                     // Events kept per project so streams can resume
+	progressRetention    = time.Minute            // How long a finished run can still be read
 )
 
 // SnapshotProgressEvent represents a progress update during snapshot generation
 type SnapshotProgressEvent struct {
-	ProjectID   string    `json:"projectId"`
-	Step        string    `json:"step"`                  // "waiting", "browsing", "compressing", "uploading", "completed", "failed"
-	StepNumber  int       `json:"stepNumber"`            // 1-6
-	TotalSteps  int       `json:"totalSteps"`            // Always 6
-	Progress    int       `json:"progress"`              // 0-100 overall percentage
-	FileCount   int       `json:"fileCount"`             // Current file count (if known)
-	TotalSize   int64     `json:"totalSize"`             // Current total size (if known)
-	Message     string    `json:"message"`               // Human-readable message
-	SnapshotURL string    `json:"snapshotUrl,omitempty"` // URL when completed
-	Error       string    `json:"error,omitempty"`       // Error message if failed
-	Timestamp   time.Time `json:"timestamp"`
+	ID               uint64    `json:"id"` // Increases across runs and restarts; the SSE event ID
+	ProjectID        string    `json:"projectId"`
+	Step             string    `json:"step"`                       // "waiting", "browsing", "hashing", "compressing", "uploading", "completed", "failed"
+	StepNumber       int       `json:"stepNumber"`                 // 1-6
+	TotalSteps       int       `json:"totalSteps"`                 // Always 6
+	Progress         int       `json:"progress"`                   // 0-100 overall percentage
+	FileCount        int       `json:"fileCount"`                  // Entries walked so far
+	TotalSize        int64     `json:"totalSize"`                  // Size of the entries walked so far
+	BytesHashed      int64     `json:"bytesHashed"`                // Size of the files hashed or served from the hash cache
+	BytesCompressed  int64     `json:"bytesCompressed"`            // Snapshot JSON fed to compression
+	BytesUploaded    int64     `json:"bytesUploaded"`              // Compressed, and encrypted if enabled, bytes sent
+	UploadSize       int64     `json:"uploadSize,omitempty"`       // Size of the snapshot JSON being uploaded
+	CompressedSize   int64     `json:"compressedSize,omitempty"`   // Size of the file being sent, once compressed
+	EntriesPerSecond float64   `json:"entriesPerSecond,omitempty"` // Walk rate, moving average
+	BytesPerSecond   float64   `json:"bytesPerSecond,omitempty"`   // Hashing or upload rate, moving average
+	ETASeconds       int       `json:"etaSeconds,omitempty"`       // Estimated time left, 0 when unknown
+	Message          string    `json:"message"`                    // Human-readable message
+	SnapshotURL      string    `json:"snapshotUrl,omitempty"`      // URL when completed
+	Error            string    `json:"error,omitempty"`            // Error message if failed
+	Timestamp        time.Time `json:"timestamp"`
+}
+
+// Finished reports whether the event ends its run
+func (e *SnapshotProgressEvent) Finished() bool {
+	return e.Step == StepCompleted || e.Step == StepFailed
 }
 
 // SnapshotProgressTracker tracks progress of snapshot generation
 type SnapshotProgressTracker struct {
 	mu          sync.RWMutex
-	trackers    map[string]*ProjectProgressTracker      // projectId -> tracker
-	subscribers map[string][]chan SnapshotProgressEvent // projectId -> list of subscribers
+	trackers    map[string]*ProjectProgressTracker // projectId -> tracker
+	subscribers map[string][]chan struct{}         // projectId -> list of subscribers, signalled on new events
+	lastID      uint64
 }
 
 // ProjectProgressTracker tracks progress for a single project
 type ProjectProgressTracker struct {
-	ProjectID    string
-	CurrentStep  string
-	StepNumber   int
-	FileCount    int
-	TotalSize    int64
-	StartTime    time.Time
-	EstimatedEnd time.Time
-	LastUpdate   time.Time
-	SnapshotURL  string
-	Error        string
-	IsComplete   bool
-	IsFailed     bool
+	ProjectID   string
+	CurrentStep string
+	Message     string
+	StartTime   time.Time
+	LastUpdate  time.Time
+	SnapshotURL string
+	Error       string
+	IsComplete  bool
+	IsFailed    bool
+
+	EntriesWalked   int
+	BytesWalked     int64
+	BytesHashed     int64
+	BytesCompressed int64
+	BytesUploaded   int64
+	UploadSize      int64
+	CompressedSize  int64
+
+	// Size of the previous snapshot, to estimate how far the walk has come; 0 when unknown
+	ExpectedEntries int
+	ExpectedBytes   int64
+
+	hashing       bool
+	walkDone      bool
+	hashableBytes int64   // Size of the walked files the hasher will read
+	progress      float64 // Percent reported last, never goes back within a run
+	rates         progressRates
+	lastEmit      time.Time
+	events        []SnapshotProgressEvent
+}
+
+// progressRates keeps moving averages of how fast a run advances
+type progressRates struct {
+	step     string
+	at       time.Time
+	progress float64
+	entries  int
+	bytes    int64
+
+	progressRate float64 // Percent per second
+	entryRate    float64
+	byteRate     float64
 }
 
 // NewSnapshotProgressTracker creates a new progress tracker
 func NewSnapshotProgressTracker() *SnapshotProgressTracker {
 	return &SnapshotProgressTracker{
 		trackers:    make(map[string]*ProjectProgressTracker),
-		subscribers: make(map[string][]chan SnapshotProgressEvent),
+		subscribers: make(map[string][]chan struct{}),
+		// Event IDs start at the current time so they keep increasing across agent restarts
+		lastID: uint64(time.Now().UnixMilli()),
 	}
 }
 
@@ -58,153 +146,146 @@ func (spt *SnapshotProgressTracker) StartTracking(projectID string) {
 
 	tracker := &ProjectProgressTracker{
 		ProjectID:   projectID,
-		CurrentStep: "waiting",
-		StepNumber:  1,
+		CurrentStep: StepWaiting,
 		StartTime:   time.Now(),
 		LastUpdate:  time.Now(),
 	}
-
 	spt.trackers[projectID] = tracker
-	spt.subscribers[projectID] = []chan SnapshotProgressEvent{}
+	spt.emit(tracker, time.Now())
 }
 
-// UpdateProgress updates progress for a project
-func (spt *SnapshotProgressTracker) UpdateProgress(projectID string, step string, stepNum int, fileCount int, totalSize int64, message string) {
-	spt.mu.Lock()
-	tracker, exists := spt.trackers[projectID]
-	if !exists {
-		spt.mu.Unlock()
-		return
-	}
+// Expect sets the size of the previous snapshot, against which the walk is measured
+func (spt *SnapshotProgressTracker) Expect(projectID string, entries int, totalSize int64) {
+	spt.update(projectID, false, func(t *ProjectProgressTracker) {
+		t.ExpectedEntries = entries
+		t.ExpectedBytes = totalSize
+	})
+}
 
-	tracker.CurrentStep = step
-	tracker.StepNumber = stepNum
-	tracker.FileCount = fileCount
-	tracker.TotalSize = totalSize
-	tracker.LastUpdate = time.Now()
-
-	// Calculate estimated time
-	if stepNum > 0 {
-		elapsed := time.Since(tracker.StartTime)
-		avgTimePerStep := elapsed / time.Duration(stepNum)
-		remainingSteps := 6 - stepNum
-		tracker.EstimatedEnd = time.Now().Add(avgTimePerStep * time.Duration(remainingSteps))
-	}
+// SetStep moves a project's run to step
+func (spt *SnapshotProgressTracker) SetStep(projectID string, step string, message string) {
+	spt.update(projectID, true, func(t *ProjectProgressTracker) {
+		t.CurrentStep = step
+		t.Message = message
+		if step == StepHashing {
+			t.hashing = true
+		}
+	})
+}
 
-	subscribers := spt.subscribers[projectID]
-	spt.mu.Unlock()
-
-	// Create and send event
-	// Calculate progress with better granularity
-	// Step 1: 10%, Step 2: 20%, Step 3: 50%, Step 4: 75%, Step 5: 95%, Step 6: 100%
-	var progressPct int
-	switch stepNum {
-	case 1:
-		progressPct = 10
-	case 2:
-		progressPct = 20
-	case 3:
-		progressPct = 50
-	case 4:
-		progressPct = 75
-	case 5:
-		progressPct = 95
-	case 6:
-		progressPct = 100
-	default:
-		progressPct = 0
-	}
+// AddWalked counts an entry found by the walk
+func (spt *SnapshotProgressTracker) AddWalked(projectID string, f api.FileInfo) {
+	spt.update(projectID, false, func(t *ProjectProgressTracker) {
+		t.EntriesWalked++
+		t.BytesWalked += f.Size
+		if !f.IsDirectory && f.Sequence == nil {
+			t.hashableBytes += f.Size
+		}
+	})
+}
 
-	event := SnapshotProgressEvent{
-		ProjectID:  projectID,
-		Step:       step,
-		StepNumber: stepNum,
-		TotalSteps: 6,
-		Progress:   progressPct,
-		FileCount:  fileCount,
-		TotalSize:  totalSize,
-		Message:    message,
-		Timestamp:  time.Now(),
-	}
+// FinishWalk records that every entry has been walked, so the walk no longer relies on estimates
+func (spt *SnapshotProgressTracker) FinishWalk(projectID string) {
+	spt.update(projectID, false, func(t *ProjectProgressTracker) {
+		t.walkDone = true
+	})
+}
 
-	// Broadcast to all subscribers
-	for _, ch := range subscribers {
-		select {
-		case ch <- event:
-		default:
-			// Don't block if subscriber is slow
-		}
-	}
+// SetHashed sets the size of the files hashed so far
+func (spt *SnapshotProgressTracker) SetHashed(projectID string, bytes int64) {
+	spt.update(projectID, false, func(t *ProjectProgressTracker) {
+		t.BytesHashed = bytes
+	})
 }
 
-// CompleteSnapshot marks snapshot generation as complete
-func (spt *SnapshotProgressTracker) CompleteSnapshot(projectID string, snapshotURL string) {
-	spt.mu.Lock()
-	tracker, exists := spt.trackers[projectID]
-	if !exists {
-		spt.mu.Unlock()
-		return
-	}
+// StartUpload resets the upload counters for an upload attempt of a document of size bytes
+func (spt *SnapshotProgressTracker) StartUpload(projectID string, size int64) {
+	spt.update(projectID, true, func(t *ProjectProgressTracker) {
+		t.UploadSize = size
+		t.CompressedSize = 0
+		t.BytesCompressed = 0
+		t.BytesUploaded = 0
+		t.rates.step = "" // The counters start over
+	})
+}
 
-	tracker.IsComplete = true
-	tracker.SnapshotURL = snapshotURL
-	tracker.LastUpdate = time.Now()
+// StartSending resets the sent bytes for sending a compressed file of size bytes
+func (spt *SnapshotProgressTracker) StartSending(projectID string, size int64) {
+	spt.update(projectID, true, func(t *ProjectProgressTracker) {
+		t.CompressedSize = size
+		t.BytesUploaded = 0
+		t.rates.step = ""
+	})
+}
 
-	subscribers := spt.subscribers[projectID]
-	spt.mu.Unlock()
+// AddCompressed counts snapshot JSON fed to compression
+func (spt *SnapshotProgressTracker) AddCompressed(projectID string, n int64) {
+	spt.update(projectID, false, func(t *ProjectProgressTracker) {
+		t.BytesCompressed += n
+	})
+}
 
-	// Send completion event
-	event := SnapshotProgressEvent{
-		ProjectID:   projectID,
-		Step:        "completed",
-		StepNumber:  6,
-		TotalSteps:  6,
-		Progress:    100,
-		SnapshotURL: snapshotURL,
-		Message:     "Snapshot generation completed successfully",
-		Timestamp:   time.Now(),
-	}
+// AddUploaded counts bytes sent to the cloud, negative when sent bytes were lost and will be sent again
+func (spt *SnapshotProgressTracker) AddUploaded(projectID string, n int64) {
+	spt.update(projectID, false, func(t *ProjectProgressTracker) {
+		t.BytesUploaded += n
+	})
+}
 
-	for _, ch := range subscribers {
-		select {
-		case ch <- event:
-		default:
-		}
-	}
+// CompleteSnapshot marks snapshot generation as complete
+func (spt *SnapshotProgressTracker) CompleteSnapshot(projectID string, snapshotURL string) {
+	spt.update(projectID, true, func(t *ProjectProgressTracker) {
+		t.IsComplete = true
+		t.SnapshotURL = snapshotURL
+	})
 }
 
 // FailSnapshot marks snapshot generation as failed
 func (spt *SnapshotProgressTracker) FailSnapshot(projectID string, errMsg string) {
+	spt.update(projectID, true, func(t *ProjectProgressTracker) {
+		t.IsFailed = true
+		t.Error = errMsg
+	})
+}
+
+// update applies change to a project's run and emits an event if one is due
+// force emits regardless of the throttle, for step changes and final states
+func (spt *SnapshotProgressTracker) update(projectID string, force bool, change func(t *ProjectProgressTracker)) {
 	spt.mu.Lock()
+	defer spt.mu.Unlock()
+
 	tracker, exists := spt.trackers[projectID]
-	if !exists {
-		spt.mu.Unlock()
+	if !exists || tracker.finished() {
 		return
 	}
 
-	tracker.IsFailed = true
-	tracker.Error = errMsg
-	tracker.LastUpdate = time.Now()
+	now := time.Now()
+	change(tracker)
+	tracker.LastUpdate = now
+	if force || now.Sub(tracker.lastEmit) >= progressEmitInterval {
+		spt.emit(tracker, now)
+	}
+}
 
-	subscribers := spt.subscribers[projectID]
-	spt.mu.Unlock()
+// emit records the run's current state as a new event and signals the subscribers; spt.mu must be held
+func (spt *SnapshotProgressTracker) emit(tracker *ProjectProgressTracker, now time.Time) {
+	if pct := tracker.percent(); pct > tracker.progress {
+		tracker.progress = pct
+	}
+	tracker.rates.sample(now, tracker.CurrentStep, tracker.progress, tracker.EntriesWalked, tracker.activeBytes())
 
-	// Send failure event
-	event := SnapshotProgressEvent{
-		ProjectID:  projectID,
-		Step:       "failed",
-		StepNumber: 0,
-		TotalSteps: 6,
-		Progress:   0,
-		Error:      errMsg,
-		Message:    "Snapshot generation failed: " + errMsg,
-		Timestamp:  time.Now(),
+	spt.lastID++
+	tracker.events = append(tracker.events, tracker.event(spt.lastID, now))
+	if len(tracker.events) > progressBufferSize {
+		tracker.events = append(tracker.events[:0], tracker.events[len(tracker.events)-progressBufferSize:]...)
 	}
+	tracker.lastEmit = now
 
-	for _, ch := range subscribers {
+	for _, ch := range spt.subscribers[tracker.ProjectID] {
 		select {
-		case ch <- event:
+		case ch <- struct{}{}:
 		default:
+			// Already signalled, the subscriber reads every event it missed
 		}
 	}
 }
@@ -212,91 +293,220 @@ func (spt *SnapshotProgressTracker) FailSnapshot(projectID string, errMsg string
 // GetProgress returns current progress for a project
 func (spt *SnapshotProgressTracker) GetProgress(projectID string) *SnapshotProgressEvent {
 	spt.mu.RLock()
-	tracker, exists := spt.trackers[projectID]
-	spt.mu.RUnlock()
+	defer spt.mu.RUnlock()
 
-	if !exists {
+	tracker, exists := spt.trackers[projectID]
+	if !exists || len(tracker.events) == 0 {
 		return nil
 	}
+	event := tracker.events[len(tracker.events)-1]
+	return &event
+}
 
-	event := &SnapshotProgressEvent{
-		ProjectID:  projectID,
-		Step:       tracker.CurrentStep,
-		StepNumber: tracker.StepNumber,
-		TotalSteps: 6,
-		Progress:   (tracker.StepNumber * 100) / 6,
-		FileCount:  tracker.FileCount,
-		TotalSize:  tracker.TotalSize,
-		Timestamp:  tracker.LastUpdate,
-	}
+// EventsSince returns the events of a project's current run after lastID
+// Every event carries the full state, so when lastID is 0 or older than the kept events only the latest is returned
+func (spt *SnapshotProgressTracker) EventsSince(projectID string, lastID uint64) []SnapshotProgressEvent {
+	spt.mu.RLock()
+	defer spt.mu.RUnlock()
 
-	if tracker.IsComplete {
-		event.Step = "completed"
-		event.StepNumber = 6
-		event.Progress = 100
-		event.SnapshotURL = tracker.SnapshotURL
-		event.Message = "Snapshot generation completed successfully"
-	} else if tracker.IsFailed {
-		event.Step = "failed"
-		event.Error = tracker.Error
-		event.Message = "Snapshot generation failed: " + tracker.Error
+	tracker, exists := spt.trackers[projectID]
+	if !exists || len(tracker.events) == 0 {
+		return nil
 	}
-
-	return event
+	events := tracker.events
+	if lastID == 0 || lastID+1 < events[0].ID {
+		return []SnapshotProgressEvent{events[len(events)-1]}
+	}
+	i := sort.Search(len(events), func(i int) bool { return events[i].ID > lastID })
+	return append([]SnapshotProgressEvent(nil), events[i:]...)
 }
 
-// Subscribe returns a channel for progress updates for a project
-func (spt *SnapshotProgressTracker) Subscribe(projectID string) chan SnapshotProgressEvent {
+// Subscribe returns a channel signalled whenever a project has new progress events
+func (spt *SnapshotProgressTracker) Subscribe(projectID string) chan struct{} {
 	spt.mu.Lock()
 	defer spt.mu.Unlock()
 
-	ch := make(chan SnapshotProgressEvent, 10) // Buffer to avoid blocking
-
-	// Ensure tracker exists
-	if _, exists := spt.trackers[projectID]; !exists {
-		spt.trackers[projectID] = &ProjectProgressTracker{
-			ProjectID:  projectID,
-			StartTime:  time.Now(),
-			LastUpdate: time.Now(),
-		}
-	}
-
+	ch := make(chan struct{}, 1)
 	spt.subscribers[projectID] = append(spt.subscribers[projectID], ch)
 	return ch
 }
 
 // Unsubscribe removes a subscriber
-func (spt *SnapshotProgressTracker) Unsubscribe(projectID string, ch chan SnapshotProgressEvent) {
+func (spt *SnapshotProgressTracker) Unsubscribe(projectID string, ch chan struct{}) {
 	spt.mu.Lock()
 	defer spt.mu.Unlock()
 
-	subscribers, exists := spt.subscribers[projectID]
-	if !exists {
-		return
-	}
-
-	// Remove channel from slice
+	subscribers := spt.subscribers[projectID]
 	for i, subscriber := range subscribers {
 		if subscriber == ch {
 			spt.subscribers[projectID] = append(subscribers[:i], subscribers[i+1:]...)
-			close(ch)
-			return
+			break
 		}
 	}
+	if len(spt.subscribers[projectID]) == 0 {
+		delete(spt.subscribers, projectID)
+	}
 }
 
-// CleanupProject removes tracking data for a project
+// CleanupProject ends a project's run; its final state stays readable for a while so streams can resume
 func (spt *SnapshotProgressTracker) CleanupProject(projectID string) {
 	spt.mu.Lock()
 	defer spt.mu.Unlock()
 
-	delete(spt.trackers, projectID)
+	tracker, exists := spt.trackers[projectID]
+	if !exists {
+		return
+	}
+	if !tracker.finished() {
+		tracker.IsFailed = true
+		tracker.Error = "snapshot generation stopped"
+		spt.emit(tracker, time.Now())
+	}
 
-	// Close all subscriber channels
-	if subscribers, exists := spt.subscribers[projectID]; exists {
-		for _, ch := range subscribers {
-			close(ch)
+	time.AfterFunc(progressRetention, func() {
+		spt.mu.Lock()
+		defer spt.mu.Unlock()
+		if spt.trackers[projectID] == tracker {
+			delete(spt.trackers, projectID)
 		}
-		delete(spt.subscribers, projectID)
+	})
+}
+
+func (t *ProjectProgressTracker) finished() bool {
+	return t.IsComplete || t.IsFailed
+}
+
+// percent returns how far the run has come from its counters
+func (t *ProjectProgressTracker) percent() float64 {
+	switch t.CurrentStep {
+	case StepBrowsing, StepHashing:
+		return scanShare * t.scanFraction()
+	case StepCompressing:
+		return scanShare
+	case StepUploading:
+		if t.CompressedSize == 0 {
+			return scanShare + prepareShare + uploadShare*compressShare*fraction(t.BytesCompressed, t.UploadSize)
+		}
+		return scanShare + prepareShare + uploadShare*(compressShare+(1-compressShare)*fraction(t.BytesUploaded, t.CompressedSize))
+	}
+	return 0
+}
+
+// scanFraction measures the walk against the previous snapshot, and hashing against the bytes to read
+func (t *ProjectProgressTracker) scanFraction() float64 {
+	walk := 1.0
+	if !t.walkDone {
+		walk = fraction(int64(t.EntriesWalked), int64(t.ExpectedEntries))
+	}
+	if !t.hashing {
+		return walk
+	}
+
+	toHash := t.hashableBytes
+	if !t.walkDone && t.ExpectedBytes > toHash {
+		toHash = t.ExpectedBytes
+	}
+	return 0.2*walk + 0.8*fraction(t.BytesHashed, toHash) // Reading files takes far longer than listing them
+}
+
+// fraction returns done/total, short of 1 since estimates can be exceeded, and 0 when total is unknown
+func fraction(done, total int64) float64 {
+	if total <= 0 {
+		return 0
+	}
+	return math.Min(float64(done)/float64(total), 0.99)
+}
+
+// activeBytes returns the byte counter of the current step
+func (t *ProjectProgressTracker) activeBytes() int64 {
+	switch t.CurrentStep {
+	case StepHashing:
+		return t.BytesHashed
+	case StepUploading:
+		return t.BytesUploaded
+	}
+	return 0
+}
+
+// event returns the run's state as an event
+func (t *ProjectProgressTracker) event(id uint64, now time.Time) SnapshotProgressEvent {
+	event := SnapshotProgressEvent{
+		ID:              id,
+		ProjectID:       t.ProjectID,
+		Step:            t.CurrentStep,
+		StepNumber:      stepNumbers[t.CurrentStep],
+		TotalSteps:      6,
+		Progress:        int(t.progress),
+		FileCount:       t.EntriesWalked,
+		TotalSize:       t.BytesWalked,
+		BytesHashed:     t.BytesHashed,
+		BytesCompressed: t.BytesCompressed,
+		BytesUploaded:   t.BytesUploaded,
+		UploadSize:      t.UploadSize,
+		CompressedSize:  t.CompressedSize,
+		Message:         t.describe(),
+		Timestamp:       now,
+	}
+
+	switch {
+	case t.IsComplete:
+		event.Step = StepCompleted
+		event.StepNumber = stepNumbers[StepCompleted]
+		event.Progress = 100
+		event.SnapshotURL = t.SnapshotURL
+		event.Message = "Snapshot generation completed successfully"
+	case t.IsFailed:
+		event.Step = StepFailed
+		event.StepNumber = 0
+		event.Error = t.Error
+		event.Message = "Snapshot generation failed: " + t.Error
+	default:
+		event.EntriesPerSecond = math.Round(t.rates.entryRate)
+		event.BytesPerSecond = math.Round(t.rates.byteRate)
+		if t.rates.progressRate > 0 {
+			event.ETASeconds = int(math.Ceil((100 - t.progress) / t.rates.progressRate))
+		}
+	}
+	return event
+}
+
+// describe returns the message of the current step, with its counters when they have started
+func (t *ProjectProgressTracker) describe() string {
+	switch {
+	case t.CurrentStep == StepBrowsing && t.EntriesWalked > 0:
+		return fmt.Sprintf("Browsing files: %d found...", t.EntriesWalked)
+	case t.CurrentStep == StepHashing && t.EntriesWalked > 0:
+		return fmt.Sprintf("Hashing files: %d found, %s hashed...", t.EntriesWalked, formatBytesSize(t.BytesHashed))
+	case t.CurrentStep == StepUploading && t.CompressedSize > 0:
+		return fmt.Sprintf("Uploading snapshot: %s of %s sent...", formatBytesSize(t.BytesUploaded), formatBytesSize(t.CompressedSize))
+	case t.CurrentStep == StepUploading && t.BytesCompressed > 0:
+		return fmt.Sprintf("Compressing snapshot: %s processed...", formatBytesSize(t.BytesCompressed))
+	}
+	return t.Message
+}
+
+// sample adds a reading of the counters to the moving averages
+// A new step or restarted counters reset the counter rates; the progress rate carries over
+func (r *progressRates) sample(now time.Time, step string, progress float64, entries int, bytes int64) {
+	if step != r.step || r.at.IsZero() {
+		*r = progressRates{step: step, at: now, progress: progress, entries: entries, bytes: bytes, progressRate: r.progressRate}
+		return
+	}
+	elapsed := now.Sub(r.at).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+
+	r.progressRate = smoothRate(r.progressRate, (progress-r.progress)/elapsed)
+	r.entryRate = smoothRate(r.entryRate, float64(entries-r.entries)/elapsed)
+	r.byteRate = smoothRate(r.byteRate, float64(bytes-r.bytes)/elapsed)
+	r.at, r.progress, r.entries, r.bytes = now, progress, entries, bytes
+}
+
+// smoothRate folds a new rate into a moving average, weighted like the transfer rates
+func smoothRate(avg, rate float64) float64 {
+	if avg == 0 {
+		return rate
 	}
+	return rateSmoothing*rate + (1-rateSmoothing)*avg
 }
@@ -0,0 +1,453 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	stdsync "sync"
+	"time"
+
+	"github.com/vidsync/agent/internal/api"
+	"github.com/vidsync/agent/internal/jobs"
+	"github.com/vidsync/agent/internal/util"
+)
+
+// SnapshotPolicy controls when a project's snapshot is refreshed after local changes
+type SnapshotPolicy struct {
+	Enabled         *bool `json:"enabled"`         // Unset takes the default, so a partial update doesn't turn refreshes off
+	QuietSeconds    int   `json:"quietSeconds"`    // Refresh once no change has landed for this long
+	MaxDelaySeconds int   `json:"maxDelaySeconds"` // Refresh at the latest this long after the first unsnapshotted change
+}
+
+// IsEnabled reports whether snapshots are refreshed automatically; unset means enabled
+func (p SnapshotPolicy) IsEnabled() bool {
+	return p.Enabled == nil || *p.Enabled
+}
+
+// Validate checks the policy and fills in defaults for unset fields
+func (p *SnapshotPolicy) Validate(defaults SnapshotPolicy) error {
+	if p.QuietSeconds < 0 || p.MaxDelaySeconds < 0 {
+		return fmt.Errorf("snapshot policy values must not be negative")
+	}
+	enabled := defaults.IsEnabled()
+	if p.Enabled != nil {
+		enabled = *p.Enabled
+	}
+	p.Enabled = &enabled // A copy, so the policy never shares its flag with the caller's
+	if p.QuietSeconds == 0 {
+		p.QuietSeconds = defaults.QuietSeconds
+	}
+	if p.MaxDelaySeconds == 0 {
+		p.MaxDelaySeconds = defaults.MaxDelaySeconds
+	}
+	if p.MaxDelaySeconds < p.QuietSeconds {
+		return fmt.Errorf("maxDelaySeconds must not be shorter than quietSeconds")
+	}
+	return nil
+}
+
+// SnapshotSchedule is a project's refresh policy and where its snapshot stands
+type SnapshotSchedule struct {
+	ProjectID  string         `json:"projectId"`
+	Policy     SnapshotPolicy `json:"policy"`
+	Custom     bool           `json:"custom"`               // Policy set for this project rather than the default
+	Dirty      bool           `json:"dirty"`                // Local changes not in the cloud snapshot yet
+	Running    bool           `json:"running"`              // A scheduled refresh is in progress
+	DirtySince *time.Time     `json:"dirtySince,omitempty"` // First change not in the snapshot
+	NextRun    *time.Time     `json:"nextRun,omitempty"`
+	LastRun    *time.Time     `json:"lastRun,omitempty"`
+	LastError  string         `json:"lastError,omitempty"`
+}
+
+// scheduledProject is the refresh state of one project
+type scheduledProject struct {
+	dirtySince time.Time // Zero when the snapshot is current
+	lastChange time.Time
+	running    bool
+	lastRun    time.Time
+	lastError  string
+	retryAt    time.Time // Earliest next attempt after a failed refresh
+}
+
+// snapshotRetryDelay is how long a failed refresh waits before trying again
+const snapshotRetryDelay = 5 * time.Minute
+
+// SnapshotScheduler regenerates project snapshots after local changes land
+// Bursts of changes are coalesced into one refresh, and a project never has two refreshes at once
+type SnapshotScheduler struct {
+	fileService *FileService
+	syncClient  *api.SyncthingClient
+	cloudClient *api.CloudClient
+	jobs        *SnapshotJobManager // Runs refreshes as jobs, nil to generate them directly
+	logger      *util.Logger
+
+	mu         stdsync.Mutex
+	defaults   SnapshotPolicy
+	policies   map[string]SnapshotPolicy // Per-project overrides of defaults
+	policyPath string                    // File the overrides are saved to, "" to keep them in memory
+	projects   map[string]*scheduledProject
+	wake       chan struct{}
+}
+
+// NewSnapshotScheduler creates a scheduler that refreshes snapshots through fileService
+func NewSnapshotScheduler(fileService *FileService, syncClient *api.SyncthingClient, cloudClient *api.CloudClient, logger *util.Logger) *SnapshotScheduler {
+	enabled := true
+	return &SnapshotScheduler{
+		fileService: fileService,
+		syncClient:  syncClient,
+		cloudClient: cloudClient,
+		logger:      logger,
+		defaults:    SnapshotPolicy{Enabled: &enabled, QuietSeconds: 120, MaxDelaySeconds: 1800},
+		policies:    make(map[string]SnapshotPolicy),
+		projects:    make(map[string]*scheduledProject),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// SetJobManager runs refreshes as snapshot jobs, so they share the job queue with other snapshots
+func (s *SnapshotScheduler) SetJobManager(jobs *SnapshotJobManager) {
+	s.jobs = jobs
+}
+
+// SetDefaultPolicy sets the policy of projects without their own
+func (s *SnapshotScheduler) SetDefaultPolicy(policy SnapshotPolicy) error {
+	s.mu.Lock()
+	err := policy.Validate(s.defaults)
+	if err == nil {
+		s.defaults = policy
+	}
+	s.mu.Unlock()
+	s.poke()
+	return err
+}
+
+// DefaultPolicy returns the policy of projects without their own
+func (s *SnapshotScheduler) DefaultPolicy() SnapshotPolicy {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.defaults
+}
+
+// SetPolicyFile loads per-project policies from path and saves later changes there
+func (s *SnapshotScheduler) SetPolicyFile(path string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.policyPath = path
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &s.policies)
+}
+
+// GetSchedule returns a project's refresh policy and state
+func (s *SnapshotScheduler) GetSchedule(projectID string) *SnapshotSchedule {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.scheduleLocked(projectID)
+}
+
+// SetPolicy gives a project its own refresh policy
+func (s *SnapshotScheduler) SetPolicy(projectID string, policy SnapshotPolicy) (*SnapshotSchedule, error) {
+	s.mu.Lock()
+	if err := policy.Validate(s.defaults); err != nil {
+		s.mu.Unlock()
+		return nil, err
+	}
+	s.policies[projectID] = policy
+	err := s.savePoliciesLocked()
+	schedule := s.scheduleLocked(projectID)
+	s.mu.Unlock()
+
+	if err != nil {
+		s.logger.Error("[SnapshotScheduler] Failed to save snapshot policies: %v", err)
+		return nil, err
+	}
+	s.logger.Info("[SnapshotScheduler] Snapshot policy of %s: enabled=%v quiet=%ds maxDelay=%ds",
+		projectID, policy.IsEnabled(), policy.QuietSeconds, policy.MaxDelaySeconds)
+	s.poke()
+	return schedule, nil
+}
+
+// ResetPolicy returns a project to the default refresh policy
+func (s *SnapshotScheduler) ResetPolicy(projectID string) (*SnapshotSchedule, error) {
+	s.mu.Lock()
+	delete(s.policies, projectID)
+	err := s.savePoliciesLocked()
+	schedule := s.scheduleLocked(projectID)
+	s.mu.Unlock()
+
+	if err != nil {
+		s.logger.Error("[SnapshotScheduler] Failed to save snapshot policies: %v", err)
+		return nil, err
+	}
+	s.poke()
+	return schedule, nil
+}
+
+// Forget drops the policy and state of a removed project
+func (s *SnapshotScheduler) Forget(projectID string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.projects, projectID)
+	if _, ok := s.policies[projectID]; ok {
+		delete(s.policies, projectID)
+		if err := s.savePoliciesLocked(); err != nil {
+			s.logger.Warn("[SnapshotScheduler] Failed to save snapshot policies: %v", err)
+		}
+	}
+}
+
+// MarkDirty records that a project's files changed since its snapshot
+func (s *SnapshotScheduler) MarkDirty(projectID string) {
+	s.mu.Lock()
+	now := time.Now()
+	p := s.projectLocked(projectID)
+	if p.dirtySince.IsZero() {
+		p.dirtySince = now
+	}
+	p.lastChange = now
+	s.mu.Unlock()
+	s.poke()
+}
+
+// Run marks projects dirty on LocalIndexUpdated events and refreshes them as their policy allows
+// Only projects that were snapshotted before or have their own policy are refreshed
+func (s *SnapshotScheduler) Run(ctx context.Context, emitter EventEmitter) {
+	events := s.syncClient.Events()
+	ch := events.Subscribe()
+	defer events.Unsubscribe(ch)
+
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+
+	s.logger.Info("[SnapshotScheduler] Snapshot refresh scheduler started")
+	for {
+		if !timer.Stop() {
+			select {
+			case <-timer.C:
+			default:
+			}
+		}
+		timer.Reset(s.startDue(ctx, emitter))
+
+		select {
+		case <-ctx.Done():
+			return
+		case evt, ok := <-ch:
+			if !ok {
+				return
+			}
+			if evt.Type != "LocalIndexUpdated" {
+				continue
+			}
+			var data api.LocalIndexUpdatedData
+			if err := evt.DecodeData(&data); err != nil || data.Folder == "" {
+				continue
+			}
+			if s.tracked(data.Folder) {
+				s.MarkDirty(data.Folder)
+			}
+		case <-s.wake:
+		case <-timer.C:
+		}
+	}
+}
+
+// startDue starts the refreshes that are due and returns how long until the next one is
+func (s *SnapshotScheduler) startDue(ctx context.Context, emitter EventEmitter) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	next := time.Hour
+	for projectID, p := range s.projects {
+		if p.running || p.dirtySince.IsZero() {
+			continue
+		}
+		policy := s.policyLocked(projectID)
+		if !policy.IsEnabled() {
+			continue
+		}
+
+		due := nextRunAt(p, policy)
+		if wait := due.Sub(now); wait > 0 {
+			next = min(next, wait)
+			continue
+		}
+
+		p.running = true
+		p.dirtySince = time.Time{} // Changes landing from here on need another refresh
+		go s.refresh(ctx, projectID, emitter)
+	}
+	return next
+}
+
+// refresh regenerates and uploads a project's snapshot
+func (s *SnapshotScheduler) refresh(ctx context.Context, projectID string, emitter EventEmitter) {
+	err := s.generate(ctx, projectID)
+
+	s.mu.Lock()
+	p := s.projectLocked(projectID)
+	p.running = false
+	p.lastRun = time.Now()
+	p.lastError = ""
+	p.retryAt = time.Time{}
+	if err != nil {
+		p.lastError = err.Error()
+		p.retryAt = p.lastRun.Add(snapshotRetryDelay)
+		if p.dirtySince.IsZero() {
+			p.dirtySince = p.lastRun
+		}
+	}
+	s.mu.Unlock()
+
+	if err != nil {
+		s.logger.Warn("[SnapshotScheduler] Scheduled snapshot of %s failed: %v", projectID, err)
+		emit(emitter, projectID, "snapshotRefreshFailed", "", err.Error(), nil)
+	} else {
+		emit(emitter, projectID, "snapshotRefreshed", "", "", nil)
+	}
+	s.poke()
+}
+
+// generate waits for Syncthing to finish scanning, then generates the project's snapshot
+func (s *SnapshotScheduler) generate(ctx context.Context, projectID string) error {
+	token := s.cloudClient.SessionToken()
+	if token == "" {
+		return fmt.Errorf("no signed-in user to upload as")
+	}
+
+	if s.jobs != nil {
+		s.logger.Info("[SnapshotScheduler] Refreshing snapshot of %s", projectID)
+		job, _ := s.jobs.Submit(projectID, token, TriggerScheduler)
+		job, err := s.jobs.Wait(ctx, projectID, job.ID)
+		if err != nil {
+			return err
+		}
+		if job.Status != jobs.StatusCompleted {
+			return fmt.Errorf("snapshot job %s: %s", job.Status, job.Error)
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+	defer cancel()
+
+	if err := s.fileService.WaitForScanCompletion(ctx, projectID, 120); err != nil {
+		return err
+	}
+
+	s.logger.Info("[SnapshotScheduler] Refreshing snapshot of %s", projectID)
+	result, err := s.fileService.GenerateSnapshot(ctx, projectID, token)
+	if err != nil {
+		if errors.Is(err, ErrSnapshotInProgress) {
+			return fmt.Errorf("snapshot started elsewhere, refreshing again later")
+		}
+		return err
+	}
+	if url, _ := result["snapshotUrl"].(string); url == "" {
+		return fmt.Errorf("snapshot generated but not uploaded")
+	}
+	return nil
+}
+
+// tracked reports whether changes to a folder should refresh its snapshot
+func (s *SnapshotScheduler) tracked(projectID string) bool {
+	s.mu.Lock()
+	_, custom := s.policies[projectID]
+	_, known := s.projects[projectID]
+	s.mu.Unlock()
+	return custom || known || s.fileService.HasSnapshotBase(projectID)
+}
+
+// poke wakes the scheduler loop to recompute what is due
+func (s *SnapshotScheduler) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// nextRunAt returns when a dirty project is due: after the quiet period, but no later than the max delay
+// A failed refresh isn't retried before its retry time either way
+func nextRunAt(p *scheduledProject, policy SnapshotPolicy) time.Time {
+	due := p.lastChange.Add(time.Duration(policy.QuietSeconds) * time.Second)
+	if latest := p.dirtySince.Add(time.Duration(policy.MaxDelaySeconds) * time.Second); latest.Before(due) {
+		due = latest
+	}
+	if due.Before(p.retryAt) {
+		due = p.retryAt
+	}
+	return due
+}
+
+func (s *SnapshotScheduler) projectLocked(projectID string) *scheduledProject {
+	p, ok := s.projects[projectID]
+	if !ok {
+		p = &scheduledProject{}
+		s.projects[projectID] = p
+	}
+	return p
+}
+
+func (s *SnapshotScheduler) policyLocked(projectID string) SnapshotPolicy {
+	if policy, ok := s.policies[projectID]; ok {
+		return policy
+	}
+	return s.defaults
+}
+
+func (s *SnapshotScheduler) scheduleLocked(projectID string) *SnapshotSchedule {
+	policy := s.policyLocked(projectID)
+	_, custom := s.policies[projectID]
+	schedule := &SnapshotSchedule{ProjectID: projectID, Policy: policy, Custom: custom}
+
+	p, ok := s.projects[projectID]
+	if !ok {
+		return schedule
+	}
+	schedule.Running = p.running
+	schedule.LastError = p.lastError
+	if !p.lastRun.IsZero() {
+		lastRun := p.lastRun
+		schedule.LastRun = &lastRun
+	}
+	if !p.dirtySince.IsZero() {
+		dirtySince := p.dirtySince
+		schedule.Dirty = true
+		schedule.DirtySince = &dirtySince
+		if policy.IsEnabled() && !p.running {
+			nextRun := nextRunAt(p, policy)
+			schedule.NextRun = &nextRun
+		}
+	}
+	return schedule
+}
+
+// savePoliciesLocked writes the per-project policies to the policy file
+func (s *SnapshotScheduler) savePoliciesLocked() error {
+	if s.policyPath == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(s.policies, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.policyPath), 0700); err != nil {
+		return err
+	}
+	tmp := s.policyPath + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.policyPath)
+}
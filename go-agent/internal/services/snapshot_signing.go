@@ -0,0 +1,275 @@
+package services
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/vidsync/agent/internal/api"
+	"github.com/vidsync/agent/internal/signing"
+)
+
+// maxVerifyChain caps how many documents a verification follows, matching the cloud's delta chain limit
+const maxVerifyChain = 64
+
+// ErrSigningKeyMismatch is returned when the cloud has another device's signing key for a project
+var ErrSigningKeyMismatch = errors.New("another signing key is registered for the project")
+
+// SnapshotVerification is the result of checking a project's cloud snapshot against its signatures
+type SnapshotVerification struct {
+	ProjectID   string             `json:"projectId"`
+	SnapshotURL string             `json:"snapshotUrl"`
+	Verified    bool               `json:"verified"`   // Every document of the chain is intact and signed by the registered key
+	Registered  bool               `json:"registered"` // The owner registered a signing key for the project
+	DeviceID    string             `json:"deviceId,omitempty"`
+	PublicKey   string             `json:"publicKey,omitempty"` // Registered key
+	Fingerprint string             `json:"fingerprint,omitempty"`
+	Trust       string             `json:"trust,omitempty"` // Registered key compared with the pinned one: new, trusted or mismatch
+	Documents   []VerifiedDocument `json:"documents"`       // Current snapshot first, then the deltas' bases
+}
+
+// VerifiedDocument is the signature check of one snapshot document
+type VerifiedDocument struct {
+	URL         string `json:"url"`
+	Kind        string `json:"kind"`
+	Signed      bool   `json:"signed"`
+	Valid       bool   `json:"valid"`
+	DeviceID    string `json:"deviceId,omitempty"`
+	Fingerprint string `json:"fingerprint,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// signatureURL returns where the cloud keeps a snapshot document's signature
+func signatureURL(snapshotURL string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(snapshotURL, ".enc"), ".json.gz") + ".sig.json"
+}
+
+// signSnapshot signs a document with the device key, once, before it is uploaded
+func (fs *FileService) signSnapshot(doc *snapshotDocument) error {
+	if fs.signer == nil || doc.Signature != nil {
+		return nil
+	}
+	digest, err := doc.Digest()
+	if err != nil {
+		return fmt.Errorf("failed to digest snapshot: %w", err)
+	}
+	sig := fs.signer(digest)
+	doc.Signature = &sig
+	return nil
+}
+
+// RegisterSigningKey registers this device's signing key with the cloud as the one a project's snapshots are signed with
+// Only the project owner can; replace swaps out another device's key, e.g. after moving the project to this device
+func (fs *FileService) RegisterSigningKey(projectID, accessToken string, replace bool) error {
+	if fs.signingKey == nil {
+		return fmt.Errorf("snapshot signing is not set up")
+	}
+	if accessToken == "" {
+		accessToken = fs.cloudClient.SessionToken()
+	}
+
+	err := fs.cloudClient.RegisterSigningKey(projectID, *fs.signingKey, replace, accessToken)
+	var statusErr *api.StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusConflict && statusErr.Code() == api.CodeSigningKeyMismatch {
+		return ErrSigningKeyMismatch
+	}
+	if err != nil {
+		return err
+	}
+
+	fs.registeredMu.Lock()
+	fs.registered[projectID] = true
+	fs.registeredMu.Unlock()
+	fs.logger.Info("[FileService] Registered signing key of %s (replace=%v)", projectID, replace)
+	return nil
+}
+
+// ensureSigningKey registers the signing key before the first upload of a project, for projects created
+// before keys were registered or first uploaded from this device; the upload itself reports a refusal
+func (fs *FileService) ensureSigningKey(projectID, accessToken string) {
+	if fs.signer == nil || fs.signingKey == nil {
+		return
+	}
+	fs.registeredMu.Lock()
+	done := fs.registered[projectID]
+	fs.registeredMu.Unlock()
+	if done {
+		return
+	}
+
+	if err := fs.RegisterSigningKey(projectID, accessToken, false); err != nil {
+		fs.logger.Warn("[FileService] Failed to register signing key of %s: %v", projectID, err)
+	}
+}
+
+// VerifySnapshot downloads a project's cloud snapshot, and the deltas' bases, and checks their signatures
+// Every document must be signed by the key the owner registered with the cloud. The registered key is
+// compared with the one pinned for the project, to flag an owner key change; acceptKey re-pins it
+func (fs *FileService) VerifySnapshot(ctx context.Context, projectID, accessToken string, acceptKey bool) (*SnapshotVerification, error) {
+	if accessToken == "" {
+		accessToken = fs.cloudClient.SessionToken()
+	}
+
+	snapshotURL, err := fs.cloudClient.GetProjectSnapshotURL(projectID, accessToken)
+	if err != nil {
+		fs.logger.Error("[FileService] Failed to get project snapshot: %v", err)
+		return nil, err
+	}
+	if snapshotURL == "" {
+		return nil, ErrSnapshotNotFound
+	}
+
+	registered, err := fs.cloudClient.GetSigningKey(projectID, accessToken)
+	if err != nil {
+		fs.logger.Error("[FileService] Failed to get registered signing key: %v", err)
+		return nil, err
+	}
+
+	result := &SnapshotVerification{
+		ProjectID:   projectID,
+		SnapshotURL: snapshotURL,
+		Verified:    registered != nil,
+		Registered:  registered != nil,
+		Documents:   []VerifiedDocument{},
+	}
+	var registeredKey ed25519.PublicKey
+	if registered != nil {
+		sig := signing.Signature{Algorithm: registered.Algorithm, PublicKey: registered.PublicKey}
+		if registeredKey, err = sig.Key(); err != nil {
+			return nil, fmt.Errorf("registered signing key: %w", err)
+		}
+		result.PublicKey = registered.PublicKey
+		result.DeviceID = registered.DeviceID
+		result.Fingerprint = signing.Fingerprint(registeredKey)
+	}
+
+	url := snapshotURL
+	for depth := 0; url != ""; depth++ {
+		if depth == maxVerifyChain {
+			return nil, fmt.Errorf("snapshot delta chain longer than %d", maxVerifyChain)
+		}
+
+		doc, baseURL, err := fs.verifyDocument(ctx, projectID, url)
+		if err != nil {
+			return nil, err
+		}
+		if doc.Valid && registeredKey != nil && doc.Fingerprint != result.Fingerprint {
+			doc.Valid = false
+			doc.Error = "signed by a key other than the registered one"
+		}
+		if !doc.Valid {
+			result.Verified = false
+		}
+		result.Documents = append(result.Documents, doc)
+		url = baseURL
+	}
+
+	if result.Registered && fs.pins != nil {
+		if result.Trust, err = fs.pins.Check(projectID, result.Fingerprint, acceptKey); err != nil {
+			fs.logger.Warn("[FileService] Failed to check pinned signing key: %v", err)
+		}
+	}
+
+	fs.logger.Info("[FileService] Verified snapshot of %s: verified=%v trust=%s documents=%d",
+		projectID, result.Verified, result.Trust, len(result.Documents))
+	return result, nil
+}
+
+// verifyDocument downloads one snapshot document and its signature and checks them
+// Returns the document's delta base URL, "" for full snapshots
+// Encrypted documents are decrypted first, since signatures cover the plain JSON
+func (fs *FileService) verifyDocument(ctx context.Context, projectID, url string) (VerifiedDocument, string, error) {
+	doc := VerifiedDocument{URL: url}
+
+	body, _, err := fs.openSnapshot(ctx, projectID, url)
+	if err != nil {
+		return doc, "", err
+	}
+	defer body.Close()
+
+	h := sha256.New()
+	raw := io.TeeReader(body, h)
+
+	var baseURL string
+	doc.Kind, baseURL, err = readSnapshotHeader(json.NewDecoder(raw))
+	if err != nil {
+		return doc, "", fmt.Errorf("failed to parse snapshot %s: %w", url, err)
+	}
+	if _, err := io.Copy(io.Discard, raw); err != nil {
+		return doc, "", fmt.Errorf("failed to read snapshot %s: %w", url, err)
+	}
+	digest := h.Sum(nil)
+
+	sig, err := fs.downloadSignature(ctx, url)
+	switch {
+	case errors.Is(err, api.ErrNotFound):
+		doc.Error = "document is not signed"
+		return doc, baseURL, nil
+	case err != nil:
+		return doc, "", fmt.Errorf("failed to download signature of %s: %w", url, err)
+	}
+
+	doc.Signed = true
+	doc.DeviceID = sig.DeviceID
+	if pub, err := sig.Key(); err == nil {
+		doc.Fingerprint = signing.Fingerprint(pub)
+	}
+	if err := signing.Verify(*sig, digest); err != nil {
+		doc.Error = err.Error()
+		return doc, baseURL, nil
+	}
+	doc.Valid = true
+	return doc, baseURL, nil
+}
+
+// downloadSignature fetches the signature stored next to a snapshot document
+func (fs *FileService) downloadSignature(ctx context.Context, url string) (*signing.Signature, error) {
+	body, err := fs.cloudClient.Download(ctx, signatureURL(url))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var sig signing.Signature
+	if err := json.NewDecoder(io.LimitReader(body, 64<<10)).Decode(&sig); err != nil {
+		return nil, err
+	}
+	return &sig, nil
+}
+
+// readSnapshotHeader reads a snapshot document's kind and delta base from the fields before its entry arrays
+func readSnapshotHeader(dec *json.Decoder) (string, string, error) {
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return "", "", fmt.Errorf("snapshot is not a JSON object")
+	}
+
+	kind := SnapshotKindFull
+	var baseURL string
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return "", "", err
+		}
+		switch tok {
+		case "kind":
+			err = dec.Decode(&kind)
+		case "baseUrl":
+			err = dec.Decode(&baseURL)
+		case "files", deltaAdded, deltaModified, deltaRemoved:
+			return kind, baseURL, nil // Header fields come first
+		default:
+			var skip json.RawMessage
+			err = dec.Decode(&skip)
+		}
+		if err != nil {
+			return "", "", err
+		}
+	}
+	return kind, baseURL, nil
+}
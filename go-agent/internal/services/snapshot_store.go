@@ -0,0 +1,105 @@
+package services
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	stdsync "sync"
+	"time"
+)
+
+// SnapshotBase is the last snapshot uploaded for a project, kept locally so
+// the next snapshot can be uploaded as a delta against it
+// Its file entries are stored next to it as a listing
+type SnapshotBase struct {
+	ProjectID   string    `json:"projectId"`
+	SnapshotURL string    `json:"snapshotUrl"` // Cloud reference the next delta is based on
+	ChainLength int       `json:"chainLength"` // Deltas uploaded since the last full snapshot
+	CreatedAt   time.Time `json:"createdAt"`
+	FileCount   int       `json:"fileCount"`
+	TotalSize   int64     `json:"totalSize"`
+}
+
+// SnapshotStore persists each project's last uploaded snapshot on disk
+type SnapshotStore struct {
+	dir string
+	mu  stdsync.Mutex
+}
+
+// NewSnapshotStore creates a snapshot store rooted at dir
+func NewSnapshotStore(dir string) *SnapshotStore {
+	return &SnapshotStore{dir: dir}
+}
+
+// metaPath returns the file holding a project's snapshot base
+func (s *SnapshotStore) metaPath(projectID string) string {
+	return filepath.Join(s.dir, filepath.Base(projectID)+".json")
+}
+
+// ListingPath returns the file holding the entries of a project's snapshot base
+func (s *SnapshotStore) ListingPath(projectID string) string {
+	return filepath.Join(s.dir, filepath.Base(projectID)+".jsonl.gz")
+}
+
+// Load returns a project's snapshot base, or nil if none is stored
+func (s *SnapshotStore) Load(projectID string) (*SnapshotBase, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.metaPath(projectID))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var base SnapshotBase
+	if err := json.Unmarshal(data, &base); err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(s.ListingPath(projectID)); err != nil {
+		return nil, nil // Listing lost, the base is unusable
+	}
+	return &base, nil
+}
+
+// newListing creates a listing file inside the store, so committing it is a rename
+func (s *SnapshotStore) newListing() (*listingWriter, error) {
+	return createListing(s.dir)
+}
+
+// Commit makes a written listing the project's snapshot base
+// The listing is moved into place before the metadata, so a crash in between only loses the base
+func (s *SnapshotStore) Commit(base *SnapshotBase, listingPath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	os.Remove(s.metaPath(base.ProjectID))
+	if err := os.Rename(listingPath, s.ListingPath(base.ProjectID)); err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(base)
+	if err != nil {
+		return err
+	}
+	tmp := s.metaPath(base.ProjectID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.metaPath(base.ProjectID))
+}
+
+// Delete removes a project's snapshot base so the next snapshot is uploaded in full
+func (s *SnapshotStore) Delete(projectID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, path := range []string{s.metaPath(projectID), s.ListingPath(projectID)} {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"context"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/vidsync/agent/internal/api"
@@ -14,6 +15,8 @@ type SyncService struct {
 	syncClient  *api.SyncthingClient
 	cloudClient *api.CloudClient
 	logger      *util.Logger
+	ratesMu     sync.Mutex
+	rates       map[string]deviceRate // deviceID -> connection byte rates
 }
 
 // NewSyncService creates a new sync service
@@ -22,6 +25,7 @@ func NewSyncService(syncClient *api.SyncthingClient, cloudClient *api.CloudClien
 		syncClient:  syncClient,
 		cloudClient: cloudClient,
 		logger:      logger,
+		rates:       make(map[string]deviceRate),
 	}
 }
 
@@ -30,7 +34,7 @@ func (ss *SyncService) StartSync(ctx context.Context, projectID, localPath, acce
 	ss.logger.Info("[SyncService] Starting sync for project: %s", projectID)
 
 	// Ensure folder exists in Syncthing
-	err := ss.syncClient.AddFolder(projectID, projectID, localPath)
+	err := ss.syncClient.AddFolder(projectID, projectID, localPath, nil)
 	if err != nil {
 		ss.logger.Warn("[SyncService] Folder may already exist: %v", err)
 		// Continue anyway - folder might already be configured
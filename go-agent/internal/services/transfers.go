@@ -0,0 +1,277 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/vidsync/agent/internal/api"
+)
+
+const (
+	// minTransferInterval bounds how often transfer progress is pushed to WebSocket clients
+	minTransferInterval = 1 * time.Second
+	// rateSmoothing is the weight of the newest sample in the moving average rate
+	rateSmoothing = 0.4
+	// activeFolderTTL is how long a folder stays tracked after its last sync activity
+	activeFolderTTL = 30 * time.Second
+	// maxInProgressFiles caps the in-progress file list in a transfer report
+	maxInProgressFiles = 20
+)
+
+// DeviceTransfer is the sync progress of one device for a project
+type DeviceTransfer struct {
+	DeviceID    string   `json:"deviceId"`
+	Name        string   `json:"name,omitempty"`
+	IsLocal     bool     `json:"isLocal"`
+	Connected   bool     `json:"connected"`
+	Completion  float64  `json:"completion"` // 0-100
+	GlobalBytes int64    `json:"globalBytes"`
+	NeedBytes   int64    `json:"needBytes"`
+	NeedItems   int      `json:"needItems"`
+	BytesPerSec float64  `json:"bytesPerSec"`
+	ETASeconds  *float64 `json:"etaSeconds,omitempty"` // Omitted when the rate is zero
+	ETA         string   `json:"eta,omitempty"`        // e.g. "5m 32s"
+	RemoteState string   `json:"remoteState,omitempty"`
+}
+
+// ProjectTransfers is the per-device transfer report for a project
+type ProjectTransfers struct {
+	ProjectID  string           `json:"projectId"`
+	Devices    []DeviceTransfer `json:"devices"`
+	InProgress []api.NeedFile   `json:"inProgress"` // Files the local device is downloading
+	Timestamp  time.Time        `json:"timestamp"`
+}
+
+// deviceRate tracks byte counters and smoothed rates for one device connection
+type deviceRate struct {
+	inBytes  int64
+	outBytes int64
+	at       time.Time
+	inRate   float64
+	outRate  float64
+}
+
+// GetTransfers returns per-device completion, needed bytes, rate and ETA for a project
+// Rates come from connection byte counters, which Syncthing keeps per device rather than
+// per folder, so they are shared between projects synced with the same device
+func (ss *SyncService) GetTransfers(ctx context.Context, projectID string) (*ProjectTransfers, error) {
+	folder, err := ss.syncClient.GetFolder(projectID)
+	if err != nil {
+		ss.logger.Error("[SyncService] Failed to get folder config: %v", err)
+		return nil, err
+	}
+
+	myID, err := ss.syncClient.GetMyID()
+	if err != nil {
+		ss.logger.Error("[SyncService] Failed to get local device ID: %v", err)
+		return nil, err
+	}
+
+	connections, err := ss.syncClient.GetConnections()
+	if err != nil {
+		ss.logger.Warn("[SyncService] Failed to get connections: %v", err)
+		connections = &api.Connections{}
+	}
+	rates := ss.sampleRates(connections)
+
+	names := map[string]string{}
+	if devices, err := ss.syncClient.GetDevices(); err == nil {
+		for _, d := range devices {
+			names[d.DeviceID] = d.Name
+		}
+	}
+
+	transfers := &ProjectTransfers{
+		ProjectID: projectID,
+		Devices:   []DeviceTransfer{},
+		Timestamp: time.Now(),
+	}
+
+	// Local device first: it downloads from every connected peer in the folder
+	local := DeviceTransfer{DeviceID: myID, Name: names[myID], IsLocal: true, Connected: true}
+	for _, d := range folder.Devices {
+		if rate, ok := rates[d.DeviceID]; ok && d.DeviceID != myID {
+			local.BytesPerSec += rate.inRate
+		}
+	}
+	if completion, err := ss.syncClient.GetCompletion(projectID, myID); err == nil {
+		applyCompletion(&local, completion)
+	}
+	transfers.Devices = append(transfers.Devices, local)
+
+	for _, d := range folder.Devices {
+		if d.DeviceID == myID {
+			continue
+		}
+
+		transfer := DeviceTransfer{
+			DeviceID:  d.DeviceID,
+			Name:      names[d.DeviceID],
+			Connected: connections.Connections[d.DeviceID].Connected,
+		}
+		if rate, ok := rates[d.DeviceID]; ok {
+			transfer.BytesPerSec = rate.outRate
+		}
+
+		completion, err := ss.syncClient.GetCompletion(projectID, d.DeviceID)
+		if err != nil {
+			ss.logger.Warn("[SyncService] Failed to get completion for %s: %v", d.DeviceID, err)
+		} else {
+			applyCompletion(&transfer, completion)
+		}
+
+		transfers.Devices = append(transfers.Devices, transfer)
+	}
+
+	if need, err := ss.syncClient.GetNeed(projectID, 1, maxInProgressFiles); err == nil {
+		transfers.InProgress = need.Progress
+	}
+
+	return transfers, nil
+}
+
+// applyCompletion copies completion counters into a transfer and derives the ETA
+func applyCompletion(transfer *DeviceTransfer, completion *api.Completion) {
+	transfer.Completion = completion.Completion
+	transfer.GlobalBytes = completion.GlobalBytes
+	transfer.NeedBytes = completion.NeedBytes
+	transfer.NeedItems = completion.NeedItems
+	transfer.RemoteState = completion.RemoteState
+
+	if transfer.NeedBytes > 0 && transfer.BytesPerSec > 0 {
+		eta := float64(transfer.NeedBytes) / transfer.BytesPerSec
+		transfer.ETASeconds = &eta
+		transfer.ETA = formatETA(eta)
+	}
+}
+
+// sampleRates updates the moving-average byte rates from a connections snapshot
+func (ss *SyncService) sampleRates(connections *api.Connections) map[string]deviceRate {
+	ss.ratesMu.Lock()
+	defer ss.ratesMu.Unlock()
+
+	now := time.Now()
+	for deviceID, conn := range connections.Connections {
+		prev, ok := ss.rates[deviceID]
+		next := deviceRate{inBytes: conn.InBytesTotal, outBytes: conn.OutBytesTotal, at: now}
+
+		if ok && conn.Connected {
+			elapsed := now.Sub(prev.at).Seconds()
+			switch {
+			case elapsed < minTransferInterval.Seconds()/2:
+				// Sampled too recently for a meaningful delta, keep the previous sample
+				next = prev
+			case conn.InBytesTotal < prev.inBytes || conn.OutBytesTotal < prev.outBytes:
+				// Counters reset when a connection is re-established
+			default:
+				inRate := float64(conn.InBytesTotal-prev.inBytes) / elapsed
+				outRate := float64(conn.OutBytesTotal-prev.outBytes) / elapsed
+				next.inRate = rateSmoothing*inRate + (1-rateSmoothing)*prev.inRate
+				next.outRate = rateSmoothing*outRate + (1-rateSmoothing)*prev.outRate
+			}
+		}
+
+		ss.rates[deviceID] = next
+	}
+
+	result := make(map[string]deviceRate, len(ss.rates))
+	for deviceID, rate := range ss.rates {
+		result[deviceID] = rate
+	}
+	return result
+}
+
+// RunTransferMonitor pushes transfer progress for folders with sync activity
+// Folders become active on Syncthing sync events and are reported at most once per interval
+func (ss *SyncService) RunTransferMonitor(ctx context.Context, interval time.Duration, emitter EventEmitter) {
+	if interval < minTransferInterval {
+		interval = minTransferInterval
+	}
+
+	events := ss.syncClient.Events()
+	ch := events.Subscribe()
+	defer events.Unsubscribe(ch)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	active := map[string]time.Time{} // projectID -> last activity
+
+	ss.logger.Info("[SyncService] Transfer monitor started (interval %v)", interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case evt, ok := <-ch:
+			if !ok {
+				return
+			}
+			if folderID := transferActivityFolder(evt); folderID != "" {
+				active[folderID] = time.Now()
+			}
+
+		case <-ticker.C:
+			for projectID, lastActivity := range active {
+				transfers, err := ss.GetTransfers(ctx, projectID)
+				if err != nil {
+					ss.logger.Debug("[SyncService] Transfer report failed for %s: %v", projectID, err)
+					delete(active, projectID)
+					continue
+				}
+
+				emit(emitter, projectID, "transferProgress", "", "", map[string]interface{}{
+					"devices":    transfers.Devices,
+					"inProgress": transfers.InProgress,
+				})
+
+				if isTransferComplete(transfers) && time.Since(lastActivity) > activeFolderTTL {
+					delete(active, projectID)
+				}
+			}
+		}
+	}
+}
+
+// transferActivityFolder returns the folder a Syncthing event shows transfer activity for
+func transferActivityFolder(evt api.SyncthingEvent) string {
+	switch evt.Type {
+	case "ItemStarted", "ItemFinished":
+		var data api.ItemEventData
+		if evt.DecodeData(&data) == nil {
+			return data.Folder
+		}
+	case "FolderCompletion":
+		var data api.FolderCompletionData
+		if evt.DecodeData(&data) == nil && data.Completion < 100 {
+			return data.Folder
+		}
+	case "StateChanged":
+		var data api.StateChangedData
+		if evt.DecodeData(&data) == nil && data.To == "syncing" {
+			return data.Folder
+		}
+	}
+	return ""
+}
+
+// isTransferComplete reports whether every device has the project fully synced
+func isTransferComplete(transfers *ProjectTransfers) bool {
+	for _, d := range transfers.Devices {
+		if d.NeedBytes > 0 || d.NeedItems > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// formatETA renders seconds as a short human-readable duration
+func formatETA(seconds float64) string {
+	d := time.Duration(seconds) * time.Second
+	if d >= time.Hour {
+		return fmt.Sprintf("%dh %dm", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return fmt.Sprintf("%dm %ds", int(d.Minutes()), int(d.Seconds())%60)
+}
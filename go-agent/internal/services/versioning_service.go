@@ -0,0 +1,231 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vidsync/agent/internal/api"
+	"github.com/vidsync/agent/internal/util"
+)
+
+// Versioning types supported by Syncthing
+const (
+	VersioningNone      = "none"
+	VersioningTrashcan  = "trashcan"
+	VersioningSimple    = "simple"
+	VersioningStaggered = "staggered"
+)
+
+// VersioningSettings is the user-facing versioning configuration of a project
+type VersioningSettings struct {
+	Type             string `json:"type"`                       // none, trashcan, simple, staggered
+	KeepVersions     int    `json:"keepVersions,omitempty"`     // simple: versions kept per file
+	CleanoutDays     int    `json:"cleanoutDays,omitempty"`     // trashcan, simple: delete versions older than this (0 = never)
+	MaxAgeDays       int    `json:"maxAgeDays,omitempty"`       // staggered: delete versions older than this (0 = never)
+	CleanupIntervalS int    `json:"cleanupIntervalS,omitempty"` // How often Syncthing prunes old versions
+}
+
+// Validate checks the settings and fills in defaults
+func (s *VersioningSettings) Validate() error {
+	if s.Type == "" {
+		s.Type = VersioningNone
+	}
+	if s.KeepVersions < 0 || s.CleanoutDays < 0 || s.MaxAgeDays < 0 || s.CleanupIntervalS < 0 {
+		return fmt.Errorf("versioning values must not be negative")
+	}
+
+	switch s.Type {
+	case VersioningNone, VersioningTrashcan, VersioningStaggered:
+	case VersioningSimple:
+		if s.KeepVersions == 0 {
+			s.KeepVersions = 5
+		}
+	default:
+		return fmt.Errorf("unknown versioning type: %s", s.Type)
+	}
+
+	if s.Type != VersioningNone && s.CleanupIntervalS == 0 {
+		s.CleanupIntervalS = 3600
+	}
+	return nil
+}
+
+// ToConfig converts the settings to a Syncthing versioning configuration
+func (s *VersioningSettings) ToConfig() *api.VersioningConfig {
+	cfg := &api.VersioningConfig{
+		Params:           map[string]string{},
+		CleanupIntervalS: s.CleanupIntervalS,
+	}
+
+	switch s.Type {
+	case VersioningTrashcan:
+		cfg.Type = VersioningTrashcan
+		cfg.Params["cleanoutDays"] = strconv.Itoa(s.CleanoutDays)
+	case VersioningSimple:
+		cfg.Type = VersioningSimple
+		cfg.Params["keep"] = strconv.Itoa(s.KeepVersions)
+		cfg.Params["cleanoutDays"] = strconv.Itoa(s.CleanoutDays)
+	case VersioningStaggered:
+		cfg.Type = VersioningStaggered
+		cfg.Params["maxAge"] = strconv.Itoa(s.MaxAgeDays * 24 * 60 * 60)
+	}
+
+	return cfg
+}
+
+// versioningSettingsFromConfig converts a Syncthing versioning configuration to settings
+func versioningSettingsFromConfig(cfg api.VersioningConfig) *VersioningSettings {
+	s := &VersioningSettings{Type: cfg.Type, CleanupIntervalS: cfg.CleanupIntervalS}
+	if s.Type == "" {
+		s.Type = VersioningNone
+	}
+
+	s.KeepVersions, _ = strconv.Atoi(cfg.Params["keep"])
+	s.CleanoutDays, _ = strconv.Atoi(cfg.Params["cleanoutDays"])
+	if maxAge, err := strconv.Atoi(cfg.Params["maxAge"]); err == nil {
+		s.MaxAgeDays = maxAge / (24 * 60 * 60)
+	}
+	return s
+}
+
+// VersioningService manages file versioning settings and restores
+type VersioningService struct {
+	syncClient  *api.SyncthingClient
+	cloudClient *api.CloudClient
+	logger      *util.Logger
+}
+
+// NewVersioningService creates a new versioning service
+func NewVersioningService(syncClient *api.SyncthingClient, cloudClient *api.CloudClient, logger *util.Logger) *VersioningService {
+	return &VersioningService{
+		syncClient:  syncClient,
+		cloudClient: cloudClient,
+		logger:      logger,
+	}
+}
+
+// FileVersions is the archived version list of one file
+type FileVersions struct {
+	Path     string            `json:"path"`
+	Versions []api.FileVersion `json:"versions"` // Newest first
+}
+
+// RestoreVersionRequest restores one or more files to an archived version
+type RestoreVersionRequest struct {
+	Path        string               `json:"path,omitempty"`
+	VersionTime time.Time            `json:"versionTime,omitempty"`
+	Files       map[string]time.Time `json:"files,omitempty"` // Multiple files: path -> versionTime
+}
+
+// GetSettings gets the versioning settings of a project
+func (vs *VersioningService) GetSettings(ctx context.Context, projectID string) (*VersioningSettings, error) {
+	folder, err := vs.syncClient.GetFolder(projectID)
+	if err != nil {
+		vs.logger.Error("[VersioningService] Failed to get folder config: %v", err)
+		return nil, err
+	}
+	return versioningSettingsFromConfig(folder.Versioning), nil
+}
+
+// UpdateSettings changes the versioning settings of a project
+func (vs *VersioningService) UpdateSettings(ctx context.Context, projectID string, settings *VersioningSettings) (*VersioningSettings, error) {
+	if err := settings.Validate(); err != nil {
+		return nil, err
+	}
+	vs.logger.Info("[VersioningService] Setting %s versioning for project: %s", settings.Type, projectID)
+
+	folder, err := vs.syncClient.GetFolder(projectID)
+	if err != nil {
+		vs.logger.Error("[VersioningService] Failed to get folder config: %v", err)
+		return nil, err
+	}
+
+	// Keep fields the agent doesn't manage, e.g. a custom versions path
+	cfg := settings.ToConfig()
+	versioning := folder.Versioning
+	versioning.Type = cfg.Type
+	versioning.Params = cfg.Params
+	versioning.CleanupIntervalS = cfg.CleanupIntervalS
+
+	if err := vs.syncClient.PatchFolder(projectID, map[string]interface{}{"versioning": versioning}); err != nil {
+		vs.logger.Error("[VersioningService] Failed to update versioning: %v", err)
+		return nil, err
+	}
+
+	return vs.GetSettings(ctx, projectID)
+}
+
+// ListVersions lists archived file versions of a project
+// prefix optionally limits the result to a file or directory
+func (vs *VersioningService) ListVersions(ctx context.Context, projectID, prefix string) ([]FileVersions, error) {
+	vs.logger.Debug("[VersioningService] Listing versions for project: %s", projectID)
+
+	versions, err := vs.syncClient.GetVersions(projectID)
+	if err != nil {
+		vs.logger.Error("[VersioningService] Failed to get versions: %v", err)
+		return nil, err
+	}
+
+	prefix = strings.Trim(path.Clean("/"+prefix), "/")
+	result := []FileVersions{}
+	for p, list := range versions {
+		if prefix != "" && p != prefix && !strings.HasPrefix(p, prefix+"/") {
+			continue
+		}
+		sort.Slice(list, func(i, j int) bool {
+			return list[i].VersionTime.After(list[j].VersionTime)
+		})
+		result = append(result, FileVersions{Path: p, Versions: list})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Path < result[j].Path
+	})
+	return result, nil
+}
+
+// RestoreVersion restores files to archived versions
+// The current file is itself archived by Syncthing before being replaced
+func (vs *VersioningService) RestoreVersion(ctx context.Context, projectID string, req *RestoreVersionRequest) (map[string]interface{}, error) {
+	files := req.Files
+	if files == nil {
+		files = map[string]time.Time{}
+	}
+	if req.Path != "" {
+		files[req.Path] = req.VersionTime
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no files to restore")
+	}
+
+	vs.logger.Info("[VersioningService] Restoring %d file(s) in project: %s", len(files), projectID)
+
+	failures, err := vs.syncClient.RestoreVersions(projectID, files)
+	if err != nil {
+		vs.logger.Error("[VersioningService] Failed to restore versions: %v", err)
+		return nil, err
+	}
+
+	restored := []string{}
+	for p := range files {
+		if _, failed := failures[p]; !failed {
+			restored = append(restored, p)
+		}
+	}
+	sort.Strings(restored)
+
+	for p, msg := range failures {
+		vs.logger.Warn("[VersioningService] Failed to restore %s: %s", p, msg)
+	}
+
+	return map[string]interface{}{
+		"ok":       len(failures) == 0,
+		"restored": restored,
+		"failed":   failures,
+	}, nil
+}
@@ -0,0 +1,98 @@
+package signing
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Pin statuses
+const (
+	PinNew      = "new"      // First key seen for the project, now pinned
+	PinTrusted  = "trusted"  // Same key as the pinned one
+	PinMismatch = "mismatch" // A different key than the pinned one
+)
+
+// PinStore remembers the registered signing key of each project, so a key the owner replaced is noticed
+type PinStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewPinStore creates a pin store saved at path
+func NewPinStore(path string) *PinStore {
+	return &PinStore{path: path}
+}
+
+// Check compares a signing key fingerprint with the project's pinned one, pinning it if there is none
+// replace pins the fingerprint even when another one is pinned
+func (ps *PinStore) Check(projectID, fingerprint string, replace bool) (string, error) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	pins, err := ps.load()
+	if err != nil {
+		return "", err
+	}
+
+	pinned, ok := pins[projectID]
+	switch {
+	case ok && pinned == fingerprint:
+		return PinTrusted, nil
+	case ok && !replace:
+		return PinMismatch, nil
+	}
+
+	pins[projectID] = fingerprint
+	if err := ps.save(pins); err != nil {
+		return "", err
+	}
+	return PinNew, nil
+}
+
+// Forget drops a project's pinned key
+func (ps *PinStore) Forget(projectID string) error {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	pins, err := ps.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := pins[projectID]; !ok {
+		return nil
+	}
+	delete(pins, projectID)
+	return ps.save(pins)
+}
+
+func (ps *PinStore) load() (map[string]string, error) {
+	pins := make(map[string]string)
+	data, err := os.ReadFile(ps.path)
+	if os.IsNotExist(err) {
+		return pins, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &pins); err != nil {
+		return nil, err
+	}
+	return pins, nil
+}
+
+func (ps *PinStore) save(pins map[string]string) error {
+	data, err := json.MarshalIndent(pins, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(ps.path), 0700); err != nil {
+		return err
+	}
+	tmp := ps.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, ps.path)
+}
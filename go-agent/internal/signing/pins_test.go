@@ -0,0 +1,90 @@
+package signing
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestPinStore(t *testing.T) {
+	type check struct {
+		project, fingerprint string
+		replace              bool
+		want                 string
+	}
+	tests := []struct {
+		name   string
+		checks []check
+	}{
+		{
+			name: "first key is pinned and trusted after",
+			checks: []check{
+				{"p", "aaa", false, PinNew},
+				{"p", "aaa", false, PinTrusted},
+			},
+		},
+		{
+			name: "another key is a mismatch and stays unpinned",
+			checks: []check{
+				{"p", "aaa", false, PinNew},
+				{"p", "bbb", false, PinMismatch},
+				{"p", "aaa", false, PinTrusted},
+				{"p", "bbb", false, PinMismatch},
+			},
+		},
+		{
+			name: "replace pins the new key",
+			checks: []check{
+				{"p", "aaa", false, PinNew},
+				{"p", "bbb", true, PinNew},
+				{"p", "bbb", false, PinTrusted},
+				{"p", "aaa", false, PinMismatch},
+			},
+		},
+		{
+			name: "projects are pinned separately",
+			checks: []check{
+				{"p", "aaa", false, PinNew},
+				{"q", "bbb", false, PinNew},
+				{"q", "aaa", false, PinMismatch},
+				{"p", "aaa", false, PinTrusted},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "keys", "pins.json")
+			for i, c := range tt.checks {
+				// A fresh store each time: pins must survive a restart
+				got, err := NewPinStore(path).Check(c.project, c.fingerprint, c.replace)
+				if err != nil {
+					t.Fatalf("check %d: %v", i, err)
+				}
+				if got != c.want {
+					t.Errorf("check %d: Check(%q, %q, %v) = %q, want %q", i, c.project, c.fingerprint, c.replace, got, c.want)
+				}
+			}
+		})
+	}
+}
+
+func TestPinStoreForget(t *testing.T) {
+	ps := NewPinStore(filepath.Join(t.TempDir(), "pins.json"))
+	if err := ps.Forget("p"); err != nil {
+		t.Fatalf("Forget without pins: %v", err)
+	}
+	for _, project := range []string{"p", "q"} {
+		if _, err := ps.Check(project, "aaa", false); err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+	}
+	if err := ps.Forget("p"); err != nil {
+		t.Fatalf("Forget: %v", err)
+	}
+
+	if got, _ := ps.Check("p", "bbb", false); got != PinNew {
+		t.Errorf("Check after Forget = %q, want %q", got, PinNew)
+	}
+	if got, _ := ps.Check("q", "bbb", false); got != PinMismatch {
+		t.Errorf("Check of another project after Forget = %q, want %q", got, PinMismatch)
+	}
+}
@@ -0,0 +1,87 @@
+package signing
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Algorithm identifies how snapshot documents are signed:
+// ed25519 over a context prefix followed by the SHA-256 digest of the uncompressed document
+const Algorithm = "ed25519-sha256"
+
+// messagePrefix separates snapshot signatures from anything else the key might sign
+const messagePrefix = "vidsync-snapshot-v1:"
+
+// ErrInvalidSignature is returned when a document doesn't match its signature
+var ErrInvalidSignature = errors.New("invalid snapshot signature")
+
+// Signature is a snapshot document's signature and the key that made it
+type Signature struct {
+	Algorithm string `json:"algorithm"`
+	PublicKey string `json:"publicKey"` // Base64
+	Signature string `json:"signature"` // Base64
+	DeviceID  string `json:"deviceId,omitempty"`
+}
+
+// Digest returns the SHA-256 digest of a document
+func Digest(r io.Reader) ([]byte, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// Sign signs a document digest with key
+func Sign(key ed25519.PrivateKey, digest []byte, deviceID string) Signature {
+	return Signature{
+		Algorithm: Algorithm,
+		PublicKey: base64.StdEncoding.EncodeToString(key.Public().(ed25519.PublicKey)),
+		Signature: base64.StdEncoding.EncodeToString(ed25519.Sign(key, message(digest))),
+		DeviceID:  deviceID,
+	}
+}
+
+// Verify checks that sig was made over a document with the given digest
+func Verify(sig Signature, digest []byte) error {
+	if sig.Algorithm != Algorithm {
+		return fmt.Errorf("unsupported signature algorithm: %q", sig.Algorithm)
+	}
+	pub, err := sig.Key()
+	if err != nil {
+		return err
+	}
+	raw, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil || len(raw) != ed25519.SignatureSize {
+		return ErrInvalidSignature
+	}
+	if !ed25519.Verify(pub, message(digest), raw) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+// Key decodes the signature's public key
+func (sig Signature) Key() (ed25519.PublicKey, error) {
+	raw, err := base64.StdEncoding.DecodeString(sig.PublicKey)
+	if err != nil || len(raw) != ed25519.PublicKeySize {
+		return nil, fmt.Errorf("invalid signing public key")
+	}
+	return ed25519.PublicKey(raw), nil
+}
+
+// Fingerprint returns a short, stable identifier of a public key for display and pinning
+func Fingerprint(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:16])
+}
+
+// message builds the bytes that are actually signed
+func message(digest []byte) []byte {
+	return append([]byte(messagePrefix), digest...)
+}
@@ -0,0 +1,117 @@
+package signing
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// testKey returns a fixed key, so failures are reproducible
+func testKey(seed byte) ed25519.PrivateKey {
+	return ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+}
+
+func TestSignVerify(t *testing.T) {
+	digest, err := Digest(strings.NewReader(`{"files":[]}`))
+	if err != nil {
+		t.Fatalf("Digest: %v", err)
+	}
+	other, _ := Digest(strings.NewReader(`{"files":[{}]}`))
+	sig := Sign(testKey(1), digest, "DEVICE1")
+
+	tests := []struct {
+		name    string
+		sig     func(s Signature) Signature
+		digest  []byte
+		invalid bool // ErrInvalidSignature rather than another error
+		ok      bool
+	}{
+		{name: "valid", sig: func(s Signature) Signature { return s }, digest: digest, ok: true},
+		{name: "other document", sig: func(s Signature) Signature { return s }, digest: other, invalid: true},
+		{
+			name: "key swapped for another",
+			sig: func(s Signature) Signature {
+				s.PublicKey = Sign(testKey(2), digest, "").PublicKey
+				return s
+			},
+			digest:  digest,
+			invalid: true,
+		},
+		{
+			name: "signature of another key",
+			sig: func(s Signature) Signature {
+				s.Signature = Sign(testKey(2), digest, "").Signature
+				return s
+			},
+			digest:  digest,
+			invalid: true,
+		},
+		{
+			name: "truncated signature",
+			sig: func(s Signature) Signature {
+				raw, _ := base64.StdEncoding.DecodeString(s.Signature)
+				s.Signature = base64.StdEncoding.EncodeToString(raw[:len(raw)-1])
+				return s
+			},
+			digest:  digest,
+			invalid: true,
+		},
+		{
+			name:    "signature not base64",
+			sig:     func(s Signature) Signature { s.Signature = "not base64!"; return s },
+			digest:  digest,
+			invalid: true,
+		},
+		{
+			name:   "unknown algorithm",
+			sig:    func(s Signature) Signature { s.Algorithm = "rsa-sha1"; return s },
+			digest: digest,
+		},
+		{
+			name: "malformed key",
+			sig: func(s Signature) Signature {
+				s.PublicKey = base64.StdEncoding.EncodeToString([]byte("short"))
+				return s
+			},
+			digest: digest,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Verify(tt.sig(sig), tt.digest)
+			switch {
+			case tt.ok && err != nil:
+				t.Errorf("Verify = %v, want success", err)
+			case !tt.ok && err == nil:
+				t.Error("Verify succeeded, want an error")
+			case tt.invalid && !errors.Is(err, ErrInvalidSignature):
+				t.Errorf("Verify = %v, want ErrInvalidSignature", err)
+			}
+		})
+	}
+}
+
+func TestSignatureKey(t *testing.T) {
+	key := testKey(1)
+	sig := Sign(key, make([]byte, 32), "DEVICE1")
+	if sig.Algorithm != Algorithm || sig.DeviceID != "DEVICE1" {
+		t.Errorf("Sign = %+v, want algorithm %q and the device ID", sig, Algorithm)
+	}
+
+	pub, err := sig.Key()
+	if err != nil {
+		t.Fatalf("Key: %v", err)
+	}
+	if !pub.Equal(key.Public()) {
+		t.Error("Key doesn't return the signing key's public key")
+	}
+	if Fingerprint(pub) != Fingerprint(key.Public().(ed25519.PublicKey)) || len(Fingerprint(pub)) != 32 {
+		t.Errorf("Fingerprint = %q, want 32 stable hex digits", Fingerprint(pub))
+	}
+	if Fingerprint(pub) == Fingerprint(testKey(2).Public().(ed25519.PublicKey)) {
+		t.Error("different keys have the same fingerprint")
+	}
+}
@@ -0,0 +1,57 @@
+package sync
+
+import (
+	"path"
+	"regexp"
+	"time"
+)
+
+// conflictPattern matches Syncthing conflict copies:
+// <name>.sync-conflict-<YYYYMMDD>-<HHMMSS>-<short device ID>[.<ext>]
+var conflictPattern = regexp.MustCompile(`^(.*)\.sync-conflict-(\d{8})-(\d{6})-([A-Z0-9]{7})(\.[^.]*)?$`)
+
+// ConflictName is a parsed Syncthing conflict file name
+type ConflictName struct {
+	Path          string    // Path of the conflict copy
+	OriginalPath  string    // Path of the file it conflicts with
+	ShortDeviceID string    // First block of the device ID that lost the conflict
+	CreatedAt     time.Time // When Syncthing created the conflict copy
+}
+
+// ParseConflictName parses a slash-separated path as a Syncthing conflict copy
+func ParseConflictName(p string) (ConflictName, bool) {
+	dir, name := path.Split(p)
+	m := conflictPattern.FindStringSubmatch(name)
+	if m == nil {
+		return ConflictName{}, false
+	}
+
+	createdAt, _ := time.ParseInLocation("20060102150405", m[2]+m[3], time.Local)
+	return ConflictName{
+		Path:          p,
+		OriginalPath:  dir + m[1] + m[5],
+		ShortDeviceID: m[4],
+		CreatedAt:     createdAt,
+	}, true
+}
+
+// IsConflictFile reports whether a path is a Syncthing conflict copy
+func IsConflictFile(p string) bool {
+	return conflictPattern.MatchString(path.Base(p))
+}
+
+// conflictEvent builds a conflict event for a conflict copy path
+func conflictEvent(projectID string, conflict ConflictName, timestamp string) Event {
+	return Event{
+		ProjectID: projectID,
+		Type:      "conflict",
+		Path:      conflict.Path,
+		Message:   "Sync conflict on " + conflict.OriginalPath,
+		Data: map[string]interface{}{
+			"originalPath":  conflict.OriginalPath,
+			"shortDeviceId": conflict.ShortDeviceID,
+			"createdAt":     conflict.CreatedAt,
+		},
+		Timestamp: timestamp,
+	}
+}
@@ -11,11 +11,12 @@ import (
 
 // Event represents a sync event
 type Event struct {
-	ProjectID string `json:"projectId"`
-	Type      string `json:"type"` // fileUpdate, scanStart, scanComplete, paused, error, conflict
-	Path      string `json:"path,omitempty"`
-	Message   string `json:"message,omitempty"`
-	Timestamp string `json:"timestamp"`
+	ProjectID string                 `json:"projectId"`
+	Type      string                 `json:"type"` // fileUpdate, itemStarted, scanStart, scanComplete, syncStart, syncComplete, stateChanged, folderSummary, folderCompletion, deviceConnected, deviceDisconnected, peerConnected, peerDisconnected, transferProgress, paused, error, conflict, conflictResolved, pendingDevice, pendingFolder, deviceAccepted, folderAccepted
+	Path      string                 `json:"path,omitempty"`
+	Message   string                 `json:"message,omitempty"`
+	Data      map[string]interface{} `json:"data,omitempty"`
+	Timestamp string                 `json:"timestamp"`
 }
 
 // SyncManager manages file synchronization
@@ -0,0 +1,169 @@
+package sync
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/vidsync/agent/internal/api"
+)
+
+// ConsumeSyncthingEvents feeds translated Syncthing events into the sync manager
+// Blocks until ctx is cancelled
+func (sm *SyncManager) ConsumeSyncthingEvents(ctx context.Context, stream *api.EventStream) {
+	ch := stream.Subscribe()
+	defer stream.Unsubscribe(ch)
+
+	sm.logger.Info("Consuming Syncthing event stream")
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case raw, ok := <-ch:
+			if !ok {
+				return
+			}
+			for _, evt := range TranslateSyncthingEvent(raw) {
+				sm.EmitEvent(evt)
+			}
+		}
+	}
+}
+
+// TranslateSyncthingEvent converts a raw Syncthing event into sync Events
+// Returns nil for events the agent does not forward
+func TranslateSyncthingEvent(raw api.SyncthingEvent) []Event {
+	timestamp := raw.Time.Format(time.RFC3339)
+	evt := Event{
+		Timestamp: timestamp,
+	}
+
+	switch raw.Type {
+	case "StateChanged":
+		var data api.StateChangedData
+		if err := raw.DecodeData(&data); err != nil {
+			return nil
+		}
+		evt.ProjectID = data.Folder
+		evt.Type = stateChangeType(data.From, data.To)
+		evt.Message = fmt.Sprintf("%s -> %s", data.From, data.To)
+		evt.Data = map[string]interface{}{
+			"from": data.From,
+			"to":   data.To,
+		}
+		if data.Error != "" {
+			evt.Data["error"] = data.Error
+		}
+
+	case "ItemStarted", "ItemFinished":
+		var data api.ItemEventData
+		if err := raw.DecodeData(&data); err != nil {
+			return nil
+		}
+		evt.ProjectID = data.Folder
+		evt.Path = data.Item
+		evt.Data = map[string]interface{}{
+			"action":   data.Action,
+			"itemType": data.Type,
+		}
+		if raw.Type == "ItemStarted" {
+			evt.Type = "itemStarted"
+		} else if data.Error != nil && *data.Error != "" {
+			evt.Type = "error"
+			evt.Message = *data.Error
+		} else {
+			evt.Type = "fileUpdate"
+			// A conflict copy pulled from a peer
+			if conflict, ok := ParseConflictName(filepath.ToSlash(data.Item)); ok && data.Action == "update" {
+				return []Event{evt, conflictEvent(data.Folder, conflict, timestamp)}
+			}
+		}
+
+	case "LocalIndexUpdated":
+		// Only forwarded when the scan picked up conflict copies created locally
+		var data api.LocalIndexUpdatedData
+		if err := raw.DecodeData(&data); err != nil {
+			return nil
+		}
+		var events []Event
+		for _, name := range data.Filenames {
+			if conflict, ok := ParseConflictName(filepath.ToSlash(name)); ok {
+				events = append(events, conflictEvent(data.Folder, conflict, timestamp))
+			}
+		}
+		return events
+
+	case "FolderSummary":
+		var data api.FolderSummaryData
+		if err := raw.DecodeData(&data); err != nil {
+			return nil
+		}
+		evt.ProjectID = data.Folder
+		evt.Type = "folderSummary"
+		evt.Data = data.Summary
+
+	case "FolderCompletion":
+		var data api.FolderCompletionData
+		if err := raw.DecodeData(&data); err != nil {
+			return nil
+		}
+		evt.ProjectID = data.Folder
+		evt.Type = "folderCompletion"
+		evt.Data = map[string]interface{}{
+			"deviceId":    data.Device,
+			"completion":  data.Completion,
+			"globalBytes": data.GlobalBytes,
+			"needBytes":   data.NeedBytes,
+			"needItems":   data.NeedItems,
+		}
+
+	case "DeviceConnected":
+		var data api.DeviceConnectedData
+		if err := raw.DecodeData(&data); err != nil {
+			return nil
+		}
+		evt.Type = "deviceConnected"
+		evt.Message = data.DeviceName
+		evt.Data = map[string]interface{}{
+			"deviceId":      data.ID,
+			"address":       data.Addr,
+			"clientVersion": data.ClientVersion,
+		}
+
+	case "DeviceDisconnected":
+		var data api.DeviceDisconnectedData
+		if err := raw.DecodeData(&data); err != nil {
+			return nil
+		}
+		evt.Type = "deviceDisconnected"
+		evt.Message = data.Error
+		evt.Data = map[string]interface{}{
+			"deviceId": data.ID,
+		}
+
+	default:
+		return nil
+	}
+
+	return []Event{evt}
+}
+
+// stateChangeType maps a folder state transition to an event type
+func stateChangeType(from, to string) string {
+	switch {
+	case to == "scanning":
+		return "scanStart"
+	case from == "scanning":
+		return "scanComplete"
+	case to == "syncing":
+		return "syncStart"
+	case from == "syncing" && to == "idle":
+		return "syncComplete"
+	case to == "error":
+		return "error"
+	default:
+		return "stateChanged"
+	}
+}
@@ -0,0 +1,404 @@
+package syncthing
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vidsync/agent/internal/util"
+)
+
+// State is the lifecycle state of the supervised Syncthing process
+type State string
+
+const (
+	StateStopped  State = "stopped"
+	StateStarting State = "starting"
+	StateRunning  State = "running"
+	StateBackoff  State = "backoff" // Crashed, waiting to restart
+)
+
+const (
+	healthTimeout  = 60 * time.Second
+	healthInterval = 250 * time.Millisecond
+	minBackoff     = 1 * time.Second
+	maxBackoff     = 60 * time.Second
+	stableUptime   = 2 * time.Minute // Uptime after which the backoff resets
+	apiKeyLength   = 32
+)
+
+// Status describes the supervised process for health reporting
+type Status struct {
+	State      State     `json:"state"`
+	PID        int       `json:"pid,omitempty"`
+	Binary     string    `json:"binary"`
+	HomeDir    string    `json:"homeDir"`
+	GUIAddress string    `json:"guiAddress"`
+	Restarts   int       `json:"restarts"`
+	StartedAt  time.Time `json:"startedAt,omitempty"`
+	LastExitAt time.Time `json:"lastExitAt,omitempty"`
+	LastError  string    `json:"lastError,omitempty"`
+}
+
+// Supervisor launches Syncthing with an agent-owned home directory and keeps it running
+type Supervisor struct {
+	binary  string
+	homeDir string
+	port    int
+	apiKey  string
+	logger  *util.Logger
+	client  *http.Client
+
+	mu     sync.RWMutex
+	status Status
+	cancel context.CancelFunc
+	done   chan struct{}
+	ready  chan struct{}
+}
+
+// NewSupervisor creates a supervisor for the given binary
+// The Syncthing home directory lives under dataDir/syncthing
+func NewSupervisor(binary, dataDir string, port int, logger *util.Logger) *Supervisor {
+	homeDir := filepath.Join(dataDir, "syncthing")
+	return &Supervisor{
+		binary:  resolveBinary(binary, dataDir),
+		homeDir: homeDir,
+		port:    port,
+		logger:  logger,
+		client:  &http.Client{Timeout: 2 * time.Second},
+		ready:   make(chan struct{}),
+		status: Status{
+			State:      StateStopped,
+			HomeDir:    homeDir,
+			GUIAddress: fmt.Sprintf("127.0.0.1:%d", port),
+		},
+	}
+}
+
+// Prepare creates the home directory and loads or generates the API key
+// Must be called before Start so API clients can be built with the key
+func (s *Supervisor) Prepare() error {
+	if err := os.MkdirAll(s.homeDir, 0700); err != nil {
+		return fmt.Errorf("failed to create syncthing home: %w", err)
+	}
+
+	keyPath := filepath.Join(s.homeDir, "apikey")
+	if data, err := os.ReadFile(keyPath); err == nil {
+		if key := strings.TrimSpace(string(data)); key != "" {
+			s.apiKey = key
+			return nil
+		}
+	}
+
+	key, err := generateAPIKey()
+	if err != nil {
+		return fmt.Errorf("failed to generate API key: %w", err)
+	}
+	if err := os.WriteFile(keyPath, []byte(key+"\n"), 0600); err != nil {
+		return fmt.Errorf("failed to write API key: %w", err)
+	}
+
+	s.logger.Info("Generated Syncthing API key in %s", keyPath)
+	s.apiKey = key
+	return nil
+}
+
+// APIKey returns the API key Syncthing is started with
+func (s *Supervisor) APIKey() string {
+	return s.apiKey
+}
+
+// BaseURL returns the URL of Syncthing's REST API
+func (s *Supervisor) BaseURL() string {
+	return fmt.Sprintf("http://127.0.0.1:%d", s.port)
+}
+
+// Start launches Syncthing and restarts it with backoff whenever it exits
+func (s *Supervisor) Start() error {
+	s.mu.Lock()
+	if s.cancel != nil {
+		s.mu.Unlock()
+		return nil
+	}
+	if s.apiKey == "" {
+		s.mu.Unlock()
+		return fmt.Errorf("supervisor not prepared: missing API key")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.done = make(chan struct{})
+	s.status.Binary = s.binary
+	s.mu.Unlock()
+
+	s.logger.Info("Starting Syncthing supervisor (binary: %s, home: %s)", s.binary, s.homeDir)
+	go s.supervise(ctx)
+	return nil
+}
+
+// Stop terminates Syncthing and stops restarting it
+func (s *Supervisor) Stop() error {
+	s.mu.Lock()
+	cancel := s.cancel
+	done := s.done
+	s.cancel = nil
+	s.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	<-done
+	s.logger.Info("Syncthing supervisor stopped")
+	return nil
+}
+
+// WaitReady blocks until Syncthing has answered its health check once
+func (s *Supervisor) WaitReady(ctx context.Context) error {
+	select {
+	case <-s.ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Status returns the current process state
+func (s *Supervisor) Status() Status {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.status
+}
+
+func (s *Supervisor) supervise(ctx context.Context) {
+	defer close(s.done)
+
+	backoff := minBackoff
+	var readyOnce sync.Once
+
+	for {
+		startedAt := time.Now()
+		err := s.runOnce(ctx, func() {
+			readyOnce.Do(func() { close(s.ready) })
+		})
+
+		if ctx.Err() != nil {
+			s.setState(StateStopped, nil)
+			return
+		}
+
+		if time.Since(startedAt) > stableUptime {
+			backoff = minBackoff
+		}
+
+		s.mu.Lock()
+		s.status.Restarts++
+		s.status.LastExitAt = time.Now()
+		s.mu.Unlock()
+		s.setState(StateBackoff, err)
+		s.logger.Error("Syncthing exited: %v (restarting in %v)", err, backoff)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			s.setState(StateStopped, nil)
+			return
+		}
+
+		backoff *= 2
+		if backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+// runOnce starts Syncthing, waits for it to become healthy and then for it to exit
+func (s *Supervisor) runOnce(ctx context.Context, onReady func()) error {
+	cmd := exec.Command(s.binary,
+		"serve",
+		"--home="+s.homeDir,
+		"--gui-address="+s.status.GUIAddress,
+		"--gui-apikey="+s.apiKey,
+		"--no-browser",
+		"--no-restart",
+	)
+	cmd.Env = append(os.Environ(), "STNOUPGRADE=1")
+
+	stdout, _ := cmd.StdoutPipe()
+	stderr, _ := cmd.StderrPipe()
+
+	s.setState(StateStarting, nil)
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start: %w", err)
+	}
+
+	s.mu.Lock()
+	s.status.PID = cmd.Process.Pid
+	s.status.StartedAt = time.Now()
+	s.mu.Unlock()
+
+	go s.pipeOutput(stdout)
+	go s.pipeOutput(stderr)
+
+	exitCh := make(chan error, 1)
+	go func() { exitCh <- cmd.Wait() }()
+
+	healthCtx, cancelHealth := context.WithTimeout(ctx, healthTimeout)
+	healthCh := make(chan error, 1)
+	go func() { healthCh <- s.waitHealthy(healthCtx) }()
+	defer cancelHealth()
+
+	for {
+		select {
+		case err := <-healthCh:
+			if err != nil {
+				if ctx.Err() != nil {
+					continue // Shutdown is handled below
+				}
+				s.logger.Error("Syncthing did not become healthy: %v", err)
+				cmd.Process.Kill()
+				continue
+			}
+			s.setState(StateRunning, nil)
+			s.logger.Info("Syncthing is healthy (pid %d)", cmd.Process.Pid)
+			onReady()
+
+		case err := <-exitCh:
+			s.clearProcess()
+			if err == nil {
+				err = fmt.Errorf("process exited")
+			}
+			return err
+
+		case <-ctx.Done():
+			s.terminate(cmd, exitCh)
+			s.clearProcess()
+			return ctx.Err()
+		}
+	}
+}
+
+// waitHealthy polls /rest/noauth/health until it reports OK
+func (s *Supervisor) waitHealthy(ctx context.Context) error {
+	ticker := time.NewTicker(healthInterval)
+	defer ticker.Stop()
+
+	for {
+		req, err := http.NewRequestWithContext(ctx, "GET", s.BaseURL()+"/rest/noauth/health", nil)
+		if err != nil {
+			return err
+		}
+		if resp, err := s.client.Do(req); err == nil {
+			resp.Body.Close()
+			if resp.StatusCode == http.StatusOK {
+				return nil
+			}
+		}
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// terminate asks Syncthing to shut down and kills it if it doesn't exit in time
+func (s *Supervisor) terminate(cmd *exec.Cmd, exitCh chan error) {
+	if runtime.GOOS == "windows" {
+		cmd.Process.Kill()
+	} else {
+		cmd.Process.Signal(os.Interrupt)
+	}
+
+	select {
+	case <-exitCh:
+	case <-time.After(10 * time.Second):
+		s.logger.Warn("Syncthing did not exit in time, killing")
+		cmd.Process.Kill()
+		<-exitCh
+	}
+}
+
+func (s *Supervisor) pipeOutput(r io.Reader) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		s.logger.Debug("[syncthing] %s", scanner.Text())
+	}
+}
+
+func (s *Supervisor) setState(state State, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.State = state
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+}
+
+func (s *Supervisor) clearProcess() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.status.PID = 0
+}
+
+// resolveBinary finds the Syncthing binary next to the agent or falls back to PATH
+func resolveBinary(binary, dataDir string) string {
+	if filepath.IsAbs(binary) {
+		return binary
+	}
+
+	name := binary
+	if runtime.GOOS == "windows" && !strings.HasSuffix(name, ".exe") {
+		name += ".exe"
+	}
+
+	candidates := []string{
+		filepath.Join(dataDir, "..", "bin", "syncthing", name),
+		filepath.Join(dataDir, "bin", "syncthing", name),
+	}
+	if exe, err := os.Executable(); err == nil {
+		exeDir := filepath.Dir(exe)
+		candidates = append(candidates,
+			filepath.Join(exeDir, "bin", "syncthing", runtime.GOOS, name),
+			filepath.Join(exeDir, "bin", "syncthing", name),
+		)
+	}
+
+	for _, candidate := range candidates {
+		if info, err := os.Stat(candidate); err == nil && !info.IsDir() {
+			return candidate
+		}
+	}
+
+	if path, err := exec.LookPath(name); err == nil {
+		return path
+	}
+	return name
+}
+
+// generateAPIKey returns a random alphanumeric key
+func generateAPIKey() (string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	key := make([]byte, apiKeyLength)
+	for i := range key {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		key[i] = alphabet[n.Int64()]
+	}
+	return string(key), nil
+}